@@ -9,6 +9,7 @@ import (
 	"github.com/vaheed/kubenova/internal/logging"
 	mngr "github.com/vaheed/kubenova/internal/manager"
 	"github.com/vaheed/kubenova/internal/observability"
+	"github.com/vaheed/kubenova/internal/security"
 	"github.com/vaheed/kubenova/internal/store"
 	"github.com/vaheed/kubenova/internal/util"
 	"go.uber.org/zap"
@@ -36,11 +37,23 @@ func main() {
 		}()
 	}
 	// Validate required env
+	issuers, err := mngr.ParseOIDCIssuers(os.Getenv("OIDC_ISSUERS"))
+	if err != nil {
+		logging.L.Fatal("invalid env", zap.String("env", "OIDC_ISSUERS"), zap.Error(err))
+	}
 	if v := os.Getenv("KUBENOVA_REQUIRE_AUTH"); v == "true" || v == "1" || v == "t" || v == "on" || v == "yes" || v == "y" {
-		if os.Getenv("JWT_SIGNING_KEY") == "" {
+		// OIDC issuers can stand in for the signing key.
+		if os.Getenv("JWT_SIGNING_KEY") == "" && len(issuers) == 0 {
 			logging.L.Fatal("missing required env for auth", zap.String("env", "JWT_SIGNING_KEY"))
 		}
 	}
+	keys, err := security.KeyProviderFromEnv()
+	if err != nil {
+		logging.L.Fatal("invalid encryption config", zap.Error(err))
+	}
+	if keys == nil {
+		logging.L.Warn("encryption_at_rest_disabled", zap.String("hint", "set VAULT_TRANSIT_KEY, ENCRYPTION_KEYRING_FILE or ENCRYPTION_KEYS to encrypt stored kubeconfigs"))
+	}
 	// Require DATABASE_URL to be set; no in-memory fallback
 	if os.Getenv("DATABASE_URL") == "" {
 		logging.L.Fatal("missing required env", zap.String("env", "DATABASE_URL"))
@@ -59,12 +72,38 @@ func main() {
 		logging.L.Fatal("postgres connect", zap.Error(err))
 	}
 	st, closeFn = pst, pclose
+	if keys != nil {
+		st = store.NewEncryptedStore(st, keys)
+	}
 	defer closeFn(context.Background())
 	if err := st.Health(context.Background()); err != nil {
 		logging.L.Fatal("store health check", zap.Error(err))
 	}
 
 	srv := mngr.NewServer(st)
+	go srv.RunUsageRetention(context.Background())
+	go srv.RunIdempotencyRetention(context.Background())
+	go srv.RunWorkflowSync(context.Background())
+	go srv.RunEventRetention(context.Background())
+	go srv.RunWebhookDelivery(context.Background())
+	go srv.RunOperations(context.Background())
+	go srv.RunRevocationRetention(context.Background())
+	go srv.RunClusterHealth(context.Background())
+	// Metrics are served on their own listener so they are not exposed on
+	// the API port.
+	if addr := metricsAddr(); addr != "" {
+		ms := &http.Server{
+			Addr:              addr,
+			Handler:           mngr.MetricsHandler(),
+			ReadHeaderTimeout: 5 * time.Second,
+		}
+		logging.L.Info("KubeNova Manager metrics listening", zap.String("addr", ms.Addr))
+		go func() {
+			if err := mngr.StartHTTP(context.Background(), ms); err != nil && err != http.ErrServerClosed {
+				logging.L.Error("metrics server error", zap.Error(err))
+			}
+		}()
+	}
 	s := &http.Server{
 		Addr:              ":8080",
 		Handler:           srv.Router(),
@@ -80,3 +119,16 @@ func main() {
 	}
 	time.Sleep(100 * time.Millisecond)
 }
+
+// metricsAddr is the metrics listen address from METRICS_ADDR; "off"
+// disables the listener.
+func metricsAddr() string {
+	switch v := os.Getenv("METRICS_ADDR"); v {
+	case "":
+		return ":9090"
+	case "off":
+		return ""
+	default:
+		return v
+	}
+}
@@ -81,6 +81,8 @@ func main() {
 	telemetry.Stopper = telemetry.StartHeartbeat(nil, os.Getenv("MANAGER_URL"), time.Duration(getEnvInt("BATCH_INTERVAL_SECONDS", 10))*time.Second)
 	// Start spool buffer so events survive manager disconnects
 	buf := telemetry.NewSpoolBuffer(os.Getenv("MANAGER_URL"), os.Getenv("TELEMETRY_SPOOL_DIR"))
+	buf.Token = os.Getenv("MANAGER_TOKEN")
+	buf.ClusterID = os.Getenv("KUBENOVA_CLUSTER_ID")
 	buf.Run()
 	defer buf.Stop()
 	telemetry.SetGlobal(buf)
@@ -104,6 +106,18 @@ func main() {
 		logging.L.Fatal("bootstrap runnable", zap.Error(err))
 	}
 
+	// Usage collection reads straight from the API server to avoid caching every pod.
+	collector := &telemetry.UsageCollector{
+		Client:     mgr.GetAPIReader(),
+		ManagerURL: os.Getenv("MANAGER_URL"),
+		ClusterID:  os.Getenv("KUBENOVA_CLUSTER_ID"),
+		Token:      os.Getenv("MANAGER_TOKEN"),
+		Interval:   time.Duration(getEnvInt("USAGE_INTERVAL_SECONDS", 300)) * time.Second,
+	}
+	if err := mgr.Add(manager.RunnableFunc(collector.Run)); err != nil {
+		logging.L.Fatal("usage collector", zap.Error(err))
+	}
+
 	// Single shared context for shutdown
 	ctx := ctrl.SetupSignalHandler()
 
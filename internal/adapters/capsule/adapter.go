@@ -25,9 +25,52 @@ func (a *TenantAdapter) ToManifests(t *types.Tenant) map[string]any {
 	if len(owners) == 0 {
 		owners = append(owners, map[string]any{"name": t.Name, "kind": "User"})
 	}
-	return map[string]any{
+	labels := map[string]string{}
+	for k, v := range t.Labels {
+		labels[k] = v
+	}
+	if t.Plan != "" {
+		labels[PlanLabel] = t.Plan
+	}
+	manifest := map[string]any{
 		"tenant": t.Name,
 		"owners": owners,
-		"labels": t.Labels,
+		"labels": labels,
+	}
+	if len(t.Quotas) > 0 {
+		hard := map[string]any{}
+		for k, v := range t.Quotas {
+			hard[k] = v
+		}
+		manifest["resourceQuotas"] = map[string]any{
+			"scope": "Tenant",
+			"items": []any{map[string]any{"hard": hard}},
+		}
+	}
+	if defaults := containerLimits(t.Limits); len(defaults) > 0 {
+		manifest["limitRanges"] = map[string]any{
+			"items": []any{map[string]any{
+				"limits": []any{map[string]any{
+					"type":    "Container",
+					"default": defaults,
+				}},
+			}},
+		}
+	}
+	return manifest
+}
+
+// PlanLabel records the tenant plan on the Capsule Tenant.
+const PlanLabel = "kubenova.io/plan"
+
+// containerLimits keeps the limit keys a Container LimitRange accepts.
+func containerLimits(limits map[string]string) map[string]any {
+	out := map[string]any{}
+	for k, v := range limits {
+		switch k {
+		case "cpu", "memory", "ephemeral-storage":
+			out[k] = v
+		}
 	}
+	return out
 }
@@ -17,3 +17,28 @@ func TestAdapterProducesNamespaces(t *testing.T) {
 		t.Fatalf("expected manifests content")
 	}
 }
+
+func TestAdapterRendersPlanEnvelope(t *testing.T) {
+	adapter := NewTenantAdapter()
+	man := adapter.ToManifests(&types.Tenant{
+		Name:   "acme",
+		Plan:   "gold",
+		Quotas: map[string]string{"pods": "20"},
+		Limits: map[string]string{"memory": "1Gi", "pods": "5"},
+	})
+	labels, _ := man["labels"].(map[string]string)
+	if labels[PlanLabel] != "gold" {
+		t.Fatalf("expected plan label, got %#v", man["labels"])
+	}
+	quotas, _ := man["resourceQuotas"].(map[string]any)
+	items, _ := quotas["items"].([]any)
+	if len(items) != 1 || items[0].(map[string]any)["hard"].(map[string]any)["pods"] != "20" {
+		t.Fatalf("unexpected resourceQuotas: %#v", man["resourceQuotas"])
+	}
+	ranges, _ := man["limitRanges"].(map[string]any)
+	limit := ranges["items"].([]any)[0].(map[string]any)["limits"].([]any)[0].(map[string]any)
+	defaults := limit["default"].(map[string]any)
+	if defaults["memory"] != "1Gi" || defaults["pods"] != nil {
+		t.Fatalf("unexpected limit defaults: %#v", defaults)
+	}
+}
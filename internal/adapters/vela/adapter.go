@@ -2,6 +2,10 @@ package vela
 
 import "github.com/vaheed/kubenova/pkg/types"
 
+// scalingTraits are replaced while an app is suspended so that nothing scales
+// its workloads back up.
+var scalingTraits = map[string]bool{"scaler": true, "cpuscaler": true, "hpa": true}
+
 // AppAdapter translates apps to KubeVela-friendly structures.
 type AppAdapter struct{}
 
@@ -36,8 +40,12 @@ func (a *AppAdapter) ToApplication(app *types.App) map[string]any {
 	if compProps != nil {
 		component["properties"] = compProps
 	}
-	if len(app.Traits) > 0 {
-		component["traits"] = app.Traits
+	traits := app.Traits
+	if app.Suspended {
+		traits = suspendedTraits(app.Traits)
+	}
+	if len(traits) > 0 {
+		component["traits"] = traits
 	}
 	manifest := map[string]any{
 		"name":       app.Name,
@@ -46,5 +54,24 @@ func (a *AppAdapter) ToApplication(app *types.App) map[string]any {
 	if len(app.Policies) > 0 {
 		manifest["policies"] = app.Policies
 	}
+	if app.PublishVersion != "" {
+		manifest["publishVersion"] = app.PublishVersion
+	}
 	return manifest
 }
+
+// suspendedTraits scales the component to zero replicas in place of any
+// scaling traits it has.
+func suspendedTraits(traits []map[string]any) []map[string]any {
+	out := make([]map[string]any, 0, len(traits)+1)
+	for _, t := range traits {
+		if typ, _ := t["type"].(string); scalingTraits[typ] {
+			continue
+		}
+		out = append(out, t)
+	}
+	return append(out, map[string]any{
+		"type":       "scaler",
+		"properties": map[string]any{"replicas": 0},
+	})
+}
@@ -31,3 +31,26 @@ func TestAppAdapter(t *testing.T) {
 		t.Fatalf("project should not be set in Application spec: %#v", result)
 	}
 }
+
+func TestAppAdapterSuspended(t *testing.T) {
+	a := NewAppAdapter()
+	result := a.ToApplication(&types.App{
+		Name:           "web",
+		Suspended:      true,
+		PublishVersion: "3-1700000000",
+		Traits: []map[string]any{
+			{"type": "scaler", "properties": map[string]any{"replicas": 3}},
+			{"type": "gateway"},
+		},
+	})
+	traits := result["components"].([]map[string]any)[0]["traits"].([]map[string]any)
+	if len(traits) != 2 || traits[0]["type"] != "gateway" {
+		t.Fatalf("expected scaling traits to be replaced, got %#v", traits)
+	}
+	if props := traits[1]["properties"].(map[string]any); traits[1]["type"] != "scaler" || props["replicas"] != 0 {
+		t.Fatalf("expected a zero-replica scaler, got %#v", traits[1])
+	}
+	if result["publishVersion"] != "3-1700000000" {
+		t.Fatalf("expected publish version, got %#v", result["publishVersion"])
+	}
+}
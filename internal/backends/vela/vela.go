@@ -2,6 +2,8 @@ package vela
 
 import (
 	"context"
+	"encoding/json"
+	"time"
 
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
@@ -13,10 +15,49 @@ import (
 
 // Interface abstracts the interaction with KubeVela Application resources.
 type Interface interface {
+	// ApplyApp creates or updates an Application. Besides name and namespace
+	// the spec may carry publishVersion and annotations (a map[string]string),
+	// which are set as metadata rather than as part of the Application spec.
 	ApplyApp(ctx context.Context, spec map[string]any) error
 	ApplyProject(ctx context.Context, spec map[string]any) error
+	// WorkflowStatus reads the workflow state of an Application.
+	WorkflowStatus(ctx context.Context, namespace, name string) (*WorkflowStatus, error)
+	// TerminateWorkflow stops the running workflow of an Application.
+	TerminateWorkflow(ctx context.Context, namespace, name string) error
 }
 
+// WorkflowStatus is the part of an Application's status.workflow that
+// KubeNova tracks runs with.
+type WorkflowStatus struct {
+	// PublishVersion is the publish version currently set on the Application.
+	PublishVersion string
+	// AppRevision is the application revision the workflow ran for.
+	AppRevision string
+	// Phase is the workflow phase, e.g. executing, succeeded or failed. Older
+	// KubeVela releases leave it empty and only set the flags below.
+	Phase      string
+	Message    string
+	Finished   bool
+	Terminated bool
+	Suspended  bool
+	Steps      []WorkflowStep
+	StartTime  time.Time
+	EndTime    time.Time
+}
+
+// WorkflowStep is one entry of status.workflow.steps.
+type WorkflowStep struct {
+	Name    string
+	Type    string
+	Phase   string
+	Message string
+	Reason  string
+}
+
+// PublishVersionAnnotation makes KubeVela create a new application revision
+// and re-run the workflow whenever its value changes.
+const PublishVersionAnnotation = "app.oam.dev/publishVersion"
+
 type clientImpl struct {
 	client client.Client
 	scheme *runtime.Scheme
@@ -59,6 +100,7 @@ func (c *clientImpl) ApplyApp(ctx context.Context, spec map[string]any) error {
 			obj.SetName(name)
 			obj.SetNamespace(namespace)
 			obj.SetLabels(map[string]string{"managed-by": "kubenova"})
+			setAnnotations(obj, spec)
 			obj.Object["spec"] = specFromMap(spec)
 			return c.client.Create(ctx, obj)
 		}
@@ -66,11 +108,98 @@ func (c *clientImpl) ApplyApp(ctx context.Context, spec map[string]any) error {
 			return err
 		}
 		obj.SetLabels(map[string]string{"managed-by": "kubenova"})
+		setAnnotations(obj, spec)
 		obj.Object["spec"] = specFromMap(spec)
 		return c.client.Update(ctx, obj)
 	})
 }
 
+// setAnnotations merges the publish version and extra annotations of spec
+// into the object's annotations.
+func setAnnotations(obj *unstructured.Unstructured, spec map[string]any) {
+	extra, _ := spec["annotations"].(map[string]string)
+	version, _ := spec["publishVersion"].(string)
+	if version == "" && len(extra) == 0 {
+		return
+	}
+	annotations := obj.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	for k, v := range extra {
+		annotations[k] = v
+	}
+	if version != "" {
+		annotations[PublishVersionAnnotation] = version
+	}
+	obj.SetAnnotations(annotations)
+}
+
+func (c *clientImpl) WorkflowStatus(ctx context.Context, namespace, name string) (*WorkflowStatus, error) {
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(applicationGVK)
+	if err := c.client.Get(ctx, client.ObjectKey{Name: name, Namespace: namespace}, obj); err != nil {
+		return nil, err
+	}
+	return workflowStatusFrom(obj), nil
+}
+
+func workflowStatusFrom(obj *unstructured.Unstructured) *WorkflowStatus {
+	ws := &WorkflowStatus{PublishVersion: obj.GetAnnotations()[PublishVersionAnnotation]}
+	wf, _, _ := unstructured.NestedMap(obj.Object, "status", "workflow")
+	if wf == nil {
+		return ws
+	}
+	ws.AppRevision, _ = wf["appRevision"].(string)
+	ws.Phase, _ = wf["status"].(string)
+	ws.Message, _ = wf["message"].(string)
+	ws.Finished, _ = wf["finished"].(bool)
+	ws.Terminated, _ = wf["terminated"].(bool)
+	ws.Suspended, _ = wf["suspend"].(bool)
+	ws.StartTime = parseTime(wf["startTime"])
+	ws.EndTime = parseTime(wf["endTime"])
+	steps, _ := wf["steps"].([]any)
+	for _, raw := range steps {
+		step, ok := raw.(map[string]any)
+		if !ok {
+			continue
+		}
+		s := WorkflowStep{}
+		s.Name, _ = step["name"].(string)
+		s.Type, _ = step["type"].(string)
+		s.Phase, _ = step["phase"].(string)
+		s.Message, _ = step["message"].(string)
+		s.Reason, _ = step["reason"].(string)
+		ws.Steps = append(ws.Steps, s)
+	}
+	return ws
+}
+
+func parseTime(v any) time.Time {
+	raw, _ := v.(string)
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// TerminateWorkflow marks the workflow terminated the same way
+// "vela workflow terminate" does.
+func (c *clientImpl) TerminateWorkflow(ctx context.Context, namespace, name string) error {
+	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(applicationGVK)
+		if err := c.client.Get(ctx, client.ObjectKey{Name: name, Namespace: namespace}, obj); err != nil {
+			return err
+		}
+		if err := unstructured.SetNestedField(obj.Object, true, "status", "workflow", "terminated"); err != nil {
+			return err
+		}
+		return c.client.Status().Update(ctx, obj)
+	})
+}
+
 func (c *clientImpl) ApplyProject(ctx context.Context, spec map[string]any) error {
 	name, _ := spec["name"].(string)
 	if name == "" {
@@ -103,7 +232,7 @@ func (c *clientImpl) ApplyProject(ctx context.Context, spec map[string]any) erro
 func specFromMap(spec map[string]any) map[string]any {
 	out := map[string]any{}
 	for k, v := range spec {
-		if k == "name" || k == "namespace" {
+		if k == "name" || k == "namespace" || k == "publishVersion" || k == "annotations" {
 			continue
 		}
 		out[k] = v
@@ -111,5 +240,13 @@ func specFromMap(spec map[string]any) map[string]any {
 	if len(out) == 0 {
 		out["placeholder"] = "managed-by-kubenova"
 	}
+	// Unstructured content must hold plain JSON values; callers build specs
+	// with typed slices such as []map[string]any.
+	if raw, err := json.Marshal(out); err == nil {
+		var normalized map[string]any
+		if err := json.Unmarshal(raw, &normalized); err == nil {
+			return normalized
+		}
+	}
 	return out
 }
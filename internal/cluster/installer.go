@@ -30,12 +30,14 @@ import (
 // It can execute Helm installs when HELM_CHARTS_DIR is provided,
 // otherwise it records placeholder ConfigMaps to mark bootstrap intent.
 type Installer struct {
-	Client         client.Client
-	Reader         client.Reader
-	Scheme         *runtime.Scheme
-	ChartsDir      string
-	UseRemote      bool
-	SkipWait       bool
+	Client    client.Client
+	Reader    client.Reader
+	Scheme    *runtime.Scheme
+	ChartsDir string
+	UseRemote bool
+	SkipWait  bool
+	// ClusterID is passed to the operator chart so usage reports can be attributed.
+	ClusterID      string
 	kubeconfigData []byte
 }
 
@@ -576,6 +578,9 @@ func (i *Installer) componentSetFlags(component string) []string {
 		if url := strings.TrimSpace(os.Getenv(envManagerURL)); url != "" {
 			flags = append(flags, "--set", fmt.Sprintf("manager.url=%s", url))
 		}
+		if id := strings.TrimSpace(i.ClusterID); id != "" {
+			flags = append(flags, "--set", fmt.Sprintf("manager.clusterId=%s", id))
+		}
 		if tag := strings.TrimSpace(operatorImageTag()); tag != "" {
 			flags = append(flags, "--set", fmt.Sprintf("image.tag=%s", tag))
 		}
@@ -654,6 +659,12 @@ var componentRepos = map[string]repoMeta{
 	"operator":      {Repo: "oci://ghcr.io/vaheed/kubenova/charts", Chart: "operator", Version: "v0.1.3"},
 }
 
+// KnownComponent reports whether Bootstrap can install the named component.
+func KnownComponent(component string) bool {
+	_, ok := componentRepos[component]
+	return ok
+}
+
 func parseBool(v string) bool {
 	switch strings.ToLower(strings.TrimSpace(v)) {
 	case "true", "1", "yes", "on", "y":
@@ -0,0 +1,291 @@
+package manager
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/vaheed/kubenova/internal/logging"
+	"github.com/vaheed/kubenova/internal/store"
+	"github.com/vaheed/kubenova/pkg/types"
+	"go.uber.org/zap"
+)
+
+const (
+	// apiKeyPrefix starts every API key, which reads knk_<id>_<secret>.
+	apiKeyPrefix = "knk_"
+
+	defaultAPIKeyTTLDays = 90
+	maxAPIKeyTTLDays     = 365
+	// apiKeyTouchInterval bounds how often a key's last use is written.
+	apiKeyTouchInterval = time.Minute
+
+	revocationPruneInterval = time.Hour
+	// revocationPruneLease keeps pruning to one manager replica.
+	revocationPruneLease = "revocation-retention"
+)
+
+var errInvalidAPIKey = errors.New("invalid API key")
+
+func (s *Server) createAPIKey(w http.ResponseWriter, r *http.Request) {
+	if !s.requireRole(w, r, "admin", "ops") {
+		return
+	}
+	var req APIKeyRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "KN-400", err.Error())
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		writeError(w, http.StatusBadRequest, "KN-400", "name is required")
+		return
+	}
+	if len(req.Roles) == 0 && len(req.Bindings) == 0 {
+		writeError(w, http.StatusBadRequest, "KN-400", "roles or bindings are required")
+		return
+	}
+	for _, role := range req.Roles {
+		if !slices.Contains(knownRoles, role) {
+			writeError(w, http.StatusBadRequest, "KN-400", "unknown role "+role)
+			return
+		}
+	}
+	for _, b := range req.Bindings {
+		if err := validBinding(b); err != nil {
+			writeError(w, http.StatusBadRequest, "KN-400", err.Error())
+			return
+		}
+	}
+	if req.TTLDays < 0 || req.TTLDays > maxAPIKeyTTLDays {
+		writeError(w, http.StatusBadRequest, "KN-400", "ttlDays must be between 1 and 365")
+		return
+	}
+	auth := s.authContext(r.Context())
+	if s.requireAuth && !auth.globalRole("admin") && grantsAdmin(req) {
+		writeError(w, http.StatusForbidden, "KN-403", "only admins can create admin keys")
+		return
+	}
+	ttlDays := req.TTLDays
+	if ttlDays == 0 {
+		ttlDays = defaultAPIKeyTTLDays
+	}
+	key := &types.APIKey{
+		ID:        uuid.NewString(),
+		Name:      req.Name,
+		Roles:     req.Roles,
+		Bindings:  req.Bindings,
+		CreatedBy: auth.Subject,
+		ExpiresAt: time.Now().UTC().Add(time.Duration(ttlDays) * 24 * time.Hour),
+	}
+	plaintext := newAPIKey(key.ID)
+	key.Hash = hashAPIKey(plaintext)
+	if err := s.store.CreateAPIKey(r.Context(), key); err != nil {
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return
+	}
+	// The key itself is only ever returned here.
+	writeJSON(w, http.StatusCreated, APIKeyResponse{APIKey: *redactAPIKey(key), Key: plaintext})
+}
+
+func grantsAdmin(req APIKeyRequest) bool {
+	if slices.Contains(req.Roles, "admin") {
+		return true
+	}
+	return slices.ContainsFunc(req.Bindings, func(b types.RoleBinding) bool { return b.Role == "admin" })
+}
+
+func (s *Server) listAPIKeys(w http.ResponseWriter, r *http.Request) {
+	if !s.requireRole(w, r, "admin", "ops", "readOnly") && s.requireAuth {
+		return
+	}
+	keys, err := s.store.ListAPIKeys(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return
+	}
+	out := make([]*types.APIKey, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, redactAPIKey(k))
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) getAPIKey(w http.ResponseWriter, r *http.Request) {
+	if !s.requireRole(w, r, "admin", "ops", "readOnly") && s.requireAuth {
+		return
+	}
+	key, ok := s.lookupAPIKey(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, redactAPIKey(key))
+}
+
+// revokeAPIKey refuses the key from the next request on. Revoked keys stay
+// listed so their use can still be traced in the audit log.
+func (s *Server) revokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	if !s.requireRole(w, r, "admin", "ops") {
+		return
+	}
+	key, ok := s.lookupAPIKey(w, r)
+	if !ok {
+		return
+	}
+	if key.RevokedAt != nil {
+		writeError(w, http.StatusConflict, "KN-409", "API key already revoked")
+		return
+	}
+	now := time.Now().UTC()
+	key.RevokedAt = &now
+	if err := s.store.UpdateAPIKey(r.Context(), key); err != nil {
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, redactAPIKey(key))
+}
+
+func (s *Server) lookupAPIKey(w http.ResponseWriter, r *http.Request) (*types.APIKey, bool) {
+	id := chi.URLParam(r, "keyID")
+	if _, err := uuid.Parse(id); err != nil {
+		writeError(w, http.StatusNotFound, "KN-404", "API key not found")
+		return nil, false
+	}
+	key, err := s.store.GetAPIKey(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "KN-404", "API key not found")
+			return nil, false
+		}
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return nil, false
+	}
+	return key, true
+}
+
+// verifyAPIKey authenticates a bearer token in the knk_<id>_<secret> format.
+func (s *Server) verifyAPIKey(ctx context.Context, raw string) (*AuthContext, error) {
+	id, _, ok := strings.Cut(strings.TrimPrefix(raw, apiKeyPrefix), "_")
+	if !ok {
+		return nil, errInvalidAPIKey
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, errInvalidAPIKey
+	}
+	key, err := s.store.GetAPIKey(ctx, id)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			logging.L.Warn("apikey_lookup_failed", zap.String("key_id", id), zap.Error(err))
+		}
+		return nil, errInvalidAPIKey
+	}
+	if subtle.ConstantTimeCompare([]byte(hashAPIKey(raw)), []byte(key.Hash)) != 1 {
+		return nil, errInvalidAPIKey
+	}
+	now := time.Now().UTC()
+	if key.RevokedAt != nil {
+		return nil, errors.New("API key revoked")
+	}
+	if !now.Before(key.ExpiresAt) {
+		return nil, errors.New("API key expired")
+	}
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) >= apiKeyTouchInterval {
+		if err := s.store.TouchAPIKey(ctx, key.ID, now); err != nil {
+			logging.L.Warn("apikey_touch_failed", zap.String("key_id", key.ID), zap.Error(err))
+		}
+	}
+	return &AuthContext{
+		Subject:  "apikey:" + key.ID,
+		Roles:    key.Roles,
+		Bindings: key.Bindings,
+	}, nil
+}
+
+func newAPIKey(id string) string {
+	buf := make([]byte, 32)
+	_, _ = rand.Read(buf)
+	return apiKeyPrefix + id + "_" + hex.EncodeToString(buf)
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func redactAPIKey(k *types.APIKey) *types.APIKey {
+	out := *k
+	out.Hash = ""
+	return &out
+}
+
+// revokeToken puts an issued JWT on the revocation list by its jti claim.
+func (s *Server) revokeToken(w http.ResponseWriter, r *http.Request) {
+	if !s.requireRole(w, r, "admin", "ops") {
+		return
+	}
+	var req TokenRevocationRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "KN-400", err.Error())
+		return
+	}
+	req.JTI = strings.TrimSpace(req.JTI)
+	if req.JTI == "" {
+		writeError(w, http.StatusBadRequest, "KN-400", "jti is required")
+		return
+	}
+	rev := &types.RevokedToken{
+		JTI:       req.JTI,
+		ExpiresAt: req.ExpiresAt,
+		RevokedBy: s.authContext(r.Context()).Subject,
+		RevokedAt: time.Now().UTC(),
+	}
+	if err := s.store.RevokeToken(r.Context(), rev); err != nil {
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, rev)
+}
+
+func (s *Server) listRevokedTokens(w http.ResponseWriter, r *http.Request) {
+	if !s.requireRole(w, r, "admin", "ops", "readOnly") && s.requireAuth {
+		return
+	}
+	revoked, err := s.store.ListRevokedTokens(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, revoked)
+}
+
+// RunRevocationRetention drops revocations of tokens that have expired
+// anyway until the context is canceled. Only the replica holding the
+// retention lease prunes.
+func (s *Server) RunRevocationRetention(ctx context.Context) {
+	ticker := time.NewTicker(revocationPruneInterval)
+	defer ticker.Stop()
+	for {
+		if s.holdLease(ctx, revocationPruneLease, 2*revocationPruneInterval) {
+			removed, err := s.store.PruneRevokedTokens(ctx, time.Now().UTC())
+			if err != nil {
+				logging.L.Warn("revocation_prune_failed", zap.Error(err))
+			} else if removed > 0 {
+				logging.L.Info("revocations_pruned", zap.Int64("removed", removed))
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
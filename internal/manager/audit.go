@@ -0,0 +1,290 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/vaheed/kubenova/internal/logging"
+	"github.com/vaheed/kubenova/internal/store"
+	"github.com/vaheed/kubenova/pkg/types"
+	"go.uber.org/zap"
+)
+
+const auditContextKey contextKey = "audit"
+
+// auditKinds maps the collections in API paths onto the kind of resource
+// their items are.
+var auditKinds = map[string]string{
+	"clusters": "cluster",
+	"tenants":  "tenant",
+	"projects": "project",
+	"apps":     "app",
+	"plans":    "plan",
+	"runs":     "workflowRun",
+	"webhooks": "webhook",
+	"apikeys":  "apiKey",
+}
+
+// auditTarget is what a mutating request path refers to.
+type auditTarget struct {
+	// kind is the innermost resource in the path; empty for paths such as
+	// /tokens that do not address a stored resource.
+	kind string
+	ids  map[string]string
+	// sub holds the path segments after the resource, e.g. ["quotas"].
+	sub []string
+	// verb is the custom method of paths such as /apps/{id}:deploy.
+	verb string
+	// create is set when the path ends at a collection.
+	create bool
+}
+
+func parseAuditTarget(resource string) auditTarget {
+	t := auditTarget{ids: map[string]string{}}
+	segs := strings.Split(strings.Trim(resource, "/"), "/")
+	for i := 0; i < len(segs); i++ {
+		kind, ok := auditKinds[segs[i]]
+		if !ok || len(t.sub) > 0 {
+			seg := segs[i]
+			if j := strings.IndexByte(seg, ':'); j >= 0 {
+				// A custom method on a path without a resource, as in
+				// /encryption:rewrap.
+				seg, t.verb = seg[:j], seg[j+1:]
+			}
+			t.sub = append(t.sub, seg)
+			continue
+		}
+		if i+1 < len(segs) {
+			if _, nested := auditKinds[segs[i+1]]; nested {
+				// A collection under a bare collection, as in /apps/runs/{id}.
+				continue
+			}
+		}
+		t.kind = kind
+		if i+1 == len(segs) {
+			t.create = true
+			break
+		}
+		id := segs[i+1]
+		if j := strings.IndexByte(id, ':'); j >= 0 {
+			id, t.verb = id[:j], id[j+1:]
+		}
+		t.ids[kind] = id
+		i++
+	}
+	if t.kind == "" {
+		t.create = true
+	}
+	return t
+}
+
+// action names the change, e.g. "tenant.create", "tenant.quotas.update" or
+// "app.deploy".
+func (t auditTarget) action(method string) string {
+	name, sub := t.kind, t.sub
+	if name == "" {
+		name, sub = strings.Join(t.sub, "."), nil
+	}
+	switch {
+	case t.verb != "":
+		return name + "." + t.verb
+	case method == http.MethodDelete:
+		return name + ".delete"
+	case len(sub) > 0 && method == http.MethodPost:
+		return name + "." + strings.Join(sub, ".")
+	case len(sub) > 0:
+		return name + "." + strings.Join(sub, ".") + ".update"
+	case t.create && method == http.MethodPost:
+		return name + ".create"
+	default:
+		return name + ".update"
+	}
+}
+
+// auditMiddleware records every mutating request together with the stored
+// state of the resource it addressed before and after the handler ran. The
+// actor is filled in by authMiddleware further down the chain.
+func (s *Server) auditMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		default:
+			next.ServeHTTP(w, r)
+			return
+		}
+		resource := strings.TrimPrefix(r.URL.Path, "/api/v1")
+		target := parseAuditTarget(resource)
+		event := &types.AuditEvent{
+			Time:      time.Now().UTC(),
+			Actor:     "anonymous",
+			Action:    target.action(r.Method),
+			Method:    r.Method,
+			Resource:  resource,
+			RequestID: middleware.GetReqID(r.Context()),
+		}
+		if !target.create {
+			event.Before = s.auditSnapshot(r.Context(), target)
+		}
+
+		rw := &recordingWriter{ResponseWriter: w}
+		next.ServeHTTP(rw, r.WithContext(context.WithValue(r.Context(), auditContextKey, event)))
+
+		ctx := context.WithoutCancel(r.Context())
+		event.Status = rw.statusCode()
+		event.Outcome = auditOutcome(event.Status)
+		if target.create && target.kind != "" && event.Status < http.StatusBadRequest {
+			event.After = createdSnapshot(rw, target)
+			if target.kind == "webhook" || target.kind == "apiKey" {
+				// The create response carries the signing secret or key.
+				event.After = s.auditSnapshot(ctx, target)
+			}
+		} else if target.kind != "" {
+			event.After = s.auditSnapshot(ctx, target)
+		}
+		event.ClusterID = target.ids["cluster"]
+		event.TenantID = target.ids["tenant"]
+		event.ProjectID = target.ids["project"]
+		event.AppID = target.ids["app"]
+		if err := s.store.RecordAudit(ctx, event); err != nil {
+			logging.L.Error("audit_record_failed",
+				zap.String("action", event.Action),
+				zap.String("resource", event.Resource),
+				zap.Error(err),
+			)
+		}
+	})
+}
+
+// setAuditActor attributes the audit event of the request, if any, to the
+// authenticated caller.
+func setAuditActor(ctx context.Context, auth *AuthContext) {
+	if event, ok := ctx.Value(auditContextKey).(*types.AuditEvent); ok && auth.Subject != "" {
+		event.Actor = auth.Subject
+		event.Roles = auth.Roles
+	}
+}
+
+func auditOutcome(status int) string {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return "denied"
+	case status >= http.StatusBadRequest:
+		return "failure"
+	default:
+		return "success"
+	}
+}
+
+// auditSnapshot returns the stored resource as the API would render it, or nil
+// when it does not exist.
+func (s *Server) auditSnapshot(ctx context.Context, t auditTarget) json.RawMessage {
+	var (
+		v   any
+		err error
+	)
+	switch t.kind {
+	case "cluster":
+		var c *types.Cluster
+		if c, err = s.store.GetCluster(ctx, t.ids["cluster"]); err == nil {
+			v = sanitizeCluster(c)
+		}
+	case "tenant":
+		v, err = s.store.GetTenant(ctx, t.ids["cluster"], t.ids["tenant"])
+	case "project":
+		v, err = s.store.GetProject(ctx, t.ids["cluster"], t.ids["tenant"], t.ids["project"])
+	case "app":
+		v, err = s.store.GetApp(ctx, t.ids["cluster"], t.ids["tenant"], t.ids["project"], t.ids["app"])
+	case "plan":
+		v, err = s.store.GetPlan(ctx, t.ids["plan"])
+	case "workflowRun":
+		v, err = s.store.GetWorkflowRun(ctx, t.ids["workflowRun"])
+	case "webhook":
+		var sub *types.WebhookSubscription
+		if sub, err = s.store.GetWebhook(ctx, t.ids["webhook"]); err == nil {
+			v = redactWebhook(sub)
+		}
+	case "apiKey":
+		var k *types.APIKey
+		if k, err = s.store.GetAPIKey(ctx, t.ids["apiKey"]); err == nil {
+			v = redactAPIKey(k)
+		}
+	default:
+		return nil
+	}
+	if err != nil {
+		return nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return raw
+}
+
+// createdSnapshot takes the new resource from the create response and records
+// its identifier on the target.
+func createdSnapshot(rw *recordingWriter, t auditTarget) json.RawMessage {
+	body := bytes.TrimSpace(rw.body.Bytes())
+	var created struct {
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	}
+	if !strings.HasPrefix(rw.Header().Get("Content-Type"), "application/json") || json.Unmarshal(body, &created) != nil {
+		return nil
+	}
+	if t.kind == "plan" {
+		t.ids["plan"] = created.Name
+	} else {
+		t.ids[t.kind] = created.ID
+	}
+	return json.RawMessage(body)
+}
+
+func (s *Server) listAudit(w http.ResponseWriter, r *http.Request) {
+	if !s.requireRole(w, r, "admin", "ops", "readOnly") && s.requireAuth {
+		return
+	}
+	values := r.URL.Query()
+	q := store.AuditQuery{
+		Actor:     values.Get("actor"),
+		Resource:  values.Get("resource"),
+		ClusterID: values.Get("clusterId"),
+		TenantID:  values.Get("tenantId"),
+		Action:    values.Get("action"),
+	}
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"from", &q.From}, {"to", &q.To}} {
+		raw := values.Get(p.name)
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "KN-400", p.name+" must be an RFC3339 timestamp")
+			return
+		}
+		*p.dst = t.UTC()
+	}
+	if raw := values.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > store.MaxAuditLimit {
+			writeError(w, http.StatusBadRequest, "KN-400", "limit must be between 1 and 1000")
+			return
+		}
+		q.Limit = limit
+	}
+	events, err := s.store.ListAudit(r.Context(), q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, events)
+}
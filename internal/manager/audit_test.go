@@ -0,0 +1,139 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/vaheed/kubenova/pkg/types"
+)
+
+func TestAuditLogRecordsMutations(t *testing.T) {
+	t.Setenv("KUBENOVA_REQUIRE_AUTH", "true")
+	t.Setenv("JWT_SIGNING_KEY", "audit-secret")
+
+	srv := newTestServer(t)
+	client := srv.client
+	baseURL := srv.baseURL
+
+	token := func(subject string, roles ...string) string {
+		tok := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"sub":   subject,
+			"roles": roles,
+			"exp":   time.Now().Add(time.Hour).Unix(),
+		})
+		signed, err := tok.SignedString([]byte("audit-secret"))
+		if err != nil {
+			t.Fatalf("sign token: %v", err)
+		}
+		return signed
+	}
+	alice := token("alice", "admin")
+	bob := token("bob", "readOnly")
+	call := func(tok, method, url string, body any, want int) []byte {
+		t.Helper()
+		var reader *bytes.Reader
+		if body != nil {
+			raw, _ := json.Marshal(body)
+			reader = bytes.NewReader(raw)
+		} else {
+			reader = bytes.NewReader(nil)
+		}
+		req, _ := http.NewRequest(method, url, reader)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+tok)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, url, err)
+		}
+		defer resp.Body.Close()
+		buf := new(bytes.Buffer)
+		_, _ = buf.ReadFrom(resp.Body)
+		if resp.StatusCode != want {
+			t.Fatalf("%s %s: want %d got %d body=%s", method, url, want, resp.StatusCode, buf.String())
+		}
+		return buf.Bytes()
+	}
+
+	call(alice, http.MethodPost, baseURL+"/plans", map[string]any{
+		"name":   "silver",
+		"quotas": map[string]string{"cpu": "2"},
+	}, http.StatusCreated)
+	call(alice, http.MethodPut, baseURL+"/plans/silver", map[string]any{
+		"name":   "silver",
+		"quotas": map[string]string{"cpu": "4"},
+	}, http.StatusOK)
+	call(bob, http.MethodDelete, baseURL+"/plans/silver", nil, http.StatusForbidden)
+
+	audit := func(query string) []*types.AuditEvent {
+		t.Helper()
+		var events []*types.AuditEvent
+		if err := json.Unmarshal(call(bob, http.MethodGet, baseURL+"/audit?"+query, nil, http.StatusOK), &events); err != nil {
+			t.Fatalf("decode audit: %v", err)
+		}
+		return events
+	}
+
+	events := audit("resource=/plans/silver")
+	if len(events) != 2 {
+		t.Fatalf("expected update and denied delete, got %d events", len(events))
+	}
+	denied, update := events[0], events[1]
+	if denied.Actor != "bob" || denied.Action != "plan.delete" || denied.Outcome != "denied" || denied.Status != http.StatusForbidden {
+		t.Fatalf("unexpected denied event: %+v", denied)
+	}
+	if update.Actor != "alice" || update.Action != "plan.update" || update.Outcome != "success" || update.RequestID == "" {
+		t.Fatalf("unexpected update event: %+v", update)
+	}
+	var before, after types.Plan
+	_ = json.Unmarshal(update.Before, &before)
+	_ = json.Unmarshal(update.After, &after)
+	if before.Quotas["cpu"] != "2" || after.Quotas["cpu"] != "4" {
+		t.Fatalf("expected before/after snapshots, got %s -> %s", update.Before, update.After)
+	}
+
+	events = audit("actor=alice&action=plan.create")
+	if len(events) != 1 || events[0].Before != nil || len(events[0].After) == 0 {
+		t.Fatalf("expected one create event with an after snapshot, got %+v", events)
+	}
+
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	if events = audit("from=" + future); len(events) != 0 {
+		t.Fatalf("expected no events after %s, got %d", future, len(events))
+	}
+	call(bob, http.MethodGet, baseURL+"/audit?from=yesterday", nil, http.StatusBadRequest)
+	call(token("carol"), http.MethodGet, baseURL+"/audit", nil, http.StatusForbidden)
+}
+
+func TestParseAuditTarget(t *testing.T) {
+	cases := []struct {
+		method, path, action, kind string
+	}{
+		{http.MethodPost, "/clusters", "cluster.create", "cluster"},
+		{http.MethodDelete, "/clusters/c1", "cluster.delete", "cluster"},
+		{http.MethodPost, "/clusters/c1/bootstrap/operator", "cluster.bootstrap.operator", "cluster"},
+		{http.MethodPut, "/clusters/c1/tenants/t1/quotas", "tenant.quotas.update", "tenant"},
+		{http.MethodPut, "/clusters/c1/tenants/t1/projects/p1", "project.update", "project"},
+		{http.MethodPost, "/clusters/c1/tenants/t1/projects/p1/apps/a1:deploy", "app.deploy", "app"},
+		{http.MethodPost, "/clusters/c1/tenants/t1/projects/p1/apps/a1/workflow/run", "app.workflow.run", "app"},
+		{http.MethodPost, "/apps/runs/r1:cancel", "workflowRun.cancel", "workflowRun"},
+		{http.MethodPost, "/webhooks", "webhook.create", "webhook"},
+		{http.MethodPut, "/webhooks/w1", "webhook.update", "webhook"},
+		{http.MethodPost, "/tokens", "tokens.create", ""},
+		{http.MethodPost, "/encryption:rewrap", "encryption.rewrap", ""},
+		{http.MethodPost, "/apikeys/k1:revoke", "apiKey.revoke", "apiKey"},
+	}
+	for _, c := range cases {
+		target := parseAuditTarget(c.path)
+		if got := target.action(c.method); got != c.action || target.kind != c.kind {
+			t.Errorf("%s %s: got action %q kind %q, want %q %q", c.method, c.path, got, target.kind, c.action, c.kind)
+		}
+	}
+	if target := parseAuditTarget("/clusters/c1/tenants/t1/projects/p1/apps/a1:deploy"); fmt.Sprint(target.ids) != "map[app:a1 cluster:c1 project:p1 tenant:t1]" {
+		t.Errorf("unexpected ids: %v", target.ids)
+	}
+}
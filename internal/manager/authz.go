@@ -0,0 +1,191 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/vaheed/kubenova/internal/store"
+	"github.com/vaheed/kubenova/pkg/types"
+)
+
+// knownRoles are the roles the API grants access to. operator is the
+// credential a cluster's operator reports usage with.
+var knownRoles = []string{"admin", "ops", "tenantOwner", "projectDev", "readOnly", "operator"}
+
+// scopedRoles only grant access through a binding to a cluster, tenant or
+// project; holding one in the roles claim alone gives no access.
+var scopedRoles = []string{"tenantOwner", "projectDev", "operator"}
+
+// resourceScope locates a resource by the IDs of its cluster, tenant and
+// project. Fields above the resource's level are empty.
+type resourceScope struct {
+	clusterID string
+	tenantID  string
+	projectID string
+}
+
+// covers reports whether b applies to the resource at sc.
+func covers(b types.RoleBinding, sc resourceScope) bool {
+	return (b.ClusterID == "" || b.ClusterID == sc.clusterID) &&
+		(b.TenantID == "" || b.TenantID == sc.tenantID) &&
+		(b.ProjectID == "" || b.ProjectID == sc.projectID)
+}
+
+// validBinding checks a binding before it is put into a token.
+func validBinding(b types.RoleBinding) error {
+	if !slices.Contains(knownRoles, b.Role) {
+		return fmt.Errorf("unknown role %q", b.Role)
+	}
+	if b.ClusterID == "" && b.TenantID == "" && b.ProjectID == "" {
+		return fmt.Errorf("binding for %s needs a clusterId, tenantId or projectId", b.Role)
+	}
+	return nil
+}
+
+// bindingsClaim reads the bindings claim of a token, dropping bindings that
+// are not valid.
+func bindingsClaim(v any) []types.RoleBinding {
+	if v == nil {
+		return nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var all []types.RoleBinding
+	if err := json.Unmarshal(raw, &all); err != nil {
+		return nil
+	}
+	out := all[:0]
+	for _, b := range all {
+		if validBinding(b) == nil {
+			out = append(out, b)
+		}
+	}
+	return out
+}
+
+// globalRole reports whether the caller holds one of roles on every resource.
+func (a *AuthContext) globalRole(roles ...string) bool {
+	for _, have := range a.Roles {
+		if slices.Contains(roles, have) && !slices.Contains(scopedRoles, have) {
+			return true
+		}
+	}
+	return false
+}
+
+// anyRole reports whether the caller holds one of roles anywhere.
+func (a *AuthContext) anyRole(roles ...string) bool {
+	if a.globalRole(roles...) {
+		return true
+	}
+	for _, b := range a.Bindings {
+		if slices.Contains(roles, b.Role) {
+			return true
+		}
+	}
+	return false
+}
+
+// can reports whether the caller holds one of roles on the resource at sc.
+func (a *AuthContext) can(sc resourceScope, roles ...string) bool {
+	if a.globalRole(roles...) {
+		return true
+	}
+	for _, b := range a.Bindings {
+		if slices.Contains(roles, b.Role) && covers(b, sc) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestScope returns the scope of the resource named by the route. Parent
+// IDs the route does not carry are looked up; a missing parent leaves them
+// empty, but any other store error is returned.
+func (s *Server) requestScope(r *http.Request) (resourceScope, error) {
+	sc := resourceScope{
+		clusterID: chi.URLParam(r, "clusterID"),
+		tenantID:  chi.URLParam(r, "tenantID"),
+		projectID: chi.URLParam(r, "projectID"),
+	}
+	if sc.projectID != "" && sc.tenantID == "" {
+		p, err := s.store.GetProjectByID(r.Context(), sc.projectID)
+		switch {
+		case err == nil:
+			sc.clusterID, sc.tenantID = p.ClusterID, p.TenantID
+		case !errors.Is(err, store.ErrNotFound):
+			return sc, err
+		}
+	}
+	if sc.tenantID != "" && sc.clusterID == "" {
+		tsc, err := s.tenantScope(r.Context(), sc.tenantID)
+		if err != nil {
+			return sc, err
+		}
+		sc.clusterID = tsc.clusterID
+	}
+	return sc, nil
+}
+
+// tenantScope returns the scope of a tenant. The cluster is left empty when
+// the tenant does not exist.
+func (s *Server) tenantScope(ctx context.Context, tenantID string) (resourceScope, error) {
+	sc := resourceScope{tenantID: tenantID}
+	t, err := s.store.GetTenantByID(ctx, tenantID)
+	switch {
+	case err == nil:
+		sc.clusterID = t.ClusterID
+	case !errors.Is(err, store.ErrNotFound):
+		return sc, err
+	}
+	return sc, nil
+}
+
+// requireScope is requireRole for a resource the route does not name.
+func (s *Server) requireScope(w http.ResponseWriter, r *http.Request, sc resourceScope, allowed ...string) bool {
+	if !s.requireAuth || s.authContext(r.Context()).can(sc, allowed...) {
+		return true
+	}
+	writeError(w, http.StatusForbidden, "KN-403", "forbidden")
+	return false
+}
+
+// requireAnyRole admits callers holding one of the roles on any resource.
+// Handlers using it must filter what they return with filterVisible or
+// canAccess, unless it belongs to no tenant, like plans.
+func (s *Server) requireAnyRole(w http.ResponseWriter, r *http.Request, allowed ...string) bool {
+	if !s.requireAuth || s.authContext(r.Context()).anyRole(allowed...) {
+		return true
+	}
+	writeError(w, http.StatusForbidden, "KN-403", "forbidden")
+	return false
+}
+
+// canAccess reports whether the caller holds one of roles on the resource at
+// sc.
+func (s *Server) canAccess(r *http.Request, sc resourceScope, roles ...string) bool {
+	return !s.requireAuth || s.authContext(r.Context()).can(sc, roles...)
+}
+
+// filterVisible keeps the items the caller holds one of roles on. It runs
+// after paging, so a page may hold fewer items than its limit.
+func filterVisible[T any](s *Server, r *http.Request, items []T, scope func(T) resourceScope, roles ...string) []T {
+	if !s.requireAuth {
+		return items
+	}
+	auth := s.authContext(r.Context())
+	out := make([]T, 0, len(items))
+	for _, item := range items {
+		if auth.can(scope(item), roles...) {
+			out = append(out, item)
+		}
+	}
+	return out
+}
@@ -0,0 +1,185 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/vaheed/kubenova/internal/store"
+	"github.com/vaheed/kubenova/pkg/types"
+)
+
+// bearerTransport adds a bearer token to every request.
+type bearerTransport struct {
+	token string
+	next  http.RoundTripper
+}
+
+func (b bearerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set("Authorization", "Bearer "+b.token)
+	return b.next.RoundTrip(r)
+}
+
+func TestScopedAuthorization(t *testing.T) {
+	t.Setenv("KUBENOVA_REQUIRE_AUTH", "true")
+	t.Setenv("JWT_SIGNING_KEY", "authz-secret")
+
+	srv := newTestServer(t)
+	st, baseURL := srv.store, srv.baseURL
+	ctx := context.Background()
+
+	as := func(roles []string, bindings ...types.RoleBinding) *http.Client {
+		tok := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"sub":      "caller",
+			"roles":    roles,
+			"bindings": bindings,
+			"exp":      time.Now().Add(time.Hour).Unix(),
+		})
+		signed, err := tok.SignedString([]byte("authz-secret"))
+		if err != nil {
+			t.Fatalf("sign token: %v", err)
+		}
+		return &http.Client{Transport: bearerTransport{token: signed, next: srv.client.Transport}}
+	}
+
+	cluster := &types.Cluster{Name: "east", Kubeconfig: "fake"}
+	otherCluster := &types.Cluster{Name: "west", Kubeconfig: "fake"}
+	for _, c := range []*types.Cluster{cluster, otherCluster} {
+		if err := st.CreateCluster(ctx, c); err != nil {
+			t.Fatalf("create cluster: %v", err)
+		}
+	}
+	acme := &types.Tenant{ClusterID: cluster.ID, Name: "acme"}
+	globex := &types.Tenant{ClusterID: cluster.ID, Name: "globex"}
+	for _, tn := range []*types.Tenant{acme, globex} {
+		if err := st.CreateTenant(ctx, tn); err != nil {
+			t.Fatalf("create tenant: %v", err)
+		}
+	}
+	web := &types.Project{ClusterID: cluster.ID, TenantID: acme.ID, Name: "web"}
+	api := &types.Project{ClusterID: cluster.ID, TenantID: acme.ID, Name: "api"}
+	for _, p := range []*types.Project{web, api} {
+		if err := st.CreateProject(ctx, p); err != nil {
+			t.Fatalf("create project: %v", err)
+		}
+	}
+	clusterURL := fmt.Sprintf("%s/clusters/%s", baseURL, cluster.ID)
+	tenantURL := func(tn *types.Tenant) string { return fmt.Sprintf("%s/tenants/%s", clusterURL, tn.ID) }
+	projectURL := func(p *types.Project) string { return fmt.Sprintf("%s/projects/%s", tenantURL(acme), p.ID) }
+
+	// A tenant owner sees and manages their own tenant only.
+	owner := as(nil, types.RoleBinding{Role: "tenantOwner", TenantID: acme.ID})
+	if tenants := doJSON[[]*types.Tenant](t, owner, http.MethodGet, clusterURL+"/tenants", nil, http.StatusOK); len(tenants) != 1 || tenants[0].ID != acme.ID {
+		t.Fatalf("expected the owner to list only their tenant, got %d tenants", len(tenants))
+	}
+	doNoBody(t, owner, http.MethodGet, tenantURL(acme), nil, http.StatusOK)
+	doNoBody(t, owner, http.MethodGet, tenantURL(globex), nil, http.StatusForbidden)
+	doNoBody(t, owner, http.MethodGet, baseURL+"/tenants/"+acme.ID+"/usage", nil, http.StatusOK)
+	doNoBody(t, owner, http.MethodGet, baseURL+"/tenants/"+globex.ID+"/kubeconfig", nil, http.StatusForbidden)
+	doNoBody(t, owner, http.MethodPut, tenantURL(acme)+"/quotas", map[string]string{"cpu": "8"}, http.StatusForbidden)
+	doNoBody(t, owner, http.MethodGet, baseURL+"/clusters", nil, http.StatusForbidden)
+	if projects := doJSON[[]*types.Project](t, owner, http.MethodGet, tenantURL(acme)+"/projects", nil, http.StatusOK); len(projects) != 2 {
+		t.Fatalf("expected the owner to see both projects, got %d", len(projects))
+	}
+
+	// A project developer sees their project only.
+	dev := as(nil, types.RoleBinding{Role: "projectDev", ProjectID: web.ID})
+	if projects := doJSON[[]*types.Project](t, dev, http.MethodGet, tenantURL(acme)+"/projects", nil, http.StatusOK); len(projects) != 1 || projects[0].ID != web.ID {
+		t.Fatalf("expected the developer to list only their project, got %d projects", len(projects))
+	}
+	doNoBody(t, dev, http.MethodGet, projectURL(web)+"/apps", nil, http.StatusOK)
+	doNoBody(t, dev, http.MethodGet, projectURL(api)+"/apps", nil, http.StatusForbidden)
+	doNoBody(t, dev, http.MethodGet, baseURL+"/projects/"+web.ID+"/usage", nil, http.StatusOK)
+	doNoBody(t, dev, http.MethodGet, baseURL+"/projects/"+api.ID+"/usage", nil, http.StatusForbidden)
+	doNoBody(t, dev, http.MethodGet, tenantURL(acme), nil, http.StatusForbidden)
+
+	// Scoped roles in the roles claim grant nothing.
+	doNoBody(t, as([]string{"tenantOwner"}), http.MethodGet, tenantURL(acme), nil, http.StatusForbidden)
+
+	// Cluster-wide roles can be bound to a single cluster.
+	ops := as(nil, types.RoleBinding{Role: "ops", ClusterID: cluster.ID})
+	if clusters := doJSON[[]*types.Cluster](t, ops, http.MethodGet, baseURL+"/clusters", nil, http.StatusOK); len(clusters) != 1 || clusters[0].ID != cluster.ID {
+		t.Fatalf("expected ops to list only their cluster, got %d clusters", len(clusters))
+	}
+	doNoBody(t, ops, http.MethodGet, baseURL+"/clusters/"+otherCluster.ID, nil, http.StatusForbidden)
+	doNoBody(t, ops, http.MethodGet, tenantURL(globex), nil, http.StatusOK)
+
+	// Tokens carrying bindings are issued by POST /tokens, here on a manager
+	// without auth as in development.
+	t.Setenv("KUBENOVA_REQUIRE_AUTH", "false")
+	issuer := httptest.NewServer(NewServer(st).Router())
+	defer issuer.Close()
+	doNoBody(t, issuer.Client(), http.MethodPost, issuer.URL+"/api/v1/tokens", map[string]any{
+		"subject": "bad", "bindings": []map[string]string{{"role": "tenantOwner"}},
+	}, http.StatusBadRequest)
+	issued := doJSON[TokenResponse](t, issuer.Client(), http.MethodPost, issuer.URL+"/api/v1/tokens", map[string]any{
+		"subject": "dana", "bindings": []map[string]string{{"role": "tenantOwner", "tenantId": globex.ID}},
+	}, http.StatusCreated)
+	dana := &http.Client{Transport: bearerTransport{token: issued.Token, next: srv.client.Transport}}
+	me := doJSON[map[string]any](t, dana, http.MethodGet, baseURL+"/me", nil, http.StatusOK)
+	if bindings, _ := me["bindings"].([]any); len(bindings) != 1 {
+		t.Fatalf("expected /me to report the binding, got %v", me)
+	}
+	doNoBody(t, dana, http.MethodGet, tenantURL(globex), nil, http.StatusOK)
+	doNoBody(t, dana, http.MethodGet, tenantURL(acme), nil, http.StatusForbidden)
+}
+
+// failingLookupStore fails the parentless tenant and project lookups.
+type failingLookupStore struct {
+	store.Store
+}
+
+var errLookupUnavailable = errors.New("lookup unavailable")
+
+func (failingLookupStore) GetTenantByID(context.Context, string) (*types.Tenant, error) {
+	return nil, errLookupUnavailable
+}
+
+func (failingLookupStore) GetProjectByID(context.Context, string) (*types.Project, error) {
+	return nil, errLookupUnavailable
+}
+
+func TestScopeLookupErrorsAreServerErrors(t *testing.T) {
+	t.Setenv("KUBENOVA_REQUIRE_AUTH", "true")
+	t.Setenv("JWT_SIGNING_KEY", "authz-secret")
+
+	srv := newTestServer(t)
+	ctx := context.Background()
+	cluster := &types.Cluster{Name: "east", Kubeconfig: "fake"}
+	if err := srv.store.CreateCluster(ctx, cluster); err != nil {
+		t.Fatalf("create cluster: %v", err)
+	}
+	tenant := &types.Tenant{ClusterID: cluster.ID, Name: "acme"}
+	if err := srv.store.CreateTenant(ctx, tenant); err != nil {
+		t.Fatalf("create tenant: %v", err)
+	}
+	project := &types.Project{ClusterID: cluster.ID, TenantID: tenant.ID, Name: "web"}
+	if err := srv.store.CreateProject(ctx, project); err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	srv.store = failingLookupStore{Store: srv.store}
+
+	tok := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":      "caller",
+		"bindings": []types.RoleBinding{{Role: "tenantOwner", TenantID: tenant.ID}},
+		"exp":      time.Now().Add(time.Hour).Unix(),
+	})
+	signed, err := tok.SignedString([]byte("authz-secret"))
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	owner := &http.Client{Transport: bearerTransport{token: signed, next: srv.client.Transport}}
+
+	// A scope that cannot be looked up is not reported as forbidden.
+	doNoBody(t, owner, http.MethodGet, srv.baseURL+"/tenants/"+tenant.ID+"/usage", nil, http.StatusInternalServerError)
+	doNoBody(t, owner, http.MethodGet, srv.baseURL+"/projects/"+project.ID+"/usage", nil, http.StatusInternalServerError)
+	doNoBody(t, owner, http.MethodPost, srv.baseURL+"/webhooks", map[string]any{
+		"url": "https://hooks.example.com/kubenova", "tenantId": tenant.ID,
+	}, http.StatusInternalServerError)
+}
@@ -0,0 +1,185 @@
+package manager
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vaheed/kubenova/internal/store"
+	"github.com/vaheed/kubenova/pkg/types"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+const gibibyte = 1 << 30
+
+var billingCSVHeader = []string{
+	"period", "cluster_id", "tenant_id", "tenant", "plan", "hours_reported",
+	"cpu_core_hours", "memory_gib_hours", "storage_gib_hours", "load_balancer_hours", "peak_pods",
+	"currency", "base_cost", "usage_cost", "total",
+}
+
+// billingExport streams one line item per tenant for a calendar month as CSV
+// (default) or JSON Lines (?format=jsonl). Line items come from the hourly
+// usage rollups, so tenants deleted during the month are still billed; tenants
+// without usage get an item for their base price.
+func (s *Server) billingExport(w http.ResponseWriter, r *http.Request) {
+	if !s.requireRole(w, r, "admin", "ops") {
+		return
+	}
+	period := strings.TrimSpace(r.URL.Query().Get("period"))
+	start, err := time.Parse("2006-01", period)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "KN-400", "period must be a month in YYYY-MM form")
+		return
+	}
+	end := start.AddDate(0, 1, 0)
+	format := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("format")))
+	switch format {
+	case "":
+		format = "csv"
+	case "csv", "jsonl":
+	default:
+		writeError(w, http.StatusBadRequest, "KN-400", "format must be csv or jsonl")
+		return
+	}
+	clusterID := r.URL.Query().Get("clusterId")
+	usage, err := s.store.ListTenantUsage(r.Context(), clusterID, start, end)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return
+	}
+	tenants, _, err := s.store.ListTenants(r.Context(), clusterID, store.ListOptions{})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return
+	}
+	plans, err := s.store.ListPlans(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return
+	}
+	plansByName := make(map[string]*types.Plan, len(plans))
+	for _, p := range plans {
+		plansByName[p.Name] = p
+	}
+
+	filename := fmt.Sprintf("kubenova-billing-%s.%s", period, format)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	var emit func(*types.BillingLineItem) error
+	if format == "jsonl" {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		enc := json.NewEncoder(w)
+		emit = func(item *types.BillingLineItem) error { return enc.Encode(item) }
+	} else {
+		w.Header().Set("Content-Type", "text/csv")
+		cw := csv.NewWriter(w)
+		if err := cw.Write(billingCSVHeader); err != nil {
+			return
+		}
+		cw.Flush()
+		emit = func(item *types.BillingLineItem) error {
+			if err := cw.Write(billingCSVRow(item)); err != nil {
+				return err
+			}
+			cw.Flush()
+			return cw.Error()
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	emitted := make(map[string]bool, len(usage))
+	write := func(t *types.Tenant, points []*types.UsageRecord) bool {
+		emitted[t.ID] = true
+		if err := emit(billingLineItem(period, t, plansByName[t.Plan], points)); err != nil {
+			return false
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return true
+	}
+	tenantsByID := make(map[string]*types.Tenant, len(tenants))
+	for _, t := range tenants {
+		tenantsByID[t.ID] = t
+	}
+	for _, u := range usage {
+		t := &types.Tenant{ID: u.TenantID, ClusterID: u.ClusterID, Name: u.Tenant, Plan: u.Plan}
+		if cur, ok := tenantsByID[u.TenantID]; ok && u.Tenant == "" {
+			t.Name, t.Plan = cur.Name, cur.Plan
+		}
+		if !write(t, u.Points) {
+			return
+		}
+	}
+	for _, t := range tenants {
+		if emitted[t.ID] || (!t.CreatedAt.IsZero() && !t.CreatedAt.Before(end)) {
+			continue
+		}
+		if !write(t, nil) {
+			return
+		}
+	}
+}
+
+// billingLineItem integrates hourly usage averages into unit-hours and prices
+// them with the tenant's plan.
+func billingLineItem(period string, t *types.Tenant, plan *types.Plan, points []*types.UsageRecord) *types.BillingLineItem {
+	item := &types.BillingLineItem{
+		Period:        period,
+		ClusterID:     t.ClusterID,
+		TenantID:      t.ID,
+		Tenant:        t.Name,
+		Plan:          t.Plan,
+		HoursReported: len(points),
+	}
+	for _, p := range points {
+		item.CPUCoreHours += quantityValue(p.CPURequests)
+		item.MemoryGiBHours += quantityValue(p.MemoryRequests) / gibibyte
+		item.StorageGiBHours += quantityValue(p.PVCStorage) / gibibyte
+		item.LoadBalancerHours += float64(p.LoadBalancers)
+		if p.Pods > item.PeakPods {
+			item.PeakPods = p.Pods
+		}
+	}
+	item.CPUCoreHours = round(item.CPUCoreHours, 4)
+	item.MemoryGiBHours = round(item.MemoryGiBHours, 4)
+	item.StorageGiBHours = round(item.StorageGiBHours, 4)
+	if plan != nil && plan.Pricing != nil {
+		price := plan.Pricing
+		item.Currency = price.Currency
+		item.BaseCost = round(price.MonthlyBase, 2)
+		item.UsageCost = round(item.CPUCoreHours*price.CPUCoreHour+
+			item.MemoryGiBHours*price.MemoryGiBHour+
+			item.StorageGiBHours*price.StorageGiBHour+
+			item.LoadBalancerHours*price.LoadBalancerHour, 2)
+		item.Total = round(item.BaseCost+item.UsageCost, 2)
+	}
+	return item
+}
+
+func billingCSVRow(item *types.BillingLineItem) []string {
+	f := func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) }
+	return []string{
+		item.Period, item.ClusterID, item.TenantID, item.Tenant, item.Plan, strconv.Itoa(item.HoursReported),
+		f(item.CPUCoreHours), f(item.MemoryGiBHours), f(item.StorageGiBHours), f(item.LoadBalancerHours), strconv.Itoa(item.PeakPods),
+		item.Currency, f(item.BaseCost), f(item.UsageCost), f(item.Total),
+	}
+}
+
+func quantityValue(v string) float64 {
+	q, err := resource.ParseQuantity(v)
+	if err != nil {
+		return 0
+	}
+	return q.AsApproximateFloat64()
+}
+
+func round(v float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(v*scale) / scale
+}
@@ -0,0 +1,173 @@
+package manager
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/vaheed/kubenova/pkg/types"
+)
+
+func TestBillingExportStreamsLineItems(t *testing.T) {
+	t.Setenv("KUBENOVA_REQUIRE_AUTH", "false")
+
+	srv := newTestServer(t)
+	st := srv.store
+	ctx := context.Background()
+	client := srv.client
+	baseURL := srv.baseURL
+
+	_ = doJSON[*types.Plan](t, client, http.MethodPost, baseURL+"/plans", map[string]any{
+		"name": "gold",
+		"pricing": map[string]any{
+			"currency":         "EUR",
+			"monthlyBase":      100,
+			"cpuCoreHour":      0.05,
+			"memoryGiBHour":    0.01,
+			"loadBalancerHour": 0.02,
+		},
+	}, http.StatusCreated)
+
+	cluster := &types.Cluster{Name: "billing"}
+	if err := st.CreateCluster(ctx, cluster); err != nil {
+		t.Fatalf("create cluster: %v", err)
+	}
+	gold := &types.Tenant{ClusterID: cluster.ID, Name: "acme", Plan: "gold"}
+	free := &types.Tenant{ClusterID: cluster.ID, Name: "hobby"}
+	for _, tenant := range []*types.Tenant{gold, free} {
+		if err := st.CreateTenant(ctx, tenant); err != nil {
+			t.Fatalf("create tenant: %v", err)
+		}
+	}
+
+	// Bill the current month so both tenants existed during the period.
+	now := time.Now().UTC()
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	period := month.Format("2006-01")
+
+	// Ten hours at 2 cores, 4Gi and one load balancer, plus a sample outside the period.
+	start := month.Add(30 * time.Minute)
+	for i := 0; i < 10; i++ {
+		if err := st.RecordUsage(ctx, &types.UsageRecord{
+			ClusterID:      cluster.ID,
+			TenantID:       gold.ID,
+			CPURequests:    "2",
+			MemoryRequests: "4Gi",
+			PVCStorage:     "0",
+			LoadBalancers:  1,
+			Pods:           3 + i%2,
+			LastReportedAt: start.Add(time.Duration(i) * time.Hour),
+		}); err != nil {
+			t.Fatalf("record usage: %v", err)
+		}
+	}
+	if err := st.RecordUsage(ctx, &types.UsageRecord{
+		ClusterID: cluster.ID, TenantID: gold.ID, CPURequests: "64", LastReportedAt: start.AddDate(0, 1, 0),
+	}); err != nil {
+		t.Fatalf("record usage: %v", err)
+	}
+
+	doNoBody(t, client, http.MethodGet, baseURL+"/billing/exports", nil, http.StatusBadRequest)
+	doNoBody(t, client, http.MethodGet, baseURL+"/billing/exports?period="+period+"&format=xml", nil, http.StatusBadRequest)
+
+	resp := doRequest(t, client, http.MethodGet, baseURL+"/billing/exports?period="+period, nil)
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/csv" {
+		t.Fatalf("unexpected csv response: %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	rows, err := csv.NewReader(resp.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("read csv: %v", err)
+	}
+	if len(rows) != 3 || rows[0][0] != "period" {
+		t.Fatalf("expected header and two tenants, got %v", rows)
+	}
+	byTenant := map[string][]string{}
+	for _, row := range rows[1:] {
+		byTenant[row[3]] = row
+	}
+	// 20 core-hours * 0.05 + 40 GiB-hours * 0.01 + 10 LB-hours * 0.02 = 1.6
+	want := []string{period, cluster.ID, gold.ID, "acme", "gold", "10", "20", "40", "0", "10", "4", "EUR", "100", "1.6", "101.6"}
+	for i, v := range want {
+		if byTenant["acme"][i] != v {
+			t.Fatalf("column %s: want %q got %q (row %v)", billingCSVHeader[i], v, byTenant["acme"][i], byTenant["acme"])
+		}
+	}
+	if byTenant["hobby"][5] != "0" || byTenant["hobby"][14] != "0" {
+		t.Fatalf("expected empty line item for tenant without usage, got %v", byTenant["hobby"])
+	}
+
+	resp = doRequest(t, client, http.MethodGet, baseURL+"/billing/exports?period="+period+"&format=jsonl&clusterId="+cluster.ID, nil)
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("unexpected jsonl content type %s", resp.Header.Get("Content-Type"))
+	}
+	var items []types.BillingLineItem
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var item types.BillingLineItem
+		if err := json.Unmarshal(scanner.Bytes(), &item); err != nil {
+			t.Fatalf("decode jsonl line %q: %v", scanner.Text(), err)
+		}
+		items = append(items, item)
+	}
+	if len(items) != 2 {
+		t.Fatalf("expected two jsonl items, got %+v", items)
+	}
+	for _, item := range items {
+		if item.Tenant == "acme" && (item.Total != 101.6 || item.CPUCoreHours != 20) {
+			t.Fatalf("unexpected jsonl item: %+v", item)
+		}
+	}
+}
+
+func TestBillingExportKeepsDeletedTenants(t *testing.T) {
+	t.Setenv("KUBENOVA_REQUIRE_AUTH", "false")
+
+	srv := newTestServer(t)
+	st := srv.store
+	ctx := context.Background()
+
+	if err := st.CreatePlan(ctx, &types.Plan{Name: "gold", Pricing: &types.PlanPricing{Currency: "EUR", MonthlyBase: 10, CPUCoreHour: 1}}); err != nil {
+		t.Fatalf("create plan: %v", err)
+	}
+	cluster := &types.Cluster{Name: "billing"}
+	if err := st.CreateCluster(ctx, cluster); err != nil {
+		t.Fatalf("create cluster: %v", err)
+	}
+	tenant := &types.Tenant{ClusterID: cluster.ID, Name: "gone", Plan: "gold"}
+	if err := st.CreateTenant(ctx, tenant); err != nil {
+		t.Fatalf("create tenant: %v", err)
+	}
+	now := time.Now().UTC()
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		if err := st.RecordUsage(ctx, &types.UsageRecord{
+			ClusterID:      cluster.ID,
+			TenantID:       tenant.ID,
+			Tenant:         tenant.Name,
+			Plan:           tenant.Plan,
+			CPURequests:    "2",
+			LastReportedAt: month.Add(time.Duration(i) * time.Hour),
+		}); err != nil {
+			t.Fatalf("record usage: %v", err)
+		}
+	}
+	if err := st.DeleteTenant(ctx, cluster.ID, tenant.ID); err != nil {
+		t.Fatalf("delete tenant: %v", err)
+	}
+
+	resp := doRequest(t, srv.client, http.MethodGet, srv.baseURL+"/billing/exports?period="+month.Format("2006-01")+"&format=jsonl", nil)
+	defer resp.Body.Close()
+	var item types.BillingLineItem
+	if err := json.NewDecoder(resp.Body).Decode(&item); err != nil {
+		t.Fatalf("decode line item: %v", err)
+	}
+	if item.TenantID != tenant.ID || item.Tenant != "gone" || item.Plan != "gold" || item.HoursReported != 3 || item.Total != 16 {
+		t.Fatalf("expected the deleted tenant to be billed, got %+v", item)
+	}
+}
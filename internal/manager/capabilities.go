@@ -0,0 +1,229 @@
+package manager
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/vaheed/kubenova/internal/store"
+	"github.com/vaheed/kubenova/pkg/types"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// API groups and versions the manager looks for on a cluster. Capsule and
+// KubeVela are required at the versions the manager writes.
+const (
+	capsuleGroup        = "capsule.clastix.io"
+	capsuleGroupVersion = "capsule.clastix.io/v1beta2"
+	velaGroup           = "core.oam.dev"
+	velaGroupVersion    = "core.oam.dev/v1beta1"
+	gatewayAPIGroup     = "gateway.networking.k8s.io"
+	certManagerGroup    = "cert-manager.io"
+
+	discoveryTimeout    = 10 * time.Second
+	capsuleProxyTimeout = 5 * time.Second
+)
+
+// discoveryFactory builds a discovery client from a kubeconfig.
+type discoveryFactory func(ctx context.Context, kubeconfig string) (discovery.DiscoveryInterface, error)
+
+func defaultDiscoveryFactory(ctx context.Context, kubeconfig string) (discovery.DiscoveryInterface, error) {
+	cfg, err := clientcmd.RESTConfigFromKubeConfig([]byte(kubeconfig))
+	if err != nil {
+		return nil, fmt.Errorf("build rest config: %w", err)
+	}
+	// Discovery calls take no context; the timeout bounds them instead.
+	cfg.Timeout = discoveryTimeout
+	return discovery.NewDiscoveryClientForConfig(cfg)
+}
+
+func (s *Server) discoveryForCluster(ctx context.Context, c *types.Cluster) (discovery.DiscoveryInterface, error) {
+	if c == nil {
+		return nil, errors.New("cluster is nil")
+	}
+	if c.Kubeconfig == "" {
+		return nil, errors.New("kubeconfig missing")
+	}
+	if s.discoveryFactory == nil {
+		s.discoveryFactory = defaultDiscoveryFactory
+	}
+	return s.discoveryFactory(ctx, c.Kubeconfig)
+}
+
+// discoverCapabilities asks the cluster's discovery API which of the APIs
+// the manager works with it serves, and checks its Capsule Proxy.
+func (s *Server) discoverCapabilities(ctx context.Context, c *types.Cluster) (types.Capabilities, error) {
+	var caps types.Capabilities
+	dc, err := s.discoveryForCluster(ctx, c)
+	if err != nil {
+		return caps, err
+	}
+	groups, err := dc.ServerGroups()
+	if err != nil {
+		return caps, fmt.Errorf("discover API groups: %w", err)
+	}
+	preferred := map[string]string{}
+	for _, g := range groups.Groups {
+		preferred[g.Name] = g.PreferredVersion.Version
+	}
+	if caps.CapsuleVersion = preferred[capsuleGroup]; caps.CapsuleVersion != "" {
+		if caps.Capsule, err = servesResources(dc, capsuleGroupVersion, "tenants"); err != nil {
+			return caps, err
+		}
+	}
+	if caps.KubeVelaVersion = preferred[velaGroup]; caps.KubeVelaVersion != "" {
+		if caps.KubeVela, err = servesResources(dc, velaGroupVersion, "applications", "projects"); err != nil {
+			return caps, err
+		}
+	}
+	caps.GatewayAPIVersion = preferred[gatewayAPIGroup]
+	caps.GatewayAPI = caps.GatewayAPIVersion != ""
+	caps.CertManagerVersion = preferred[certManagerGroup]
+	caps.CertManager = caps.CertManagerVersion != ""
+	caps.CapsuleProxy = s.capsuleProxyReachable(ctx, c.CapsuleProxyEndpoint)
+	now := time.Now().UTC()
+	caps.DiscoveredAt = &now
+	return caps, nil
+}
+
+// servesResources reports whether the group version serves every one of the
+// resources.
+func servesResources(dc discovery.DiscoveryInterface, groupVersion string, resources ...string) (bool, error) {
+	list, err := dc.ServerResourcesForGroupVersion(groupVersion)
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("discover %s: %w", groupVersion, err)
+	}
+	served := map[string]bool{}
+	for _, r := range list.APIResources {
+		served[r.Name] = true
+	}
+	for _, r := range resources {
+		if !served[r] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// capsuleProxyReachable reports whether anything answers at the endpoint.
+// Capsule Proxy refuses anonymous requests and often serves a certificate of
+// a private CA, so an HTTP error or an untrusted certificate still counts.
+func (s *Server) capsuleProxyReachable(ctx context.Context, endpoint string) bool {
+	endpoint = strings.TrimSpace(endpoint)
+	if endpoint == "" {
+		return false
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return false
+	}
+	resp, err := s.proxyClient.Do(req)
+	if err != nil {
+		var unverified *tls.CertificateVerificationError
+		return errors.As(err, &unverified)
+	}
+	resp.Body.Close()
+	return true
+}
+
+// refreshCapabilities discovers the capabilities of c and stores them. c is
+// refreshed in place.
+func (s *Server) refreshCapabilities(ctx context.Context, c *types.Cluster) error {
+	caps, err := s.discoverCapabilities(ctx, c)
+	if err != nil {
+		return err
+	}
+	return s.storeCapabilities(ctx, c, caps)
+}
+
+func (s *Server) storeCapabilities(ctx context.Context, c *types.Cluster, caps types.Capabilities) error {
+	_, err := s.mutateCluster(ctx, c, func(c *types.Cluster) bool {
+		c.Capabilities = caps
+		return true
+	})
+	return err
+}
+
+// describeCapabilities summarizes caps for operation logs.
+func describeCapabilities(caps types.Capabilities) string {
+	var parts []string
+	add := func(name string, ok bool, version string) {
+		switch {
+		case ok && version != "":
+			parts = append(parts, name+" "+version)
+		case ok:
+			parts = append(parts, name)
+		}
+	}
+	add("capsule", caps.Capsule, caps.CapsuleVersion)
+	add("capsule-proxy", caps.CapsuleProxy, "")
+	add("kubevela", caps.KubeVela, caps.KubeVelaVersion)
+	add("gateway-api", caps.GatewayAPI, caps.GatewayAPIVersion)
+	add("cert-manager", caps.CertManager, caps.CertManagerVersion)
+	if len(parts) == 0 {
+		return "none"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// requireCapability writes a 409 and returns false when discovery found that
+// the cluster lacks what the request needs. Clusters whose capabilities were
+// never discovered are let through, and fail on the cluster instead.
+func requireCapability(w http.ResponseWriter, c *types.Cluster, capability string) bool {
+	caps := c.Capabilities
+	if caps.DiscoveredAt == nil {
+		return true
+	}
+	var ok bool
+	var api, component string
+	switch capability {
+	case "capsule":
+		ok, api, component = caps.Capsule, capsuleGroupVersion+" Tenants", "capsule"
+	case "kubeVela":
+		ok, api, component = caps.KubeVela, velaGroupVersion+" Applications and Projects", "kubevela"
+	}
+	if ok {
+		return true
+	}
+	writeError(w, http.StatusConflict, "KN-409", fmt.Sprintf(
+		"cluster %s does not serve %s; install %s with POST /api/v1/clusters/%s/bootstrap/%s, then retry",
+		c.Name, api, component, c.ID, component))
+	return false
+}
+
+// refreshClusterCapabilities discovers the capabilities of a cluster again,
+// without reinstalling anything.
+func (s *Server) refreshClusterCapabilities(w http.ResponseWriter, r *http.Request) {
+	if !s.requireRole(w, r, "admin", "ops") {
+		return
+	}
+	c, err := s.store.GetCluster(r.Context(), chi.URLParam(r, "clusterID"))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "KN-404", "cluster not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return
+	}
+	caps, err := s.discoverCapabilities(r.Context(), c)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "KN-500", fmt.Sprintf("discover capabilities: %v", err))
+		return
+	}
+	if err := s.storeCapabilities(r.Context(), c, caps); err != nil {
+		writeUpdateError(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, c.Capabilities)
+}
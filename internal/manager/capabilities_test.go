@@ -0,0 +1,144 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/vaheed/kubenova/internal/store"
+	"github.com/vaheed/kubenova/pkg/types"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeversion "k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/discovery"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+// fakeDiscovery serves the given API resources and server version.
+func fakeDiscovery(gitVersion string, resources ...*metav1.APIResourceList) *fakediscovery.FakeDiscovery {
+	return &fakediscovery.FakeDiscovery{
+		Fake:               &clienttesting.Fake{Resources: resources},
+		FakedServerVersion: &kubeversion.Info{GitVersion: gitVersion},
+	}
+}
+
+func apiResources(groupVersion string, names ...string) *metav1.APIResourceList {
+	list := &metav1.APIResourceList{GroupVersion: groupVersion}
+	for _, name := range names {
+		list.APIResources = append(list.APIResources, metav1.APIResource{Name: name})
+	}
+	return list
+}
+
+// postError posts body and returns the status and error message.
+func postError(t *testing.T, client *http.Client, url string, body any) (int, string) {
+	t.Helper()
+	resp := doRequest(t, client, http.MethodPost, url, body)
+	defer resp.Body.Close()
+	var out struct {
+		Message string `json:"message"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&out)
+	return resp.StatusCode, out.Message
+}
+
+func TestCapabilityDiscovery(t *testing.T) {
+	t.Setenv("KUBENOVA_REQUIRE_AUTH", "false")
+
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}))
+	defer proxy.Close()
+	gone := httptest.NewServer(http.NotFoundHandler())
+	gone.Close()
+
+	var (
+		mu        sync.Mutex
+		resources = []*metav1.APIResourceList{
+			apiResources("v1", "namespaces"),
+			apiResources(capsuleGroupVersion, "tenants"),
+			apiResources("gateway.networking.k8s.io/v1", "gateways", "httproutes"),
+		}
+	)
+	srv := newTestServer(t)
+	st, client, baseURL := srv.store, srv.client, srv.baseURL
+	srv.discoveryFactory = func(context.Context, string) (discovery.DiscoveryInterface, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return fakeDiscovery("v1.31.2", resources...), nil
+	}
+	srv.installComponent = func(context.Context, *types.Cluster, string) error {
+		// Installing KubeVela makes its APIs appear.
+		mu.Lock()
+		defer mu.Unlock()
+		resources = append(resources, apiResources(velaGroupVersion, "applications", "projects"))
+		return nil
+	}
+	ctx := context.Background()
+
+	c := &types.Cluster{Name: "edge", Kubeconfig: fakeKubeconfig, Status: types.ClusterConnected, CapsuleProxyEndpoint: proxy.URL}
+	if err := st.CreateCluster(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	clusterURL := baseURL + "/clusters/" + c.ID
+
+	// Clusters whose capabilities were never discovered are not held back.
+	if caps := doJSON[types.Capabilities](t, client, http.MethodGet, clusterURL+"/capabilities", nil, http.StatusOK); caps.DiscoveredAt != nil {
+		t.Fatalf("expected undiscovered capabilities, got %+v", caps)
+	}
+
+	caps := doJSON[types.Capabilities](t, client, http.MethodPost, clusterURL+"/capabilities/refresh", nil, http.StatusOK)
+	if !caps.Capsule || caps.CapsuleVersion != "v1beta2" || !caps.CapsuleProxy || caps.KubeVela ||
+		!caps.GatewayAPI || caps.GatewayAPIVersion != "v1" || caps.CertManager || caps.DiscoveredAt == nil {
+		t.Fatalf("unexpected capabilities %+v", caps)
+	}
+	if got := doJSON[types.Capabilities](t, client, http.MethodGet, clusterURL+"/capabilities", nil, http.StatusOK); got.CapsuleVersion != "v1beta2" {
+		t.Fatalf("expected the capabilities to be stored, got %+v", got)
+	}
+
+	tenant := doJSON[*types.Tenant](t, client, http.MethodPost, clusterURL+"/tenants", map[string]any{"name": "acme"}, http.StatusCreated)
+	project := doJSON[*types.Project](t, client, http.MethodPost, clusterURL+"/tenants/"+tenant.ID+"/projects", map[string]any{"name": "web"}, http.StatusCreated)
+	appsURL := fmt.Sprintf("%s/tenants/%s/projects/%s/apps", clusterURL, tenant.ID, project.ID)
+	app := map[string]any{"name": "api", "spec": map[string]any{"type": "webservice"}}
+	if status, msg := postError(t, client, appsURL, app); status != http.StatusConflict || !strings.Contains(msg, velaGroupVersion) || !strings.Contains(msg, "/bootstrap/kubevela") {
+		t.Fatalf("expected a 409 naming the missing KubeVela APIs, got %d %s", status, msg)
+	}
+
+	// A bootstrap discovers the capabilities again once it succeeded.
+	op := doJSON[*types.Operation](t, client, http.MethodPost, clusterURL+"/bootstrap/kubevela", nil, http.StatusAccepted)
+	op = waitOperation(t, client, baseURL+"/operations/"+op.ID)
+	if op.Phase != types.OperationSucceeded || !strings.Contains(op.Logs[len(op.Logs)-2].Message, "kubevela v1beta1") {
+		t.Fatalf("expected the operation to log the discovered capabilities, got %+v", op.Logs)
+	}
+	if got := doJSON[*types.Cluster](t, client, http.MethodGet, clusterURL, nil, http.StatusOK); !got.Capabilities.KubeVela || got.Capabilities.KubeVelaVersion != "v1beta1" {
+		t.Fatalf("expected KubeVela after the bootstrap, got %+v", got.Capabilities)
+	}
+	doJSON[*types.App](t, client, http.MethodPost, appsURL, app, http.StatusCreated)
+
+	// Capsule gone and the proxy down: tenants are refused up front.
+	mu.Lock()
+	resources = resources[:1]
+	mu.Unlock()
+	stored, _ := st.GetCluster(ctx, c.ID)
+	stored.CapsuleProxyEndpoint = gone.URL
+	if err := st.UpdateCluster(ctx, stored); err != nil {
+		t.Fatal(err)
+	}
+	caps = doJSON[types.Capabilities](t, client, http.MethodPost, clusterURL+"/capabilities/refresh", nil, http.StatusOK)
+	if caps.Capsule || caps.CapsuleProxy || caps.KubeVela || caps.GatewayAPI {
+		t.Fatalf("expected nothing but core APIs, got %+v", caps)
+	}
+	if status, msg := postError(t, client, clusterURL+"/tenants", map[string]any{"name": "globex"}); status != http.StatusConflict || !strings.Contains(msg, capsuleGroupVersion) {
+		t.Fatalf("expected a 409 naming the missing Capsule API, got %d %s", status, msg)
+	}
+	if tenants, _, _ := st.ListTenants(ctx, c.ID, store.ListOptions{}); len(tenants) != 1 {
+		t.Fatalf("expected the refused tenant not to be stored, got %d tenants", len(tenants))
+	}
+
+	doJSON[types.Capabilities](t, client, http.MethodPost, baseURL+"/clusters/missing/capabilities/refresh", nil, http.StatusNotFound)
+}
@@ -0,0 +1,110 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/vaheed/kubenova/internal/store"
+	"github.com/vaheed/kubenova/pkg/types"
+)
+
+func TestResourceVersionsAndIfMatch(t *testing.T) {
+	t.Setenv("KUBENOVA_REQUIRE_AUTH", "false")
+
+	srv := newTestServer(t)
+	st, client, baseURL := srv.store, srv.client, srv.baseURL
+	ctx := context.Background()
+
+	cluster := &types.Cluster{Name: "versions", Kubeconfig: "fake"}
+	if err := st.CreateCluster(ctx, cluster); err != nil {
+		t.Fatalf("create cluster: %v", err)
+	}
+	tenant := doJSON[*types.Tenant](t, client, http.MethodPost,
+		fmt.Sprintf("%s/clusters/%s/tenants", baseURL, cluster.ID), map[string]any{"name": "acme"}, http.StatusCreated)
+	tenantURL := fmt.Sprintf("%s/clusters/%s/tenants/%s", baseURL, cluster.ID, tenant.ID)
+
+	get := func() (string, *types.Tenant) {
+		t.Helper()
+		resp := doRequest(t, client, http.MethodGet, tenantURL, nil)
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("get tenant: status %d", resp.StatusCode)
+		}
+		cur, err := st.GetTenant(ctx, cluster.ID, tenant.ID)
+		if err != nil {
+			t.Fatalf("read tenant: %v", err)
+		}
+		return resp.Header.Get("ETag"), cur
+	}
+	putQuotas := func(ifMatch string, quotas map[string]string) int {
+		t.Helper()
+		raw, _ := json.Marshal(quotas)
+		req, _ := http.NewRequest(http.MethodPut, tenantURL+"/quotas", bytes.NewReader(raw))
+		req.Header.Set("Content-Type", "application/json")
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("put quotas: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	tag, cur := get()
+	if tag != etag(cur.ResourceVersion) || cur.ResourceVersion != 1 {
+		t.Fatalf("expected ETag for version 1, got %q (version %d)", tag, cur.ResourceVersion)
+	}
+
+	if code := putQuotas(tag, map[string]string{"cpu": "2"}); code != http.StatusOK {
+		t.Fatalf("expected matching If-Match to succeed, got %d", code)
+	}
+	newTag, cur := get()
+	if newTag == tag || cur.ResourceVersion != 2 {
+		t.Fatalf("expected version to advance, got %q (version %d)", newTag, cur.ResourceVersion)
+	}
+
+	// A writer still holding the old ETag must not overwrite the new quotas.
+	if code := putQuotas(tag, map[string]string{"cpu": "1"}); code != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 for stale If-Match, got %d", code)
+	}
+	if _, cur = get(); cur.Quotas["cpu"] != "2" {
+		t.Fatalf("stale write was applied: %+v", cur.Quotas)
+	}
+	// If-Match compares strongly, so a weak tag for the current version fails.
+	if code := putQuotas("W/"+newTag, map[string]string{"cpu": "3"}); code != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 for weak If-Match, got %d", code)
+	}
+	if code := putQuotas("*", map[string]string{"cpu": "4"}); code != http.StatusOK {
+		t.Fatalf("expected wildcard If-Match to succeed, got %d", code)
+	}
+
+	// Two copies read at the same version: only the first write may land.
+	a, _ := st.GetTenant(ctx, cluster.ID, tenant.ID)
+	b, _ := st.GetTenant(ctx, cluster.ID, tenant.ID)
+	a.Owners = []string{"alice"}
+	if err := st.UpdateTenant(ctx, a); err != nil {
+		t.Fatalf("first update: %v", err)
+	}
+	b.Owners = []string{"bob"}
+	if err := st.UpdateTenant(ctx, b); !errors.Is(err, store.ErrVersionConflict) {
+		t.Fatalf("expected version conflict for stale update, got %v", err)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, tenantURL, nil)
+	req.Header.Set("If-Match", `"1"`)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("delete tenant: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusPreconditionFailed {
+		t.Fatalf("expected 412 for stale delete, got %d", resp.StatusCode)
+	}
+}
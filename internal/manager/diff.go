@@ -0,0 +1,206 @@
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/vaheed/kubenova/pkg/types"
+	"sigs.k8s.io/yaml"
+)
+
+// PatchOp is one RFC 6902 JSON Patch operation.
+type PatchOp struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	Value any    `json:"value"`
+}
+
+// MarshalJSON leaves out value only for remove. add, replace and test require
+// it even when the new value is null, false, zero or empty.
+func (o PatchOp) MarshalJSON() ([]byte, error) {
+	if o.Op == "remove" {
+		return json.Marshal(struct {
+			Op   string `json:"op"`
+			Path string `json:"path"`
+		}{o.Op, o.Path})
+	}
+	type patchOp PatchOp
+	return json.Marshal(patchOp(o))
+}
+
+// FieldChange is a changed leaf or subtree in dotted form, e.g.
+// "spec.properties.image" or "traits[0].properties.max".
+type FieldChange struct {
+	Path string `json:"path"`
+	Op   string `json:"op"`
+	Old  any    `json:"old,omitempty"`
+	New  any    `json:"new,omitempty"`
+}
+
+// RevisionDiff compares the configuration of two app revisions.
+type RevisionDiff struct {
+	From    int           `json:"from"`
+	To      int           `json:"to"`
+	Summary string        `json:"summary"`
+	Patch   []PatchOp     `json:"patch"`
+	Changes []FieldChange `json:"changes"`
+	Unified string        `json:"unified,omitempty"`
+}
+
+// revisionDoc is the part of a revision the diff covers.
+type revisionDoc struct {
+	Spec     map[string]any   `json:"spec,omitempty"`
+	Traits   []map[string]any `json:"traits,omitempty"`
+	Policies []map[string]any `json:"policies,omitempty"`
+}
+
+func diffRevisions(a, b *types.AppRevision, unified bool) (*RevisionDiff, error) {
+	from, err := revisionValue(a)
+	if err != nil {
+		return nil, err
+	}
+	to, err := revisionValue(b)
+	if err != nil {
+		return nil, err
+	}
+	d := &RevisionDiff{From: a.Number, To: b.Number, Patch: []PatchOp{}, Changes: []FieldChange{}}
+	diffValues(d, nil, from, to)
+	switch len(d.Changes) {
+	case 0:
+		d.Summary = fmt.Sprintf("no changes between revision %d and %d", a.Number, b.Number)
+	case 1:
+		d.Summary = fmt.Sprintf("1 change between revision %d and %d", a.Number, b.Number)
+	default:
+		d.Summary = fmt.Sprintf("%d changes between revision %d and %d", len(d.Changes), a.Number, b.Number)
+	}
+	if unified {
+		if d.Unified, err = unifiedYAML(a, b); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// revisionValue renders a revision as generic JSON values so that numbers and
+// nested types compare the same way regardless of how they were decoded.
+func revisionValue(rev *types.AppRevision) (any, error) {
+	raw, err := json.Marshal(revisionDoc{Spec: rev.Spec, Traits: rev.Traits, Policies: rev.Policies})
+	if err != nil {
+		return nil, err
+	}
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// diffValues appends the operations turning a into b. Array elements are
+// compared by index; surplus elements are removed from the end first so that
+// the patch applies in order.
+func diffValues(d *RevisionDiff, path []string, a, b any) {
+	switch av := a.(type) {
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(av)+len(bv))
+		for k := range av {
+			keys = append(keys, k)
+		}
+		for k := range bv {
+			if _, ok := av[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := append(path[:len(path):len(path)], k)
+			old, inA := av[k]
+			val, inB := bv[k]
+			switch {
+			case !inB:
+				d.add("remove", child, old, nil)
+			case !inA:
+				d.add("add", child, nil, val)
+			default:
+				diffValues(d, child, old, val)
+			}
+		}
+		return
+	case []any:
+		bv, ok := b.([]any)
+		if !ok {
+			break
+		}
+		n := min(len(av), len(bv))
+		for i := 0; i < n; i++ {
+			diffValues(d, append(path[:len(path):len(path)], strconv.Itoa(i)), av[i], bv[i])
+		}
+		for i := len(av) - 1; i >= n; i-- {
+			d.add("remove", append(path[:len(path):len(path)], strconv.Itoa(i)), av[i], nil)
+		}
+		for i := n; i < len(bv); i++ {
+			d.add("add", append(path[:len(path):len(path)], strconv.Itoa(i)), nil, bv[i])
+		}
+		return
+	}
+	if !reflect.DeepEqual(a, b) {
+		d.add("replace", path, a, b)
+	}
+}
+
+func (d *RevisionDiff) add(op string, path []string, old, val any) {
+	d.Patch = append(d.Patch, PatchOp{Op: op, Path: jsonPointer(path), Value: val})
+	d.Changes = append(d.Changes, FieldChange{Path: dottedPath(path), Op: op, Old: old, New: val})
+}
+
+func jsonPointer(path []string) string {
+	var b strings.Builder
+	for _, p := range path {
+		b.WriteByte('/')
+		b.WriteString(strings.ReplaceAll(strings.ReplaceAll(p, "~", "~0"), "/", "~1"))
+	}
+	return b.String()
+}
+
+// dottedPath renders a path the way reviewers read it: map keys joined by
+// dots and array indexes in brackets.
+func dottedPath(path []string) string {
+	var b strings.Builder
+	for i, p := range path {
+		if _, err := strconv.Atoi(p); err == nil && i > 0 {
+			b.WriteString("[" + p + "]")
+			continue
+		}
+		if i > 0 {
+			b.WriteByte('.')
+		}
+		b.WriteString(p)
+	}
+	return b.String()
+}
+
+func unifiedYAML(a, b *types.AppRevision) (string, error) {
+	from, err := yaml.Marshal(revisionDoc{Spec: a.Spec, Traits: a.Traits, Policies: a.Policies})
+	if err != nil {
+		return "", err
+	}
+	to, err := yaml.Marshal(revisionDoc{Spec: b.Spec, Traits: b.Traits, Policies: b.Policies})
+	if err != nil {
+		return "", err
+	}
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(from)),
+		B:        difflib.SplitLines(string(to)),
+		FromFile: fmt.Sprintf("revision-%d.yaml", a.Number),
+		ToFile:   fmt.Sprintf("revision-%d.yaml", b.Number),
+		Context:  3,
+	})
+}
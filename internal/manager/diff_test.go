@@ -0,0 +1,98 @@
+package manager
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/vaheed/kubenova/pkg/types"
+)
+
+func TestDiffRevisions(t *testing.T) {
+	a := &types.AppRevision{
+		Number: 1,
+		Spec: map[string]any{
+			"type":       "webservice",
+			"properties": map[string]any{"image": "api:v1", "port": 8080, "env/name": "a"},
+		},
+		Traits: []map[string]any{
+			{"type": "scaler", "properties": map[string]any{"min": 1, "max": 3}},
+			{"type": "gateway"},
+		},
+	}
+	b := &types.AppRevision{
+		Number: 3,
+		Spec: map[string]any{
+			"type":       "webservice",
+			"properties": map[string]any{"image": "api:v2", "port": 8080.0, "cpu": "500m"},
+		},
+		Traits: []map[string]any{
+			{"type": "scaler", "properties": map[string]any{"min": 1, "max": 5}},
+		},
+		Policies: []map[string]any{{"type": "topology"}},
+	}
+
+	d, err := diffRevisions(a, b, true)
+	if err != nil {
+		t.Fatalf("diff: %v", err)
+	}
+	patch, _ := json.Marshal(d.Patch)
+	want := `[{"op":"add","path":"/policies","value":[{"type":"topology"}]},` +
+		`{"op":"add","path":"/spec/properties/cpu","value":"500m"},` +
+		`{"op":"remove","path":"/spec/properties/env~1name"},` +
+		`{"op":"replace","path":"/spec/properties/image","value":"api:v2"},` +
+		`{"op":"replace","path":"/traits/0/properties/max","value":5},` +
+		`{"op":"remove","path":"/traits/1"}]`
+	if string(patch) != want {
+		t.Fatalf("unexpected patch:\n%s\nwant:\n%s", patch, want)
+	}
+	var paths []string
+	for _, c := range d.Changes {
+		paths = append(paths, c.Path)
+	}
+	if strings.Join(paths, " ") != "policies spec.properties.cpu spec.properties.env/name spec.properties.image traits[0].properties.max traits[1]" {
+		t.Fatalf("unexpected changed paths: %v", paths)
+	}
+	if d.Changes[3].Old != "api:v1" || d.Changes[3].New != "api:v2" {
+		t.Fatalf("expected old and new image, got %+v", d.Changes[3])
+	}
+	if d.Summary != "6 changes between revision 1 and 3" {
+		t.Fatalf("unexpected summary %q", d.Summary)
+	}
+	for _, want := range []string{"--- revision-1.yaml", "+++ revision-3.yaml", "-    image: api:v1", "+    image: api:v2"} {
+		if !strings.Contains(d.Unified, want) {
+			t.Fatalf("unified diff missing %q:\n%s", want, d.Unified)
+		}
+	}
+
+	off := &types.AppRevision{Number: 4, Spec: map[string]any{
+		"type":       "webservice",
+		"properties": map[string]any{"image": "", "port": 0, "env/name": nil, "cpu": false},
+	}}
+	d, err = diffRevisions(a, off, false)
+	if err != nil {
+		t.Fatalf("diff: %v", err)
+	}
+	valued := 0
+	for _, op := range d.Patch {
+		if op.Op != "add" && op.Op != "replace" {
+			continue
+		}
+		valued++
+		raw, _ := json.Marshal(op)
+		if !strings.Contains(string(raw), `"value":`) {
+			t.Fatalf("expected %s to carry a value: %s", op.Op, raw)
+		}
+	}
+	if valued != 4 {
+		t.Fatalf("expected four zero-valued operations, got %+v", d.Patch)
+	}
+
+	same, err := diffRevisions(a, a, false)
+	if err != nil {
+		t.Fatalf("diff: %v", err)
+	}
+	if len(same.Patch) != 0 || same.Unified != "" || same.Summary != "no changes between revision 1 and 1" {
+		t.Fatalf("expected an empty diff, got %+v", same)
+	}
+}
@@ -22,22 +22,11 @@ import (
 
 func TestManagerEndToEndLifecycle(t *testing.T) {
 	t.Setenv("KUBENOVA_REQUIRE_AUTH", "false")
+	t.Setenv("CLUSTER_PREFLIGHT", "false")
 	t.Setenv("JWT_SIGNING_KEY", "unused")
 
-	st := store.NewMemoryStore()
-	srv := NewServer(st)
-	scheme := runtime.NewScheme()
-	_ = clientgoscheme.AddToScheme(scheme)
-	_ = v1alpha1.AddToScheme(scheme)
-	fakeClient := fake.NewClientBuilder().WithScheme(scheme).Build()
-	srv.kubeFactory = func(context.Context, string) (ctrlclient.Client, error) {
-		return fakeClient, nil
-	}
-	ts := httptest.NewServer(srv.Router())
-	defer ts.Close()
-
-	client := ts.Client()
-	baseURL := ts.URL + "/api/v1"
+	srv := newTestServer(t)
+	client, baseURL := srv.client, srv.baseURL
 
 	cluster := doJSON[*types.Cluster](t, client, http.MethodPost, baseURL+"/clusters", map[string]any{
 		"name":       "dev-cluster",
@@ -59,6 +48,11 @@ func TestManagerEndToEndLifecycle(t *testing.T) {
 		t.Fatalf("expected 1 cluster, got %d", len(clusters))
 	}
 
+	_ = doJSON[*types.Plan](t, client, http.MethodPost, baseURL+"/plans", map[string]any{
+		"name":   "gold",
+		"quotas": map[string]string{"cpu": "2", "memory": "8Gi"},
+	}, http.StatusCreated)
+
 	tenant := doJSON[*types.Tenant](t, client, http.MethodPost,
 		fmt.Sprintf("%s/clusters/%s/tenants", baseURL, cluster.ID), map[string]any{
 			"name":   "acme",
@@ -225,6 +219,41 @@ func TestManagerEndToEndLifecycle(t *testing.T) {
 		nil, http.StatusNoContent)
 }
 
+// testServer is a manager on a memory store served over HTTP, whose clusters
+// all share one fake client.
+type testServer struct {
+	*Server
+	kube    ctrlclient.WithWatch
+	scheme  *runtime.Scheme
+	client  *http.Client
+	url     string
+	baseURL string
+}
+
+// newTestServer starts a manager whose clusters all share a fake client
+// holding objs. Its fields may be replaced before the first request.
+func newTestServer(t *testing.T, objs ...ctrlclient.Object) *testServer {
+	t.Helper()
+	scheme := runtime.NewScheme()
+	_ = clientgoscheme.AddToScheme(scheme)
+	_ = v1alpha1.AddToScheme(scheme)
+	kube := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).Build()
+	srv := NewServer(store.NewMemoryStore())
+	srv.kubeFactory = func(context.Context, string) (ctrlclient.Client, error) {
+		return kube, nil
+	}
+	ts := httptest.NewServer(srv.Router())
+	t.Cleanup(ts.Close)
+	return &testServer{
+		Server:  srv,
+		kube:    kube,
+		scheme:  scheme,
+		client:  ts.Client(),
+		url:     ts.URL,
+		baseURL: ts.URL + "/api/v1",
+	}
+}
+
 const fakeKubeconfig = `
 apiVersion: v1
 kind: Config
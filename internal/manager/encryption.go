@@ -0,0 +1,46 @@
+package manager
+
+import (
+	"net/http"
+
+	"github.com/vaheed/kubenova/internal/store"
+)
+
+// getEncryption reports which master keys the stored secrets are encrypted
+// under, so a key rotation can be followed.
+func (s *Server) getEncryption(w http.ResponseWriter, r *http.Request) {
+	if !s.requireRole(w, r, "admin") && s.requireAuth {
+		return
+	}
+	enc, ok := s.store.(store.SecretEncryption)
+	if !ok {
+		writeJSON(w, http.StatusOK, &store.EncryptionStatus{})
+		return
+	}
+	status, err := enc.EncryptionStatus(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// rewrapEncryption moves every stored secret to the primary master key. It
+// is run after ENCRYPTION_KEY_ID names a new key; the old key can be removed
+// from ENCRYPTION_KEYS once no secret is left under it.
+func (s *Server) rewrapEncryption(w http.ResponseWriter, r *http.Request) {
+	if !s.requireRole(w, r, "admin") {
+		return
+	}
+	enc, ok := s.store.(store.SecretEncryption)
+	if !ok {
+		writeError(w, http.StatusConflict, "KN-409", "encryption at rest is not configured")
+		return
+	}
+	status, err := enc.RewrapSecrets(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
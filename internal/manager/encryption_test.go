@@ -0,0 +1,115 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/vaheed/kubenova/internal/security"
+	"github.com/vaheed/kubenova/internal/store"
+	"github.com/vaheed/kubenova/pkg/types"
+)
+
+func TestKubeconfigEncryption(t *testing.T) {
+	t.Setenv("KUBENOVA_REQUIRE_AUTH", "false")
+	t.Setenv("CLUSTER_PREFLIGHT", "false")
+	ctx := context.Background()
+	key := func(b byte) string { return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32)) }
+	keyring := func(spec, primary string) *security.Keyring {
+		kr, err := security.ParseKeyring(spec, primary)
+		if err != nil {
+			t.Fatalf("parse keyring: %v", err)
+		}
+		return kr
+	}
+
+	raw := store.NewMemoryStore()
+	legacy := &types.Cluster{Name: "legacy", Kubeconfig: "legacy-kubeconfig"}
+	if err := raw.CreateCluster(ctx, legacy); err != nil {
+		t.Fatalf("create legacy cluster: %v", err)
+	}
+	enc := store.NewEncryptedStore(raw, keyring("k1="+key(1), ""))
+	east := &types.Cluster{Name: "east", Kubeconfig: "east-kubeconfig"}
+	if err := enc.CreateCluster(ctx, east); err != nil {
+		t.Fatalf("create cluster: %v", err)
+	}
+	if east.Kubeconfig != "east-kubeconfig" || east.ID == "" {
+		t.Fatalf("expected the caller's cluster to keep its kubeconfig, got %+v", east)
+	}
+	stored, _ := raw.GetCluster(ctx, east.ID)
+	if !security.IsEnvelope(stored.Kubeconfig) || strings.Contains(stored.Kubeconfig, "east-kubeconfig") {
+		t.Fatalf("expected the kubeconfig to be stored encrypted, got %q", stored.Kubeconfig)
+	}
+	clusters, _, err := enc.ListClusters(ctx, store.ListOptions{})
+	if err != nil || len(clusters) != 2 {
+		t.Fatalf("list clusters: %d %v", len(clusters), err)
+	}
+	for _, c := range clusters {
+		if c.Kubeconfig != c.Name+"-kubeconfig" {
+			t.Fatalf("expected %s to read back in plaintext, got %q", c.Name, c.Kubeconfig)
+		}
+	}
+
+	// An envelope moved to another record does not open.
+	swapped, _ := raw.GetCluster(ctx, legacy.ID)
+	swapped.Kubeconfig = stored.Kubeconfig
+	if err := raw.UpdateCluster(ctx, swapped); err != nil {
+		t.Fatalf("update cluster: %v", err)
+	}
+	if _, err := enc.GetCluster(ctx, legacy.ID); err == nil {
+		t.Fatal("expected the envelope to be bound to its cluster")
+	}
+	// The cluster that does not open is left out of lists.
+	if clusters, _, err := enc.ListClusters(ctx, store.ListOptions{}); err != nil || len(clusters) != 1 || clusters[0].ID != east.ID {
+		t.Fatalf("expected only the cluster that opens to be listed, got %d %v", len(clusters), err)
+	}
+	// Envelopes are not accepted as input.
+	if err := enc.CreateCluster(ctx, &types.Cluster{Name: "copy", Kubeconfig: stored.Kubeconfig}); !errors.Is(err, store.ErrEncryptedInput) {
+		t.Fatalf("expected an envelope passed in to be refused, got %v", err)
+	}
+	swapped.Kubeconfig = "legacy-kubeconfig"
+	if err := raw.UpdateCluster(ctx, swapped); err != nil {
+		t.Fatalf("update cluster: %v", err)
+	}
+
+	// Rotate to k2 and rewrap through the API.
+	srv := NewServer(store.NewEncryptedStore(raw, keyring("k1="+key(1)+",k2="+key(2), "k2")))
+	ts := httptest.NewServer(srv.Router())
+	defer ts.Close()
+	client := ts.Client()
+	status := doJSON[store.EncryptionStatus](t, client, http.MethodGet, ts.URL+"/api/v1/encryption", nil, http.StatusOK)
+	if !status.Enabled || status.KeyID != "k2" || status.Secrets["k1"] != 1 || status.Secrets["plaintext"] != 1 {
+		t.Fatalf("unexpected status before the rewrap: %+v", status)
+	}
+	status = doJSON[store.EncryptionStatus](t, client, http.MethodPost, ts.URL+"/api/v1/encryption:rewrap", nil, http.StatusOK)
+	if status.Rewrapped != 2 || status.Secrets["k2"] != 2 || len(status.Secrets) != 1 {
+		t.Fatalf("unexpected status after the rewrap: %+v", status)
+	}
+	doNoBody(t, client, http.MethodPost, ts.URL+"/api/v1/clusters", map[string]any{
+		"name": "copy", "kubeconfig": stored.Kubeconfig,
+	}, http.StatusBadRequest)
+	if again := doJSON[store.EncryptionStatus](t, client, http.MethodPost, ts.URL+"/api/v1/encryption:rewrap", nil, http.StatusOK); again.Rewrapped != 0 {
+		t.Fatalf("expected nothing left to rewrap, got %+v", again)
+	}
+
+	// k1 can go now.
+	enc = store.NewEncryptedStore(raw, keyring("k2="+key(2), ""))
+	for _, c := range []*types.Cluster{east, legacy} {
+		got, err := enc.GetCluster(ctx, c.ID)
+		if err != nil || got.Kubeconfig != c.Name+"-kubeconfig" {
+			t.Fatalf("expected %s to read back with k2 only, got %+v %v", c.Name, got, err)
+		}
+	}
+
+	plain := httptest.NewServer(NewServer(store.NewMemoryStore()).Router())
+	defer plain.Close()
+	if status := doJSON[store.EncryptionStatus](t, plain.Client(), http.MethodGet, plain.URL+"/api/v1/encryption", nil, http.StatusOK); status.Enabled {
+		t.Fatalf("expected encryption to be off, got %+v", status)
+	}
+	doNoBody(t, plain.Client(), http.MethodPost, plain.URL+"/api/v1/encryption:rewrap", nil, http.StatusConflict)
+}
@@ -0,0 +1,58 @@
+package manager
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/vaheed/kubenova/internal/store"
+)
+
+// etag renders a resource version as a strong entity tag.
+func etag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// checkIfMatch compares the If-Match header with the version the handler just
+// read and writes a 412 when none of the listed tags match. A missing header
+// or "*" matches any version. If-Match uses strong comparison, so a weak
+// "W/" tag never matches.
+func checkIfMatch(w http.ResponseWriter, r *http.Request, version int64) bool {
+	header := strings.TrimSpace(r.Header.Get("If-Match"))
+	if header == "" || header == "*" {
+		return true
+	}
+	want := etag(version)
+	for _, tag := range strings.Split(header, ",") {
+		if strings.TrimSpace(tag) == want {
+			return true
+		}
+	}
+	writeError(w, http.StatusPreconditionFailed, "KN-412", "resource version does not match If-Match")
+	return false
+}
+
+// writeVersioned writes a resource together with its ETag.
+func writeVersioned(w http.ResponseWriter, status int, version int64, v any) {
+	w.Header().Set("ETag", etag(version))
+	writeJSON(w, status, v)
+}
+
+// writeUpdateError reports a failed store update. Losing a race to another
+// writer is a 412 when the client asked for a specific version and a 409 when
+// it did not.
+func writeUpdateError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, store.ErrVersionConflict) && r.Header.Get("If-Match") != "":
+		writeError(w, http.StatusPreconditionFailed, "KN-412", "resource was modified concurrently")
+	case errors.Is(err, store.ErrVersionConflict):
+		writeError(w, http.StatusConflict, "KN-409", "resource was modified concurrently; retry with the latest version")
+	case errors.Is(err, store.ErrNotFound):
+		writeError(w, http.StatusNotFound, "KN-404", "resource not found")
+	case errors.Is(err, store.ErrUnknownPlan):
+		writeError(w, http.StatusUnprocessableEntity, "KN-422", err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+	}
+}
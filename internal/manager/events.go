@@ -0,0 +1,348 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vaheed/kubenova/internal/logging"
+	"github.com/vaheed/kubenova/internal/store"
+	"github.com/vaheed/kubenova/pkg/types"
+	"go.uber.org/zap"
+)
+
+// Event types published on the event stream.
+const (
+	eventClusterCreated         = "cluster.created"
+	eventClusterStatusChanged   = "cluster.status_changed"
+	eventClusterBootstrapFailed = "cluster.bootstrap_failed"
+	eventClusterDeleted         = "cluster.deleted"
+	eventTenantCreated          = "tenant.created"
+	eventTenantUpdated          = "tenant.updated"
+	eventTenantDeleted          = "tenant.deleted"
+	eventProjectCreated         = "project.created"
+	eventProjectUpdated         = "project.updated"
+	eventProjectDeleted         = "project.deleted"
+	eventAppCreated             = "app.created"
+	eventAppUpdated             = "app.updated"
+	eventAppRevisionCreated     = "app.revision_created"
+	eventAppStatusChanged       = "app.status_changed"
+	eventAppDeployed            = "app.deployed"
+	eventAppDeleted             = "app.deleted"
+	eventWorkflowRunStarted     = "workflow_run.started"
+	eventWorkflowRunFinished    = "workflow_run.finished"
+	// Operator telemetry is published as "telemetry.<event>".
+	eventTelemetryPrefix = "telemetry."
+)
+
+const (
+	// eventPollInterval bounds how late events published by other manager
+	// replicas reach a stream; local events wake streams immediately.
+	eventPollInterval          = 2 * time.Second
+	eventHeartbeatInterval     = 15 * time.Second
+	eventRetentionInterval     = time.Hour
+	defaultEventRetentionHours = 24
+	// eventRetentionLease keeps pruning to one manager replica.
+	eventRetentionLease = "event-retention"
+)
+
+// eventReaders lists the roles that may see events about each kind of
+// resource; they match the roles that may read the resource itself.
+var eventReaders = map[string][]string{
+	"cluster":      {"admin", "ops", "readOnly"},
+	"telemetry":    {"admin", "ops", "readOnly"},
+	"tenant":       {"admin", "ops", "tenantOwner", "readOnly"},
+	"project":      {"admin", "ops", "projectDev", "tenantOwner", "readOnly"},
+	"app":          {"admin", "ops", "projectDev", "tenantOwner", "readOnly"},
+	"workflow_run": {"admin", "ops", "projectDev", "tenantOwner", "readOnly"},
+}
+
+// eventHub wakes the streams of this replica when an event is published.
+type eventHub struct {
+	mu   sync.Mutex
+	wake chan struct{}
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{wake: make(chan struct{})}
+}
+
+// wait returns a channel that is closed on the next notify.
+func (h *eventHub) wait() <-chan struct{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.wake
+}
+
+func (h *eventHub) notify() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	close(h.wake)
+	h.wake = make(chan struct{})
+}
+
+// knownEventTypes lists every type except the open-ended telemetry ones.
+var knownEventTypes = []string{
+	eventClusterCreated, eventClusterStatusChanged, eventClusterBootstrapFailed, eventClusterDeleted,
+	eventTenantCreated, eventTenantUpdated, eventTenantDeleted,
+	eventProjectCreated, eventProjectUpdated, eventProjectDeleted,
+	eventAppCreated, eventAppUpdated, eventAppRevisionCreated, eventAppStatusChanged, eventAppDeployed, eventAppDeleted,
+	eventWorkflowRunStarted, eventWorkflowRunFinished,
+}
+
+// publishEvent records an event about v, which is the resource as it is after
+// the change, and queues it for matching webhooks. Failures are logged; they
+// never fail the change itself.
+func (s *Server) publishEvent(ctx context.Context, typ string, v any) {
+	s.publishEventMessage(ctx, typ, v, "")
+}
+
+// publishEventMessage is publishEvent with an explanation, such as the error
+// behind a failure event.
+func (s *Server) publishEventMessage(ctx context.Context, typ string, v any, message string) {
+	s.appendEvent(ctx, typ, v, message, true)
+}
+
+// appendEvent stores an event and wakes the stream. The event is queued for
+// the matching webhook subscriptions only when webhooks is set.
+func (s *Server) appendEvent(ctx context.Context, typ string, v any, message string, webhooks bool) {
+	ctx = context.WithoutCancel(ctx)
+	e := &types.Event{Type: typ, Time: time.Now().UTC(), Message: message}
+	switch obj := v.(type) {
+	case *types.Cluster:
+		e.ClusterID = obj.ID
+		v = sanitizeCluster(obj)
+	case *types.Tenant:
+		e.ClusterID, e.TenantID = obj.ClusterID, obj.ID
+	case *types.Project:
+		e.ClusterID, e.TenantID, e.ProjectID = obj.ClusterID, obj.TenantID, obj.ID
+	case *types.App:
+		e.ClusterID, e.TenantID, e.ProjectID, e.AppID = obj.ClusterID, obj.TenantID, obj.ProjectID, obj.ID
+	case *types.WorkflowRun:
+		e.ClusterID, e.TenantID, e.ProjectID, e.AppID = obj.ClusterID, obj.TenantID, obj.ProjectID, obj.AppID
+	case TelemetryEvent:
+		e.ClusterID = obj.ClusterID
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		logging.L.Warn("event_encode_failed", zap.String("type", typ), zap.Error(err))
+		return
+	}
+	e.Data = raw
+	if err := s.store.AppendEvent(ctx, e); err != nil {
+		logging.L.Warn("event_publish_failed", zap.String("type", typ), zap.Error(err))
+		return
+	}
+	if webhooks {
+		s.enqueueWebhooks(ctx, e)
+	}
+	s.events.notify()
+}
+
+// validEventName reports whether a name reported by the operator can be used
+// in an event type, which is written verbatim into the stream.
+func validEventName(name string) bool {
+	if name == "" || len(name) > 64 {
+		return false
+	}
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '_' && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// validEventPattern reports whether p names an event type, or all types of a
+// kind as in "app.*".
+func validEventPattern(p string) bool {
+	kind, name, ok := strings.Cut(p, ".")
+	if !ok {
+		return false
+	}
+	if _, known := eventReaders[kind]; known && name == "*" {
+		return true
+	}
+	if kind+"." == eventTelemetryPrefix {
+		return validEventName(name)
+	}
+	for _, t := range knownEventTypes {
+		if t == p {
+			return true
+		}
+	}
+	return false
+}
+
+// eventTypeMatches reports whether typ matches one of the patterns; no
+// patterns match every type.
+func eventTypeMatches(patterns []string, typ string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	for _, p := range patterns {
+		if p == typ || (strings.HasSuffix(p, ".*") && strings.HasPrefix(typ, strings.TrimSuffix(p, "*"))) {
+			return true
+		}
+	}
+	return false
+}
+
+// eventFilter selects the events a stream delivers.
+type eventFilter struct {
+	types     []string
+	clusterID string
+	tenantID  string
+	projectID string
+	appID     string
+	// auth is nil when every event is visible.
+	auth *AuthContext
+}
+
+func (f eventFilter) matches(e *types.Event) bool {
+	switch {
+	case f.clusterID != "" && e.ClusterID != f.clusterID,
+		f.tenantID != "" && e.TenantID != f.tenantID,
+		f.projectID != "" && e.ProjectID != f.projectID,
+		f.appID != "" && e.AppID != f.appID,
+		!f.visible(e):
+		return false
+	}
+	return eventTypeMatches(f.types, e.Type)
+}
+
+// visible reports whether the caller may read the resource the event is
+// about.
+func (f eventFilter) visible(e *types.Event) bool {
+	if f.auth == nil {
+		return true
+	}
+	kind, _, _ := strings.Cut(e.Type, ".")
+	return f.auth.can(resourceScope{clusterID: e.ClusterID, tenantID: e.TenantID, projectID: e.ProjectID}, eventReaders[kind]...)
+}
+
+// streamEvents serves the event stream as Server-Sent Events. Streams start
+// at the newest event unless the client resumes with Last-Event-ID (or the
+// lastEventId query parameter, for clients that cannot set headers).
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAnyRole(w, r, "admin", "ops", "projectDev", "tenantOwner", "readOnly") {
+		return
+	}
+	q := r.URL.Query()
+	filter := eventFilter{
+		clusterID: q.Get("clusterId"),
+		tenantID:  q.Get("tenantId"),
+		projectID: q.Get("projectId"),
+		appID:     q.Get("appId"),
+	}
+	for _, t := range strings.Split(q.Get("types"), ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			filter.types = append(filter.types, t)
+		}
+	}
+	if s.requireAuth {
+		filter.auth = s.authContext(r.Context())
+	}
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = q.Get("lastEventId")
+	}
+	var after int64
+	if lastID != "" {
+		id, err := strconv.ParseInt(lastID, 10, 64)
+		if err != nil || id < 0 {
+			writeError(w, http.StatusBadRequest, "KN-400", "Last-Event-ID must be a non-negative event ID")
+			return
+		}
+		after = id
+	} else {
+		id, err := s.store.LatestEventID(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+			return
+		}
+		after = id
+	}
+
+	clearWriteDeadline(r)
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	_ = rc.Flush()
+
+	poll := time.NewTicker(eventPollInterval)
+	defer poll.Stop()
+	heartbeat := time.NewTicker(eventHeartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		// Take the wake channel before reading so an event published while
+		// the page is written is not missed.
+		wake := s.events.wait()
+		for {
+			events, err := s.store.ListEvents(r.Context(), store.EventQuery{After: after, Limit: store.MaxEventLimit})
+			if err != nil {
+				if r.Context().Err() == nil {
+					logging.L.Warn("event_stream_read_failed", zap.Error(err))
+				}
+				return
+			}
+			for _, e := range events {
+				after = e.ID
+				if !filter.matches(e) {
+					continue
+				}
+				raw, _ := json.Marshal(e)
+				if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, raw); err != nil {
+					return
+				}
+			}
+			if len(events) < store.MaxEventLimit {
+				break
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-wake:
+		case <-poll.C:
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// RunEventRetention drops events past their retention until the context is
+// canceled. A retention of zero keeps events forever. Only the replica
+// holding the retention lease prunes.
+func (s *Server) RunEventRetention(ctx context.Context) {
+	ticker := time.NewTicker(eventRetentionInterval)
+	defer ticker.Stop()
+	for {
+		retention := time.Duration(envInt("EVENT_RETENTION_HOURS", defaultEventRetentionHours)) * time.Hour
+		if retention > 0 && s.holdLease(ctx, eventRetentionLease, 2*eventRetentionInterval) {
+			removed, err := s.store.PruneEvents(ctx, time.Now().UTC().Add(-retention))
+			if err != nil {
+				logging.L.Warn("event_prune_failed", zap.Error(err))
+			} else if removed > 0 {
+				logging.L.Info("events_pruned", zap.Int64("removed", removed))
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
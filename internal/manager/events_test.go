@@ -0,0 +1,236 @@
+package manager
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/vaheed/kubenova/internal/store"
+	"github.com/vaheed/kubenova/pkg/types"
+)
+
+// openEventStream connects to the event stream and delivers its events until
+// the test ends.
+func openEventStream(t *testing.T, client *http.Client, url string, header http.Header) <-chan types.Event {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("open stream: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		t.Fatalf("expected an event stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	events := make(chan types.Event, 64)
+	go func() {
+		defer resp.Body.Close()
+		scanner := bufio.NewScanner(resp.Body)
+		var id, typ, data string
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				typ = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				data = strings.TrimPrefix(line, "data: ")
+			case line == "" && data != "":
+				var e types.Event
+				if err := json.Unmarshal([]byte(data), &e); err != nil || fmt.Sprint(e.ID) != id || e.Type != typ {
+					t.Errorf("malformed event id=%q event=%q data=%s", id, typ, data)
+				}
+				events <- e
+				id, typ, data = "", "", ""
+			}
+		}
+	}()
+	return events
+}
+
+func nextEvents(t *testing.T, events <-chan types.Event, n int) []types.Event {
+	t.Helper()
+	var out []types.Event
+	for len(out) < n {
+		select {
+		case e := <-events:
+			out = append(out, e)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("expected %d events, got %d: %v", n, len(out), eventTypes(out))
+		}
+	}
+	return out
+}
+
+func eventTypes(events []types.Event) []string {
+	out := make([]string, len(events))
+	for i, e := range events {
+		out[i] = e.Type
+	}
+	return out
+}
+
+func TestEventStreamPublishesChanges(t *testing.T) {
+	t.Setenv("KUBENOVA_REQUIRE_AUTH", "false")
+
+	srv := newTestServer(t)
+	st, client, baseURL := srv.store, srv.client, srv.baseURL
+	streamURL := baseURL + "/events/stream"
+
+	cluster := &types.Cluster{Name: "events", Kubeconfig: "fake"}
+	if err := st.CreateCluster(context.Background(), cluster); err != nil {
+		t.Fatalf("create cluster: %v", err)
+	}
+	live := openEventStream(t, client, streamURL, nil)
+
+	tenant := doJSON[*types.Tenant](t, client, http.MethodPost,
+		fmt.Sprintf("%s/clusters/%s/tenants", baseURL, cluster.ID), map[string]any{"name": "acme"}, http.StatusCreated)
+	project := doJSON[*types.Project](t, client, http.MethodPost,
+		fmt.Sprintf("%s/clusters/%s/tenants/%s/projects", baseURL, cluster.ID, tenant.ID),
+		map[string]any{"name": "web"}, http.StatusCreated)
+	appsURL := fmt.Sprintf("%s/clusters/%s/tenants/%s/projects/%s/apps", baseURL, cluster.ID, tenant.ID, project.ID)
+	app := doJSON[*types.App](t, client, http.MethodPost, appsURL,
+		map[string]any{"name": "api", "spec": map[string]any{"type": "webservice"}}, http.StatusCreated)
+	doJSON[map[string]any](t, client, http.MethodPost, appsURL+"/"+app.ID+":deploy", nil, http.StatusAccepted)
+	doJSON[map[string]any](t, client, http.MethodPost, baseURL+"/telemetry/events", map[string]any{
+		"stream": "component_install", "component": "capsule", "status": "error", "clusterId": cluster.ID,
+	}, http.StatusAccepted)
+	doJSON[map[string]any](t, client, http.MethodPost, baseURL+"/telemetry/events", map[string]any{
+		"stream": "bad\nevent: forged", "clusterId": cluster.ID,
+	}, http.StatusAccepted)
+
+	got := nextEvents(t, live, 6)
+	want := []string{"tenant.created", "project.created", "app.created", "app.status_changed", "app.deployed", "telemetry.component_install"}
+	if strings.Join(eventTypes(got), ",") != strings.Join(want, ",") {
+		t.Fatalf("expected events %v, got %v", want, eventTypes(got))
+	}
+	for i := 1; i < len(got); i++ {
+		if got[i].ID <= got[i-1].ID {
+			t.Fatalf("expected increasing event IDs, got %d after %d", got[i].ID, got[i-1].ID)
+		}
+	}
+	changed := got[3]
+	var deployed types.App
+	if err := json.Unmarshal(changed.Data, &deployed); err != nil || deployed.Status != "Deployed" {
+		t.Fatalf("expected the deployed app in the event, got %s", changed.Data)
+	}
+	if changed.ClusterID != cluster.ID || changed.TenantID != tenant.ID || changed.ProjectID != project.ID || changed.AppID != app.ID {
+		t.Fatalf("expected the event to be scoped to the app, got %+v", changed)
+	}
+	if got[5].ClusterID != cluster.ID {
+		t.Fatalf("expected telemetry to be scoped to its cluster, got %+v", got[5])
+	}
+
+	// A client that reconnects picks up after the last event it saw.
+	resumed := openEventStream(t, client, streamURL+"?types=app.*",
+		http.Header{"Last-Event-Id": {fmt.Sprint(got[1].ID)}})
+	if again := nextEvents(t, resumed, 2); again[0].ID != got[2].ID || again[1].ID != got[3].ID {
+		t.Fatalf("expected to resume with the app events, got %v", eventTypes(again))
+	}
+	doNoBody(t, client, http.MethodGet, streamURL+"?lastEventId=latest", nil, http.StatusBadRequest)
+}
+
+func TestEventStreamIsScopedByRole(t *testing.T) {
+	t.Setenv("KUBENOVA_REQUIRE_AUTH", "true")
+	t.Setenv("JWT_SIGNING_KEY", "events-secret")
+
+	srv := newTestServer(t)
+	ctx := context.Background()
+
+	token := func(roles []string, bindings ...types.RoleBinding) http.Header {
+		tok := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"sub":      "dev",
+			"roles":    roles,
+			"bindings": bindings,
+			"exp":      time.Now().Add(time.Hour).Unix(),
+		})
+		signed, err := tok.SignedString([]byte("events-secret"))
+		if err != nil {
+			t.Fatalf("sign token: %v", err)
+		}
+		return http.Header{"Authorization": {"Bearer " + signed}, "Last-Event-Id": {"0"}}
+	}
+	srv.publishEvent(ctx, eventClusterStatusChanged, &types.Cluster{ID: "c1", Kubeconfig: "secret"})
+	srv.publishEvent(ctx, eventTenantCreated, &types.Tenant{ID: "t1", ClusterID: "c1"})
+	srv.publishEvent(ctx, eventAppStatusChanged, &types.App{ID: "a2", ProjectID: "p2", TenantID: "t1", ClusterID: "c1"})
+	srv.publishEvent(ctx, eventAppStatusChanged, &types.App{ID: "a1", ProjectID: "p1", TenantID: "t1", ClusterID: "c1"})
+
+	dev := nextEvents(t, openEventStream(t, srv.client, srv.url+"/api/v1/events/stream",
+		token(nil, types.RoleBinding{Role: "projectDev", ProjectID: "p1"})), 1)
+	if dev[0].Type != eventAppStatusChanged || dev[0].AppID != "a1" {
+		t.Fatalf("expected a projectDev to only see the events of their project, got %v", eventTypes(dev))
+	}
+	owner := nextEvents(t, openEventStream(t, srv.client, srv.url+"/api/v1/events/stream",
+		token(nil, types.RoleBinding{Role: "tenantOwner", TenantID: "t1"})), 3)
+	if owner[0].Type != eventTenantCreated {
+		t.Fatalf("expected a tenantOwner to see their tenant, got %v", eventTypes(owner))
+	}
+	ops := nextEvents(t, openEventStream(t, srv.client, srv.url+"/api/v1/events/stream", token([]string{"ops"})), 3)
+	if strings.Contains(string(ops[0].Data), "secret") {
+		t.Fatalf("expected cluster events to omit the kubeconfig, got %s", ops[0].Data)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, srv.url+"/api/v1/events/stream", nil)
+	// tenantOwner and projectDev only count when bound to a resource.
+	req.Header = token([]string{"billing", "projectDev"})
+	resp, err := srv.client.Do(req)
+	if err != nil {
+		t.Fatalf("open stream: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusForbidden {
+		t.Fatalf("expected 403 for a role without read access, got %d", resp.StatusCode)
+	}
+}
+
+func TestTelemetryEventsRequireClusterOperator(t *testing.T) {
+	t.Setenv("KUBENOVA_REQUIRE_AUTH", "true")
+	t.Setenv("JWT_SIGNING_KEY", "events-secret")
+
+	srv := newTestServer(t)
+	ctx := context.Background()
+	east := &types.Cluster{Name: "east", Kubeconfig: "fake"}
+	west := &types.Cluster{Name: "west", Kubeconfig: "fake"}
+	for _, c := range []*types.Cluster{east, west} {
+		if err := srv.store.CreateCluster(ctx, c); err != nil {
+			t.Fatalf("create cluster: %v", err)
+		}
+	}
+	as := func(bindings ...types.RoleBinding) *http.Client {
+		tok := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"sub": "operator", "bindings": bindings, "exp": time.Now().Add(time.Hour).Unix(),
+		})
+		signed, err := tok.SignedString([]byte("events-secret"))
+		if err != nil {
+			t.Fatalf("sign token: %v", err)
+		}
+		return &http.Client{Transport: bearerTransport{token: signed, next: srv.client.Transport}}
+	}
+	eventsURL := srv.baseURL + "/telemetry/events"
+	ev := map[string]any{"stream": "component_install", "status": "error", "clusterId": east.ID}
+
+	doNoBody(t, srv.client, http.MethodPost, eventsURL, ev, http.StatusUnauthorized)
+	doNoBody(t, as(types.RoleBinding{Role: "operator", ClusterID: west.ID}), http.MethodPost, eventsURL, ev, http.StatusForbidden)
+	operator := as(types.RoleBinding{Role: "operator", ClusterID: east.ID})
+	doNoBody(t, operator, http.MethodPost, eventsURL, map[string]any{"stream": "component_install"}, http.StatusBadRequest)
+	doNoBody(t, operator, http.MethodPost, eventsURL, ev, http.StatusAccepted)
+
+	events, err := srv.store.ListEvents(ctx, store.EventQuery{})
+	if err != nil {
+		t.Fatalf("list events: %v", err)
+	}
+	if len(events) != 1 || events[0].ClusterID != east.ID {
+		t.Fatalf("expected only the operator's event to be published, got %+v", events)
+	}
+}
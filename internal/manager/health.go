@@ -0,0 +1,306 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/vaheed/kubenova/internal/logging"
+	"github.com/vaheed/kubenova/internal/metrics"
+	"github.com/vaheed/kubenova/internal/store"
+	"github.com/vaheed/kubenova/pkg/types"
+	"go.uber.org/zap"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	kubeversion "k8s.io/apimachinery/pkg/version"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// clusterHealthLease names the store lease that keeps the prober to one
+	// manager replica.
+	clusterHealthLease = "cluster-health-prober"
+
+	defaultClusterHealthIntervalSeconds = 30
+	defaultClusterHealthTimeoutSeconds  = 10
+	defaultClusterHealthSlowMillis      = 2000
+	clusterHealthWorkers                = 8
+
+	// A connected cluster becomes degraded after healthDegradeAfter failed or
+	// slow probes in a row and unreachable after healthUnreachableAfter failed
+	// ones. healthRecoverAfter healthy probes in a row make it connected again.
+	healthDegradeAfter     = 2
+	healthUnreachableAfter = 5
+	healthRecoverAfter     = 2
+)
+
+// newInstanceID names this manager replica as the holder of store leases.
+func newInstanceID() string {
+	host, _ := os.Hostname()
+	if host == "" {
+		host = "manager"
+	}
+	return host + "-" + uuid.NewString()[:8]
+}
+
+// holdLease reports whether this replica holds the named store lease until
+// ttl from now. Only one replica holds a lease at a time; another takes it
+// over once its holder stopped renewing it.
+func (s *Server) holdLease(ctx context.Context, name string, ttl time.Duration) bool {
+	held, err := s.store.AcquireLease(ctx, name, s.instanceID, time.Now().UTC(), ttl)
+	if err != nil {
+		logging.L.Warn("lease_acquire_failed", zap.String("lease", name), zap.Error(err))
+		return false
+	}
+	return held
+}
+
+// probedStatus reports whether the prober manages a cluster in this status.
+// Clusters that are still being bootstrapped, or failed to be, are left to
+// their operations.
+func probedStatus(status string) bool {
+	switch status {
+	case types.ClusterConnected, types.ClusterDegraded, types.ClusterUnreachable:
+		return true
+	}
+	return false
+}
+
+// healthProbe is the outcome of one probe of a cluster's API server.
+type healthProbe struct {
+	latency time.Duration
+	version string
+	err     error
+}
+
+// RunClusterHealth probes the API server of every connected cluster each
+// CLUSTER_HEALTH_INTERVAL_SECONDS until the context is canceled. Only the
+// replica holding the prober lease probes; the others wait to take over.
+func (s *Server) RunClusterHealth(ctx context.Context) {
+	interval := time.Duration(envInt("CLUSTER_HEALTH_INTERVAL_SECONDS", defaultClusterHealthIntervalSeconds)) * time.Second
+	if interval <= 0 {
+		logging.L.Info("cluster_health_disabled")
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		s.probeClusters(ctx, interval)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// probeClusters runs one round of probes if this replica holds the prober
+// lease. The lease outlives the round by an interval, so another replica
+// takes over only once this one stopped renewing it.
+func (s *Server) probeClusters(ctx context.Context, interval time.Duration) {
+	held, err := s.store.AcquireLease(ctx, clusterHealthLease, s.instanceID, time.Now().UTC(), 2*interval)
+	if err != nil {
+		logging.L.Warn("cluster_health_lease_failed", zap.Error(err))
+		return
+	}
+	if !held {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, interval)
+	defer cancel()
+	clusters, _, err := s.store.ListClusters(ctx, store.ListOptions{})
+	if err != nil {
+		logging.L.Warn("cluster_health_list_failed", zap.Error(err))
+		return
+	}
+	work := make(chan *types.Cluster)
+	var wg sync.WaitGroup
+	for range clusterHealthWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range work {
+				s.probeCluster(ctx, c)
+			}
+		}()
+	}
+	for _, c := range clusters {
+		if probedStatus(c.Status) && c.Kubeconfig != "" {
+			work <- c
+		}
+	}
+	close(work)
+	wg.Wait()
+}
+
+// probeCluster probes c once, records its health and moves the cluster to
+// the status the probes settled on.
+func (s *Server) probeCluster(ctx context.Context, c *types.Cluster) {
+	if ctx.Err() != nil {
+		return
+	}
+	probe := s.probeClusterAPI(ctx, c)
+	if ctx.Err() != nil {
+		// The round ran out of time; that says nothing about the cluster.
+		return
+	}
+	outcome := "ok"
+	switch {
+	case probe.err != nil:
+		outcome = "failed"
+	case probe.latency > time.Duration(envInt("CLUSTER_HEALTH_SLOW_MS", defaultClusterHealthSlowMillis))*time.Millisecond:
+		outcome = "slow"
+	}
+	metrics.ClusterProbesTotal.WithLabelValues(outcome).Inc()
+	if probe.err == nil {
+		metrics.ClusterProbeSeconds.Observe(probe.latency.Seconds())
+	}
+
+	h, err := s.store.GetClusterHealth(ctx, c.ID)
+	if errors.Is(err, store.ErrNotFound) {
+		h, err = &types.ClusterHealth{ClusterID: c.ID}, nil
+	}
+	if err != nil {
+		logging.L.Warn("cluster_health_load_failed", zap.String("cluster_id", c.ID), zap.Error(err))
+		return
+	}
+	// The cluster's status wins over the recorded one, which a bootstrap may
+	// have moved on since the last probe.
+	h.Status = c.Status
+	applyProbe(h, probe, outcome, time.Now().UTC())
+	if err := s.store.SaveClusterHealth(ctx, h); err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			logging.L.Warn("cluster_health_save_failed", zap.String("cluster_id", c.ID), zap.Error(err))
+		}
+		return
+	}
+	if h.Status != c.Status {
+		if err := s.setProbedClusterStatus(ctx, c, h.Status, h.LastError); err != nil {
+			logging.L.Warn("cluster_status_update_failed", zap.String("cluster_id", c.ID), zap.Error(err))
+		}
+	}
+}
+
+// probeClusterAPI reads a namespace through the cluster's client, which
+// proves the API server answers and accepts the manager's credentials, and
+// then asks for its version.
+func (s *Server) probeClusterAPI(ctx context.Context, c *types.Cluster) healthProbe {
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(envInt("CLUSTER_HEALTH_TIMEOUT_SECONDS", defaultClusterHealthTimeoutSeconds))*time.Second)
+	defer cancel()
+	cli, err := s.kubeClientForCluster(ctx, c)
+	if err != nil {
+		return healthProbe{err: err}
+	}
+	start := time.Now()
+	var ns corev1.Namespace
+	if err := cli.Get(ctx, ctrlclient.ObjectKey{Name: metav1.NamespaceSystem}, &ns); err != nil && !apierrors.IsNotFound(err) {
+		return healthProbe{err: err}
+	}
+	probe := healthProbe{latency: time.Since(start)}
+	dc, err := s.discoveryForCluster(ctx, c)
+	if err == nil {
+		var info *kubeversion.Info
+		if info, err = dc.ServerVersion(); err == nil {
+			probe.version = info.GitVersion
+		}
+	}
+	if err != nil {
+		logging.L.Debug("cluster_version_failed", zap.String("cluster_id", c.ID), zap.Error(err))
+	}
+	return probe
+}
+
+// applyProbe counts the probe into h and moves h.Status once enough probes
+// in a row agree, so that a single slow or lost request does not flip it.
+func applyProbe(h *types.ClusterHealth, probe healthProbe, outcome string, now time.Time) {
+	h.LastProbeAt = &now
+	switch outcome {
+	case "failed":
+		h.ConsecutiveFailures++
+		h.ConsecutiveSlow, h.ConsecutiveSuccesses = 0, 0
+		h.LastError = probe.err.Error()
+	case "slow":
+		h.ConsecutiveSlow++
+		h.ConsecutiveFailures, h.ConsecutiveSuccesses = 0, 0
+	default:
+		h.ConsecutiveSuccesses++
+		h.ConsecutiveFailures, h.ConsecutiveSlow = 0, 0
+	}
+	if probe.err == nil {
+		h.LastError = ""
+		h.LastSeenAt = &now
+		h.LatencyMs = probe.latency.Milliseconds()
+		if probe.version != "" {
+			h.ServerVersion = probe.version
+		}
+	}
+
+	next := h.Status
+	switch {
+	case h.ConsecutiveFailures >= healthUnreachableAfter:
+		next = types.ClusterUnreachable
+	case h.Status == types.ClusterConnected && (h.ConsecutiveFailures >= healthDegradeAfter || h.ConsecutiveSlow >= healthDegradeAfter):
+		next = types.ClusterDegraded
+	case h.Status == types.ClusterUnreachable && h.ConsecutiveSlow >= healthRecoverAfter:
+		// Answering again, but slowly.
+		next = types.ClusterDegraded
+	case h.ConsecutiveSuccesses >= healthRecoverAfter:
+		next = types.ClusterConnected
+	}
+	if next != h.Status {
+		h.Status = next
+		h.StatusChangedAt = &now
+	}
+}
+
+// setProbedClusterStatus is setClusterStatus for the prober: it gives up
+// when the cluster left the probed statuses meanwhile, for example because a
+// refresh started, so that it never overwrites a bootstrap's status.
+func (s *Server) setProbedClusterStatus(ctx context.Context, c *types.Cluster, status, reason string) error {
+	updated, err := s.mutateCluster(ctx, c, func(c *types.Cluster) bool {
+		if !probedStatus(c.Status) || c.Status == status {
+			return false
+		}
+		c.Status = status
+		return true
+	})
+	if updated {
+		logging.L.Info("cluster_status_changed", zap.String("cluster_id", c.ID), zap.String("status", status), zap.String("reason", reason))
+		s.publishEventMessage(ctx, eventClusterStatusChanged, c, reason)
+	}
+	return err
+}
+
+// getClusterHealth returns what the prober last recorded for a cluster. A
+// cluster that was not probed yet reports its status alone.
+func (s *Server) getClusterHealth(w http.ResponseWriter, r *http.Request) {
+	if !s.requireRole(w, r, "admin", "ops", "readOnly") && s.requireAuth {
+		return
+	}
+	id := chi.URLParam(r, "clusterID")
+	c, err := s.store.GetCluster(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "KN-404", "cluster not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return
+	}
+	h, err := s.store.GetClusterHealth(r.Context(), id)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		h = &types.ClusterHealth{ClusterID: id}
+	case err != nil:
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return
+	}
+	h.Status = c.Status
+	writeJSON(w, http.StatusOK, h)
+}
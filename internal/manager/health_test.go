@@ -0,0 +1,190 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vaheed/kubenova/internal/store"
+	"github.com/vaheed/kubenova/pkg/types"
+	"k8s.io/client-go/discovery"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestClusterHealthProber(t *testing.T) {
+	t.Setenv("KUBENOVA_REQUIRE_AUTH", "false")
+	t.Setenv("CLUSTER_HEALTH_SLOW_MS", "50")
+
+	var (
+		mu    sync.Mutex
+		fail  error
+		delay time.Duration
+		gets  int
+	)
+	srv := newTestServer(t)
+	st, client := srv.store, srv.client
+	fakeClient := fake.NewClientBuilder().WithScheme(srv.scheme).WithInterceptorFuncs(interceptor.Funcs{
+		Get: func(ctx context.Context, cli ctrlclient.WithWatch, key ctrlclient.ObjectKey, obj ctrlclient.Object, opts ...ctrlclient.GetOption) error {
+			mu.Lock()
+			err, wait := fail, delay
+			gets++
+			mu.Unlock()
+			time.Sleep(wait)
+			if err != nil {
+				return err
+			}
+			return cli.Get(ctx, key, obj, opts...)
+		},
+	}).Build()
+	srv.kubeFactory = func(context.Context, string) (ctrlclient.Client, error) { return fakeClient, nil }
+	srv.discoveryFactory = func(context.Context, string) (discovery.DiscoveryInterface, error) {
+		return fakeDiscovery("v1.31.2"), nil
+	}
+	ctx := context.Background()
+
+	c := &types.Cluster{Name: "edge", Kubeconfig: fakeKubeconfig, Status: types.ClusterConnected}
+	if err := st.CreateCluster(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	pending := &types.Cluster{Name: "new", Kubeconfig: fakeKubeconfig, Status: "bootstrapping"}
+	if err := st.CreateCluster(ctx, pending); err != nil {
+		t.Fatal(err)
+	}
+	healthURL := srv.baseURL + "/clusters/" + c.ID + "/health"
+	if h := doJSON[*types.ClusterHealth](t, client, http.MethodGet, healthURL, nil, http.StatusOK); h.Status != types.ClusterConnected || h.LastProbeAt != nil {
+		t.Fatalf("expected an unprobed connected cluster, got %+v", h)
+	}
+
+	round := func() {
+		srv.probeClusters(ctx, time.Minute)
+	}
+	expect := func(status string) *types.ClusterHealth {
+		t.Helper()
+		h := doJSON[*types.ClusterHealth](t, client, http.MethodGet, healthURL, nil, http.StatusOK)
+		if h.Status != status {
+			t.Fatalf("expected %s, got %+v", status, h)
+		}
+		if stored, _ := st.GetCluster(ctx, c.ID); stored.Status != status {
+			t.Fatalf("expected the cluster to be %s, got %s", status, stored.Status)
+		}
+		return h
+	}
+
+	round()
+	if h := expect(types.ClusterConnected); h.ServerVersion != "v1.31.2" || h.LastSeenAt == nil || h.ConsecutiveSuccesses != 1 {
+		t.Fatalf("expected the probe to be recorded, got %+v", h)
+	}
+	if gets != 1 {
+		t.Fatalf("expected only the connected cluster to be probed, got %d probes", gets)
+	}
+
+	// One lost request does not flip the status; a second one does.
+	mu.Lock()
+	fail = errors.New("dial tcp 10.0.0.1:6443: connect: connection refused")
+	mu.Unlock()
+	round()
+	expect(types.ClusterConnected)
+	round()
+	if h := expect(types.ClusterDegraded); h.LastError == "" || h.ConsecutiveFailures != 2 || h.StatusChangedAt == nil {
+		t.Fatalf("expected the failures to be recorded, got %+v", h)
+	}
+	for range healthUnreachableAfter - 2 {
+		round()
+	}
+	expect(types.ClusterUnreachable)
+	events, _ := st.ListEvents(ctx, store.EventQuery{})
+	var changes []*types.Event
+	for _, e := range events {
+		if e.Type == eventClusterStatusChanged {
+			changes = append(changes, e)
+		}
+	}
+	if len(changes) != 2 || changes[1].Message == "" {
+		t.Fatalf("expected two status change events with the reason, got %+v", changes)
+	}
+
+	// Answering slowly moves it to degraded, answering quickly to connected.
+	mu.Lock()
+	fail, delay = nil, 80*time.Millisecond
+	mu.Unlock()
+	round()
+	round()
+	expect(types.ClusterDegraded)
+	mu.Lock()
+	delay = 0
+	mu.Unlock()
+	round()
+	expect(types.ClusterDegraded)
+	round()
+	if h := expect(types.ClusterConnected); h.LastError != "" || h.ConsecutiveSuccesses != 2 {
+		t.Fatalf("expected a clean recovery, got %+v", h)
+	}
+
+	// A cluster being refreshed is left to its operation.
+	stored, _ := st.GetCluster(ctx, c.ID)
+	stored.Status = "reinstalling"
+	if err := st.UpdateCluster(ctx, stored); err != nil {
+		t.Fatal(err)
+	}
+	mu.Lock()
+	fail, gets = errors.New("connection refused"), 0
+	mu.Unlock()
+	for range healthUnreachableAfter {
+		round()
+	}
+	if gets != 0 {
+		t.Fatalf("expected no probes of a reinstalling cluster, got %d", gets)
+	}
+
+	doJSON[*types.ClusterHealth](t, client, http.MethodGet, srv.baseURL+"/clusters/missing/health", nil, http.StatusNotFound)
+}
+
+func TestClusterHealthLease(t *testing.T) {
+	st := store.NewMemoryStore()
+	ctx := context.Background()
+	now := time.Now().UTC()
+	if ok, _ := st.AcquireLease(ctx, clusterHealthLease, "a", now, time.Minute); !ok {
+		t.Fatal("expected a to get the free lease")
+	}
+	if ok, _ := st.AcquireLease(ctx, clusterHealthLease, "b", now.Add(30*time.Second), time.Minute); ok {
+		t.Fatal("expected b to wait while a holds the lease")
+	}
+	if ok, _ := st.AcquireLease(ctx, clusterHealthLease, "a", now.Add(30*time.Second), time.Minute); !ok {
+		t.Fatal("expected a to renew its lease")
+	}
+	if ok, _ := st.AcquireLease(ctx, clusterHealthLease, "b", now.Add(time.Minute), time.Minute); ok {
+		t.Fatal("expected the renewed lease to hold")
+	}
+	if ok, _ := st.AcquireLease(ctx, clusterHealthLease, "b", now.Add(2*time.Minute), time.Minute); !ok {
+		t.Fatal("expected b to take over once a stopped renewing")
+	}
+
+	// Only the replica holding the lease probes.
+	var probes int
+	var mu sync.Mutex
+	srv := NewServer(st)
+	srv.instanceID = "a"
+	srv.kubeFactory = func(context.Context, string) (ctrlclient.Client, error) {
+		mu.Lock()
+		probes++
+		mu.Unlock()
+		return nil, errors.New("unreachable")
+	}
+	if err := st.CreateCluster(ctx, &types.Cluster{Name: "c", Kubeconfig: fakeKubeconfig, Status: types.ClusterConnected}); err != nil {
+		t.Fatal(err)
+	}
+	srv.probeClusters(ctx, time.Minute)
+	if probes != 0 {
+		t.Fatalf("expected a to skip the round while b holds the lease, got %d probes", probes)
+	}
+	srv.instanceID = "b"
+	srv.probeClusters(ctx, time.Minute)
+	if probes != 1 {
+		t.Fatalf("expected the lease holder to probe, got %d probes", probes)
+	}
+}
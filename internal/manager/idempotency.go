@@ -0,0 +1,194 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/vaheed/kubenova/internal/logging"
+	"github.com/vaheed/kubenova/internal/store"
+	"go.uber.org/zap"
+)
+
+const (
+	idempotencyKeyHeader       = "Idempotency-Key"
+	idempotentReplayedHeader   = "Idempotent-Replayed"
+	maxIdempotencyKeyLen       = 255
+	defaultIdempotencyTTLHours = 24
+	idempotencyPruneInterval   = time.Hour
+	// idempotencyPruneLease keeps pruning to one manager replica.
+	idempotencyPruneLease = "idempotency-retention"
+)
+
+// replayedHeaders are the response headers saved alongside the body so that a
+// replay looks like the original response.
+var replayedHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// idempotencyMiddleware makes POST requests carrying an Idempotency-Key safe to
+// retry: the first response is stored and replayed for later requests with the
+// same key and body, while the same key with a different request is rejected.
+// Server errors are not stored so that the client can retry them.
+func (s *Server) idempotencyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimSpace(r.Header.Get(idempotencyKeyHeader))
+		if r.Method != http.MethodPost || key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			writeError(w, http.StatusBadRequest, "KN-400", "Idempotency-Key must be at most 255 characters")
+			return
+		}
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "KN-400", "read body: "+err.Error())
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		now := time.Now().UTC()
+		rec := &store.IdempotencyRecord{
+			Key:         idempotencyScope(r, key),
+			Fingerprint: requestFingerprint(r, body),
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(idempotencyTTL()),
+		}
+		existing, err := s.store.ReserveIdempotencyKey(r.Context(), rec)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+			return
+		}
+		if existing != nil {
+			switch {
+			case existing.Fingerprint != rec.Fingerprint:
+				writeError(w, http.StatusUnprocessableEntity, "KN-422", "Idempotency-Key was already used for a different request")
+			case existing.Pending():
+				writeError(w, http.StatusConflict, "KN-409", "a request with this Idempotency-Key is still in progress")
+			default:
+				replayResponse(w, existing)
+			}
+			return
+		}
+
+		// The outcome is saved even if the client has gone away meanwhile.
+		ctx := context.WithoutCancel(r.Context())
+		rw := &recordingWriter{ResponseWriter: w}
+		defer func() {
+			if p := recover(); p != nil {
+				_ = s.store.ReleaseIdempotencyKey(ctx, rec.Key)
+				panic(p)
+			}
+		}()
+		next.ServeHTTP(rw, r)
+
+		status := rw.statusCode()
+		// Server errors and rate limiting say nothing about the request, so
+		// a retry with the same key runs it again.
+		if status >= http.StatusInternalServerError || status == http.StatusTooManyRequests {
+			if err := s.store.ReleaseIdempotencyKey(ctx, rec.Key); err != nil {
+				logging.L.Warn("idempotency_release_failed", zap.Error(err))
+			}
+			return
+		}
+		rec.Status = status
+		rec.Body = rw.body.Bytes()
+		rec.Header = map[string]string{}
+		for _, h := range replayedHeaders {
+			if v := rw.Header().Get(h); v != "" {
+				rec.Header[h] = v
+			}
+		}
+		if err := s.store.CompleteIdempotencyKey(ctx, rec); err != nil {
+			logging.L.Warn("idempotency_save_failed", zap.Error(err))
+		}
+	})
+}
+
+func replayResponse(w http.ResponseWriter, rec *store.IdempotencyRecord) {
+	for k, v := range rec.Header {
+		w.Header().Set(k, v)
+	}
+	w.Header().Set(idempotentReplayedHeader, "true")
+	w.WriteHeader(rec.Status)
+	_, _ = w.Write(rec.Body)
+}
+
+// idempotencyScope ties a client key to the credentials it was sent with so
+// that callers cannot replay each other's responses.
+func idempotencyScope(r *http.Request, key string) string {
+	h := sha256.New()
+	io.WriteString(h, r.Header.Get("Authorization"))
+	h.Write([]byte{0})
+	io.WriteString(h, key)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func requestFingerprint(r *http.Request, body []byte) string {
+	h := sha256.New()
+	io.WriteString(h, r.Method)
+	h.Write([]byte{0})
+	io.WriteString(h, r.URL.Path)
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func idempotencyTTL() time.Duration {
+	return time.Duration(envInt("IDEMPOTENCY_TTL_HOURS", defaultIdempotencyTTLHours)) * time.Hour
+}
+
+// RunIdempotencyRetention drops expired idempotency records until the context
+// is canceled. Only the replica holding the retention lease prunes.
+func (s *Server) RunIdempotencyRetention(ctx context.Context) {
+	ticker := time.NewTicker(idempotencyPruneInterval)
+	defer ticker.Stop()
+	for {
+		if s.holdLease(ctx, idempotencyPruneLease, 2*idempotencyPruneInterval) {
+			removed, err := s.store.PruneIdempotencyKeys(ctx, time.Now().UTC())
+			if err != nil {
+				logging.L.Warn("idempotency_prune_failed", zap.Error(err))
+			} else if removed > 0 {
+				logging.L.Info("idempotency_pruned", zap.Int64("removed", removed))
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// recordingWriter passes a response through while keeping a copy of it.
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) statusCode() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
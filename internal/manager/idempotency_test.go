@@ -0,0 +1,86 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/vaheed/kubenova/pkg/types"
+)
+
+func TestIdempotencyKeyReplaysResponses(t *testing.T) {
+	t.Setenv("KUBENOVA_REQUIRE_AUTH", "false")
+	t.Setenv("CLUSTER_PREFLIGHT", "false")
+
+	srv := newTestServer(t)
+	client, baseURL := srv.client, srv.baseURL
+
+	post := func(url, key string, body any) (*http.Response, []byte) {
+		t.Helper()
+		raw, _ := json.Marshal(body)
+		req, _ := http.NewRequest(http.MethodPost, url, bytes.NewReader(raw))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set(idempotencyKeyHeader, key)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("post %s: %v", url, err)
+		}
+		defer resp.Body.Close()
+		out, _ := io.ReadAll(resp.Body)
+		return resp, out
+	}
+
+	clusterReq := map[string]any{"name": "idem", "kubeconfig": fakeKubeconfigB64}
+	first, firstBody := post(baseURL+"/clusters", "create-idem", clusterReq)
+	if first.StatusCode != http.StatusCreated {
+		t.Fatalf("create cluster: status %d body=%s", first.StatusCode, firstBody)
+	}
+	retry, retryBody := post(baseURL+"/clusters", "create-idem", clusterReq)
+	if retry.StatusCode != http.StatusCreated || !bytes.Equal(firstBody, retryBody) {
+		t.Fatalf("expected replayed 201, got %d body=%s", retry.StatusCode, retryBody)
+	}
+	if retry.Header.Get(idempotentReplayedHeader) != "true" || retry.Header.Get("ETag") != first.Header.Get("ETag") {
+		t.Fatalf("expected replay headers, got %v", retry.Header)
+	}
+	if resp, _ := post(baseURL+"/clusters", "", clusterReq); resp.StatusCode != http.StatusConflict {
+		t.Fatalf("expected 409 without a key, got %d", resp.StatusCode)
+	}
+	other := map[string]any{"name": "idem-2", "kubeconfig": fakeKubeconfigB64}
+	if resp, _ := post(baseURL+"/clusters", "create-idem", other); resp.StatusCode != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422 for a reused key with a different body, got %d", resp.StatusCode)
+	}
+
+	var cluster types.Cluster
+	if err := json.Unmarshal(firstBody, &cluster); err != nil {
+		t.Fatalf("decode cluster: %v", err)
+	}
+	tenant := doJSON[*types.Tenant](t, client, http.MethodPost,
+		fmt.Sprintf("%s/clusters/%s/tenants", baseURL, cluster.ID), map[string]any{"name": "acme"}, http.StatusCreated)
+	project := doJSON[*types.Project](t, client, http.MethodPost,
+		fmt.Sprintf("%s/clusters/%s/tenants/%s/projects", baseURL, cluster.ID, tenant.ID), map[string]any{"name": "web"}, http.StatusCreated)
+	appsURL := fmt.Sprintf("%s/clusters/%s/tenants/%s/projects/%s/apps", baseURL, cluster.ID, tenant.ID, project.ID)
+	app := doJSON[*types.App](t, client, http.MethodPost, appsURL, map[string]any{
+		"name": "api",
+		"spec": map[string]any{"type": "webservice"},
+	}, http.StatusCreated)
+
+	runURL := fmt.Sprintf("%s/%s/workflow/run", appsURL, app.ID)
+	for i := 0; i < 3; i++ {
+		if resp, body := post(runURL, "run-once", map[string]any{}); resp.StatusCode != http.StatusAccepted {
+			t.Fatalf("run workflow: status %d body=%s", resp.StatusCode, body)
+		}
+	}
+	runs := doJSON[[]types.WorkflowRun](t, client, http.MethodGet, fmt.Sprintf("%s/%s/workflow/runs", appsURL, app.ID), nil, http.StatusOK)
+	if len(runs) != 1 {
+		t.Fatalf("expected retries to start one workflow run, got %d", len(runs))
+	}
+
+	if resp, _ := post(runURL, string(bytes.Repeat([]byte("k"), maxIdempotencyKeyLen+1)), map[string]any{}); resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an oversized key, got %d", resp.StatusCode)
+	}
+}
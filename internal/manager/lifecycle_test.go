@@ -0,0 +1,145 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	velabackend "github.com/vaheed/kubenova/internal/backends/vela"
+	v1alpha1 "github.com/vaheed/kubenova/pkg/api/v1alpha1"
+	"github.com/vaheed/kubenova/pkg/types"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+type failingVela struct{ velabackend.Interface }
+
+func (failingVela) ApplyApp(context.Context, map[string]any) error {
+	return errors.New("admission webhook denied the request")
+}
+
+func TestAppLifecycleActionsDriveCluster(t *testing.T) {
+	t.Setenv("KUBENOVA_REQUIRE_AUTH", "false")
+
+	srv := newTestServer(t)
+	st, client, baseURL := srv.store, srv.client, srv.baseURL
+	ctx := context.Background()
+
+	cluster := &types.Cluster{Name: "lifecycle", Kubeconfig: "fake"}
+	if err := st.CreateCluster(ctx, cluster); err != nil {
+		t.Fatalf("create cluster: %v", err)
+	}
+	tenant := doJSON[*types.Tenant](t, client, http.MethodPost,
+		fmt.Sprintf("%s/clusters/%s/tenants", baseURL, cluster.ID), map[string]any{"name": "acme"}, http.StatusCreated)
+	project := doJSON[*types.Project](t, client, http.MethodPost,
+		fmt.Sprintf("%s/clusters/%s/tenants/%s/projects", baseURL, cluster.ID, tenant.ID),
+		map[string]any{"name": "web"}, http.StatusCreated)
+	app := doJSON[*types.App](t, client, http.MethodPost,
+		fmt.Sprintf("%s/clusters/%s/tenants/%s/projects/%s/apps", baseURL, cluster.ID, tenant.ID, project.ID),
+		map[string]any{
+			"name":   "api",
+			"spec":   map[string]any{"type": "webservice", "properties": map[string]any{"image": "api:v1"}},
+			"traits": []map[string]any{{"type": "scaler", "properties": map[string]any{"replicas": 3}}},
+		}, http.StatusCreated)
+	actionURL := func(verb string) string {
+		return fmt.Sprintf("%s/clusters/%s/tenants/%s/projects/%s/apps/%s:%s", baseURL, cluster.ID, tenant.ID, project.ID, app.ID, verb)
+	}
+	application := func() *unstructured.Unstructured {
+		t.Helper()
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(schema.GroupVersionKind{Group: "core.oam.dev", Version: "v1beta1", Kind: "Application"})
+		if err := srv.kube.Get(ctx, ctrlclient.ObjectKey{Name: "api", Namespace: "acme-apps"}, obj); err != nil {
+			t.Fatalf("get Application: %v", err)
+		}
+		return obj
+	}
+	replicas := func(obj *unstructured.Unstructured) any {
+		t.Helper()
+		components, _, _ := unstructured.NestedSlice(obj.Object, "spec", "components")
+		traits := components[0].(map[string]any)["traits"].([]any)
+		var out any
+		for _, tr := range traits {
+			if tr := tr.(map[string]any); tr["type"] == "scaler" {
+				out = tr["properties"].(map[string]any)["replicas"]
+			}
+		}
+		return out
+	}
+	novaApp := func() v1alpha1.NovaApp {
+		t.Helper()
+		var obj v1alpha1.NovaApp
+		if err := srv.kube.Get(ctx, ctrlclient.ObjectKey{Name: "api", Namespace: "acme-apps"}, &obj); err != nil {
+			t.Fatalf("get NovaApp: %v", err)
+		}
+		return obj
+	}
+
+	deployed := doJSON[map[string]any](t, client, http.MethodPost, actionURL("deploy"), nil, http.StatusAccepted)
+	first := application().GetAnnotations()[velabackend.PublishVersionAnnotation]
+	if first == "" || deployed["publishVersion"] != first {
+		t.Fatalf("expected deploy to set a publish version, got %q (response %v)", first, deployed)
+	}
+	if novaApp().Spec.PublishVersion != first {
+		t.Fatalf("expected NovaApp to carry publish version %q", first)
+	}
+	doJSON[map[string]any](t, client, http.MethodPost, actionURL("deploy"), nil, http.StatusAccepted)
+	second := application().GetAnnotations()[velabackend.PublishVersionAnnotation]
+	if second == first {
+		t.Fatalf("expected a second deploy to force a new revision, publish version stayed %q", second)
+	}
+
+	doJSON[map[string]any](t, client, http.MethodPost, actionURL("suspend"), nil, http.StatusAccepted)
+	if got := replicas(application()); got != int64(0) {
+		t.Fatalf("expected suspended app to be scaled to zero, got replicas %v", got)
+	}
+	if !novaApp().Spec.Suspended {
+		t.Fatalf("expected NovaApp to be marked suspended")
+	}
+	suspended := application().GetAnnotations()[velabackend.PublishVersionAnnotation]
+	if suspended == second || novaApp().Spec.PublishVersion != suspended {
+		t.Fatalf("expected suspend after deploy to change the publish version, got %q after %q", suspended, second)
+	}
+
+	doJSON[map[string]any](t, client, http.MethodPost, actionURL("resume"), nil, http.StatusAccepted)
+	if got := replicas(application()); got != int64(3) {
+		t.Fatalf("expected resume to restore replicas, got %v", got)
+	}
+	resumed := application().GetAnnotations()[velabackend.PublishVersionAnnotation]
+	if resumed == suspended {
+		t.Fatalf("expected resume to change the publish version, it stayed %q", resumed)
+	}
+
+	appURL := fmt.Sprintf("%s/clusters/%s/tenants/%s/projects/%s/apps/%s", baseURL, cluster.ID, tenant.ID, project.ID, app.ID)
+	doJSON[*types.App](t, client, http.MethodPut, appURL,
+		map[string]any{"spec": map[string]any{"type": "webservice", "properties": map[string]any{"image": "api:v2"}}}, http.StatusOK)
+	if got := novaApp().Spec.PublishVersion; got == resumed {
+		t.Fatalf("expected a spec update to change the publish version, it stayed %q", got)
+	}
+	updated := novaApp().Spec.PublishVersion
+
+	doJSON[*types.App](t, client, http.MethodPut, appURL+"/traits",
+		map[string]any{"traits": []map[string]any{{"type": "scaler", "properties": map[string]any{"replicas": 5}}}}, http.StatusOK)
+	applied := novaApp()
+	if applied.Spec.PublishVersion == updated {
+		t.Fatalf("expected a traits update to change the publish version, it stayed %q", updated)
+	}
+	if len(applied.Spec.Traits) != 1 || fmt.Sprint(applied.Spec.Traits[0]["properties"].(map[string]any)["replicas"]) != "5" {
+		t.Fatalf("expected the traits update to reach the cluster, got %v", applied.Spec.Traits)
+	}
+
+	srv.velaFactory = func(ctrlclient.Client) velabackend.Interface { return failingVela{} }
+	doNoBody(t, client, http.MethodPost, actionURL("suspend"), nil, http.StatusInternalServerError)
+	stored, err := st.GetApp(ctx, cluster.ID, tenant.ID, project.ID, app.ID)
+	if err != nil {
+		t.Fatalf("get app: %v", err)
+	}
+	if stored.Suspended || stored.Status != "Deployed" {
+		t.Fatalf("app must not be marked suspended when the cluster rejects it, got suspended=%v status=%s", stored.Suspended, stored.Status)
+	}
+	if novaApp().Spec.Suspended {
+		t.Fatalf("NovaApp must not be suspended when the Application was rejected")
+	}
+}
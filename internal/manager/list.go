@@ -0,0 +1,68 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/vaheed/kubenova/internal/store"
+)
+
+// continueHeader carries the token for the next page of a list response.
+const continueHeader = "X-KN-Continue"
+
+// parseListOptions reads ?limit=&continue=&sort=&labelSelector= from a list request.
+func parseListOptions(r *http.Request) (store.ListOptions, error) {
+	q := r.URL.Query()
+	opts := store.ListOptions{Continue: strings.TrimSpace(q.Get("continue"))}
+	if v := strings.TrimSpace(q.Get("limit")); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 0 {
+			return opts, errors.New("limit must be a non-negative integer")
+		}
+		opts.Limit = min(limit, store.MaxListLimit)
+	}
+	sortKeys, err := store.ParseSort(q.Get("sort"))
+	if err != nil {
+		return opts, err
+	}
+	opts.Sort = sortKeys
+	sel, err := store.ParseSelector(q.Get("labelSelector"))
+	if err != nil {
+		return opts, err
+	}
+	opts.Selector = sel
+	return opts, nil
+}
+
+// listOptions parses the list parameters and writes a 400 when they are invalid.
+func listOptions(w http.ResponseWriter, r *http.Request) (store.ListOptions, bool) {
+	opts, err := parseListOptions(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "KN-400", err.Error())
+		return opts, false
+	}
+	return opts, true
+}
+
+// writeList writes one page of a list response, advertising the next page in
+// the X-KN-Continue header.
+func writeList(w http.ResponseWriter, r *http.Request, items any, next string, err error) {
+	if err != nil {
+		if errors.Is(err, store.ErrInvalidList) {
+			writeError(w, http.StatusBadRequest, "KN-400", err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return
+	}
+	if next != "" {
+		w.Header().Set(continueHeader, next)
+		q := r.URL.Query()
+		q.Set("continue", next)
+		w.Header().Set("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, r.URL.Path, q.Encode()))
+	}
+	writeJSON(w, http.StatusOK, items)
+}
@@ -55,10 +55,15 @@ func TestLiveAPIE2E(t *testing.T) {
 	}, headers, http.StatusCreated)
 	clusterID := fmt.Sprint(cluster["id"])
 
+	plan := liveJSON[map[string]any](t, client, http.MethodPost, base+"/api/v1/plans", map[string]any{
+		"name":   fmt.Sprintf("gold-%d", uniq),
+		"quotas": map[string]string{"cpu": "4", "memory": "8Gi"},
+	}, headers, http.StatusCreated)
+
 	tenant := liveJSON[map[string]any](t, client, http.MethodPost, fmt.Sprintf("%s/api/v1/clusters/%s/tenants", base, clusterID), map[string]any{
 		"name":   fmt.Sprintf("tenant-%d", uniq),
 		"owners": []string{"e2e@example.com"},
-		"plan":   "gold",
+		"plan":   fmt.Sprint(plan["name"]),
 	}, headers, http.StatusCreated)
 	tenantID := fmt.Sprint(tenant["id"])
 
@@ -0,0 +1,322 @@
+package manager
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/vaheed/kubenova/pkg/types"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// Labels KubeVela stamps on the workloads it renders for an Application.
+	velaAppNameLabel           = "app.oam.dev/name"
+	velaComponentLabel         = "app.oam.dev/component"
+	defaultContainerAnnotation = "kubectl.kubernetes.io/default-container"
+
+	defaultLogTailLines int64 = 500
+	maxLogBytes         int64 = 4 << 20 // per pod, when not following
+	maxLogLineBytes           = 1 << 20
+)
+
+type podLogsFactory func(context.Context, string) (kubernetes.Interface, error)
+
+func defaultPodLogsFactory() podLogsFactory {
+	return func(ctx context.Context, kubeconfig string) (kubernetes.Interface, error) {
+		cfg, err := clientcmd.RESTConfigFromKubeConfig([]byte(kubeconfig))
+		if err != nil {
+			return nil, fmt.Errorf("build rest config: %w", err)
+		}
+		return kubernetes.NewForConfig(cfg)
+	}
+}
+
+// podLogsForCluster returns a clientset for reading pod logs, which the
+// controller-runtime client from kubeClientForCluster cannot stream.
+func (s *Server) podLogsForCluster(ctx context.Context, c *types.Cluster) (kubernetes.Interface, error) {
+	if c == nil {
+		return nil, errors.New("cluster is nil")
+	}
+	if c.Kubeconfig == "" {
+		return nil, errors.New("kubeconfig missing")
+	}
+	if s.logsFactory == nil {
+		s.logsFactory = defaultPodLogsFactory()
+	}
+	return s.logsFactory(ctx, c.Kubeconfig)
+}
+
+// logLine is one line of output from a pod. Follow streams send it as the
+// data of each Server-Sent Event.
+type logLine struct {
+	Pod       string `json:"pod"`
+	Container string `json:"container"`
+	Line      string `json:"line"`
+}
+
+// logRequest holds the query parameters of a log request.
+type logRequest struct {
+	container string
+	opts      corev1.PodLogOptions
+}
+
+func parseLogRequest(r *http.Request) (logRequest, error) {
+	q := r.URL.Query()
+	req := logRequest{
+		container: q.Get("container"),
+		opts: corev1.PodLogOptions{
+			Follow:     parseBool(q.Get("follow")),
+			Previous:   parseBool(q.Get("previous")),
+			Timestamps: true,
+		},
+	}
+	if raw := q.Get("tailLines"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n < 0 {
+			return req, errors.New("tailLines must be a non-negative integer")
+		}
+		req.opts.TailLines = &n
+	}
+	if raw := q.Get("sinceSeconds"); raw != "" {
+		n, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil || n < 1 {
+			return req, errors.New("sinceSeconds must be a positive integer")
+		}
+		req.opts.SinceSeconds = &n
+	}
+	if req.opts.Follow && req.opts.Previous {
+		return req, errors.New("previous logs cannot be followed")
+	}
+	if !req.opts.Follow {
+		// Bound one-shot reads; follow streams are bounded by the client.
+		if req.opts.TailLines == nil && req.opts.SinceSeconds == nil {
+			tail := defaultLogTailLines
+			req.opts.TailLines = &tail
+		}
+		limit := maxLogBytes
+		req.opts.LimitBytes = &limit
+	}
+	return req, nil
+}
+
+// logContainer picks the container to read: the requested one, the pod's
+// default-container annotation, a container named after the component, or
+// the first container.
+func logContainer(pod *corev1.Pod, requested, component string) (string, bool) {
+	names := make([]string, 0, len(pod.Spec.Containers))
+	for _, c := range pod.Spec.Containers {
+		names = append(names, c.Name)
+	}
+	has := func(name string) bool {
+		for _, n := range names {
+			if n == name {
+				return true
+			}
+		}
+		return false
+	}
+	switch {
+	case requested != "":
+		return requested, has(requested)
+	case has(pod.Annotations[defaultContainerAnnotation]):
+		return pod.Annotations[defaultContainerAnnotation], true
+	case has(component):
+		return component, true
+	case len(names) > 0:
+		return names[0], true
+	}
+	return "", false
+}
+
+func (s *Server) appLogs(w http.ResponseWriter, r *http.Request) {
+	if !s.requireRole(w, r, "admin", "ops", "projectDev", "tenantOwner", "readOnly") && s.requireAuth {
+		return
+	}
+	clusterID := chi.URLParam(r, "clusterID")
+	tenantID := chi.URLParam(r, "tenantID")
+	projectID := chi.URLParam(r, "projectID")
+	appID := chi.URLParam(r, "appID")
+	component := chi.URLParam(r, "component")
+	req, err := parseLogRequest(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "KN-400", err.Error())
+		return
+	}
+	app, err := s.store.GetApp(r.Context(), clusterID, tenantID, projectID, appID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "KN-404", "app not found")
+		return
+	}
+	tenant, err := s.store.GetTenant(r.Context(), clusterID, tenantID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "KN-404", "tenant not found")
+		return
+	}
+	cluster, err := s.store.GetCluster(r.Context(), clusterID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "KN-404", "cluster not found")
+		return
+	}
+	cli, err := s.kubeClientForCluster(r.Context(), cluster)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "KN-500", fmt.Sprintf("cluster client: %v", err))
+		return
+	}
+	ns := appsNamespace(tenant)
+	var pods corev1.PodList
+	if err := cli.List(r.Context(), &pods, ctrlclient.InNamespace(ns), ctrlclient.MatchingLabels{
+		velaAppNameLabel:   app.Name,
+		velaComponentLabel: component,
+	}); err != nil {
+		writeError(w, http.StatusInternalServerError, "KN-500", fmt.Sprintf("list pods: %v", err))
+		return
+	}
+	if len(pods.Items) == 0 {
+		writeError(w, http.StatusNotFound, "KN-404", fmt.Sprintf("no pods found for component %q", component))
+		return
+	}
+	sort.Slice(pods.Items, func(i, j int) bool { return pods.Items[i].Name < pods.Items[j].Name })
+
+	logs, err := s.podLogsForCluster(r.Context(), cluster)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "KN-500", fmt.Sprintf("cluster client: %v", err))
+		return
+	}
+	streams := make([]io.ReadCloser, 0, len(pods.Items))
+	sources := make([]logLine, 0, len(pods.Items))
+	defer func() {
+		for _, st := range streams {
+			_ = st.Close()
+		}
+	}()
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		container, ok := logContainer(pod, req.container, component)
+		if !ok {
+			writeError(w, http.StatusBadRequest, "KN-400", fmt.Sprintf("pod %s has no container %q", pod.Name, req.container))
+			return
+		}
+		opts := req.opts
+		opts.Container = container
+		st, err := logs.CoreV1().Pods(ns).GetLogs(pod.Name, &opts).Stream(r.Context())
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "KN-500", fmt.Sprintf("logs for pod %s: %v", pod.Name, err))
+			return
+		}
+		streams = append(streams, st)
+		sources = append(sources, logLine{Pod: pod.Name, Container: container})
+	}
+
+	if req.opts.Follow {
+		followLogs(w, r, streams, sources)
+		return
+	}
+	lines := []string{}
+	names := make([]string, 0, len(sources))
+	for i, st := range streams {
+		names = append(names, sources[i].Pod)
+		_ = scanLogLines(st, func(line string) {
+			lines = append(lines, formatLogLine(sources[i], line, len(sources) > 1))
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"component": component,
+		"pods":      names,
+		"lines":     lines,
+	})
+}
+
+// followLogs streams lines from every pod as they arrive until all streams end
+// or the client goes away. Clients asking for text/plain get chunked lines;
+// everyone else gets Server-Sent Events carrying a logLine each.
+func followLogs(w http.ResponseWriter, r *http.Request, streams []io.ReadCloser, sources []logLine) {
+	sse := !strings.Contains(r.Header.Get("Accept"), "text/plain")
+	clearWriteDeadline(r)
+	rc := http.NewResponseController(w)
+	if sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	_ = rc.Flush()
+
+	lines := make(chan logLine)
+	var wg sync.WaitGroup
+	for i, st := range streams {
+		wg.Add(1)
+		go func(st io.Reader, src logLine) {
+			defer wg.Done()
+			_ = scanLogLines(st, func(line string) {
+				src.Line = line
+				select {
+				case lines <- src:
+				case <-r.Context().Done():
+				}
+			})
+		}(st, sources[i])
+	}
+	go func() {
+		wg.Wait()
+		close(lines)
+	}()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case line, ok := <-lines:
+			if !ok {
+				if sse {
+					_, _ = io.WriteString(w, "event: end\ndata: {}\n\n")
+					_ = rc.Flush()
+				}
+				return
+			}
+			var err error
+			if sse {
+				raw, _ := json.Marshal(line)
+				_, err = fmt.Fprintf(w, "event: log\ndata: %s\n\n", raw)
+			} else {
+				_, err = io.WriteString(w, formatLogLine(line, line.Line, len(sources) > 1)+"\n")
+			}
+			if err != nil {
+				return
+			}
+			_ = rc.Flush()
+		}
+	}
+}
+
+func scanLogLines(r io.Reader, fn func(string)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLogLineBytes)
+	for scanner.Scan() {
+		fn(scanner.Text())
+	}
+	return scanner.Err()
+}
+
+// formatLogLine prefixes the line with its pod when output from several pods
+// is interleaved.
+func formatLogLine(src logLine, line string, prefix bool) string {
+	if !prefix {
+		return line
+	}
+	return "[" + src.Pod + "] " + line
+}
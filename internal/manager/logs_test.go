@@ -0,0 +1,108 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/vaheed/kubenova/pkg/types"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestAppLogsReadsComponentPods(t *testing.T) {
+	t.Setenv("KUBENOVA_REQUIRE_AUTH", "false")
+
+	srv := newTestServer(t)
+	st, client := srv.store, srv.client
+	ctx := context.Background()
+
+	cluster := &types.Cluster{Name: "logs", Kubeconfig: "fake"}
+	if err := st.CreateCluster(ctx, cluster); err != nil {
+		t.Fatalf("create cluster: %v", err)
+	}
+	tenant := &types.Tenant{ClusterID: cluster.ID, Name: "acme"}
+	if err := st.CreateTenant(ctx, tenant); err != nil {
+		t.Fatalf("create tenant: %v", err)
+	}
+	project := &types.Project{ClusterID: cluster.ID, TenantID: tenant.ID, Name: "web"}
+	if err := st.CreateProject(ctx, project); err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	app := &types.App{ClusterID: cluster.ID, TenantID: tenant.ID, ProjectID: project.ID, Name: "api"}
+	if err := st.CreateApp(ctx, app); err != nil {
+		t.Fatalf("create app: %v", err)
+	}
+
+	pod := func(name, appName, component string) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: tenant.AppsNamespace,
+				Labels:    map[string]string{velaAppNameLabel: appName, velaComponentLabel: component},
+			},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "sidecar"}, {Name: component}}},
+		}
+	}
+	pods := []ctrlclient.Object{
+		pod("api-web-b", "api", "web"),
+		pod("api-web-a", "api", "web"),
+		pod("api-worker-a", "api", "worker"),
+		pod("other-web-a", "other", "web"),
+	}
+	for _, pod := range pods {
+		if err := srv.kube.Create(ctx, pod); err != nil {
+			t.Fatalf("create pod: %v", err)
+		}
+	}
+	srv.logsFactory = func(context.Context, string) (kubernetes.Interface, error) {
+		return kubefake.NewSimpleClientset(), nil
+	}
+	logsURL := fmt.Sprintf("%s/clusters/%s/tenants/%s/projects/%s/apps/%s/logs", srv.baseURL, cluster.ID, tenant.ID, project.ID, app.ID)
+
+	out := doJSON[struct {
+		Component string   `json:"component"`
+		Pods      []string `json:"pods"`
+		Lines     []string `json:"lines"`
+	}](t, client, http.MethodGet, logsURL+"/web?tailLines=20&sinceSeconds=60", nil, http.StatusOK)
+	if fmt.Sprint(out.Pods) != "[api-web-a api-web-b]" {
+		t.Fatalf("expected the app's web pods, got %v", out.Pods)
+	}
+	if len(out.Lines) != 2 || out.Lines[0] != "[api-web-a] fake logs" {
+		t.Fatalf("unexpected lines: %q", out.Lines)
+	}
+
+	doNoBody(t, client, http.MethodGet, logsURL+"/db", nil, http.StatusNotFound)
+	doNoBody(t, client, http.MethodGet, logsURL+"/web?tailLines=-1", nil, http.StatusBadRequest)
+	doNoBody(t, client, http.MethodGet, logsURL+"/web?follow=true&previous=true", nil, http.StatusBadRequest)
+	doNoBody(t, client, http.MethodGet, logsURL+"/worker?container=missing", nil, http.StatusBadRequest)
+
+	resp := doRequest(t, client, http.MethodGet, logsURL+"/worker?follow=true", nil)
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %q", resp.Header.Get("Content-Type"))
+	}
+	want := "event: log\ndata: {\"pod\":\"api-worker-a\",\"container\":\"worker\",\"line\":\"fake logs\"}\n\nevent: end\ndata: {}\n\n"
+	if string(body) != want {
+		t.Fatalf("unexpected stream:\n%s", body)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, logsURL+"/worker?follow=true", nil)
+	req.Header.Set("Accept", "text/plain")
+	plain, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("follow plain: %v", err)
+	}
+	defer plain.Body.Close()
+	body, _ = io.ReadAll(plain.Body)
+	if !strings.HasPrefix(plain.Header.Get("Content-Type"), "text/plain") || string(body) != "fake logs\n" {
+		t.Fatalf("unexpected plain stream %q: %q", plain.Header.Get("Content-Type"), body)
+	}
+}
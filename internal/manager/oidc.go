@@ -0,0 +1,351 @@
+package manager
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/vaheed/kubenova/internal/logging"
+	"github.com/vaheed/kubenova/pkg/types"
+	"go.uber.org/zap"
+)
+
+const (
+	// jwksCacheTTL is how long fetched signing keys are used before they are
+	// fetched again.
+	jwksCacheTTL = time.Hour
+	// jwksMinRefreshInterval limits how often a token with an unknown key ID
+	// makes the manager fetch the keys again.
+	jwksMinRefreshInterval = time.Minute
+	oidcFetchTimeout       = 10 * time.Second
+	maxJWKSBytes           = 1 << 20
+)
+
+// oidcSigningMethods are the algorithms accepted from OIDC issuers.
+var oidcSigningMethods = []string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodES256.Alg()}
+
+// OIDCIssuerConfig configures one identity provider whose tokens the manager
+// accepts. OIDC_ISSUERS holds a JSON array of them.
+type OIDCIssuerConfig struct {
+	// Issuer must equal the iss claim of the tokens.
+	Issuer string `json:"issuer"`
+	// Audience must be one of the aud claims of the tokens.
+	Audience string `json:"audience"`
+	// JWKSURL skips discovery through /.well-known/openid-configuration.
+	JWKSURL string `json:"jwksUrl,omitempty"`
+	// SubjectClaim names the caller in the audit log; defaults to "sub".
+	SubjectClaim string `json:"subjectClaim,omitempty"`
+	// GroupsClaim and EmailClaim default to "groups" and "email".
+	GroupsClaim string `json:"groupsClaim,omitempty"`
+	EmailClaim  string `json:"emailClaim,omitempty"`
+	// GroupRoles maps groups onto KubeNova roles.
+	GroupRoles map[string][]string `json:"groupRoles,omitempty"`
+	// EmailRoles maps addresses, or whole domains written as "@example.com",
+	// onto KubeNova roles. Only addresses the token marks with
+	// email_verified: true count.
+	EmailRoles map[string][]string `json:"emailRoles,omitempty"`
+	// TrustUnverifiedEmail applies EmailRoles whatever email_verified says,
+	// for issuers that only issue verified addresses but leave the claim out.
+	TrustUnverifiedEmail bool `json:"trustUnverifiedEmail,omitempty"`
+	// GroupBindings maps groups onto roles on a cluster, tenant or project.
+	GroupBindings map[string][]types.RoleBinding `json:"groupBindings,omitempty"`
+	// DefaultRoles are given to every caller with a valid token.
+	DefaultRoles []string `json:"defaultRoles,omitempty"`
+}
+
+// ParseOIDCIssuers reads the OIDC_ISSUERS setting. An empty value configures
+// no issuers.
+func ParseOIDCIssuers(raw string) ([]OIDCIssuerConfig, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var cfgs []OIDCIssuerConfig
+	if err := json.Unmarshal([]byte(raw), &cfgs); err != nil {
+		return nil, fmt.Errorf("OIDC_ISSUERS: %w", err)
+	}
+	seen := map[string]bool{}
+	for i := range cfgs {
+		cfg := &cfgs[i]
+		cfg.Issuer = strings.TrimRight(strings.TrimSpace(cfg.Issuer), "/")
+		switch {
+		case !strings.HasPrefix(cfg.Issuer, "https://") && !strings.HasPrefix(cfg.Issuer, "http://"):
+			return nil, fmt.Errorf("OIDC_ISSUERS: issuer %q must be an http or https URL", cfg.Issuer)
+		case cfg.Audience == "":
+			return nil, fmt.Errorf("OIDC_ISSUERS: issuer %s needs an audience", cfg.Issuer)
+		case seen[cfg.Issuer]:
+			return nil, fmt.Errorf("OIDC_ISSUERS: issuer %s is configured twice", cfg.Issuer)
+		}
+		seen[cfg.Issuer] = true
+		for group, bindings := range cfg.GroupBindings {
+			for _, b := range bindings {
+				if err := validBinding(b); err != nil {
+					return nil, fmt.Errorf("OIDC_ISSUERS: issuer %s group %s: %w", cfg.Issuer, group, err)
+				}
+			}
+		}
+		if cfg.SubjectClaim == "" {
+			cfg.SubjectClaim = "sub"
+		}
+		if cfg.GroupsClaim == "" {
+			cfg.GroupsClaim = "groups"
+		}
+		if cfg.EmailClaim == "" {
+			cfg.EmailClaim = "email"
+		}
+	}
+	return cfgs, nil
+}
+
+// oidcIssuer verifies the tokens of one issuer with its published keys.
+type oidcIssuer struct {
+	cfg         OIDCIssuerConfig
+	client      *http.Client
+	minRefresh  time.Duration
+	mu          sync.Mutex
+	jwksURL     string
+	keys        map[string]any
+	fetchedAt   time.Time
+	lastAttempt time.Time
+}
+
+func newOIDCIssuers(cfgs []OIDCIssuerConfig) map[string]*oidcIssuer {
+	out := make(map[string]*oidcIssuer, len(cfgs))
+	for _, cfg := range cfgs {
+		out[cfg.Issuer] = &oidcIssuer{
+			cfg:        cfg,
+			client:     &http.Client{Timeout: oidcFetchTimeout},
+			minRefresh: jwksMinRefreshInterval,
+			jwksURL:    cfg.JWKSURL,
+		}
+	}
+	return out
+}
+
+// oidcIssuerFor returns the issuer a token claims to come from.
+func (s *Server) oidcIssuerFor(t *jwt.Token) (*oidcIssuer, error) {
+	claims, ok := t.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid token claims")
+	}
+	iss, _ := claims.GetIssuer()
+	issuer, ok := s.oidc[strings.TrimRight(iss, "/")]
+	if !ok {
+		return nil, fmt.Errorf("unknown issuer %q", iss)
+	}
+	return issuer, nil
+}
+
+// key returns the signing key with the given ID. Keys are fetched again once
+// the cache is stale, or sooner when a token names a key that is not cached,
+// which is how key rotation is picked up.
+func (i *oidcIssuer) key(ctx context.Context, kid string) (any, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	now := time.Now()
+	key, ok := i.keys[kid]
+	stale := now.Sub(i.fetchedAt) > jwksCacheTTL
+	if (!ok || stale) && now.Sub(i.lastAttempt) >= i.minRefresh {
+		i.lastAttempt = now
+		if err := i.refresh(ctx); err != nil {
+			logging.L.Warn("oidc_jwks_fetch_failed", zap.String("issuer", i.cfg.Issuer), zap.Error(err))
+			if i.keys == nil {
+				return nil, err
+			}
+		} else {
+			i.fetchedAt = now
+		}
+		key, ok = i.keys[kid]
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+func (i *oidcIssuer) refresh(ctx context.Context) error {
+	if i.jwksURL == "" {
+		var discovery struct {
+			Issuer  string `json:"issuer"`
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := i.getJSON(ctx, i.cfg.Issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+			return fmt.Errorf("discovery: %w", err)
+		}
+		if strings.TrimRight(discovery.Issuer, "/") != i.cfg.Issuer || discovery.JWKSURI == "" {
+			return fmt.Errorf("discovery: unexpected issuer %q or missing jwks_uri", discovery.Issuer)
+		}
+		i.jwksURL = discovery.JWKSURI
+	}
+	var set jwkSet
+	if err := i.getJSON(ctx, i.jwksURL, &set); err != nil {
+		return fmt.Errorf("jwks: %w", err)
+	}
+	keys := make(map[string]any, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			logging.L.Warn("oidc_jwk_skipped", zap.String("issuer", i.cfg.Issuer), zap.String("kid", k.Kid), zap.Error(err))
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+	if len(keys) == 0 {
+		return errors.New("jwks: no usable signing keys")
+	}
+	i.keys = keys
+	return nil
+}
+
+func (i *oidcIssuer) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := i.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: status %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, maxJWKSBytes)).Decode(v)
+}
+
+// authContext checks the issuer-specific claims of a verified token and maps
+// it onto KubeNova roles.
+func (i *oidcIssuer) authContext(claims jwt.MapClaims) (*AuthContext, error) {
+	aud, _ := claims.GetAudience()
+	if !slices.Contains(aud, i.cfg.Audience) {
+		return nil, errors.New("token audience does not match")
+	}
+	if exp, _ := claims.GetExpirationTime(); exp == nil {
+		return nil, errors.New("token has no expiry")
+	}
+	subject, _ := claims[i.cfg.SubjectClaim].(string)
+	if subject == "" {
+		return nil, fmt.Errorf("token has no %s claim", i.cfg.SubjectClaim)
+	}
+	roles := append([]string{}, i.cfg.DefaultRoles...)
+	var bindings []types.RoleBinding
+	for _, group := range stringsClaim(claims[i.cfg.GroupsClaim]) {
+		roles = append(roles, i.cfg.GroupRoles[group]...)
+		bindings = append(bindings, i.cfg.GroupBindings[group]...)
+	}
+	// Unverified addresses could be claimed by anyone.
+	verified := claims["email_verified"] == true || i.cfg.TrustUnverifiedEmail
+	if email, _ := claims[i.cfg.EmailClaim].(string); email != "" && verified {
+		email = strings.ToLower(email)
+		roles = append(roles, i.cfg.EmailRoles[email]...)
+		if at := strings.LastIndexByte(email, '@'); at >= 0 {
+			roles = append(roles, i.cfg.EmailRoles[email[at:]]...)
+		}
+	}
+	slices.Sort(roles)
+	return &AuthContext{Subject: subject, Roles: slices.Compact(roles), Bindings: bindings, Issuer: i.cfg.Issuer}, nil
+}
+
+// stringsClaim reads a claim that is either a list of strings or a single
+// string.
+func stringsClaim(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return []string{v}
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+type jwkSet struct {
+	Keys []jwk `json:"keys"`
+}
+
+// jwk is a public key in JSON Web Key form (RFC 7517).
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jwk) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := jwkInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := jwkInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := jwkInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := jwkInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if x.BitLen() > 256 || y.BitLen() > 256 {
+			return nil, errors.New("invalid EC point")
+		}
+		// ecdh rejects points that are not on the curve.
+		point := make([]byte, 65)
+		point[0] = 4
+		x.FillBytes(point[1:33])
+		y.FillBytes(point[33:])
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func jwkInt(v string) (*big.Int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil || len(raw) == 0 {
+		return nil, errors.New("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(raw), nil
+}
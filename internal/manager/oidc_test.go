@@ -0,0 +1,222 @@
+package manager
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testIdP is an identity provider serving discovery and a JWKS whose keys
+// can be rotated.
+type testIdP struct {
+	*httptest.Server
+	mu   sync.Mutex
+	keys map[string]crypto.Signer
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+	idp := &testIdP{keys: map[string]crypto.Signer{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"issuer": idp.URL, "jwks_uri": idp.URL + "/jwks"})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+		set := jwkSet{}
+		for kid, key := range idp.keys {
+			switch pub := key.Public().(type) {
+			case *rsa.PublicKey:
+				set.Keys = append(set.Keys, jwk{Kid: kid, Kty: "RSA", Use: "sig", N: b64(pub.N), E: b64(big.NewInt(int64(pub.E)))})
+			case *ecdsa.PublicKey:
+				set.Keys = append(set.Keys, jwk{Kid: kid, Kty: "EC", Crv: "P-256", X: b64(pub.X), Y: b64(pub.Y)})
+			}
+		}
+		writeJSON(w, http.StatusOK, set)
+	})
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+func b64(n *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(n.Bytes())
+}
+
+// rotate replaces the published keys with a single new key.
+func (idp *testIdP) rotate(t *testing.T, kid string, key crypto.Signer) {
+	t.Helper()
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.keys = map[string]crypto.Signer{kid: key}
+}
+
+func (idp *testIdP) sign(t *testing.T, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	idp.mu.Lock()
+	key := idp.keys[kid]
+	idp.mu.Unlock()
+	method := jwt.SigningMethod(jwt.SigningMethodRS256)
+	if _, ok := key.(*ecdsa.PrivateKey); ok {
+		method = jwt.SigningMethodES256
+	}
+	tok := jwt.NewWithClaims(method, claims)
+	tok.Header["kid"] = kid
+	signed, err := tok.SignedString(key)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return signed
+}
+
+func TestOIDCAuthentication(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate rsa key: %v", err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate ec key: %v", err)
+	}
+	idp := newTestIdP(t)
+	idp.rotate(t, "rsa-1", rsaKey)
+
+	issuers, _ := json.Marshal([]OIDCIssuerConfig{{
+		Issuer:       idp.URL,
+		Audience:     "kubenova",
+		GroupRoles:   map[string][]string{"platform": {"admin"}},
+		EmailRoles:   map[string][]string{"@example.com": {"readOnly"}},
+		DefaultRoles: []string{"tenantViewer"},
+	}})
+	t.Setenv("KUBENOVA_REQUIRE_AUTH", "true")
+	t.Setenv("JWT_SIGNING_KEY", "oidc-secret")
+	t.Setenv("OIDC_ISSUERS", string(issuers))
+
+	srv := newTestServer(t)
+	srv.oidc[idp.URL].minRefresh = 0
+	client := srv.client
+	meURL := srv.baseURL + "/me"
+
+	me := func(token string, want int) map[string]any {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodGet, meURL, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("GET /me: %v", err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Fatalf("expected %d, got %d", want, resp.StatusCode)
+		}
+		var out map[string]any
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		return out
+	}
+	claims := func(extra jwt.MapClaims) jwt.MapClaims {
+		c := jwt.MapClaims{
+			"iss": idp.URL,
+			"aud": []string{"kubenova", "other"},
+			"sub": "user-1",
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+		for k, v := range extra {
+			c[k] = v
+		}
+		return c
+	}
+
+	out := me(idp.sign(t, "rsa-1", claims(jwt.MapClaims{"groups": []string{"platform", "dev"}})), http.StatusOK)
+	if out["subject"] != "user-1" || out["issuer"] != idp.URL || !sameRoles(out["roles"], "admin", "tenantViewer") {
+		t.Fatalf("expected an admin from the platform group, got %v", out)
+	}
+
+	// A rotated key is fetched when a token names it.
+	idp.rotate(t, "ec-1", ecKey)
+	out = me(idp.sign(t, "ec-1", claims(jwt.MapClaims{"email": "Dana@Example.com", "email_verified": true})), http.StatusOK)
+	if !sameRoles(out["roles"], "readOnly", "tenantViewer") {
+		t.Fatalf("expected readOnly from the email domain, got %v", out)
+	}
+	for _, unverified := range []jwt.MapClaims{
+		{"email": "dana@example.com", "email_verified": false},
+		{"email": "dana@example.com"},
+		{"email": "dana@example.com", "email_verified": "true"},
+	} {
+		if out := me(idp.sign(t, "ec-1", claims(unverified)), http.StatusOK); !sameRoles(out["roles"], "tenantViewer") {
+			t.Fatalf("expected unverified email %v to grant nothing, got %v", unverified, out)
+		}
+	}
+	trusting := &oidcIssuer{cfg: srv.oidc[idp.URL].cfg}
+	trusting.cfg.TrustUnverifiedEmail = true
+	if ac, err := trusting.authContext(claims(jwt.MapClaims{"email": "dana@example.com", "exp": float64(time.Now().Add(time.Hour).Unix())})); err != nil || !slices.Contains(ac.Roles, "readOnly") {
+		t.Fatalf("expected an issuer trusting unverified email to map it, got %+v (%v)", ac, err)
+	}
+
+	me(idp.sign(t, "ec-1", claims(jwt.MapClaims{"aud": "someone-else"})), http.StatusUnauthorized)
+	me(idp.sign(t, "ec-1", claims(jwt.MapClaims{"exp": time.Now().Add(-time.Minute).Unix()})), http.StatusUnauthorized)
+	me(idp.sign(t, "ec-1", claims(jwt.MapClaims{"iss": "https://unknown.example.com"})), http.StatusUnauthorized)
+	noExpiry := claims(nil)
+	delete(noExpiry, "exp")
+	me(idp.sign(t, "ec-1", noExpiry), http.StatusUnauthorized)
+	// The old key is gone after the rotation.
+	idp.rotate(t, "rsa-1", rsaKey)
+	stale := idp.sign(t, "rsa-1", claims(nil))
+	idp.rotate(t, "ec-1", ecKey)
+	me(stale, http.StatusUnauthorized)
+
+	// HS256 tokens issued by the manager keep working.
+	tok := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "local", "roles": []string{"ops"}, "exp": time.Now().Add(time.Hour).Unix(),
+	})
+	signed, _ := tok.SignedString([]byte("oidc-secret"))
+	if out := me(signed, http.StatusOK); out["subject"] != "local" || out["issuer"] != nil {
+		t.Fatalf("expected the HS256 caller, got %v", out)
+	}
+}
+
+func sameRoles(v any, want ...string) bool {
+	raw, _ := json.Marshal(v)
+	var got []string
+	_ = json.Unmarshal(raw, &got)
+	return strings.Join(got, ",") == strings.Join(want, ",")
+}
+
+func TestParseOIDCIssuers(t *testing.T) {
+	cases := map[string]string{
+		`[{"issuer":"https://idp.example.com/","audience":"kn"}]`:                                                 "",
+		`[{"issuer":"idp.example.com","audience":"kn"}]`:                                                          "must be an http or https URL",
+		`[{"issuer":"https://idp.example.com"}]`:                                                                  "needs an audience",
+		`[{"issuer":"https://a.example.com","audience":"kn"},{"issuer":"https://a.example.com/","audience":"x"}]`: "configured twice",
+		`{"issuer":"https://idp.example.com"}`:                                                                    "cannot unmarshal",
+	}
+	for raw, want := range cases {
+		cfgs, err := ParseOIDCIssuers(raw)
+		if want == "" {
+			if err != nil || cfgs[0].Issuer != "https://idp.example.com" || cfgs[0].GroupsClaim != "groups" || cfgs[0].SubjectClaim != "sub" {
+				t.Fatalf("expected defaults for %s, got %+v %v", raw, cfgs, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("expected %q for %s, got %v", want, raw, err)
+		}
+	}
+	if cfgs, err := ParseOIDCIssuers(" "); err != nil || cfgs != nil {
+		t.Fatalf("expected no issuers, got %v %v", cfgs, err)
+	}
+}
@@ -0,0 +1,328 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/vaheed/kubenova/internal/logging"
+	"github.com/vaheed/kubenova/internal/store"
+	"github.com/vaheed/kubenova/pkg/types"
+	"go.uber.org/zap"
+)
+
+// Operation types.
+const (
+	operationClusterCreate    = "cluster.create"
+	operationClusterBootstrap = "cluster.bootstrap"
+	operationClusterRefresh   = "cluster.refresh"
+)
+
+const (
+	// Install steps are named "install_<component>".
+	stepInstallPrefix       = "install_"
+	stepReinstallComponents = "reinstall_components"
+
+	// operationLease is how long an operation may go without a heartbeat
+	// before another manager resumes it.
+	operationLease          = 2 * time.Minute
+	operationHeartbeat      = 30 * time.Second
+	operationResumeInterval = 30 * time.Second
+	operationBatchSize      = 10
+	maxOperationLogs        = 200
+)
+
+func operationLocation(id string) string {
+	return "/api/v1/operations/" + id
+}
+
+// clusterBusy writes a 409 and returns true when an operation is still
+// running on the cluster.
+func (s *Server) clusterBusy(w http.ResponseWriter, r *http.Request, clusterID string) bool {
+	ops, err := s.store.ListOperations(r.Context(), store.OperationQuery{ClusterID: clusterID, Active: true, Limit: 1})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return true
+	}
+	if len(ops) > 0 {
+		writeError(w, http.StatusConflict, "KN-409", fmt.Sprintf("operation %s is still running on this cluster", ops[0].ID))
+		return true
+	}
+	return false
+}
+
+// startOperation records a new operation on c and runs it in the background.
+// The operation is leased to this manager from the start so that no other
+// manager picks it up.
+func (s *Server) startOperation(ctx context.Context, typ string, c *types.Cluster, component string) (*types.Operation, error) {
+	step := stepInstallPrefix + component
+	if typ == operationClusterRefresh {
+		step = stepReinstallComponents
+	}
+	lease := time.Now().UTC().Add(operationLease)
+	op := &types.Operation{
+		Type:           typ,
+		ClusterID:      c.ID,
+		Component:      component,
+		Phase:          types.OperationPending,
+		Steps:          []types.OperationStep{{Name: step, Phase: types.OperationPending}},
+		LeaseExpiresAt: &lease,
+	}
+	if err := s.store.CreateOperation(ctx, op); err != nil {
+		return nil, err
+	}
+	run := *op
+	run.Steps = slices.Clone(op.Steps)
+	go s.runOperation(context.Background(), &run)
+	return op, nil
+}
+
+// RunOperations resumes operations that no manager is working on, such as
+// those interrupted by a restart, until the context is canceled.
+func (s *Server) RunOperations(ctx context.Context) {
+	ticker := time.NewTicker(operationResumeInterval)
+	defer ticker.Stop()
+	for {
+		s.resumeOperations(ctx, time.Now().UTC())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) resumeOperations(ctx context.Context, now time.Time) {
+	ops, err := s.store.ClaimOperations(ctx, now, operationLease, operationBatchSize)
+	if err != nil {
+		logging.L.Warn("operation_claim_failed", zap.Error(err))
+		return
+	}
+	for _, op := range ops {
+		logging.L.Info("operation_resumed", zap.String("operation_id", op.ID), zap.String("type", op.Type))
+		go s.runOperation(ctx, op)
+	}
+}
+
+// runOperation drives op from its first unfinished step to the end. A step
+// that was interrupted runs again, so steps must be safe to repeat. The run
+// stops as soon as another manager has claimed the operation.
+func (s *Server) runOperation(ctx context.Context, op *types.Operation) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	run := &operationRun{s: s, op: op, cancel: cancel}
+	run.update(ctx, func(op *types.Operation) {
+		now := time.Now().UTC()
+		op.Phase = types.OperationRunning
+		op.Attempts++
+		if op.StartedAt == nil {
+			op.StartedAt = &now
+			logOperation(op, "started")
+		} else {
+			logOperation(op, "resumed (attempt %d)", op.Attempts)
+		}
+	})
+	stop := run.heartbeat(ctx)
+	defer stop()
+
+	c, err := s.store.GetCluster(ctx, op.ClusterID)
+	if err != nil {
+		run.finish(ctx, -1, fmt.Errorf("load cluster: %w", err))
+		return
+	}
+	for i := range op.Steps {
+		if op.Steps[i].Phase == types.OperationSucceeded {
+			continue
+		}
+		name := op.Steps[i].Name
+		run.update(ctx, func(op *types.Operation) {
+			now := time.Now().UTC()
+			step := &op.Steps[i]
+			step.Phase, step.StartedAt, step.EndedAt, step.Error = types.OperationRunning, &now, nil, ""
+			logOperation(op, "%s started", name)
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		if err := s.runOperationStep(ctx, c, name); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			run.finish(ctx, i, err)
+			s.failClusterBootstrap(ctx, c, err)
+			return
+		}
+		run.update(ctx, func(op *types.Operation) {
+			now := time.Now().UTC()
+			step := &op.Steps[i]
+			step.Phase, step.EndedAt = types.OperationSucceeded, &now
+			logOperation(op, "%s succeeded", name)
+		})
+	}
+	if ctx.Err() != nil {
+		return
+	}
+	// What was installed decides what the cluster can do; a failed discovery
+	// leaves the previous capabilities in place.
+	if err := s.refreshCapabilities(ctx, c); err != nil {
+		logging.L.Warn("capability_discovery_failed", zap.String("cluster_id", c.ID), zap.Error(err))
+		run.update(ctx, func(op *types.Operation) { logOperation(op, "capability discovery failed: %v", err) })
+	} else {
+		run.update(ctx, func(op *types.Operation) {
+			logOperation(op, "discovered capabilities: %s", describeCapabilities(c.Capabilities))
+		})
+	}
+	if err := s.setClusterStatus(ctx, c, types.ClusterConnected); err != nil {
+		logging.L.Warn("cluster_status_update_failed", zap.String("cluster_id", c.ID), zap.Error(err))
+	}
+	run.finish(ctx, -1, nil)
+}
+
+func (s *Server) runOperationStep(ctx context.Context, c *types.Cluster, step string) error {
+	if component, ok := strings.CutPrefix(step, stepInstallPrefix); ok {
+		if err := s.installComponent(ctx, c, component); err != nil {
+			return fmt.Errorf("%s install: %w", component, err)
+		}
+		return nil
+	}
+	if step == stepReinstallComponents {
+		if err := s.reinstallComponents(ctx, c); err != nil {
+			return fmt.Errorf("reinstall components: %w", err)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown step %q", step)
+}
+
+// operationRun serializes the updates made to a running operation by its
+// steps and by its heartbeat.
+type operationRun struct {
+	s  *Server
+	mu sync.Mutex
+	op *types.Operation
+	// cancel stops the run once the operation was claimed by another manager.
+	cancel context.CancelFunc
+	lost   bool
+}
+
+// update applies fn, renews the lease of an unfinished operation and stores
+// the result. Updates are written only while this manager holds the lease.
+func (r *operationRun) update(ctx context.Context, fn func(op *types.Operation)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.lost {
+		return
+	}
+	if fn != nil {
+		fn(r.op)
+	}
+	if r.op.Finished() {
+		r.op.LeaseExpiresAt = nil
+	} else {
+		lease := time.Now().UTC().Add(operationLease)
+		r.op.LeaseExpiresAt = &lease
+	}
+	err := r.s.store.UpdateOperation(ctx, r.op)
+	switch {
+	case errors.Is(err, store.ErrLeaseLost):
+		logging.L.Warn("operation_lease_lost", zap.String("operation_id", r.op.ID))
+		r.lost = true
+		r.cancel()
+	case err != nil:
+		logging.L.Warn("operation_update_failed", zap.String("operation_id", r.op.ID), zap.Error(err))
+	}
+}
+
+// finish ends the operation; a failed step is marked with the error.
+func (r *operationRun) finish(ctx context.Context, step int, err error) {
+	r.update(ctx, func(op *types.Operation) {
+		now := time.Now().UTC()
+		op.EndedAt = &now
+		if err == nil {
+			op.Phase = types.OperationSucceeded
+			logOperation(op, "succeeded")
+			return
+		}
+		op.Phase, op.Error = types.OperationFailed, err.Error()
+		if step >= 0 {
+			op.Steps[step].Phase, op.Steps[step].Error, op.Steps[step].EndedAt = types.OperationFailed, err.Error(), &now
+		}
+		logOperation(op, "failed: %v", err)
+	})
+}
+
+// heartbeat keeps the lease of the operation until stop is called.
+func (r *operationRun) heartbeat(ctx context.Context) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(operationHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				r.update(ctx, nil)
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+func logOperation(op *types.Operation, format string, args ...any) {
+	op.Logs = append(op.Logs, types.OperationLog{Time: time.Now().UTC(), Message: fmt.Sprintf(format, args...)})
+	if len(op.Logs) > maxOperationLogs {
+		op.Logs = op.Logs[len(op.Logs)-maxOperationLogs:]
+	}
+}
+
+func (s *Server) getOperation(w http.ResponseWriter, r *http.Request) {
+	if !s.requireRole(w, r, "admin", "ops", "readOnly") && s.requireAuth {
+		return
+	}
+	op, err := s.store.GetOperation(r.Context(), chi.URLParam(r, "operationID"))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "KN-404", "operation not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, op)
+}
+
+func (s *Server) listOperations(w http.ResponseWriter, r *http.Request) {
+	if !s.requireRole(w, r, "admin", "ops", "readOnly") && s.requireAuth {
+		return
+	}
+	values := r.URL.Query()
+	q := store.OperationQuery{ClusterID: values.Get("clusterId"), Phase: values.Get("phase")}
+	switch q.Phase {
+	case "", types.OperationPending, types.OperationRunning, types.OperationSucceeded, types.OperationFailed:
+	default:
+		writeError(w, http.StatusBadRequest, "KN-400", "phase must be Pending, Running, Succeeded or Failed")
+		return
+	}
+	if raw := values.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > store.MaxOperationLimit {
+			writeError(w, http.StatusBadRequest, "KN-400", "limit must be between 1 and 1000")
+			return
+		}
+		q.Limit = limit
+	}
+	ops, err := s.store.ListOperations(r.Context(), q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, ops)
+}
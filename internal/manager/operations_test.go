@@ -0,0 +1,186 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vaheed/kubenova/internal/store"
+	"github.com/vaheed/kubenova/pkg/types"
+)
+
+// waitOperation polls an operation until it finishes.
+func waitOperation(t *testing.T, client *http.Client, url string) *types.Operation {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		op := doJSON[*types.Operation](t, client, http.MethodGet, url, nil, http.StatusOK)
+		if op.Finished() {
+			return op
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("operation %s still %s", op.ID, op.Phase)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestClusterOperations(t *testing.T) {
+	t.Setenv("KUBENOVA_REQUIRE_AUTH", "false")
+	t.Setenv("CLUSTER_PREFLIGHT", "false")
+
+	srv := newTestServer(t)
+	st := srv.store
+	var (
+		mu        sync.Mutex
+		installed []string
+		failWith  error
+		release   chan struct{}
+	)
+	srv.installComponent = func(_ context.Context, _ *types.Cluster, component string) error {
+		mu.Lock()
+		wait, err := release, failWith
+		installed = append(installed, component)
+		mu.Unlock()
+		if wait != nil {
+			<-wait
+		}
+		return err
+	}
+	srv.reinstallComponents = func(context.Context, *types.Cluster) error { return nil }
+	client := srv.client
+	baseURL := srv.baseURL
+	ctx := context.Background()
+
+	resp := doRequest(t, client, http.MethodPost, baseURL+"/clusters", map[string]any{
+		"name": "ops", "kubeconfig": fakeKubeconfigB64,
+	})
+	resp.Body.Close()
+	location := resp.Header.Get("Operation-Location")
+	if resp.StatusCode != http.StatusCreated || !strings.HasPrefix(location, "/api/v1/operations/") {
+		t.Fatalf("expected 201 with an Operation-Location, got %d %q", resp.StatusCode, location)
+	}
+	op := waitOperation(t, client, srv.url+location)
+	if op.Type != operationClusterCreate || op.Phase != types.OperationSucceeded || op.Attempts != 1 ||
+		len(op.Steps) != 1 || op.Steps[0].Name != "install_operator" || op.Steps[0].Phase != types.OperationSucceeded ||
+		len(op.Logs) == 0 || op.LeaseExpiresAt != nil {
+		t.Fatalf("expected the operator install to succeed, got %+v", op)
+	}
+	clusterURL := baseURL + "/clusters/" + op.ClusterID
+	if c := doJSON[*types.Cluster](t, client, http.MethodGet, clusterURL, nil, http.StatusOK); c.Status != "connected" {
+		t.Fatalf("expected the cluster to be connected, got %s", c.Status)
+	}
+
+	// A failing install fails the operation and the cluster.
+	mu.Lock()
+	failWith = errors.New("chart not found")
+	mu.Unlock()
+	op = doJSON[*types.Operation](t, client, http.MethodPost, clusterURL+"/bootstrap/capsule:upgrade", nil, http.StatusAccepted)
+	if op.Component != "capsule" || op.Phase != types.OperationPending {
+		t.Fatalf("expected a pending capsule install, got %+v", op)
+	}
+	op = waitOperation(t, client, baseURL+"/operations/"+op.ID)
+	if op.Phase != types.OperationFailed || op.Error != "capsule install: chart not found" || op.Steps[0].Error != op.Error {
+		t.Fatalf("expected the install to fail, got %+v", op)
+	}
+	if c := doJSON[*types.Cluster](t, client, http.MethodGet, clusterURL, nil, http.StatusOK); c.Status != "error" {
+		t.Fatalf("expected the cluster to be in error, got %s", c.Status)
+	}
+	doNoBody(t, client, http.MethodPost, clusterURL+"/bootstrap/nginx", nil, http.StatusBadRequest)
+
+	// Only one operation runs on a cluster at a time.
+	mu.Lock()
+	failWith, release = nil, make(chan struct{})
+	mu.Unlock()
+	running := doJSON[*types.Operation](t, client, http.MethodPost, clusterURL+"/bootstrap/operator", nil, http.StatusAccepted)
+	doNoBody(t, client, http.MethodPost, clusterURL+"/refresh", nil, http.StatusConflict)
+	close(release)
+	waitOperation(t, client, baseURL+"/operations/"+running.ID)
+	refresh := doJSON[*types.Operation](t, client, http.MethodPost, clusterURL+"/refresh", nil, http.StatusAccepted)
+	if op = waitOperation(t, client, baseURL+"/operations/"+refresh.ID); op.Phase != types.OperationSucceeded || op.Steps[0].Name != "reinstall_components" {
+		t.Fatalf("expected the refresh to succeed, got %+v", op)
+	}
+
+	// An operation whose manager stopped is resumed at the interrupted step.
+	started := time.Now().UTC().Add(-time.Hour)
+	expired := started.Add(operationLease)
+	orphan := &types.Operation{
+		Type:           operationClusterBootstrap,
+		ClusterID:      op.ClusterID,
+		Component:      "kubevela",
+		Phase:          types.OperationRunning,
+		Attempts:       1,
+		Steps:          []types.OperationStep{{Name: "install_kubevela", Phase: types.OperationRunning, StartedAt: &started}},
+		StartedAt:      &started,
+		LeaseExpiresAt: &expired,
+	}
+	if err := st.CreateOperation(ctx, orphan); err != nil {
+		t.Fatalf("create operation: %v", err)
+	}
+	srv.resumeOperations(ctx, time.Now().UTC())
+	op = waitOperation(t, client, baseURL+"/operations/"+orphan.ID)
+	if op.Phase != types.OperationSucceeded || op.Attempts != 2 || !strings.Contains(op.Logs[0].Message, "resumed") {
+		t.Fatalf("expected the operation to be resumed, got %+v", op)
+	}
+	mu.Lock()
+	if want := "operator,capsule,operator,kubevela"; strings.Join(installed, ",") != want {
+		t.Fatalf("expected installs %s, got %v", want, installed)
+	}
+	mu.Unlock()
+
+	ops := doJSON[[]*types.Operation](t, client, http.MethodGet,
+		fmt.Sprintf("%s/operations?clusterId=%s&phase=Succeeded", baseURL, op.ClusterID), nil, http.StatusOK)
+	if len(ops) != 4 || ops[0].ID != orphan.ID {
+		t.Fatalf("expected four succeeded operations newest first, got %d", len(ops))
+	}
+	doNoBody(t, client, http.MethodGet, baseURL+"/operations?phase=Lost", nil, http.StatusBadRequest)
+	doNoBody(t, client, http.MethodGet, baseURL+"/operations/missing", nil, http.StatusNotFound)
+}
+
+func TestOperationLeaseIsExclusive(t *testing.T) {
+	srv := newTestServer(t)
+	st := srv.store
+	ctx := context.Background()
+
+	expired := time.Now().UTC().Add(-time.Minute)
+	op := &types.Operation{
+		Type:           operationClusterRefresh,
+		ClusterID:      "c1",
+		Phase:          types.OperationRunning,
+		Steps:          []types.OperationStep{{Name: stepReinstallComponents, Phase: types.OperationRunning}},
+		LeaseExpiresAt: &expired,
+	}
+	if err := st.CreateOperation(ctx, op); err != nil {
+		t.Fatalf("create operation: %v", err)
+	}
+	second := &types.Operation{Type: operationClusterRefresh, ClusterID: "c1", Phase: types.OperationPending}
+	if err := st.CreateOperation(ctx, second); !errors.Is(err, store.ErrConflict) {
+		t.Fatalf("expected a second active operation on the cluster to conflict, got %v", err)
+	}
+
+	// Another manager claims the operation while this one still works on it.
+	claimed, err := st.ClaimOperations(ctx, time.Now().UTC(), operationLease, operationBatchSize)
+	if err != nil || len(claimed) != 1 || claimed[0].LeaseGeneration != op.LeaseGeneration+1 {
+		t.Fatalf("expected the claim to bump the lease generation, got %+v (%v)", claimed, err)
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	run := &operationRun{s: srv.Server, op: op, cancel: cancel}
+	run.update(runCtx, func(op *types.Operation) { op.Phase = types.OperationSucceeded })
+	if runCtx.Err() == nil {
+		t.Fatalf("expected the run to stop once its lease was lost")
+	}
+	stored, err := st.GetOperation(ctx, op.ID)
+	if err != nil || stored.Phase != types.OperationRunning {
+		t.Fatalf("expected the stale run not to overwrite the operation, got %+v (%v)", stored, err)
+	}
+	claimed[0].Phase = types.OperationSucceeded
+	if err := st.UpdateOperation(ctx, claimed[0]); err != nil {
+		t.Fatalf("expected the new holder to update the operation: %v", err)
+	}
+}
@@ -0,0 +1,328 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/vaheed/kubenova/internal/logging"
+	"github.com/vaheed/kubenova/internal/store"
+	"github.com/vaheed/kubenova/pkg/types"
+	"go.uber.org/zap"
+)
+
+func (s *Server) createPlan(w http.ResponseWriter, r *http.Request) {
+	if !s.requireRole(w, r, "admin", "ops") {
+		return
+	}
+	var req PlanRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "KN-400", err.Error())
+		return
+	}
+	if strings.TrimSpace(req.Name) == "" {
+		writeError(w, http.StatusBadRequest, "KN-400", "name is required")
+		return
+	}
+	plan := &types.Plan{
+		Name:            strings.TrimSpace(req.Name),
+		Description:     req.Description,
+		Quotas:          req.Quotas,
+		Limits:          req.Limits,
+		NetworkPolicies: req.NetworkPolicies,
+		Components:      req.Components,
+		Pricing:         req.Pricing,
+	}
+	if err := s.store.CreatePlan(r.Context(), plan); err != nil {
+		if errors.Is(err, store.ErrConflict) {
+			writeError(w, http.StatusConflict, "KN-409", "plan already exists")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusCreated, plan)
+}
+
+func (s *Server) listPlans(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAnyRole(w, r, "admin", "ops", "tenantOwner", "readOnly") {
+		return
+	}
+	plans, err := s.store.ListPlans(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, plans)
+}
+
+func (s *Server) getPlan(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAnyRole(w, r, "admin", "ops", "tenantOwner", "readOnly") {
+		return
+	}
+	plan, err := s.store.GetPlan(r.Context(), chi.URLParam(r, "planName"))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "KN-404", "plan not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, plan)
+}
+
+func (s *Server) updatePlan(w http.ResponseWriter, r *http.Request) {
+	if !s.requireRole(w, r, "admin", "ops") {
+		return
+	}
+	plan, err := s.store.GetPlan(r.Context(), chi.URLParam(r, "planName"))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "KN-404", "plan not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return
+	}
+	var req PlanRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "KN-400", err.Error())
+		return
+	}
+	prev := *plan
+	if req.Name != "" && strings.TrimSpace(req.Name) != plan.Name {
+		writeError(w, http.StatusBadRequest, "KN-400", "plan name cannot be changed")
+		return
+	}
+	if req.Description != "" {
+		plan.Description = req.Description
+	}
+	if req.Quotas != nil {
+		plan.Quotas = req.Quotas
+	}
+	if req.Limits != nil {
+		plan.Limits = req.Limits
+	}
+	if req.NetworkPolicies != nil {
+		plan.NetworkPolicies = req.NetworkPolicies
+	}
+	if req.Components != nil {
+		plan.Components = req.Components
+	}
+	if req.Pricing != nil {
+		plan.Pricing = req.Pricing
+	}
+	if err := s.store.UpdatePlan(r.Context(), plan); err != nil {
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return
+	}
+	if err := s.reapplyPlan(r.Context(), &prev, plan); err != nil {
+		writeError(w, http.StatusInternalServerError, "KN-500", fmt.Sprintf("apply plan to tenants: %v", err))
+		return
+	}
+	writeJSON(w, http.StatusOK, plan)
+}
+
+// reapplyPlan moves the tenants on a plan from its previous defaults to the
+// updated ones. Values a tenant overrode when it was assigned stay as they are.
+func (s *Server) reapplyPlan(ctx context.Context, prev, plan *types.Plan) error {
+	tenants, _, err := s.store.ListTenants(ctx, "", store.ListOptions{})
+	if err != nil {
+		return err
+	}
+	for _, t := range tenants {
+		if t.Plan != plan.Name {
+			continue
+		}
+		if err := s.reapplyTenantPlan(ctx, prev, plan, t); err != nil {
+			return fmt.Errorf("tenant %s: %w", t.Name, err)
+		}
+	}
+	return nil
+}
+
+func (s *Server) reapplyTenantPlan(ctx context.Context, prev, plan *types.Plan, t *types.Tenant) error {
+	for attempt := 1; ; attempt++ {
+		quotas, limits, networkPolicies := planOverrides(prev, t)
+		applyPlan(t, plan, quotas, limits, networkPolicies)
+		t.UpdatedAt = time.Now().UTC()
+		err := s.store.UpdateTenant(ctx, t)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, store.ErrVersionConflict) || attempt == 3 {
+			return err
+		}
+		if t, err = s.store.GetTenant(ctx, t.ClusterID, t.ID); err != nil {
+			return err
+		}
+		if t.Plan != plan.Name {
+			return nil
+		}
+	}
+	s.publishEvent(ctx, eventTenantUpdated, t)
+	if err := s.syncTenant(ctx, t); err != nil {
+		logging.L.Warn("plan_tenant_sync_failed", zap.String("tenant_id", t.ID), zap.String("plan", plan.Name), zap.Error(err))
+	}
+	return nil
+}
+
+// planOverrides returns the parts of the tenant's envelope that differ from
+// the plan defaults it was given.
+func planOverrides(plan *types.Plan, t *types.Tenant) (quotas, limits map[string]string, networkPolicies []string) {
+	quotas = overriddenValues(plan.Quotas, t.Quotas)
+	limits = overriddenValues(plan.Limits, t.Limits)
+	if !slices.Equal(plan.NetworkPolicies, t.NetworkPolicies) {
+		networkPolicies = append([]string{}, t.NetworkPolicies...)
+	}
+	return quotas, limits, networkPolicies
+}
+
+func overriddenValues(defaults, values map[string]string) map[string]string {
+	var out map[string]string
+	for k, v := range values {
+		if d, ok := defaults[k]; ok && d == v {
+			continue
+		}
+		if out == nil {
+			out = make(map[string]string)
+		}
+		out[k] = v
+	}
+	return out
+}
+
+func (s *Server) deletePlan(w http.ResponseWriter, r *http.Request) {
+	if !s.requireRole(w, r, "admin", "ops") {
+		return
+	}
+	if err := s.store.DeletePlan(r.Context(), chi.URLParam(r, "planName")); err != nil {
+		switch {
+		case errors.Is(err, store.ErrNotFound):
+			writeError(w, http.StatusNotFound, "KN-404", "plan not found")
+		case errors.Is(err, store.ErrPlanInUse):
+			writeError(w, http.StatusConflict, "KN-409", err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) updateTenantPlan(w http.ResponseWriter, r *http.Request) {
+	if !s.requireRole(w, r, "admin", "ops") {
+		return
+	}
+	clusterID := chi.URLParam(r, "clusterID")
+	tenantID := chi.URLParam(r, "tenantID")
+	var req TenantPlanRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "KN-400", err.Error())
+		return
+	}
+	if strings.TrimSpace(req.Plan) == "" {
+		writeError(w, http.StatusBadRequest, "KN-400", "plan is required")
+		return
+	}
+	t, err := s.store.GetTenant(r.Context(), clusterID, tenantID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "KN-404", "tenant not found")
+		return
+	}
+	if !checkIfMatch(w, r, t.ResourceVersion) {
+		return
+	}
+	plan, ok := s.lookupPlan(w, r, strings.TrimSpace(req.Plan))
+	if !ok {
+		return
+	}
+	applyPlan(t, plan, req.Quotas, req.Limits, req.NetworkPolicies)
+	t.UpdatedAt = time.Now().UTC()
+	if err := s.store.UpdateTenant(r.Context(), t); err != nil {
+		writeUpdateError(w, r, err)
+		return
+	}
+	s.publishEvent(r.Context(), eventTenantUpdated, t)
+	if err := s.syncTenant(r.Context(), t); err != nil {
+		writeError(w, http.StatusInternalServerError, "KN-500", fmt.Sprintf("sync tenant: %v", err))
+		return
+	}
+	writeVersioned(w, http.StatusOK, t.ResourceVersion, t)
+}
+
+// lookupPlan resolves a catalog plan and writes the error response when it is missing.
+func (s *Server) lookupPlan(w http.ResponseWriter, r *http.Request, name string) (*types.Plan, bool) {
+	plan, err := s.store.GetPlan(r.Context(), name)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusUnprocessableEntity, "KN-422", fmt.Sprintf("plan %q not found", name))
+			return nil, false
+		}
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return nil, false
+	}
+	return plan, true
+}
+
+// applyPlan assigns the plan to the tenant and resets its resource envelope to
+// the plan defaults overlaid with the explicit overrides.
+func applyPlan(t *types.Tenant, plan *types.Plan, quotas, limits map[string]string, networkPolicies []string) {
+	t.Plan = plan.Name
+	t.Quotas = mergeStringMap(plan.Quotas, quotas)
+	t.Limits = mergeStringMap(plan.Limits, limits)
+	if networkPolicies != nil {
+		t.NetworkPolicies = networkPolicies
+	} else {
+		t.NetworkPolicies = append([]string(nil), plan.NetworkPolicies...)
+	}
+}
+
+func mergeStringMap(defaults, overrides map[string]string) map[string]string {
+	if len(defaults) == 0 && len(overrides) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(defaults)+len(overrides))
+	for k, v := range defaults {
+		out[k] = v
+	}
+	for k, v := range overrides {
+		out[k] = v
+	}
+	return out
+}
+
+// checkPlanComponent rejects component types that the tenant's plan does not allow.
+func (s *Server) checkPlanComponent(ctx context.Context, tenant *types.Tenant, spec map[string]any) error {
+	if tenant == nil || tenant.Plan == "" {
+		return nil
+	}
+	compType, _ := spec["type"].(string)
+	if compType == "" {
+		return nil
+	}
+	plan, err := s.store.GetPlan(ctx, tenant.Plan)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+	if len(plan.Components) == 0 {
+		return nil
+	}
+	for _, allowed := range plan.Components {
+		if allowed == compType {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: component type %q is not allowed by plan %q", errPlanViolation, compType, plan.Name)
+}
+
+var errPlanViolation = errors.New("plan violation")
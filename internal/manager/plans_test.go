@@ -0,0 +1,121 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/vaheed/kubenova/internal/store"
+	v1alpha1 "github.com/vaheed/kubenova/pkg/api/v1alpha1"
+	"github.com/vaheed/kubenova/pkg/types"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestPlanDefaultsAppliedToTenants(t *testing.T) {
+	t.Setenv("KUBENOVA_REQUIRE_AUTH", "false")
+	t.Setenv("CLUSTER_PREFLIGHT", "false")
+
+	srv := newTestServer(t)
+	client, baseURL := srv.client, srv.baseURL
+
+	_ = doJSON[*types.Plan](t, client, http.MethodPost, baseURL+"/plans", map[string]any{
+		"name":            "silver",
+		"quotas":          map[string]string{"cpu": "2", "memory": "4Gi"},
+		"limits":          map[string]string{"memory": "512Mi"},
+		"networkPolicies": []string{"default-deny"},
+		"components":      []string{"webservice"},
+	}, http.StatusCreated)
+	_ = doJSON[*types.Plan](t, client, http.MethodPost, baseURL+"/plans", map[string]any{
+		"name":   "gold",
+		"quotas": map[string]string{"cpu": "8", "memory": "16Gi"},
+	}, http.StatusCreated)
+	doNoBody(t, client, http.MethodPost, baseURL+"/plans", map[string]any{"name": "gold"}, http.StatusConflict)
+
+	plans := doJSON[[]*types.Plan](t, client, http.MethodGet, baseURL+"/plans", nil, http.StatusOK)
+	if len(plans) != 2 || plans[0].Name != "gold" || plans[1].Name != "silver" {
+		t.Fatalf("expected plans sorted by name, got %+v", plans)
+	}
+
+	cluster := doJSON[*types.Cluster](t, client, http.MethodPost, baseURL+"/clusters", map[string]any{
+		"name":       "plans",
+		"kubeconfig": fakeKubeconfigB64,
+	}, http.StatusCreated)
+	tenantsURL := fmt.Sprintf("%s/clusters/%s/tenants", baseURL, cluster.ID)
+
+	doNoBody(t, client, http.MethodPost, tenantsURL, map[string]any{
+		"name": "ghost",
+		"plan": "platinum",
+	}, http.StatusUnprocessableEntity)
+
+	tenant := doJSON[*types.Tenant](t, client, http.MethodPost, tenantsURL, map[string]any{
+		"name":   "acme",
+		"plan":   "silver",
+		"quotas": map[string]string{"cpu": "3"},
+	}, http.StatusCreated)
+	if tenant.Quotas["cpu"] != "3" || tenant.Quotas["memory"] != "4Gi" {
+		t.Fatalf("expected plan quotas merged with overrides, got %+v", tenant.Quotas)
+	}
+	if tenant.Limits["memory"] != "512Mi" || len(tenant.NetworkPolicies) != 1 {
+		t.Fatalf("expected plan limits and policies, got %+v %+v", tenant.Limits, tenant.NetworkPolicies)
+	}
+
+	project := doJSON[*types.Project](t, client, http.MethodPost,
+		fmt.Sprintf("%s/%s/projects", tenantsURL, tenant.ID), map[string]any{"name": "web"}, http.StatusCreated)
+	appsURL := fmt.Sprintf("%s/%s/projects/%s/apps", tenantsURL, tenant.ID, project.ID)
+	doNoBody(t, client, http.MethodPost, appsURL, map[string]any{
+		"name": "worker",
+		"spec": map[string]any{"type": "worker"},
+	}, http.StatusUnprocessableEntity)
+	_ = doJSON[*types.App](t, client, http.MethodPost, appsURL, map[string]any{
+		"name": "api",
+		"spec": map[string]any{"type": "webservice"},
+	}, http.StatusCreated)
+
+	upgraded := doJSON[*types.Tenant](t, client, http.MethodPut,
+		fmt.Sprintf("%s/%s/plan", tenantsURL, tenant.ID), map[string]any{
+			"plan":   "gold",
+			"limits": map[string]string{"memory": "2Gi"},
+		}, http.StatusOK)
+	if upgraded.Plan != "gold" || upgraded.Quotas["cpu"] != "8" || upgraded.Limits["memory"] != "2Gi" {
+		t.Fatalf("expected gold envelope, got %+v", upgraded)
+	}
+	if len(upgraded.NetworkPolicies) != 0 {
+		t.Fatalf("expected gold network policies, got %+v", upgraded.NetworkPolicies)
+	}
+
+	var cr v1alpha1.NovaTenant
+	if err := srv.kube.Get(context.Background(), ctrlclient.ObjectKey{Name: "acme"}, &cr); err != nil {
+		t.Fatalf("get tenant CR: %v", err)
+	}
+	if cr.Spec.Plan != "gold" || cr.Spec.Quotas["memory"] != "16Gi" {
+		t.Fatalf("tenant CR not synced with plan: %+v", cr.Spec)
+	}
+
+	// Tenants on a plan follow its new defaults but keep their overrides.
+	_ = doJSON[*types.Plan](t, client, http.MethodPut, baseURL+"/plans/gold", map[string]any{
+		"quotas": map[string]string{"cpu": "12", "memory": "16Gi"},
+		"limits": map[string]string{"cpu": "1", "memory": "1Gi"},
+	}, http.StatusOK)
+	followed := doJSON[*types.Tenant](t, client, http.MethodGet, fmt.Sprintf("%s/%s", tenantsURL, tenant.ID), nil, http.StatusOK)
+	if followed.Quotas["cpu"] != "12" || followed.Limits["cpu"] != "1" || followed.Limits["memory"] != "2Gi" {
+		t.Fatalf("expected the new gold defaults under the tenant's overrides, got %+v %+v", followed.Quotas, followed.Limits)
+	}
+	if err := srv.kube.Get(context.Background(), ctrlclient.ObjectKey{Name: "acme"}, &cr); err != nil {
+		t.Fatalf("get tenant CR: %v", err)
+	}
+	if cr.Spec.Quotas["cpu"] != "12" {
+		t.Fatalf("tenant CR not synced with the updated plan: %+v", cr.Spec)
+	}
+
+	doNoBody(t, client, http.MethodDelete, baseURL+"/plans/gold", nil, http.StatusConflict)
+	doNoBody(t, client, http.MethodDelete, baseURL+"/plans/silver", nil, http.StatusNoContent)
+	doNoBody(t, client, http.MethodGet, baseURL+"/plans/silver", nil, http.StatusNotFound)
+
+	// A tenant cannot be moved onto a plan deleted after it was looked up.
+	followed.Plan = "silver"
+	if err := srv.store.UpdateTenant(context.Background(), followed); !errors.Is(err, store.ErrUnknownPlan) {
+		t.Fatalf("expected the deleted plan to be refused, got %v", err)
+	}
+}
@@ -0,0 +1,361 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vaheed/kubenova/pkg/types"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	utilversion "k8s.io/apimachinery/pkg/util/version"
+	kubeversion "k8s.io/apimachinery/pkg/version"
+	"k8s.io/client-go/tools/clientcmd"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// The Kubernetes versions the manager supports by default. Older clusters
+	// fail the preflight; newer ones only warn, as they were not tested yet.
+	defaultMinKubernetesVersion = "1.28"
+	defaultMaxKubernetesVersion = "1.34"
+
+	// preflightTimeout is kept well under the 30s WriteTimeout of the API
+	// server, so a slow cluster still gets its report instead of a reset
+	// connection.
+	preflightTimeout = 15 * time.Second
+	// preflightReviewWorkers bounds the SelfSubjectAccessReviews in flight.
+	preflightReviewWorkers = 8
+)
+
+// preflightPermission is access the manager needs on a cluster.
+type preflightPermission struct {
+	group, resource, subresource string
+	verbs                        []string
+}
+
+// preflightPermissions lists what the installer and the sync paths do on a
+// cluster: the installer creates namespaces and runs Helm charts that bring
+// CRDs, RBAC and webhooks, and the sync paths write the KubeNova resources
+// and KubeVela Applications and read pod logs.
+var preflightPermissions = []preflightPermission{
+	{group: "", resource: "namespaces", verbs: []string{"get", "create"}},
+	{group: "", resource: "secrets", verbs: []string{"get", "create", "update", "delete"}},
+	{group: "", resource: "configmaps", verbs: []string{"get", "create", "update"}},
+	{group: "", resource: "services", verbs: []string{"get", "create"}},
+	{group: "", resource: "serviceaccounts", verbs: []string{"create"}},
+	{group: "", resource: "pods", verbs: []string{"list"}},
+	{group: "", resource: "pods", subresource: "log", verbs: []string{"get"}},
+	{group: "apps", resource: "deployments", verbs: []string{"get", "create", "update"}},
+	{group: "batch", resource: "jobs", verbs: []string{"create", "delete"}},
+	{group: "apiextensions.k8s.io", resource: "customresourcedefinitions", verbs: []string{"get", "create", "update"}},
+	{group: "rbac.authorization.k8s.io", resource: "clusterroles", verbs: []string{"create", "bind"}},
+	{group: "rbac.authorization.k8s.io", resource: "clusterrolebindings", verbs: []string{"create"}},
+	{group: "admissionregistration.k8s.io", resource: "validatingwebhookconfigurations", verbs: []string{"create"}},
+	{group: "admissionregistration.k8s.io", resource: "mutatingwebhookconfigurations", verbs: []string{"create"}},
+	{group: "kubenova.io", resource: "novatenants", verbs: []string{"get", "create", "update", "delete"}},
+	{group: "kubenova.io", resource: "novaprojects", verbs: []string{"get", "create", "update", "delete"}},
+	{group: "kubenova.io", resource: "novaapps", verbs: []string{"get", "create", "update", "delete"}},
+	{group: velaGroup, resource: "applications", verbs: []string{"get", "create", "update", "delete"}},
+}
+
+// Annotations that mark the default StorageClass.
+var defaultStorageClassAnnotations = []string{
+	"storageclass.kubernetes.io/is-default-class",
+	"storageclass.beta.kubernetes.io/is-default-class",
+}
+
+// preflightOnRegister reports whether cluster registration runs the
+// preflight first. CLUSTER_PREFLIGHT=false turns it off.
+func preflightOnRegister() bool {
+	v := os.Getenv("CLUSTER_PREFLIGHT")
+	return strings.TrimSpace(v) == "" || parseBool(v)
+}
+
+// preflight checks that c can be registered: its kubeconfig parses, the API
+// server answers with a supported version, the credentials may do what the
+// manager does, and the cluster can expose capsule-proxy and provision
+// volumes. Nothing is written to the cluster or the store.
+func (s *Server) preflight(ctx context.Context, c *types.Cluster) *types.PreflightReport {
+	ctx, cancel := context.WithTimeout(ctx, preflightTimeout)
+	defer cancel()
+	report := &types.PreflightReport{CheckedAt: time.Now().UTC()}
+	defer func() {
+		report.Result = types.PreflightPass
+		for _, check := range report.Checks {
+			report.Result = worsePreflightResult(report.Result, check.Result)
+		}
+	}()
+	add := func(check types.PreflightCheck) {
+		report.Checks = append(report.Checks, check)
+	}
+
+	cfg, err := clientcmd.RESTConfigFromKubeConfig([]byte(c.Kubeconfig))
+	if err != nil {
+		add(types.PreflightCheck{Name: "kubeconfig", Result: types.PreflightFail, Message: fmt.Sprintf("parse kubeconfig: %v", err)})
+		return report
+	}
+	add(types.PreflightCheck{Name: "kubeconfig", Result: types.PreflightPass, Message: "API server " + cfg.Host})
+
+	dc, err := s.discoveryForCluster(ctx, c)
+	var info *kubeversion.Info
+	if err == nil {
+		info, err = dc.ServerVersion()
+	}
+	if err != nil {
+		add(types.PreflightCheck{Name: "connection", Result: types.PreflightFail, Message: fmt.Sprintf("connect to %s: %v", cfg.Host, err)})
+		return report
+	}
+	add(types.PreflightCheck{Name: "connection", Result: types.PreflightPass, Message: "the API server answered"})
+	report.ServerVersion = info.GitVersion
+	add(checkKubernetesVersion(info.GitVersion))
+
+	cli, err := s.kubeClientForCluster(ctx, c)
+	if err != nil {
+		add(types.PreflightCheck{Name: "permissions", Result: types.PreflightFail, Message: fmt.Sprintf("build client: %v", err)})
+		return report
+	}
+	add(checkPermissions(ctx, cli))
+	add(checkLoadBalancer(ctx, cli, c.CapsuleProxyEndpoint))
+	add(checkDefaultStorageClass(ctx, cli))
+	return report
+}
+
+// worsePreflightResult returns the worse of two check results.
+func worsePreflightResult(a, b string) string {
+	rank := map[string]int{types.PreflightPass: 0, types.PreflightWarn: 1, types.PreflightFail: 2}
+	if rank[b] > rank[a] {
+		return b
+	}
+	return a
+}
+
+// checkKubernetesVersion compares the server version with the supported
+// range, CLUSTER_MIN_KUBERNETES_VERSION to CLUSTER_MAX_KUBERNETES_VERSION.
+func checkKubernetesVersion(gitVersion string) types.PreflightCheck {
+	check := types.PreflightCheck{Name: "kubernetesVersion"}
+	v, err := utilversion.ParseGeneric(gitVersion)
+	if err != nil {
+		check.Result, check.Message = types.PreflightWarn, fmt.Sprintf("cannot parse server version %q", gitVersion)
+		return check
+	}
+	minVersion := supportedKubernetesVersion("CLUSTER_MIN_KUBERNETES_VERSION", defaultMinKubernetesVersion)
+	maxVersion := supportedKubernetesVersion("CLUSTER_MAX_KUBERNETES_VERSION", defaultMaxKubernetesVersion)
+	minor := utilversion.MajorMinor(v.Major(), v.Minor())
+	switch {
+	case minor.LessThan(minVersion):
+		check.Result = types.PreflightFail
+		check.Message = fmt.Sprintf("Kubernetes %s is older than %s, the oldest supported version", gitVersion, minVersion)
+	case maxVersion.LessThan(minor):
+		check.Result = types.PreflightWarn
+		check.Message = fmt.Sprintf("Kubernetes %s is newer than %s, the newest tested version", gitVersion, maxVersion)
+	default:
+		check.Result = types.PreflightPass
+		check.Message = fmt.Sprintf("Kubernetes %s is supported", gitVersion)
+	}
+	return check
+}
+
+func supportedKubernetesVersion(key, def string) *utilversion.Version {
+	if v, err := utilversion.ParseGeneric(strings.TrimSpace(os.Getenv(key))); err == nil {
+		return utilversion.MajorMinor(v.Major(), v.Minor())
+	}
+	v := utilversion.MustParseGeneric(def)
+	return utilversion.MajorMinor(v.Major(), v.Minor())
+}
+
+// checkPermissions asks the API server with SelfSubjectAccessReviews whether
+// the kubeconfig's credentials may do what the manager does. The reviews run
+// concurrently; missing permissions are listed in preflightPermissions order.
+func checkPermissions(ctx context.Context, cli ctrlclient.Client) types.PreflightCheck {
+	check := types.PreflightCheck{Name: "permissions"}
+	type review struct {
+		verb, resource string
+		spec           *authorizationv1.SelfSubjectAccessReview
+		err            error
+	}
+	var reviews []*review
+	for _, p := range preflightPermissions {
+		for _, verb := range p.verbs {
+			reviews = append(reviews, &review{
+				verb:     verb,
+				resource: permissionResource(p),
+				spec: &authorizationv1.SelfSubjectAccessReview{
+					Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+						ResourceAttributes: &authorizationv1.ResourceAttributes{
+							Verb:        verb,
+							Group:       p.group,
+							Resource:    p.resource,
+							Subresource: p.subresource,
+						},
+					},
+				},
+			})
+		}
+	}
+	work := make(chan *review)
+	var wg sync.WaitGroup
+	for range preflightReviewWorkers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for rv := range work {
+				rv.err = cli.Create(ctx, rv.spec)
+			}
+		}()
+	}
+	for _, rv := range reviews {
+		work <- rv
+	}
+	close(work)
+	wg.Wait()
+
+	for _, rv := range reviews {
+		if rv.err != nil {
+			check.Result, check.Message, check.Missing = types.PreflightFail, fmt.Sprintf("review access: %v", rv.err), nil
+			return check
+		}
+		if !rv.spec.Status.Allowed {
+			check.Missing = append(check.Missing, rv.verb+" "+rv.resource)
+		}
+	}
+	if len(check.Missing) > 0 {
+		check.Result = types.PreflightFail
+		check.Message = fmt.Sprintf("the credentials lack %d of the permissions the installer and the sync need", len(check.Missing))
+		return check
+	}
+	check.Result, check.Message = types.PreflightPass, "the credentials may install components and sync resources"
+	return check
+}
+
+// permissionResource names the resource of p as kubectl does, e.g.
+// "deployments.apps" or "pods/log".
+func permissionResource(p preflightPermission) string {
+	name := p.resource
+	if p.subresource != "" {
+		name += "/" + p.subresource
+	}
+	if p.group != "" {
+		name += "." + p.group
+	}
+	return name
+}
+
+// checkLoadBalancer looks for LoadBalancer Services that got an address,
+// which capsule-proxy needs unless it is reached through an endpoint of the
+// operator's own.
+func checkLoadBalancer(ctx context.Context, cli ctrlclient.Client, proxyEndpoint string) types.PreflightCheck {
+	check := types.PreflightCheck{Name: "loadBalancer"}
+	var services corev1.ServiceList
+	if err := cli.List(ctx, &services); err != nil {
+		check.Result, check.Message = types.PreflightWarn, fmt.Sprintf("list services: %v", err)
+		return check
+	}
+	var pending []string
+	for _, svc := range services.Items {
+		if svc.Spec.Type != corev1.ServiceTypeLoadBalancer {
+			continue
+		}
+		if len(svc.Status.LoadBalancer.Ingress) > 0 {
+			check.Result = types.PreflightPass
+			check.Message = fmt.Sprintf("LoadBalancer Services get addresses (%s/%s)", svc.Namespace, svc.Name)
+			return check
+		}
+		pending = append(pending, svc.Namespace+"/"+svc.Name)
+	}
+	switch {
+	case len(pending) > 0:
+		check.Message = fmt.Sprintf("LoadBalancer Services have no address (%s), so capsule-proxy would not get one either", strings.Join(pending, ", "))
+	default:
+		check.Message = "no LoadBalancer Service has an address, so LoadBalancer support is unknown"
+	}
+	if strings.TrimSpace(proxyEndpoint) != "" {
+		check.Result = types.PreflightPass
+		check.Message += "; tenants reach capsule-proxy at " + proxyEndpoint
+		return check
+	}
+	check.Result = types.PreflightWarn
+	check.Message += "; set capsuleProxyEndpoint if capsule-proxy is exposed otherwise"
+	return check
+}
+
+// checkDefaultStorageClass looks for exactly one default StorageClass, which
+// volume claims without a storageClassName need.
+func checkDefaultStorageClass(ctx context.Context, cli ctrlclient.Client) types.PreflightCheck {
+	check := types.PreflightCheck{Name: "storageClass"}
+	var classes storagev1.StorageClassList
+	if err := cli.List(ctx, &classes); err != nil {
+		check.Result, check.Message = types.PreflightWarn, fmt.Sprintf("list storage classes: %v", err)
+		return check
+	}
+	var defaults []string
+	for _, sc := range classes.Items {
+		for _, key := range defaultStorageClassAnnotations {
+			if sc.Annotations[key] == "true" {
+				defaults = append(defaults, sc.Name)
+				break
+			}
+		}
+	}
+	sort.Strings(defaults)
+	switch len(defaults) {
+	case 0:
+		check.Result = types.PreflightWarn
+		check.Message = "no default StorageClass; volume claims without a storageClassName stay pending"
+	case 1:
+		check.Result, check.Message = types.PreflightPass, "default StorageClass "+defaults[0]
+	default:
+		check.Result = types.PreflightWarn
+		check.Message = fmt.Sprintf("several default StorageClasses (%s); Kubernetes uses the newest", strings.Join(defaults, ", "))
+	}
+	return check
+}
+
+// preflightFailures joins the messages of the failed checks.
+func preflightFailures(report *types.PreflightReport) string {
+	var msgs []string
+	for _, check := range report.Checks {
+		if check.Result == types.PreflightFail {
+			msgs = append(msgs, check.Name+": "+check.Message)
+		}
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// writePreflightFailure refuses a registration with the report.
+func writePreflightFailure(w http.ResponseWriter, report *types.PreflightReport) {
+	writeJSON(w, http.StatusUnprocessableEntity, map[string]any{
+		"code":      "KN-422",
+		"message":   "cluster preflight failed: " + preflightFailures(report),
+		"preflight": report,
+	})
+}
+
+// preflightCluster runs the registration checks on a kubeconfig without
+// registering the cluster.
+func (s *Server) preflightCluster(w http.ResponseWriter, r *http.Request) {
+	if !s.requireRole(w, r, "admin", "ops") {
+		return
+	}
+	var req ClusterRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "KN-400", err.Error())
+		return
+	}
+	if strings.TrimSpace(req.Kubeconfig) == "" {
+		writeError(w, http.StatusBadRequest, "KN-400", "kubeconfig is required")
+		return
+	}
+	report := s.preflight(r.Context(), &types.Cluster{
+		Name:                 strings.TrimSpace(req.Name),
+		Kubeconfig:           normalizeKubeconfig(req.Kubeconfig),
+		CapsuleProxyEndpoint: strings.TrimSpace(req.CapsuleProxyEndpoint),
+	})
+	writeJSON(w, http.StatusOK, report)
+}
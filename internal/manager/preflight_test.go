@@ -0,0 +1,156 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/vaheed/kubenova/internal/store"
+	"github.com/vaheed/kubenova/pkg/types"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	storagev1 "k8s.io/api/storage/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/discovery"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+)
+
+func TestClusterPreflight(t *testing.T) {
+	t.Setenv("KUBENOVA_REQUIRE_AUTH", "false")
+
+	var (
+		mu         sync.Mutex
+		gitVersion = "v1.31.2"
+		denied     = map[string]bool{}
+	)
+	srv := newTestServer(t)
+	st, client, baseURL := srv.store, srv.client, srv.baseURL
+	ready := fake.NewClientBuilder().WithScheme(srv.scheme).WithObjects(
+		&storagev1.StorageClass{
+			ObjectMeta:  metav1.ObjectMeta{Name: "standard", Annotations: map[string]string{"storageclass.kubernetes.io/is-default-class": "true"}},
+			Provisioner: "example.com/disk",
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "ingress", Name: "gateway"},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer},
+			Status:     corev1.ServiceStatus{LoadBalancer: corev1.LoadBalancerStatus{Ingress: []corev1.LoadBalancerIngress{{IP: "203.0.113.10"}}}},
+		},
+	)
+	empty := fake.NewClientBuilder().WithScheme(srv.scheme)
+	reviews := interceptor.Funcs{
+		Create: func(ctx context.Context, cli ctrlclient.WithWatch, obj ctrlclient.Object, opts ...ctrlclient.CreateOption) error {
+			review, ok := obj.(*authorizationv1.SelfSubjectAccessReview)
+			if !ok {
+				return cli.Create(ctx, obj, opts...)
+			}
+			attrs := review.Spec.ResourceAttributes
+			mu.Lock()
+			defer mu.Unlock()
+			review.Status.Allowed = !denied[attrs.Verb+" "+attrs.Resource]
+			return nil
+		},
+	}
+	readyClient := ready.WithInterceptorFuncs(reviews).Build()
+	bareClient := empty.WithInterceptorFuncs(reviews).Build()
+	// The bare cluster has no StorageClasses and no LoadBalancer Services.
+	bare := strings.Replace(fakeKubeconfig, "127.0.0.1", "127.0.0.2", 1)
+
+	srv.kubeFactory = func(_ context.Context, kubeconfig string) (ctrlclient.Client, error) {
+		if strings.Contains(kubeconfig, "127.0.0.2") {
+			return bareClient, nil
+		}
+		return readyClient, nil
+	}
+	srv.discoveryFactory = func(context.Context, string) (discovery.DiscoveryInterface, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return fakeDiscovery(gitVersion), nil
+	}
+	srv.installComponent = func(context.Context, *types.Cluster, string) error { return nil }
+	ctx := context.Background()
+
+	results := func(report *types.PreflightReport) map[string]string {
+		out := map[string]string{}
+		for _, check := range report.Checks {
+			out[check.Name] = check.Result
+		}
+		return out
+	}
+
+	report := doJSON[*types.PreflightReport](t, client, http.MethodPost, baseURL+"/clusters:preflight", map[string]any{"kubeconfig": "not a kubeconfig"}, http.StatusOK)
+	if report.Result != types.PreflightFail || len(report.Checks) != 1 || report.Checks[0].Name != "kubeconfig" {
+		t.Fatalf("expected the kubeconfig check alone to fail, got %+v", report)
+	}
+
+	report = doJSON[*types.PreflightReport](t, client, http.MethodPost, baseURL+"/clusters:preflight", map[string]any{"kubeconfig": fakeKubeconfigB64}, http.StatusOK)
+	if report.Result != types.PreflightPass || report.ServerVersion != "v1.31.2" || len(report.Checks) != 6 {
+		t.Fatalf("expected every check to pass, got %+v", report)
+	}
+
+	// Missing permissions fail the registration before anything is stored.
+	mu.Lock()
+	denied["create customresourcedefinitions"] = true
+	mu.Unlock()
+	resp := doRequest(t, client, http.MethodPost, baseURL+"/clusters", map[string]any{"name": "locked", "kubeconfig": fakeKubeconfigB64})
+	var refused struct {
+		Code      string                `json:"code"`
+		Message   string                `json:"message"`
+		Preflight types.PreflightReport `json:"preflight"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&refused)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnprocessableEntity || refused.Code != "KN-422" || !strings.Contains(refused.Message, "permissions") ||
+		results(&refused.Preflight)["permissions"] != types.PreflightFail {
+		t.Fatalf("expected a 422 with the failed permissions check, got %d %+v", resp.StatusCode, refused)
+	}
+	var missing []string
+	for _, check := range refused.Preflight.Checks {
+		if check.Name == "permissions" {
+			missing = check.Missing
+		}
+	}
+	if len(missing) != 1 || missing[0] != "create customresourcedefinitions.apiextensions.k8s.io" {
+		t.Fatalf("expected the missing permission to be named, got %v", missing)
+	}
+	if clusters, _, _ := st.ListClusters(ctx, store.ListOptions{}); len(clusters) != 0 {
+		t.Fatalf("expected nothing to be stored, got %d clusters", len(clusters))
+	}
+
+	mu.Lock()
+	delete(denied, "create customresourcedefinitions")
+	gitVersion = "v1.26.3"
+	mu.Unlock()
+	report = doJSON[*types.PreflightReport](t, client, http.MethodPost, baseURL+"/clusters:preflight", map[string]any{"kubeconfig": fakeKubeconfigB64}, http.StatusOK)
+	if report.Result != types.PreflightFail || results(report)["kubernetesVersion"] != types.PreflightFail {
+		t.Fatalf("expected an unsupported version to fail, got %+v", report)
+	}
+
+	// Warnings do not hold the registration back and are kept on the cluster.
+	mu.Lock()
+	gitVersion = "v1.40.0"
+	mu.Unlock()
+	cluster := doJSON[*types.Cluster](t, client, http.MethodPost, baseURL+"/clusters", map[string]any{"name": "bare", "kubeconfig": bare}, http.StatusCreated)
+	got := results(cluster.Preflight)
+	if cluster.Preflight.Result != types.PreflightWarn || got["kubernetesVersion"] != types.PreflightWarn ||
+		got["loadBalancer"] != types.PreflightWarn || got["storageClass"] != types.PreflightWarn || got["permissions"] != types.PreflightPass {
+		t.Fatalf("expected version, load balancer and storage warnings, got %+v", cluster.Preflight)
+	}
+	if stored, _ := st.GetCluster(ctx, cluster.ID); stored.Preflight == nil || stored.Preflight.Result != types.PreflightWarn {
+		t.Fatalf("expected the report to be stored with the cluster, got %+v", stored.Preflight)
+	}
+
+	// An endpoint of the operator's own stands in for LoadBalancer support.
+	report = doJSON[*types.PreflightReport](t, client, http.MethodPost, baseURL+"/clusters:preflight", map[string]any{
+		"kubeconfig": bare, "capsuleProxyEndpoint": "https://proxy.example.com",
+	}, http.StatusOK)
+	if results(report)["loadBalancer"] != types.PreflightPass {
+		t.Fatalf("expected the proxy endpoint to satisfy the load balancer check, got %+v", report)
+	}
+
+	doJSON[*types.PreflightReport](t, client, http.MethodPost, baseURL+"/clusters:preflight", map[string]any{}, http.StatusBadRequest)
+}
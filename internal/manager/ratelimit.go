@@ -0,0 +1,208 @@
+package manager
+
+import (
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vaheed/kubenova/internal/logging"
+	"github.com/vaheed/kubenova/internal/metrics"
+	"github.com/vaheed/kubenova/internal/store"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultRateLimitBurstSeconds = 2
+	// rateLimitSweepInterval is how often buckets that have refilled are
+	// dropped.
+	rateLimitSweepInterval = time.Minute
+)
+
+// Route classes limited separately.
+const (
+	rateClassRead   = "read"
+	rateClassMutate = "mutate"
+)
+
+// rateLimit is a token bucket refilled at rate tokens a second and holding
+// at most burst tokens.
+type rateLimit struct {
+	rate  float64
+	burst float64
+}
+
+// rateKey names one bucket: the limit ("subject" or "tenant"), the route
+// class and whose bucket it is.
+type rateKey struct {
+	limit string
+	class string
+	id    string
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// rateLimiter holds the token buckets of every subject and tenant.
+type rateLimiter struct {
+	mu        sync.Mutex
+	limits    map[rateKey]rateLimit // by limit and class; id is empty
+	buckets   map[rateKey]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// newRateLimiter reads the limits from RATE_LIMIT_{SUBJECT,TENANT}_{READ,MUTATE}_RPS.
+// Limits that are not set or zero do not apply.
+func newRateLimiter() *rateLimiter {
+	l := &rateLimiter{
+		limits:  map[rateKey]rateLimit{},
+		buckets: map[rateKey]*tokenBucket{},
+		now:     time.Now,
+	}
+	burstSeconds := envInt("RATE_LIMIT_BURST_SECONDS", defaultRateLimitBurstSeconds)
+	if burstSeconds < 1 {
+		burstSeconds = 1
+	}
+	for _, limit := range []string{"subject", "tenant"} {
+		for _, class := range []string{rateClassRead, rateClassMutate} {
+			env := "RATE_LIMIT_" + strings.ToUpper(limit) + "_" + strings.ToUpper(class) + "_RPS"
+			if rps := envInt(env, 0); rps > 0 {
+				l.limits[rateKey{limit: limit, class: class}] = rateLimit{
+					rate:  float64(rps),
+					burst: float64(rps * burstSeconds),
+				}
+			}
+		}
+	}
+	return l
+}
+
+func (l *rateLimiter) enabled(limit string) bool {
+	for k := range l.limits {
+		if k.limit == limit {
+			return true
+		}
+	}
+	return false
+}
+
+// allow takes a token from the bucket of every key with a limit, or from
+// none of them when one is empty. It then returns the key that was out of
+// tokens and how long until it has one.
+func (l *rateLimiter) allow(keys ...rateKey) (bool, rateKey, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	l.sweep(now)
+
+	var take []*tokenBucket
+	var checked []rateKey
+	for _, k := range keys {
+		limit, ok := l.limits[rateKey{limit: k.limit, class: k.class}]
+		if !ok {
+			continue
+		}
+		b := l.buckets[k]
+		if b == nil {
+			b = &tokenBucket{tokens: limit.burst, last: now}
+			l.buckets[k] = b
+		}
+		b.tokens = math.Min(limit.burst, b.tokens+now.Sub(b.last).Seconds()*limit.rate)
+		b.last = now
+		if b.tokens < 1 {
+			metrics.RateLimitRequestsTotal.WithLabelValues(k.limit, k.class, "limited").Inc()
+			wait := time.Duration((1 - b.tokens) / limit.rate * float64(time.Second))
+			return false, k, wait
+		}
+		take = append(take, b)
+		checked = append(checked, k)
+	}
+	for i, b := range take {
+		b.tokens--
+		metrics.RateLimitRequestsTotal.WithLabelValues(checked[i].limit, checked[i].class, "allowed").Inc()
+	}
+	return true, rateKey{}, 0
+}
+
+// sweep drops buckets that have refilled, which behave like new ones.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for k, b := range l.buckets {
+		limit := l.limits[rateKey{limit: k.limit, class: k.class}]
+		if b.tokens+now.Sub(b.last).Seconds()*limit.rate >= limit.burst {
+			delete(l.buckets, k)
+		}
+	}
+}
+
+// allowRequest applies the rate limits of the caller and of the tenant the
+// request addresses, answering 429 when one of them is exhausted.
+func (s *Server) allowRequest(w http.ResponseWriter, r *http.Request, auth *AuthContext) bool {
+	if len(s.limiter.limits) == 0 {
+		return true
+	}
+	class := rateClassMutate
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		class = rateClassRead
+	}
+	keys := []rateKey{{limit: "subject", class: class, id: rateSubject(r, auth)}}
+	if s.limiter.enabled("tenant") {
+		if tenantID := s.rateTenant(r); tenantID != "" {
+			keys = append(keys, rateKey{limit: "tenant", class: class, id: tenantID})
+		}
+	}
+	ok, denied, wait := s.limiter.allow(keys...)
+	if ok {
+		return true
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	writeError(w, http.StatusTooManyRequests, "KN-429", "rate limit exceeded for "+denied.limit+" "+denied.class+" requests")
+	return false
+}
+
+// rateSubject identifies the caller. Without auth every caller is
+// anonymous, so they are told apart by address.
+func rateSubject(r *http.Request, auth *AuthContext) string {
+	if auth.Subject == "anonymous" {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		return "anonymous@" + host
+	}
+	if auth.Issuer != "" {
+		return auth.Issuer + "#" + auth.Subject
+	}
+	return auth.Subject
+}
+
+// rateTenant returns the tenant the request path addresses, if any. The
+// middleware runs before the route's URL parameters are known, so the path
+// is parsed as the audit log does.
+func (s *Server) rateTenant(r *http.Request) string {
+	ids := parseAuditTarget(strings.TrimPrefix(r.URL.Path, "/api/v1")).ids
+	if ids["tenant"] != "" {
+		return ids["tenant"]
+	}
+	if ids["project"] != "" {
+		p, err := s.store.GetProjectByID(r.Context(), ids["project"])
+		if err == nil {
+			return p.TenantID
+		}
+		if !errors.Is(err, store.ErrNotFound) {
+			logging.L.Warn("rate_limit_tenant_lookup_failed", zap.String("project_id", ids["project"]), zap.Error(err))
+		}
+	}
+	return ""
+}
@@ -0,0 +1,148 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/vaheed/kubenova/internal/metrics"
+	"github.com/vaheed/kubenova/pkg/types"
+)
+
+func TestRateLimits(t *testing.T) {
+	t.Setenv("KUBENOVA_REQUIRE_AUTH", "true")
+	t.Setenv("JWT_SIGNING_KEY", "ratelimit-secret")
+	t.Setenv("RATE_LIMIT_SUBJECT_MUTATE_RPS", "1")
+	t.Setenv("RATE_LIMIT_TENANT_READ_RPS", "2")
+	t.Setenv("RATE_LIMIT_BURST_SECONDS", "1")
+
+	srv := newTestServer(t)
+	st := srv.store
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	srv.limiter.now = func() time.Time { return now }
+	baseURL := srv.baseURL
+	ctx := context.Background()
+
+	token := func(sub string) string {
+		tok := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"sub": sub, "roles": []string{"admin"}, "exp": time.Now().Add(time.Hour).Unix(),
+		})
+		signed, err := tok.SignedString([]byte("ratelimit-secret"))
+		if err != nil {
+			t.Fatalf("sign token: %v", err)
+		}
+		return signed
+	}
+	alice, bob := token("alice"), token("bob")
+	send := func(token, method, url, key string, body any, want int) *http.Response {
+		t.Helper()
+		var reader io.Reader
+		if body != nil {
+			raw, _ := json.Marshal(body)
+			reader = bytes.NewReader(raw)
+		}
+		req, _ := http.NewRequest(method, url, reader)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set(idempotencyKeyHeader, key)
+		}
+		resp, err := srv.client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %v", method, url, err)
+		}
+		defer resp.Body.Close()
+		raw, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode != want {
+			t.Fatalf("%s %s: want %d got %d body=%s", method, url, want, resp.StatusCode, raw)
+		}
+		return resp
+	}
+	plan := func(name string) map[string]any {
+		return map[string]any{"name": name, "quotas": map[string]string{"cpu": "2"}}
+	}
+
+	// Mutations are limited per subject; reads have no subject limit here.
+	limited := testutil.ToFloat64(metrics.RateLimitRequestsTotal.WithLabelValues("subject", "mutate", "limited"))
+	send(alice, http.MethodPost, baseURL+"/plans", "", plan("bronze"), http.StatusCreated)
+	resp := send(alice, http.MethodPost, baseURL+"/plans", "retry-silver", plan("silver"), http.StatusTooManyRequests)
+	if got := resp.Header.Get("Retry-After"); got != "1" {
+		t.Fatalf("expected Retry-After 1, got %q", got)
+	}
+	if got := testutil.ToFloat64(metrics.RateLimitRequestsTotal.WithLabelValues("subject", "mutate", "limited")); got != limited+1 {
+		t.Fatalf("expected the limited request to be counted, got %v after %v", got, limited)
+	}
+	send(alice, http.MethodGet, baseURL+"/plans", "", nil, http.StatusOK)
+	send(bob, http.MethodPost, baseURL+"/plans", "", plan("gold"), http.StatusCreated)
+
+	// The bucket refills, and the limited request was not saved under its
+	// idempotency key.
+	now = now.Add(time.Second)
+	send(alice, http.MethodPost, baseURL+"/plans", "retry-silver", plan("silver"), http.StatusCreated)
+
+	// Reads of one tenant are limited across callers.
+	cluster := &types.Cluster{Name: "east", Kubeconfig: "fake"}
+	if err := st.CreateCluster(ctx, cluster); err != nil {
+		t.Fatalf("create cluster: %v", err)
+	}
+	acme := &types.Tenant{ClusterID: cluster.ID, Name: "acme"}
+	globex := &types.Tenant{ClusterID: cluster.ID, Name: "globex"}
+	for _, tn := range []*types.Tenant{acme, globex} {
+		if err := st.CreateTenant(ctx, tn); err != nil {
+			t.Fatalf("create tenant: %v", err)
+		}
+	}
+	tenantURL := func(tn *types.Tenant) string {
+		return fmt.Sprintf("%s/clusters/%s/tenants/%s", baseURL, cluster.ID, tn.ID)
+	}
+	send(alice, http.MethodGet, tenantURL(acme), "", nil, http.StatusOK)
+	send(bob, http.MethodGet, baseURL+"/tenants/"+acme.ID+"/usage", "", nil, http.StatusOK)
+	send(alice, http.MethodGet, tenantURL(acme), "", nil, http.StatusTooManyRequests)
+	send(alice, http.MethodGet, tenantURL(globex), "", nil, http.StatusOK)
+
+	// Routes naming only a project count against its tenant.
+	web := &types.Project{ClusterID: cluster.ID, TenantID: acme.ID, Name: "web"}
+	if err := st.CreateProject(ctx, web); err != nil {
+		t.Fatalf("create project: %v", err)
+	}
+	send(bob, http.MethodGet, baseURL+"/projects/"+web.ID+"/usage", "", nil, http.StatusTooManyRequests)
+}
+
+func TestMetricsAreServedOffTheAPIRouter(t *testing.T) {
+	srv := newTestServer(t)
+	doNoBody(t, srv.client, http.MethodGet, srv.url+"/metrics", nil, http.StatusNotFound)
+
+	rec := httptest.NewRecorder()
+	MetricsHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "go_goroutines") {
+		t.Fatalf("expected the metrics handler to serve metrics, got %d", rec.Code)
+	}
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	t.Setenv("RATE_LIMIT_SUBJECT_READ_RPS", "1")
+	l := newRateLimiter()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	l.now = func() time.Time { return now }
+	key := rateKey{limit: "subject", class: rateClassRead, id: "alice"}
+	if ok, _, _ := l.allow(key, rateKey{limit: "tenant", class: rateClassRead, id: "acme"}); !ok {
+		t.Fatal("expected the first request to pass")
+	}
+	if len(l.buckets) != 1 {
+		t.Fatalf("expected only limits that are set to keep buckets, got %d", len(l.buckets))
+	}
+	now = now.Add(rateLimitSweepInterval)
+	l.allow(rateKey{limit: "subject", class: rateClassRead, id: "bob"})
+	if _, ok := l.buckets[key]; ok {
+		t.Fatal("expected the refilled bucket to be dropped")
+	}
+}
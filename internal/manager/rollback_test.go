@@ -0,0 +1,101 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	v1alpha1 "github.com/vaheed/kubenova/pkg/api/v1alpha1"
+	"github.com/vaheed/kubenova/pkg/types"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+func TestRollbackToRevisionResyncsCluster(t *testing.T) {
+	t.Setenv("KUBENOVA_REQUIRE_AUTH", "false")
+
+	srv := newTestServer(t)
+	st, client, baseURL := srv.store, srv.client, srv.baseURL
+	kubeErr := error(nil)
+	srv.kubeFactory = func(context.Context, string) (ctrlclient.Client, error) {
+		return srv.kube, kubeErr
+	}
+	ctx := context.Background()
+
+	cluster := &types.Cluster{Name: "rollback", Kubeconfig: "fake"}
+	if err := st.CreateCluster(ctx, cluster); err != nil {
+		t.Fatalf("create cluster: %v", err)
+	}
+	tenant := doJSON[*types.Tenant](t, client, http.MethodPost,
+		fmt.Sprintf("%s/clusters/%s/tenants", baseURL, cluster.ID), map[string]any{"name": "acme"}, http.StatusCreated)
+	project := doJSON[*types.Project](t, client, http.MethodPost,
+		fmt.Sprintf("%s/clusters/%s/tenants/%s/projects", baseURL, cluster.ID, tenant.ID),
+		map[string]any{"name": "web"}, http.StatusCreated)
+	appsURL := fmt.Sprintf("%s/clusters/%s/tenants/%s/projects/%s/apps", baseURL, cluster.ID, tenant.ID, project.ID)
+	specFor := func(image string) map[string]any {
+		return map[string]any{"type": "webservice", "properties": map[string]any{"image": image}}
+	}
+	app := doJSON[*types.App](t, client, http.MethodPost, appsURL,
+		map[string]any{"name": "api", "spec": specFor("api:v1")}, http.StatusCreated)
+	appURL := appsURL + "/" + app.ID
+	for _, image := range []string{"api:v2", "api:v3"} {
+		doJSON[*types.App](t, client, http.MethodPut, appURL, map[string]any{"spec": specFor(image)}, http.StatusOK)
+	}
+
+	clusterImage := func() any {
+		t.Helper()
+		var novaApp v1alpha1.NovaApp
+		if err := srv.kube.Get(ctx, ctrlclient.ObjectKey{Name: "api", Namespace: "acme-apps"}, &novaApp); err != nil {
+			t.Fatalf("get NovaApp: %v", err)
+		}
+		return novaApp.Spec.Template["properties"].(map[string]any)["image"]
+	}
+	if img := clusterImage(); img != "api:v3" {
+		t.Fatalf("expected cluster to run api:v3 before rollback, got %v", img)
+	}
+
+	res := doJSON[RollbackResponse](t, client, http.MethodPost, appsURL+"/"+app.ID+":rollback",
+		map[string]any{"revision": 1}, http.StatusOK)
+	if !res.Synced || res.SyncError != "" {
+		t.Fatalf("expected the cluster to accept the rollback, got %+v", res)
+	}
+	if res.RolledBackFrom != 3 || res.RolledBackTo != 1 || res.Revision != 4 || res.Status != "RolledBack" {
+		t.Fatalf("unexpected rollback result: from %d to %d, revision %d, status %s",
+			res.RolledBackFrom, res.RolledBackTo, res.Revision, res.Status)
+	}
+	if len(res.Revisions) != 4 {
+		t.Fatalf("expected history to be kept, got %d revisions", len(res.Revisions))
+	}
+	if img := res.Revisions[3].Spec["properties"].(map[string]any)["image"]; img != "api:v1" {
+		t.Fatalf("expected revision 4 to copy revision 1, got image %v", img)
+	}
+	if img := clusterImage(); img != "api:v1" {
+		t.Fatalf("expected cluster to run api:v1 after rollback, got %v", img)
+	}
+
+	// Without a target the rollback steps back to the revision before the
+	// current one, which is now revision 3.
+	res = doJSON[RollbackResponse](t, client, http.MethodPost, appsURL+"/"+app.ID+":rollback", nil, http.StatusOK)
+	if res.RolledBackTo != 3 || res.Revision != 5 {
+		t.Fatalf("expected default rollback to revision 3 as revision 5, got to %d as %d", res.RolledBackTo, res.Revision)
+	}
+
+	doNoBody(t, client, http.MethodPost, appsURL+"/"+app.ID+":rollback?revision=9", nil, http.StatusNotFound)
+	doNoBody(t, client, http.MethodPost, appsURL+"/"+app.ID+":rollback?revision=5", nil, http.StatusUnprocessableEntity)
+
+	kubeErr = errors.New("cluster unreachable")
+	res = doJSON[RollbackResponse](t, client, http.MethodPost, appsURL+"/"+app.ID+":rollback",
+		map[string]any{"revision": 2}, http.StatusOK)
+	if res.Synced || res.SyncError == "" || res.Status != "SyncFailed" || res.Revision != 6 {
+		t.Fatalf("expected a recorded but unsynced rollback, got synced=%v error=%q status=%s revision=%d",
+			res.Synced, res.SyncError, res.Status, res.Revision)
+	}
+	stored, err := st.GetApp(ctx, cluster.ID, tenant.ID, project.ID, app.ID)
+	if err != nil {
+		t.Fatalf("get app: %v", err)
+	}
+	if stored.Status != "SyncFailed" || stored.Revision != 6 {
+		t.Fatalf("expected stored app at revision 6 with SyncFailed, got %d %s", stored.Revision, stored.Status)
+	}
+}
@@ -9,12 +9,18 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/vaheed/kubenova/internal/adapters/vela"
+	velabackend "github.com/vaheed/kubenova/internal/backends/vela"
 	"github.com/vaheed/kubenova/internal/cluster"
 	"github.com/vaheed/kubenova/internal/logging"
 	"github.com/vaheed/kubenova/internal/reconcile"
@@ -37,32 +43,91 @@ import (
 const (
 	version                   = "v0.1.3"
 	authContextKey            = contextKey("auth")
+	connContextKey            = contextKey("conn")
 	defaultTokenTTL           = 60 * time.Minute
 	maxBodyBytes        int64 = 1 << 20 // 1MB
 	otelServiceName           = "kubenova-manager"
 	defaultCapsuleProxy       = "https://proxy.kubenova.local"
+	maxStatusRetries          = 3
 )
 
 type contextKey string
 
 type kubeClientFactory func(context.Context, string) (ctrlclient.Client, error)
 
+type velaBackendFactory func(ctrlclient.Client) velabackend.Interface
+
+func defaultVelaBackendFactory(c ctrlclient.Client) velabackend.Interface {
+	return velabackend.NewClient(c, c.Scheme())
+}
+
 // Server exposes the HTTP handlers for the Manager.
 type Server struct {
 	store       store.Store
 	requireAuth bool
 	signingKey  []byte
 	kubeFactory kubeClientFactory
+	logsFactory podLogsFactory
+	velaFactory velaBackendFactory
+	events      *eventHub
+	// webhookClient sends webhook deliveries; its dialer refuses the addresses
+	// webhookTargets blocks.
+	webhookClient  *http.Client
+	webhookTargets *webhookGuard
+	// oidc holds the OIDC issuers whose tokens are accepted, by issuer URL.
+	oidc map[string]*oidcIssuer
+	// installComponent and reinstallComponents do the cluster work of
+	// operations.
+	installComponent    func(context.Context, *types.Cluster, string) error
+	reinstallComponents func(context.Context, *types.Cluster) error
+	// limiter enforces the per-subject and per-tenant request rate limits.
+	limiter *rateLimiter
+	// instanceID names this replica as the holder of store leases.
+	instanceID string
+	// discoveryFactory builds discovery clients for the health prober and
+	// capability discovery.
+	discoveryFactory discoveryFactory
+	// proxyClient checks that a cluster's Capsule Proxy answers.
+	proxyClient *http.Client
 }
 
 // NewServer builds a Server using the provided persistence store.
 func NewServer(st store.Store) *Server {
-	return &Server{
-		store:       st,
-		requireAuth: parseBool(os.Getenv("KUBENOVA_REQUIRE_AUTH")),
-		signingKey:  []byte(os.Getenv("JWT_SIGNING_KEY")),
-		kubeFactory: defaultKubeClientFactory(),
+	issuers, err := ParseOIDCIssuers(os.Getenv("OIDC_ISSUERS"))
+	if err != nil {
+		logging.L.Error("oidc_config_invalid", zap.Error(err))
+	}
+	allowed, err := parseWebhookAllowedCIDRs(os.Getenv("WEBHOOK_ALLOWED_CIDRS"))
+	if err != nil {
+		logging.L.Error("webhook_config_invalid", zap.Error(err))
 	}
+	targets := &webhookGuard{allowed: allowed}
+	return &Server{
+		store:               st,
+		requireAuth:         parseBool(os.Getenv("KUBENOVA_REQUIRE_AUTH")),
+		signingKey:          []byte(os.Getenv("JWT_SIGNING_KEY")),
+		kubeFactory:         defaultKubeClientFactory(),
+		logsFactory:         defaultPodLogsFactory(),
+		velaFactory:         defaultVelaBackendFactory,
+		events:              newEventHub(),
+		webhookClient:       newWebhookClient(targets),
+		webhookTargets:      targets,
+		installComponent:    installClusterComponent,
+		reinstallComponents: reinstallClusterComponents,
+		oidc:                newOIDCIssuers(issuers),
+		limiter:             newRateLimiter(),
+		instanceID:          newInstanceID(),
+		discoveryFactory:    defaultDiscoveryFactory,
+		proxyClient:         &http.Client{Timeout: capsuleProxyTimeout},
+	}
+}
+
+// MetricsHandler serves the Prometheus metrics on /metrics. It is not part
+// of Router, so metrics are only reachable on the separate metrics listener.
+func MetricsHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	return mux
 }
 
 // Router returns the configured HTTP handler.
@@ -71,19 +136,39 @@ func (s *Server) Router() http.Handler {
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
 	r.Use(middleware.Recoverer)
+	r.Use(connMiddleware)
 	r.Use(otelhttp.NewMiddleware(otelServiceName))
 	r.Use(s.logMiddleware)
+	r.Use(s.auditMiddleware)
+	r.Use(s.idempotencyMiddleware)
 
 	r.Route("/api/v1", func(api chi.Router) {
 		api.Get("/healthz", s.healthz)
 		api.Get("/readyz", s.readyz)
 		api.Get("/version", s.version)
 		api.Get("/features", s.features)
-		api.Post("/telemetry/events", s.telemetryEvent)
+		api.With(s.authMiddleware).Post("/telemetry/events", s.telemetryEvent)
+		api.With(s.authMiddleware).Post("/usage/reports", s.ingestUsageReport)
 
 		api.Post("/tokens", s.issueToken)
+		api.With(s.authMiddleware).Route("/tokens/revocations", func(r chi.Router) {
+			r.Get("/", s.listRevokedTokens)
+			r.Post("/", s.revokeToken)
+		})
 		api.With(s.authMiddleware).Get("/me", s.me)
 
+		api.Route("/plans", func(r chi.Router) {
+			r.Use(s.authMiddleware)
+			r.Post("/", s.createPlan)
+			r.Get("/", s.listPlans)
+			r.Route("/{planName}", func(r chi.Router) {
+				r.Get("/", s.getPlan)
+				r.Put("/", s.updatePlan)
+				r.Delete("/", s.deletePlan)
+			})
+		})
+
+		api.With(s.authMiddleware).Post("/clusters:preflight", s.preflightCluster)
 		api.Route("/clusters", func(r chi.Router) {
 			r.Use(s.authMiddleware)
 			r.Post("/", s.createCluster)
@@ -92,6 +177,8 @@ func (s *Server) Router() http.Handler {
 				r.Get("/", s.getCluster)
 				r.Delete("/", s.deleteCluster)
 				r.Get("/capabilities", s.getCapabilities)
+				r.Post("/capabilities/refresh", s.refreshClusterCapabilities)
+				r.Get("/health", s.getClusterHealth)
 				r.Post("/bootstrap/{component}", s.bootstrapComponent)
 				r.Post("/refresh", s.refreshCluster)
 
@@ -105,6 +192,7 @@ func (s *Server) Router() http.Handler {
 						r.Put("/quotas", s.updateTenantQuotas)
 						r.Put("/limits", s.updateTenantLimits)
 						r.Put("/network-policies", s.updateTenantNetworkPolicies)
+						r.Put("/plan", s.updateTenantPlan)
 						r.Get("/summary", s.tenantSummary)
 
 						r.Route("/projects", func(r chi.Router) {
@@ -158,13 +246,45 @@ func (s *Server) Router() http.Handler {
 			})
 		})
 
+		api.With(s.authMiddleware).Get("/audit", s.listAudit)
+		api.With(s.authMiddleware).Get("/events/stream", s.streamEvents)
+
+		api.With(s.authMiddleware).Route("/operations", func(r chi.Router) {
+			r.Get("/", s.listOperations)
+			r.Get("/{operationID}", s.getOperation)
+		})
+
+		api.With(s.authMiddleware).Route("/webhooks", func(r chi.Router) {
+			r.Get("/", s.listWebhooks)
+			r.Post("/", s.createWebhook)
+			r.Route("/{webhookID}", func(r chi.Router) {
+				r.Get("/", s.getWebhook)
+				r.Put("/", s.updateWebhook)
+				r.Delete("/", s.deleteWebhook)
+				r.Get("/deliveries", s.listWebhookDeliveries)
+			})
+		})
+
+		api.With(s.authMiddleware).Route("/apikeys", func(r chi.Router) {
+			r.Get("/", s.listAPIKeys)
+			r.Post("/", s.createAPIKey)
+			r.Get("/{keyID}", s.getAPIKey)
+			r.Post("/{keyID}:revoke", s.revokeAPIKey)
+		})
+
+		api.With(s.authMiddleware).Get("/encryption", s.getEncryption)
+		api.With(s.authMiddleware).Post("/encryption:rewrap", s.rewrapEncryption)
+
+		api.With(s.authMiddleware).Route("/billing", func(r chi.Router) {
+			r.Get("/exports", s.billingExport)
+		})
+
 		api.With(s.authMiddleware).Route("/apps", func(r chi.Router) {
 			r.Route("/runs/{runID}", func(r chi.Router) {
 				r.Get("/", s.getWorkflowRun)
 			})
+			r.Post("/runs/{runID}:cancel", s.cancelWorkflowRun)
 		})
-
-		api.Post("/telemetry/events", s.telemetryEvent)
 	})
 
 	return r
@@ -208,6 +328,24 @@ func (s *Server) logMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// connMiddleware keeps a ResponseController for the connection's own writer,
+// which the tracing wrapper hides, so that streaming handlers can lift the
+// server's write timeout.
+func connMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), connContextKey, http.NewResponseController(w))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// clearWriteDeadline lets a long-lived response outlive the server's write
+// timeout.
+func clearWriteDeadline(r *http.Request) {
+	if rc, ok := r.Context().Value(connContextKey).(*http.ResponseController); ok {
+		_ = rc.SetWriteDeadline(time.Time{})
+	}
+}
+
 func (s *Server) authMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if !s.requireAuth {
@@ -220,10 +358,15 @@ func (s *Server) authMiddleware(next http.Handler) http.Handler {
 					}
 				}
 			}
-			ctx := context.WithValue(r.Context(), authContextKey, &AuthContext{
+			auth := &AuthContext{
 				Subject: "anonymous",
 				Roles:   roles,
-			})
+			}
+			setAuditActor(r.Context(), auth)
+			if !s.allowRequest(w, r, auth) {
+				return
+			}
+			ctx := context.WithValue(r.Context(), authContextKey, auth)
 			next.ServeHTTP(w, r.WithContext(ctx))
 			return
 		}
@@ -232,42 +375,89 @@ func (s *Server) authMiddleware(next http.Handler) http.Handler {
 			writeError(w, http.StatusUnauthorized, "KN-401", "missing bearer token")
 			return
 		}
-		tokenStr := strings.TrimPrefix(authz, "Bearer ")
-		token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (any, error) {
-			if t.Method.Alg() != jwt.SigningMethodHS256.Alg() {
-				return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
-			}
-			return s.signingKey, nil
-		})
-		if err != nil || !token.Valid {
-			writeError(w, http.StatusUnauthorized, "KN-401", "invalid token")
+		auth, err := s.verifyToken(r.Context(), strings.TrimPrefix(authz, "Bearer "))
+		if err != nil {
+			writeError(w, http.StatusUnauthorized, "KN-401", err.Error())
 			return
 		}
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			writeError(w, http.StatusUnauthorized, "KN-401", "invalid token claims")
+		setAuditActor(r.Context(), auth)
+		if !s.allowRequest(w, r, auth) {
 			return
 		}
-		roles := []string{}
-		if raw, ok := claims["roles"].([]any); ok {
-			for _, r := range raw {
-				if str, ok := r.(string); ok {
-					roles = append(roles, str)
-				}
+		ctx := context.WithValue(r.Context(), authContextKey, auth)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// verifyToken accepts API keys, HS256 tokens issued by POST /tokens and
+// RS256/ES256 tokens from the configured OIDC issuers.
+func (s *Server) verifyToken(ctx context.Context, tokenStr string) (*AuthContext, error) {
+	if strings.HasPrefix(tokenStr, apiKeyPrefix) {
+		return s.verifyAPIKey(ctx, tokenStr)
+	}
+	var issuer *oidcIssuer
+	token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (any, error) {
+		if t.Method.Alg() == jwt.SigningMethodHS256.Alg() {
+			if len(s.signingKey) == 0 {
+				return nil, errors.New("signing key not configured")
 			}
+			return s.signingKey, nil
 		}
-		subject, _ := claims["sub"].(string)
-		ctx := context.WithValue(r.Context(), authContextKey, &AuthContext{
-			Subject: subject,
-			Roles:   roles,
-		})
-		next.ServeHTTP(w, r.WithContext(ctx))
+		if !slices.Contains(oidcSigningMethods, t.Method.Alg()) {
+			return nil, fmt.Errorf("unexpected signing method %s", t.Method.Alg())
+		}
+		iss, err := s.oidcIssuerFor(t)
+		if err != nil {
+			return nil, err
+		}
+		issuer = iss
+		kid, _ := t.Header["kid"].(string)
+		return iss.key(ctx, kid)
 	})
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid token claims")
+	}
+	if jti, _ := claims["jti"].(string); jti != "" {
+		revoked, err := s.store.TokenRevoked(ctx, jti)
+		if err != nil {
+			logging.L.Warn("token_revocation_check_failed", zap.Error(err))
+			return nil, errors.New("could not check token revocation")
+		}
+		if revoked {
+			return nil, errors.New("token revoked")
+		}
+	}
+	if issuer != nil {
+		return issuer.authContext(claims)
+	}
+	roles := []string{}
+	if raw, ok := claims["roles"].([]any); ok {
+		for _, r := range raw {
+			if str, ok := r.(string); ok {
+				roles = append(roles, str)
+			}
+		}
+	}
+	subject, _ := claims["sub"].(string)
+	return &AuthContext{
+		Subject:  subject,
+		Roles:    roles,
+		Bindings: bindingsClaim(claims["bindings"]),
+	}, nil
 }
 
 type AuthContext struct {
 	Subject string
-	Roles   []string
+	// Roles apply to every resource, except tenantOwner and projectDev which
+	// only apply through Bindings.
+	Roles    []string
+	Bindings []types.RoleBinding
+	// Issuer is set for callers authenticated by an OIDC issuer.
+	Issuer string
 }
 
 func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
@@ -310,17 +500,28 @@ func (s *Server) issueToken(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "KN-400", "subject is required")
 		return
 	}
+	for _, b := range req.Bindings {
+		if err := validBinding(b); err != nil {
+			writeError(w, http.StatusBadRequest, "KN-400", err.Error())
+			return
+		}
+	}
 	ttl := defaultTokenTTL
 	if req.TTLMinutes > 0 {
 		ttl = time.Duration(req.TTLMinutes) * time.Minute
 	}
 	exp := time.Now().Add(ttl)
+	jti := uuid.NewString()
 	claims := jwt.MapClaims{
+		"jti":    jti,
 		"sub":    req.Subject,
 		"roles":  req.Roles,
 		"exp":    exp.Unix(),
 		"issued": time.Now().Unix(),
 	}
+	if len(req.Bindings) > 0 {
+		claims["bindings"] = req.Bindings
+	}
 	tok := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	signed, err := tok.SignedString(s.signingKey)
 	if err != nil {
@@ -329,16 +530,24 @@ func (s *Server) issueToken(w http.ResponseWriter, r *http.Request) {
 	}
 	writeJSON(w, http.StatusCreated, TokenResponse{
 		Token:     signed,
+		JTI:       jti,
 		ExpiresAt: exp,
 	})
 }
 
 func (s *Server) me(w http.ResponseWriter, r *http.Request) {
 	auth := s.authContext(r.Context())
-	writeJSON(w, http.StatusOK, map[string]any{
+	resp := map[string]any{
 		"subject": auth.Subject,
 		"roles":   auth.Roles,
-	})
+	}
+	if len(auth.Bindings) > 0 {
+		resp["bindings"] = auth.Bindings
+	}
+	if auth.Issuer != "" {
+		resp["issuer"] = auth.Issuer
+	}
+	writeJSON(w, http.StatusOK, resp)
 }
 
 func (s *Server) createCluster(w http.ResponseWriter, r *http.Request) {
@@ -366,44 +575,55 @@ func (s *Server) createCluster(w http.ResponseWriter, r *http.Request) {
 		Kubeconfig:           kubeconfig,
 		CapsuleProxyEndpoint: strings.TrimSpace(req.CapsuleProxyEndpoint),
 		Status:               "pending_bootstrap",
-		Capabilities:         types.Capabilities{Capsule: true, CapsuleProxy: true, KubeVela: true},
+	}
+	if preflightOnRegister() {
+		report := s.preflight(r.Context(), cluster)
+		if report.Result == types.PreflightFail {
+			writePreflightFailure(w, report)
+			return
+		}
+		cluster.Preflight = report
 	}
 	if err := s.store.CreateCluster(r.Context(), cluster); err != nil {
 		if errors.Is(err, store.ErrConflict) {
 			writeError(w, http.StatusConflict, "KN-409", "cluster already exists")
 			return
 		}
+		if errors.Is(err, store.ErrEncryptedInput) {
+			writeError(w, http.StatusBadRequest, "KN-400", "kubeconfig must not be an encrypted envelope")
+			return
+		}
 		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
 		return
 	}
 	cluster.Status = "bootstrapping"
 	_ = s.store.UpdateCluster(r.Context(), cluster)
-	go func(c *types.Cluster) {
-		if err := s.installOperator(context.Background(), c); err != nil {
-			logging.L.Error("operator_install_failed",
-				zap.String("cluster_id", c.ID),
-				zap.Error(err),
-			)
-			c.Status = "error"
-		} else {
-			c.Status = "connected"
-		}
-		c.UpdatedAt = time.Now().UTC()
-		_ = s.store.UpdateCluster(context.Background(), c)
-	}(cluster)
-	writeJSON(w, http.StatusCreated, sanitizeCluster(cluster))
+	s.publishEvent(r.Context(), eventClusterCreated, cluster)
+	if op, err := s.startOperation(r.Context(), operationClusterCreate, cluster, "operator"); err != nil {
+		logging.L.Error("operation_start_failed",
+			zap.String("cluster_id", cluster.ID),
+			zap.Error(err),
+		)
+		s.failClusterBootstrap(r.Context(), cluster, fmt.Errorf("start operator install: %w", err))
+	} else {
+		w.Header().Set("Operation-Location", operationLocation(op.ID))
+	}
+	writeVersioned(w, http.StatusCreated, cluster.ResourceVersion, sanitizeCluster(cluster))
 }
 
 func (s *Server) listClusters(w http.ResponseWriter, r *http.Request) {
-	if !s.requireRole(w, r, "admin", "ops", "readOnly") && s.requireAuth {
+	if !s.requireAnyRole(w, r, "admin", "ops", "readOnly") {
 		return
 	}
-	clusters, err := s.store.ListClusters(r.Context())
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+	opts, ok := listOptions(w, r)
+	if !ok {
 		return
 	}
-	writeJSON(w, http.StatusOK, sanitizeClusters(clusters))
+	clusters, next, err := s.store.ListClusters(r.Context(), opts)
+	clusters = filterVisible(s, r, clusters, func(c *types.Cluster) resourceScope {
+		return resourceScope{clusterID: c.ID}
+	}, "admin", "ops", "readOnly")
+	writeList(w, r, sanitizeClusters(clusters), next, err)
 }
 
 func (s *Server) getCluster(w http.ResponseWriter, r *http.Request) {
@@ -420,7 +640,7 @@ func (s *Server) getCluster(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
 		return
 	}
-	writeJSON(w, http.StatusOK, sanitizeCluster(c))
+	writeVersioned(w, http.StatusOK, c.ResourceVersion, sanitizeCluster(c))
 }
 
 func (s *Server) deleteCluster(w http.ResponseWriter, r *http.Request) {
@@ -428,6 +648,18 @@ func (s *Server) deleteCluster(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	id := chi.URLParam(r, "clusterID")
+	c, err := s.store.GetCluster(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "KN-404", "cluster not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return
+	}
+	if !checkIfMatch(w, r, c.ResourceVersion) {
+		return
+	}
 	if err := s.store.DeleteCluster(r.Context(), id); err != nil {
 		if errors.Is(err, store.ErrNotFound) {
 			writeError(w, http.StatusNotFound, "KN-404", "cluster not found")
@@ -436,6 +668,7 @@ func (s *Server) deleteCluster(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
 		return
 	}
+	s.publishEvent(r.Context(), eventClusterDeleted, c)
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -456,12 +689,20 @@ func (s *Server) getCapabilities(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, c.Capabilities)
 }
 
+// bootstrapComponent installs a component on the cluster. The install runs as
+// an operation; the response points at it.
 func (s *Server) bootstrapComponent(w http.ResponseWriter, r *http.Request) {
 	if !s.requireRole(w, r, "admin", "ops") {
 		return
 	}
 	id := chi.URLParam(r, "clusterID")
-	component := chi.URLParam(r, "component")
+	// ":upgrade" reinstalls at the release's versions, which is what an
+	// install does anyway.
+	component, _, _ := strings.Cut(chi.URLParam(r, "component"), ":")
+	if !cluster.KnownComponent(component) {
+		writeError(w, http.StatusBadRequest, "KN-400", fmt.Sprintf("unknown component %q", component))
+		return
+	}
 	c, err := s.store.GetCluster(r.Context(), id)
 	if err != nil {
 		if errors.Is(err, store.ErrNotFound) {
@@ -471,29 +712,17 @@ func (s *Server) bootstrapComponent(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
 		return
 	}
-	c.Status = "bootstrapping"
-	c.UpdatedAt = time.Now().UTC()
-	_ = s.store.UpdateCluster(r.Context(), c)
-
-	if component == "operator" {
-		if err := s.installOperator(r.Context(), c); err != nil {
-			c.Status = "error"
-			_ = s.store.UpdateCluster(r.Context(), c)
-			writeError(w, http.StatusInternalServerError, "KN-500", fmt.Sprintf("operator install: %v", err))
-			return
-		}
-		c.Status = "connected"
-		c.UpdatedAt = time.Now().UTC()
-		_ = s.store.UpdateCluster(r.Context(), c)
+	if !checkIfMatch(w, r, c.ResourceVersion) || s.clusterBusy(w, r, c.ID) {
+		return
 	}
-
-	writeJSON(w, http.StatusAccepted, map[string]any{
-		"clusterId": c.ID,
-		"component": component,
-		"status":    c.Status,
-	})
+	if err := s.setClusterStatus(r.Context(), c, "bootstrapping"); err != nil {
+		writeUpdateError(w, r, err)
+		return
+	}
+	s.writeOperation(w, r, operationClusterBootstrap, c, component)
 }
 
+// refreshCluster reinstalls every foundational component as an operation.
 func (s *Server) refreshCluster(w http.ResponseWriter, r *http.Request) {
 	if !s.requireRole(w, r, "admin", "ops") {
 		return
@@ -514,42 +743,30 @@ func (s *Server) refreshCluster(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	c.Status = "reinstalling"
-	c.UpdatedAt = time.Now().UTC()
-	_ = s.store.UpdateCluster(r.Context(), c)
-
-	cfg, err := clientcmd.RESTConfigFromKubeConfig([]byte(c.Kubeconfig))
-	if err != nil {
-		c.Status = "error"
-		_ = s.store.UpdateCluster(r.Context(), c)
-		writeError(w, http.StatusInternalServerError, "KN-500", fmt.Sprintf("parse kubeconfig: %v", err))
+	if !checkIfMatch(w, r, c.ResourceVersion) || s.clusterBusy(w, r, c.ID) {
 		return
 	}
-	scheme := runtime.NewScheme()
-	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
-	cli, err := ctrlclient.New(cfg, ctrlclient.Options{Scheme: scheme})
-	if err != nil {
-		c.Status = "error"
-		_ = s.store.UpdateCluster(r.Context(), c)
-		writeError(w, http.StatusInternalServerError, "KN-500", fmt.Sprintf("build client: %v", err))
+	if err := s.setClusterStatus(r.Context(), c, "reinstalling"); err != nil {
+		writeUpdateError(w, r, err)
 		return
 	}
+	s.writeOperation(w, r, operationClusterRefresh, c, "")
+}
 
-	if err := reconcile.BootstrapHelmJob(r.Context(), cli, cli, scheme); err != nil {
-		c.Status = "error"
-		_ = s.store.UpdateCluster(r.Context(), c)
-		writeError(w, http.StatusInternalServerError, "KN-500", fmt.Sprintf("reinstall components: %v", err))
+// writeOperation starts an operation on c and answers with it.
+func (s *Server) writeOperation(w http.ResponseWriter, r *http.Request, typ string, c *types.Cluster, component string) {
+	op, err := s.startOperation(r.Context(), typ, c, component)
+	if errors.Is(err, store.ErrConflict) {
+		writeError(w, http.StatusConflict, "KN-409", "another operation is still running on this cluster")
 		return
 	}
-
-	c.Status = "connected"
-	c.UpdatedAt = time.Now().UTC()
-	_ = s.store.UpdateCluster(r.Context(), c)
-
-	writeJSON(w, http.StatusAccepted, map[string]any{
-		"clusterId": c.ID,
-		"status":    c.Status,
-	})
+	if err != nil {
+		s.failClusterBootstrap(r.Context(), c, fmt.Errorf("start operation: %w", err))
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return
+	}
+	w.Header().Set("Operation-Location", operationLocation(op.ID))
+	writeJSON(w, http.StatusAccepted, op)
 }
 
 func (s *Server) createTenant(w http.ResponseWriter, r *http.Request) {
@@ -575,6 +792,9 @@ func (s *Server) createTenant(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "KN-400", "name is required")
 		return
 	}
+	if !requireCapability(w, cluster, "capsule") {
+		return
+	}
 	t := &types.Tenant{
 		ClusterID:       clusterID,
 		Name:            strings.TrimSpace(req.Name),
@@ -585,12 +805,21 @@ func (s *Server) createTenant(w http.ResponseWriter, r *http.Request) {
 		Limits:          req.Limits,
 		NetworkPolicies: req.NetworkPolicies,
 	}
+	if plan := strings.TrimSpace(req.Plan); plan != "" {
+		p, ok := s.lookupPlan(w, r, plan)
+		if !ok {
+			return
+		}
+		applyPlan(t, p, req.Quotas, req.Limits, req.NetworkPolicies)
+	}
 	if err := s.store.CreateTenant(r.Context(), t); err != nil {
 		switch {
 		case errors.Is(err, store.ErrConflict):
 			writeError(w, http.StatusConflict, "KN-409", "tenant already exists")
 		case errors.Is(err, store.ErrNotFound):
 			writeError(w, http.StatusNotFound, "KN-404", "cluster not found")
+		case errors.Is(err, store.ErrUnknownPlan):
+			writeError(w, http.StatusUnprocessableEntity, "KN-422", err.Error())
 		default:
 			writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
 		}
@@ -601,24 +830,28 @@ func (s *Server) createTenant(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusInternalServerError, "KN-500", fmt.Sprintf("sync tenant: %v", err))
 		return
 	}
-	writeJSON(w, http.StatusCreated, t)
+	s.publishEvent(r.Context(), eventTenantCreated, t)
+	writeVersioned(w, http.StatusCreated, t.ResourceVersion, t)
 }
 
 func (s *Server) listTenants(w http.ResponseWriter, r *http.Request) {
-	if !s.requireRole(w, r, "admin", "ops", "readOnly") && s.requireAuth {
+	if !s.requireAnyRole(w, r, "admin", "ops", "readOnly", "tenantOwner") {
 		return
 	}
-	clusterID := chi.URLParam(r, "clusterID")
-	tenants, err := s.store.ListTenants(r.Context(), clusterID)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+	opts, ok := listOptions(w, r)
+	if !ok {
 		return
 	}
-	writeJSON(w, http.StatusOK, tenants)
+	clusterID := chi.URLParam(r, "clusterID")
+	tenants, next, err := s.store.ListTenants(r.Context(), clusterID, opts)
+	tenants = filterVisible(s, r, tenants, func(t *types.Tenant) resourceScope {
+		return resourceScope{clusterID: t.ClusterID, tenantID: t.ID}
+	}, "admin", "ops", "readOnly", "tenantOwner")
+	writeList(w, r, tenants, next, err)
 }
 
 func (s *Server) getTenant(w http.ResponseWriter, r *http.Request) {
-	if !s.requireRole(w, r, "admin", "ops", "readOnly") && s.requireAuth {
+	if !s.requireRole(w, r, "admin", "ops", "readOnly", "tenantOwner") && s.requireAuth {
 		return
 	}
 	clusterID := chi.URLParam(r, "clusterID")
@@ -632,7 +865,7 @@ func (s *Server) getTenant(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
 		return
 	}
-	writeJSON(w, http.StatusOK, t)
+	writeVersioned(w, http.StatusOK, t.ResourceVersion, t)
 }
 
 func (s *Server) deleteTenant(w http.ResponseWriter, r *http.Request) {
@@ -646,6 +879,9 @@ func (s *Server) deleteTenant(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusNotFound, "KN-404", "tenant not found")
 		return
 	}
+	if !checkIfMatch(w, r, tenant.ResourceVersion) {
+		return
+	}
 	if err := s.deleteTenantResource(r.Context(), tenant); err != nil {
 		writeError(w, http.StatusInternalServerError, "KN-500", fmt.Sprintf("delete tenant from cluster: %v", err))
 		return
@@ -658,10 +894,14 @@ func (s *Server) deleteTenant(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
 		return
 	}
+	s.publishEvent(r.Context(), eventTenantDeleted, tenant)
 	w.WriteHeader(http.StatusNoContent)
 }
 
 func (s *Server) updateTenantOwners(w http.ResponseWriter, r *http.Request) {
+	if !s.requireRole(w, r, "admin", "ops") {
+		return
+	}
 	clusterID := chi.URLParam(r, "clusterID")
 	tenantID := chi.URLParam(r, "tenantID")
 	var req OwnersRequest
@@ -674,17 +914,21 @@ func (s *Server) updateTenantOwners(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusNotFound, "KN-404", "tenant not found")
 		return
 	}
+	if !checkIfMatch(w, r, t.ResourceVersion) {
+		return
+	}
 	t.Owners = req.Owners
 	t.UpdatedAt = time.Now().UTC()
 	if err := s.store.UpdateTenant(r.Context(), t); err != nil {
-		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		writeUpdateError(w, r, err)
 		return
 	}
+	s.publishEvent(r.Context(), eventTenantUpdated, t)
 	if err := s.syncTenant(r.Context(), t); err != nil {
 		writeError(w, http.StatusInternalServerError, "KN-500", fmt.Sprintf("sync tenant: %v", err))
 		return
 	}
-	writeJSON(w, http.StatusOK, t)
+	writeVersioned(w, http.StatusOK, t.ResourceVersion, t)
 }
 
 func (s *Server) updateTenantQuotas(w http.ResponseWriter, r *http.Request) {
@@ -696,6 +940,9 @@ func (s *Server) updateTenantLimits(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) updateTenantNetworkPolicies(w http.ResponseWriter, r *http.Request) {
+	if !s.requireRole(w, r, "admin", "ops") {
+		return
+	}
 	clusterID := chi.URLParam(r, "clusterID")
 	tenantID := chi.URLParam(r, "tenantID")
 	var req NetworkPolicyRequest
@@ -708,20 +955,27 @@ func (s *Server) updateTenantNetworkPolicies(w http.ResponseWriter, r *http.Requ
 		writeError(w, http.StatusNotFound, "KN-404", "tenant not found")
 		return
 	}
+	if !checkIfMatch(w, r, t.ResourceVersion) {
+		return
+	}
 	t.NetworkPolicies = req.Policies
 	t.UpdatedAt = time.Now().UTC()
 	if err := s.store.UpdateTenant(r.Context(), t); err != nil {
-		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		writeUpdateError(w, r, err)
 		return
 	}
+	s.publishEvent(r.Context(), eventTenantUpdated, t)
 	if err := s.syncTenant(r.Context(), t); err != nil {
 		writeError(w, http.StatusInternalServerError, "KN-500", fmt.Sprintf("sync tenant: %v", err))
 		return
 	}
-	writeJSON(w, http.StatusOK, t)
+	writeVersioned(w, http.StatusOK, t.ResourceVersion, t)
 }
 
 func (s *Server) updateTenantMapField(w http.ResponseWriter, r *http.Request, apply func(*types.Tenant, map[string]string)) {
+	if !s.requireRole(w, r, "admin", "ops") {
+		return
+	}
 	clusterID := chi.URLParam(r, "clusterID")
 	tenantID := chi.URLParam(r, "tenantID")
 	var req map[string]string
@@ -734,27 +988,31 @@ func (s *Server) updateTenantMapField(w http.ResponseWriter, r *http.Request, ap
 		writeError(w, http.StatusNotFound, "KN-404", "tenant not found")
 		return
 	}
+	if !checkIfMatch(w, r, t.ResourceVersion) {
+		return
+	}
 	apply(t, req)
 	t.UpdatedAt = time.Now().UTC()
 	if err := s.store.UpdateTenant(r.Context(), t); err != nil {
-		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		writeUpdateError(w, r, err)
 		return
 	}
+	s.publishEvent(r.Context(), eventTenantUpdated, t)
 	if err := s.syncTenant(r.Context(), t); err != nil {
 		writeError(w, http.StatusInternalServerError, "KN-500", fmt.Sprintf("sync tenant: %v", err))
 		return
 	}
-	writeJSON(w, http.StatusOK, t)
+	writeVersioned(w, http.StatusOK, t.ResourceVersion, t)
 }
 
 func (s *Server) tenantSummary(w http.ResponseWriter, r *http.Request) {
-	if !s.requireRole(w, r, "admin", "ops", "readOnly") && s.requireAuth {
+	if !s.requireRole(w, r, "admin", "ops", "readOnly", "tenantOwner") && s.requireAuth {
 		return
 	}
 	clusterID := chi.URLParam(r, "clusterID")
 	tenantID := chi.URLParam(r, "tenantID")
-	projects, _ := s.store.ListProjects(r.Context(), clusterID, tenantID)
-	apps, _ := s.store.ListApps(r.Context(), clusterID, tenantID, "")
+	projects, _, _ := s.store.ListProjects(r.Context(), clusterID, tenantID, store.ListOptions{})
+	apps, _, _ := s.store.ListApps(r.Context(), clusterID, tenantID, "", store.ListOptions{})
 	summary := types.TenantSummary{
 		TenantID:        tenantID,
 		ClusterID:       clusterID,
@@ -772,9 +1030,8 @@ func (s *Server) tenantKubeconfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	tenantID := chi.URLParam(r, "tenantID")
-	tenant := s.findTenant(r.Context(), tenantID)
-	if tenant == nil {
-		writeError(w, http.StatusNotFound, "KN-404", "tenant not found")
+	tenant, ok := s.lookupTenant(w, r, tenantID)
+	if !ok {
 		return
 	}
 	cfgs := map[string]string{}
@@ -809,32 +1066,31 @@ func (s *Server) tenantKubeconfig(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) tenantUsage(w http.ResponseWriter, r *http.Request) {
-	if !s.requireRole(w, r, "admin", "ops", "readOnly") && s.requireAuth {
+	if !s.requireRole(w, r, "admin", "ops", "readOnly", "tenantOwner") && s.requireAuth {
 		return
 	}
 	tenantID := chi.URLParam(r, "tenantID")
-	tenant := s.findTenant(r.Context(), tenantID)
-	if tenant == nil {
-		writeError(w, http.StatusNotFound, "KN-404", "tenant not found")
+	tenant, ok := s.lookupTenant(w, r, tenantID)
+	if !ok {
 		return
 	}
-	apps, _ := s.store.ListApps(r.Context(), tenant.ClusterID, tenant.ID, "")
-	usage := types.UsageRecord{
-		CPURequests:     "0",
-		MemoryRequests:  "0",
-		PVCStorage:      "0Gi",
-		LoadBalancers:   0,
-		Pods:            0,
-		Namespaces:      2,
-		Apps:            len(apps),
-		QuotaViolations: 0,
-		LastReportedAt:  time.Now().UTC(),
+	if s.writeUsageSeries(w, r, tenant.ID, "") {
+		return
+	}
+	usage, err := s.store.LatestUsage(r.Context(), tenant.ID, "")
+	if errors.Is(err, store.ErrNotFound) {
+		apps, _, _ := s.store.ListApps(r.Context(), tenant.ClusterID, tenant.ID, "", store.ListOptions{})
+		usage, err = emptyUsage(tenant.ClusterID, tenant.ID, "", len(apps)), nil
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return
 	}
 	writeJSON(w, http.StatusOK, usage)
 }
 
 func (s *Server) createProject(w http.ResponseWriter, r *http.Request) {
-	if !s.requireRole(w, r, "admin", "ops") {
+	if !s.requireRole(w, r, "admin", "ops", "tenantOwner") {
 		return
 	}
 	clusterID := chi.URLParam(r, "clusterID")
@@ -886,21 +1142,31 @@ func (s *Server) createProject(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusInternalServerError, "KN-500", fmt.Sprintf("sync project: %v", err))
 		return
 	}
-	writeJSON(w, http.StatusCreated, p)
+	s.publishEvent(r.Context(), eventProjectCreated, p)
+	writeVersioned(w, http.StatusCreated, p.ResourceVersion, p)
 }
 
 func (s *Server) listProjects(w http.ResponseWriter, r *http.Request) {
-	clusterID := chi.URLParam(r, "clusterID")
-	tenantID := chi.URLParam(r, "tenantID")
-	projects, err := s.store.ListProjects(r.Context(), clusterID, tenantID)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+	if !s.requireAnyRole(w, r, "admin", "ops", "readOnly", "tenantOwner", "projectDev") {
+		return
+	}
+	opts, ok := listOptions(w, r)
+	if !ok {
 		return
 	}
-	writeJSON(w, http.StatusOK, projects)
+	clusterID := chi.URLParam(r, "clusterID")
+	tenantID := chi.URLParam(r, "tenantID")
+	projects, next, err := s.store.ListProjects(r.Context(), clusterID, tenantID, opts)
+	projects = filterVisible(s, r, projects, func(p *types.Project) resourceScope {
+		return resourceScope{clusterID: p.ClusterID, tenantID: p.TenantID, projectID: p.ID}
+	}, "admin", "ops", "readOnly", "tenantOwner", "projectDev")
+	writeList(w, r, projects, next, err)
 }
 
 func (s *Server) getProject(w http.ResponseWriter, r *http.Request) {
+	if !s.requireRole(w, r, "admin", "ops", "readOnly", "tenantOwner", "projectDev") && s.requireAuth {
+		return
+	}
 	clusterID := chi.URLParam(r, "clusterID")
 	tenantID := chi.URLParam(r, "tenantID")
 	projectID := chi.URLParam(r, "projectID")
@@ -913,10 +1179,13 @@ func (s *Server) getProject(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
 		return
 	}
-	writeJSON(w, http.StatusOK, project)
+	writeVersioned(w, http.StatusOK, project.ResourceVersion, project)
 }
 
 func (s *Server) updateProject(w http.ResponseWriter, r *http.Request) {
+	if !s.requireRole(w, r, "admin", "ops", "tenantOwner") {
+		return
+	}
 	clusterID := chi.URLParam(r, "clusterID")
 	tenantID := chi.URLParam(r, "tenantID")
 	projectID := chi.URLParam(r, "projectID")
@@ -925,6 +1194,9 @@ func (s *Server) updateProject(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusNotFound, "KN-404", "project not found")
 		return
 	}
+	if !checkIfMatch(w, r, project.ResourceVersion) {
+		return
+	}
 	var req ProjectRequest
 	if err := decodeJSON(r, &req); err != nil {
 		writeError(w, http.StatusBadRequest, "KN-400", err.Error())
@@ -944,18 +1216,19 @@ func (s *Server) updateProject(w http.ResponseWriter, r *http.Request) {
 	}
 	project.UpdatedAt = time.Now().UTC()
 	if err := s.store.UpdateProject(r.Context(), project); err != nil {
-		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		writeUpdateError(w, r, err)
 		return
 	}
+	s.publishEvent(r.Context(), eventProjectUpdated, project)
 	if err := s.syncProject(r.Context(), project, nil); err != nil {
 		writeError(w, http.StatusInternalServerError, "KN-500", fmt.Sprintf("sync project: %v", err))
 		return
 	}
-	writeJSON(w, http.StatusOK, project)
+	writeVersioned(w, http.StatusOK, project.ResourceVersion, project)
 }
 
 func (s *Server) deleteProject(w http.ResponseWriter, r *http.Request) {
-	if !s.requireRole(w, r, "admin", "ops") {
+	if !s.requireRole(w, r, "admin", "ops", "tenantOwner") {
 		return
 	}
 	clusterID := chi.URLParam(r, "clusterID")
@@ -966,6 +1239,9 @@ func (s *Server) deleteProject(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusNotFound, "KN-404", "project not found")
 		return
 	}
+	if !checkIfMatch(w, r, project.ResourceVersion) {
+		return
+	}
 	if err := s.deleteProjectResource(r.Context(), project); err != nil {
 		writeError(w, http.StatusInternalServerError, "KN-500", fmt.Sprintf("delete project from cluster: %v", err))
 		return
@@ -978,10 +1254,14 @@ func (s *Server) deleteProject(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
 		return
 	}
+	s.publishEvent(r.Context(), eventProjectDeleted, project)
 	w.WriteHeader(http.StatusNoContent)
 }
 
 func (s *Server) updateProjectAccess(w http.ResponseWriter, r *http.Request) {
+	if !s.requireRole(w, r, "admin", "ops", "tenantOwner") {
+		return
+	}
 	clusterID := chi.URLParam(r, "clusterID")
 	tenantID := chi.URLParam(r, "tenantID")
 	projectID := chi.URLParam(r, "projectID")
@@ -990,6 +1270,9 @@ func (s *Server) updateProjectAccess(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusNotFound, "KN-404", "project not found")
 		return
 	}
+	if !checkIfMatch(w, r, project.ResourceVersion) {
+		return
+	}
 	var req AccessRequest
 	if err := decodeJSON(r, &req); err != nil {
 		writeError(w, http.StatusBadRequest, "KN-400", err.Error())
@@ -998,14 +1281,15 @@ func (s *Server) updateProjectAccess(w http.ResponseWriter, r *http.Request) {
 	project.Access = req.Access
 	project.UpdatedAt = time.Now().UTC()
 	if err := s.store.UpdateProject(r.Context(), project); err != nil {
-		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		writeUpdateError(w, r, err)
 		return
 	}
+	s.publishEvent(r.Context(), eventProjectUpdated, project)
 	if err := s.syncProject(r.Context(), project, nil); err != nil {
 		writeError(w, http.StatusInternalServerError, "KN-500", fmt.Sprintf("sync project: %v", err))
 		return
 	}
-	writeJSON(w, http.StatusOK, project)
+	writeVersioned(w, http.StatusOK, project.ResourceVersion, project)
 }
 
 func (s *Server) projectKubeconfig(w http.ResponseWriter, r *http.Request) {
@@ -1014,9 +1298,8 @@ func (s *Server) projectKubeconfig(w http.ResponseWriter, r *http.Request) {
 	}
 	tenantID := chi.URLParam(r, "tenantID")
 	projectID := chi.URLParam(r, "projectID")
-	tenant := s.findTenant(r.Context(), tenantID)
-	if tenant == nil {
-		writeError(w, http.StatusNotFound, "KN-404", "tenant not found")
+	tenant, ok := s.lookupTenant(w, r, tenantID)
+	if !ok {
 		return
 	}
 	base := s.clusterProxyBase(r.Context(), tenant.ClusterID)
@@ -1027,26 +1310,25 @@ func (s *Server) projectKubeconfig(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) projectUsage(w http.ResponseWriter, r *http.Request) {
-	if !s.requireRole(w, r, "admin", "ops", "readOnly") && s.requireAuth {
+	if !s.requireRole(w, r, "admin", "ops", "readOnly", "tenantOwner", "projectDev") && s.requireAuth {
 		return
 	}
 	projectID := chi.URLParam(r, "projectID")
-	project := s.findProject(r.Context(), projectID)
-	if project == nil {
-		writeError(w, http.StatusNotFound, "KN-404", "project not found")
+	project, ok := s.lookupProject(w, r, projectID)
+	if !ok {
 		return
 	}
-	apps, _ := s.store.ListApps(r.Context(), project.ClusterID, project.TenantID, project.ID)
-	usage := types.UsageRecord{
-		CPURequests:     "0",
-		MemoryRequests:  "0",
-		PVCStorage:      "0Gi",
-		LoadBalancers:   0,
-		Pods:            len(apps) * 2,
-		Namespaces:      1,
-		Apps:            len(apps),
-		QuotaViolations: 0,
-		LastReportedAt:  time.Now().UTC(),
+	if s.writeUsageSeries(w, r, project.TenantID, project.ID) {
+		return
+	}
+	usage, err := s.store.LatestUsage(r.Context(), project.TenantID, project.ID)
+	if errors.Is(err, store.ErrNotFound) {
+		apps, _, _ := s.store.ListApps(r.Context(), project.ClusterID, project.TenantID, project.ID, store.ListOptions{})
+		usage, err = emptyUsage(project.ClusterID, project.TenantID, project.ID, len(apps)), nil
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return
 	}
 	writeJSON(w, http.StatusOK, usage)
 }
@@ -1082,6 +1364,13 @@ func (s *Server) createApp(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusNotFound, "KN-404", "project not found")
 		return
 	}
+	if !requireCapability(w, cluster, "kubeVela") {
+		return
+	}
+	if err := s.checkPlanComponent(r.Context(), tenant, req.Spec); err != nil {
+		writePlanError(w, err)
+		return
+	}
 	now := time.Now().UTC()
 	app := &types.App{
 		ClusterID:   clusterID,
@@ -1122,7 +1411,8 @@ func (s *Server) createApp(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusInternalServerError, "KN-500", fmt.Sprintf("sync app: %v", err))
 		return
 	}
-	writeJSON(w, http.StatusCreated, app)
+	s.publishEvent(r.Context(), eventAppCreated, app)
+	writeVersioned(w, http.StatusCreated, app.ResourceVersion, app)
 }
 
 func (s *Server) listApps(w http.ResponseWriter, r *http.Request) {
@@ -1132,12 +1422,12 @@ func (s *Server) listApps(w http.ResponseWriter, r *http.Request) {
 	clusterID := chi.URLParam(r, "clusterID")
 	tenantID := chi.URLParam(r, "tenantID")
 	projectID := chi.URLParam(r, "projectID")
-	apps, err := s.store.ListApps(r.Context(), clusterID, tenantID, projectID)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+	opts, ok := listOptions(w, r)
+	if !ok {
 		return
 	}
-	writeJSON(w, http.StatusOK, apps)
+	apps, next, err := s.store.ListApps(r.Context(), clusterID, tenantID, projectID, opts)
+	writeList(w, r, apps, next, err)
 }
 
 func (s *Server) getApp(w http.ResponseWriter, r *http.Request) {
@@ -1157,10 +1447,13 @@ func (s *Server) getApp(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
 		return
 	}
-	writeJSON(w, http.StatusOK, app)
+	writeVersioned(w, http.StatusOK, app.ResourceVersion, app)
 }
 
 func (s *Server) updateApp(w http.ResponseWriter, r *http.Request) {
+	if !s.requireRole(w, r, "admin", "ops", "projectDev", "tenantOwner") {
+		return
+	}
 	clusterID := chi.URLParam(r, "clusterID")
 	tenantID := chi.URLParam(r, "tenantID")
 	projectID := chi.URLParam(r, "projectID")
@@ -1170,6 +1463,9 @@ func (s *Server) updateApp(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusNotFound, "KN-404", "app not found")
 		return
 	}
+	if !checkIfMatch(w, r, app.ResourceVersion) {
+		return
+	}
 	tenant, _ := s.store.GetTenant(r.Context(), clusterID, tenantID)
 	var req AppRequest
 	if err := decodeJSON(r, &req); err != nil {
@@ -1186,6 +1482,10 @@ func (s *Server) updateApp(w http.ResponseWriter, r *http.Request) {
 		app.Image = req.Image
 	}
 	if req.Spec != nil {
+		if err := s.checkPlanComponent(r.Context(), tenant, req.Spec); err != nil {
+			writePlanError(w, err)
+			return
+		}
 		app.Spec = req.Spec
 		app.Revision++
 		app.Revisions = append(app.Revisions, types.AppRevision{
@@ -1197,27 +1497,33 @@ func (s *Server) updateApp(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 	app.UpdatedAt = time.Now().UTC()
+	app.PublishVersion = publishVersion(app, app.UpdatedAt)
 	if err := s.store.UpdateApp(r.Context(), app); err != nil {
-		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		writeUpdateError(w, r, err)
 		return
 	}
+	if req.Spec != nil {
+		s.publishEvent(r.Context(), eventAppRevisionCreated, app)
+	} else {
+		s.publishEvent(r.Context(), eventAppUpdated, app)
+	}
 	if err := s.syncApp(r.Context(), app, tenant, nil); err != nil {
 		writeError(w, http.StatusInternalServerError, "KN-500", fmt.Sprintf("sync app: %v", err))
 		return
 	}
-	writeJSON(w, http.StatusOK, app)
+	writeVersioned(w, http.StatusOK, app.ResourceVersion, app)
 }
 
 func (s *Server) deployApp(w http.ResponseWriter, r *http.Request) {
-	s.changeAppStatus(w, r, "Deployed", false)
+	s.changeAppStatus(w, r, "Deployed", false, true)
 }
 
 func (s *Server) suspendApp(w http.ResponseWriter, r *http.Request) {
-	s.changeAppStatus(w, r, "Suspended", true)
+	s.changeAppStatus(w, r, "Suspended", true, false)
 }
 
 func (s *Server) resumeApp(w http.ResponseWriter, r *http.Request) {
-	s.changeAppStatus(w, r, "Deployed", false)
+	s.changeAppStatus(w, r, "Deployed", false, false)
 }
 
 func (s *Server) deleteAppAction(w http.ResponseWriter, r *http.Request) {
@@ -1233,6 +1539,9 @@ func (s *Server) deleteAppAction(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusNotFound, "KN-404", "app not found")
 		return
 	}
+	if !checkIfMatch(w, r, app.ResourceVersion) {
+		return
+	}
 	if err := s.deleteAppResource(r.Context(), app); err != nil {
 		writeError(w, http.StatusInternalServerError, "KN-500", fmt.Sprintf("delete app from cluster: %v", err))
 		return
@@ -1245,6 +1554,7 @@ func (s *Server) deleteAppAction(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
 		return
 	}
+	s.publishEvent(r.Context(), eventAppDeleted, app)
 	writeJSON(w, http.StatusAccepted, map[string]string{"status": "deleting"})
 }
 
@@ -1256,28 +1566,100 @@ func (s *Server) rollbackApp(w http.ResponseWriter, r *http.Request) {
 	tenantID := chi.URLParam(r, "tenantID")
 	projectID := chi.URLParam(r, "projectID")
 	appID := chi.URLParam(r, "appID")
+	var req RollbackRequest
+	if r.ContentLength != 0 {
+		if err := decodeJSON(r, &req); err != nil && !errors.Is(err, io.EOF) {
+			writeError(w, http.StatusBadRequest, "KN-400", err.Error())
+			return
+		}
+	}
+	if raw := r.URL.Query().Get("revision"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "KN-400", "revision must be an integer")
+			return
+		}
+		req.Revision = n
+	}
 	app, err := s.store.GetApp(r.Context(), clusterID, tenantID, projectID, appID)
 	if err != nil {
 		writeError(w, http.StatusNotFound, "KN-404", "app not found")
 		return
 	}
-	if len(app.Revisions) < 2 {
-		writeError(w, http.StatusUnprocessableEntity, "KN-422", "no previous revision to roll back to")
+	if !checkIfMatch(w, r, app.ResourceVersion) {
+		return
+	}
+	var target *types.AppRevision
+	if req.Revision == 0 {
+		// Without a target, step back to the revision before the current one.
+		if len(app.Revisions) < 2 {
+			writeError(w, http.StatusUnprocessableEntity, "KN-422", "no previous revision to roll back to")
+			return
+		}
+		prev := app.Revisions[len(app.Revisions)-2]
+		target = &prev
+	} else if target = findRevision(app.Revisions, strconv.Itoa(req.Revision)); target == nil {
+		writeError(w, http.StatusNotFound, "KN-404", fmt.Sprintf("revision %d not found", req.Revision))
+		return
+	}
+	if target.Number == app.Revision {
+		writeError(w, http.StatusUnprocessableEntity, "KN-422", fmt.Sprintf("app is already at revision %d", target.Number))
 		return
 	}
-	previous := app.Revisions[len(app.Revisions)-2]
-	app.Spec = previous.Spec
-	app.Traits = previous.Traits
-	app.Policies = previous.Policies
-	app.Revision = previous.Number
-	app.Revisions = app.Revisions[:len(app.Revisions)-1]
+	tenant, err := s.store.GetTenant(r.Context(), clusterID, tenantID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "KN-404", "tenant not found")
+		return
+	}
+
+	// Rolling back is a change like any other: the target is copied into a
+	// new revision so the history stays append-only.
+	from := app.Revision
+	now := time.Now().UTC()
+	app.Spec = target.Spec
+	app.Traits = target.Traits
+	app.Policies = target.Policies
+	app.Revision = latestRevision(app.Revisions) + 1
+	app.Revisions = append(app.Revisions, types.AppRevision{
+		Number:    app.Revision,
+		Spec:      target.Spec,
+		Traits:    target.Traits,
+		Policies:  target.Policies,
+		CreatedAt: now,
+	})
+	prevStatus := app.Status
 	app.Status = "RolledBack"
-	app.UpdatedAt = time.Now().UTC()
+	app.UpdatedAt = now
+	app.PublishVersion = publishVersion(app, now)
 	if err := s.store.UpdateApp(r.Context(), app); err != nil {
-		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		writeUpdateError(w, r, err)
 		return
 	}
-	writeJSON(w, http.StatusOK, app)
+	s.publishEvent(r.Context(), eventAppRevisionCreated, app)
+	resp := RollbackResponse{App: app, RolledBackFrom: from, RolledBackTo: target.Number, Synced: true}
+	if err := s.syncApp(r.Context(), app, tenant, nil); err != nil {
+		logging.L.Warn("rollback_sync_failed", zap.String("app", app.ID), zap.Int("revision", app.Revision), zap.Error(err))
+		resp.Synced = false
+		resp.SyncError = err.Error()
+		app.Status = "SyncFailed"
+		if err := s.store.UpdateApp(r.Context(), app); err != nil {
+			writeUpdateError(w, r, err)
+			return
+		}
+	}
+	if app.Status != prevStatus {
+		s.publishEvent(r.Context(), eventAppStatusChanged, app)
+	}
+	writeVersioned(w, http.StatusOK, app.ResourceVersion, resp)
+}
+
+// latestRevision returns the highest revision number in the history.
+func latestRevision(revs []types.AppRevision) int {
+	n := 0
+	for _, r := range revs {
+		n = max(n, r.Number)
+	}
+	return n
 }
 
 func (s *Server) appStatus(w http.ResponseWriter, r *http.Request) {
@@ -1337,25 +1719,12 @@ func (s *Server) appDiff(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusNotFound, "KN-404", "revision not found")
 		return
 	}
-	writeJSON(w, http.StatusOK, map[string]any{
-		"from":    a.Number,
-		"to":      b.Number,
-		"summary": fmt.Sprintf("changed spec from rev %d to %d", a.Number, b.Number),
-	})
-}
-
-func (s *Server) appLogs(w http.ResponseWriter, r *http.Request) {
-	if !s.requireRole(w, r, "admin", "ops", "projectDev", "tenantOwner", "readOnly") && s.requireAuth {
+	diff, err := diffRevisions(a, b, parseBool(r.URL.Query().Get("unified")))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
 		return
 	}
-	component := chi.URLParam(r, "component")
-	writeJSON(w, http.StatusOK, map[string]any{
-		"component": component,
-		"lines": []string{
-			"2024-01-01T00:00:00Z starting component",
-			"2024-01-01T00:00:01Z reconciled",
-		},
-	})
+	writeJSON(w, http.StatusOK, diff)
 }
 
 func (s *Server) updateAppTraits(w http.ResponseWriter, r *http.Request) {
@@ -1370,64 +1739,6 @@ func (s *Server) updateAppPolicies(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
-func (s *Server) runWorkflow(w http.ResponseWriter, r *http.Request) {
-	clusterID := chi.URLParam(r, "clusterID")
-	tenantID := chi.URLParam(r, "tenantID")
-	projectID := chi.URLParam(r, "projectID")
-	appID := chi.URLParam(r, "appID")
-	app, err := s.store.GetApp(r.Context(), clusterID, tenantID, projectID, appID)
-	if err != nil {
-		writeError(w, http.StatusNotFound, "KN-404", "app not found")
-		return
-	}
-	var req WorkflowRequest
-	if err := decodeJSON(r, &req); err != nil {
-		writeError(w, http.StatusBadRequest, "KN-400", err.Error())
-		return
-	}
-	run := types.WorkflowRun{
-		ID:        fmt.Sprintf("run-%d", len(app.WorkflowRuns)+1),
-		AppID:     app.ID,
-		Status:    "Running",
-		Inputs:    req.Inputs,
-		StartedAt: time.Now().UTC(),
-	}
-	app.WorkflowRuns = append(app.WorkflowRuns, run)
-	app.UpdatedAt = time.Now().UTC()
-	if err := s.store.UpdateApp(r.Context(), app); err != nil {
-		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
-		return
-	}
-	writeJSON(w, http.StatusAccepted, run)
-}
-
-func (s *Server) listWorkflowRuns(w http.ResponseWriter, r *http.Request) {
-	clusterID := chi.URLParam(r, "clusterID")
-	tenantID := chi.URLParam(r, "tenantID")
-	projectID := chi.URLParam(r, "projectID")
-	appID := chi.URLParam(r, "appID")
-	app, err := s.store.GetApp(r.Context(), clusterID, tenantID, projectID, appID)
-	if err != nil {
-		writeError(w, http.StatusNotFound, "KN-404", "app not found")
-		return
-	}
-	writeJSON(w, http.StatusOK, app.WorkflowRuns)
-}
-
-func (s *Server) getWorkflowRun(w http.ResponseWriter, r *http.Request) {
-	runID := chi.URLParam(r, "runID")
-	apps, _ := s.store.ListApps(r.Context(), "", "", "")
-	for _, app := range apps {
-		for _, run := range app.WorkflowRuns {
-			if run.ID == runID {
-				writeJSON(w, http.StatusOK, run)
-				return
-			}
-		}
-	}
-	writeError(w, http.StatusNotFound, "KN-404", "run not found")
-}
-
 func (s *Server) updateAppConfig(w http.ResponseWriter, r *http.Request, apply func(*types.App, AppRequest)) {
 	if !s.requireRole(w, r, "admin", "ops", "projectDev", "tenantOwner") {
 		return
@@ -1441,6 +1752,10 @@ func (s *Server) updateAppConfig(w http.ResponseWriter, r *http.Request, apply f
 		writeError(w, http.StatusNotFound, "KN-404", "app not found")
 		return
 	}
+	if !checkIfMatch(w, r, app.ResourceVersion) {
+		return
+	}
+	tenant, _ := s.store.GetTenant(r.Context(), clusterID, tenantID)
 	var req AppRequest
 	if err := decodeJSON(r, &req); err != nil {
 		writeError(w, http.StatusBadRequest, "KN-400", err.Error())
@@ -1456,14 +1771,37 @@ func (s *Server) updateAppConfig(w http.ResponseWriter, r *http.Request, apply f
 		CreatedAt: time.Now().UTC(),
 	})
 	app.UpdatedAt = time.Now().UTC()
+	app.PublishVersion = publishVersion(app, app.UpdatedAt)
 	if err := s.store.UpdateApp(r.Context(), app); err != nil {
-		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		writeUpdateError(w, r, err)
+		return
+	}
+	s.publishEvent(r.Context(), eventAppRevisionCreated, app)
+	if err := s.syncApp(r.Context(), app, tenant, nil); err != nil {
+		writeError(w, http.StatusInternalServerError, "KN-500", fmt.Sprintf("sync app: %v", err))
 		return
 	}
-	writeJSON(w, http.StatusOK, app)
+	writeVersioned(w, http.StatusOK, app.ResourceVersion, app)
+}
+
+// publishVersion names one change to an app. Once an Application carries a
+// publish version KubeVela ignores spec changes until the version changes, so
+// every deploy, suspend, resume, update and rollback gets its own.
+func publishVersion(app *types.App, now time.Time) string {
+	v := fmt.Sprintf("%d-%d", app.Revision, now.UnixNano())
+	if app.Suspended {
+		v += "-suspended"
+	}
+	return v
 }
 
-func (s *Server) changeAppStatus(w http.ResponseWriter, r *http.Request, status string, suspended bool) {
+// changeAppStatus applies a lifecycle action to the cluster and records the
+// new status only once the cluster has accepted it. Suspended apps are scaled
+// to zero; redeploy also reports the app as deployed.
+func (s *Server) changeAppStatus(w http.ResponseWriter, r *http.Request, status string, suspended, redeploy bool) {
+	if !s.requireRole(w, r, "admin", "ops", "projectDev", "tenantOwner") {
+		return
+	}
 	clusterID := chi.URLParam(r, "clusterID")
 	tenantID := chi.URLParam(r, "tenantID")
 	projectID := chi.URLParam(r, "projectID")
@@ -1473,14 +1811,36 @@ func (s *Server) changeAppStatus(w http.ResponseWriter, r *http.Request, status
 		writeError(w, http.StatusNotFound, "KN-404", "app not found")
 		return
 	}
+	if !checkIfMatch(w, r, app.ResourceVersion) {
+		return
+	}
+	now := time.Now().UTC()
+	desired := *app
+	desired.Suspended = suspended
+	desired.PublishVersion = publishVersion(&desired, now)
+	if err := s.applyApp(r.Context(), &desired, nil); err != nil {
+		writeError(w, http.StatusInternalServerError, "KN-500", fmt.Sprintf("apply app to cluster: %v", err))
+		return
+	}
+	prevStatus := app.Status
 	app.Status = status
 	app.Suspended = suspended
-	app.UpdatedAt = time.Now().UTC()
+	app.PublishVersion = desired.PublishVersion
+	app.UpdatedAt = now
 	if err := s.store.UpdateApp(r.Context(), app); err != nil {
-		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		writeUpdateError(w, r, err)
 		return
 	}
-	writeJSON(w, http.StatusAccepted, map[string]any{"status": status})
+	if status != prevStatus {
+		s.publishEvent(r.Context(), eventAppStatusChanged, app)
+	} else {
+		s.publishEvent(r.Context(), eventAppUpdated, app)
+	}
+	if redeploy {
+		s.publishEvent(r.Context(), eventAppDeployed, app)
+	}
+	resp := map[string]any{"status": status, "suspended": app.Suspended, "publishVersion": app.PublishVersion}
+	writeVersioned(w, http.StatusAccepted, app.ResourceVersion, resp)
 }
 
 func (s *Server) authContext(ctx context.Context) *AuthContext {
@@ -1490,12 +1850,30 @@ func (s *Server) authContext(ctx context.Context) *AuthContext {
 	return &AuthContext{Subject: "anonymous", Roles: []string{}}
 }
 
+// telemetryEvent logs an event reported by a cluster's operator and
+// republishes it on the event stream. Like usage reports, only admins and
+// callers holding the operator role bound to the event's cluster may post it.
 func (s *Server) telemetryEvent(w http.ResponseWriter, r *http.Request) {
 	var ev TelemetryEvent
 	if err := decodeJSON(r, &ev); err != nil {
 		writeError(w, http.StatusBadRequest, "KN-400", err.Error())
 		return
 	}
+	if strings.TrimSpace(ev.ClusterID) == "" {
+		writeError(w, http.StatusBadRequest, "KN-400", "clusterId is required")
+		return
+	}
+	if !s.requireScope(w, r, resourceScope{clusterID: ev.ClusterID}, "admin", "operator") {
+		return
+	}
+	if _, err := s.store.GetCluster(r.Context(), ev.ClusterID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "KN-404", "cluster not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return
+	}
 	logging.L.Info("telemetry_event_received",
 		zap.String("stream", ev.Stream),
 		zap.String("component", ev.Component),
@@ -1503,21 +1881,52 @@ func (s *Server) telemetryEvent(w http.ResponseWriter, r *http.Request) {
 		zap.String("error", ev.Error),
 		zap.String("cluster_id", ev.ClusterID),
 	)
+	name := ev.Event
+	if name == "" {
+		name = ev.Stream
+	}
+	if validEventName(name) {
+		// Without auth anyone can post telemetry, so it is only streamed and
+		// not sent on as signed webhook deliveries.
+		s.appendEvent(r.Context(), eventTelemetryPrefix+name, ev, "", s.requireAuth)
+	}
 	writeJSON(w, http.StatusAccepted, map[string]string{"status": "received"})
 }
 
 // Request DTOs
 type TokenRequest struct {
-	Subject    string   `json:"subject"`
-	Roles      []string `json:"roles"`
-	TTLMinutes int      `json:"ttlMinutes"`
+	Subject    string              `json:"subject"`
+	Roles      []string            `json:"roles"`
+	Bindings   []types.RoleBinding `json:"bindings,omitempty"`
+	TTLMinutes int                 `json:"ttlMinutes"`
 }
 
 type TokenResponse struct {
-	Token     string    `json:"token"`
+	Token string `json:"token"`
+	// JTI identifies the token on the revocation list.
+	JTI       string    `json:"jti"`
 	ExpiresAt time.Time `json:"expiresAt"`
 }
 
+type TokenRevocationRequest struct {
+	JTI string `json:"jti"`
+	// ExpiresAt lets the revocation be pruned once the token has expired.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+type APIKeyRequest struct {
+	Name     string              `json:"name"`
+	Roles    []string            `json:"roles,omitempty"`
+	Bindings []types.RoleBinding `json:"bindings,omitempty"`
+	TTLDays  int                 `json:"ttlDays,omitempty"`
+}
+
+// APIKeyResponse is the created key along with the key itself.
+type APIKeyResponse struct {
+	types.APIKey
+	Key string `json:"key"`
+}
+
 type TelemetryEvent struct {
 	Stream    string `json:"stream"`
 	Event     string `json:"event"`
@@ -1545,6 +1954,23 @@ type TenantRequest struct {
 	NetworkPolicies []string          `json:"networkPolicies"`
 }
 
+type TenantPlanRequest struct {
+	Plan            string            `json:"plan"`
+	Quotas          map[string]string `json:"quotas"`
+	Limits          map[string]string `json:"limits"`
+	NetworkPolicies []string          `json:"networkPolicies"`
+}
+
+type PlanRequest struct {
+	Name            string             `json:"name"`
+	Description     string             `json:"description"`
+	Quotas          map[string]string  `json:"quotas"`
+	Limits          map[string]string  `json:"limits"`
+	NetworkPolicies []string           `json:"networkPolicies"`
+	Components      []string           `json:"components"`
+	Pricing         *types.PlanPricing `json:"pricing"`
+}
+
 type OwnersRequest struct {
 	Owners []string `json:"owners"`
 }
@@ -1574,10 +2000,35 @@ type AppRequest struct {
 	Policies    []map[string]any `json:"policies"`
 }
 
+// RollbackRequest selects the revision to roll back to; zero means the one
+// before the current revision.
+type RollbackRequest struct {
+	Revision int `json:"revision"`
+}
+
+// RollbackResponse is the app after a rollback together with whether the
+// cluster accepted the new revision.
+type RollbackResponse struct {
+	*types.App
+	RolledBackFrom int    `json:"rolledBackFrom"`
+	RolledBackTo   int    `json:"rolledBackTo"`
+	Synced         bool   `json:"synced"`
+	SyncError      string `json:"syncError,omitempty"`
+}
+
 type WorkflowRequest struct {
 	Inputs map[string]any `json:"inputs"`
 }
 
+type WebhookRequest struct {
+	URL         string   `json:"url"`
+	Description string   `json:"description,omitempty"`
+	EventTypes  []string `json:"eventTypes,omitempty"`
+	TenantID    string   `json:"tenantId,omitempty"`
+	Active      *bool    `json:"active,omitempty"`
+	Secret      string   `json:"secret,omitempty"`
+}
+
 // Helpers
 func decodeJSON(r *http.Request, v any) error {
 	defer r.Body.Close()
@@ -1605,6 +2056,14 @@ func writeError(w http.ResponseWriter, status int, code, msg string) {
 	})
 }
 
+func writePlanError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errPlanViolation) {
+		writeError(w, http.StatusUnprocessableEntity, "KN-422", err.Error())
+		return
+	}
+	writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+}
+
 func findRevision(revs []types.AppRevision, number string) *types.AppRevision {
 	for _, r := range revs {
 		if fmt.Sprintf("%d", r.Number) == number {
@@ -1615,6 +2074,14 @@ func findRevision(revs []types.AppRevision, number string) *types.AppRevision {
 	return nil
 }
 
+func envInt(key string, def int) int {
+	v, err := strconv.Atoi(strings.TrimSpace(os.Getenv(key)))
+	if err != nil {
+		return def
+	}
+	return v
+}
+
 func parseBool(v string) bool {
 	switch strings.ToLower(strings.TrimSpace(v)) {
 	case "true", "1", "yes", "on", "y", "t":
@@ -1624,24 +2091,33 @@ func parseBool(v string) bool {
 	}
 }
 
-func (s *Server) findTenant(ctx context.Context, tenantID string) *types.Tenant {
-	tenants, _ := s.store.ListTenants(ctx, "")
-	for _, t := range tenants {
-		if t.ID == tenantID {
-			return t
+// lookupTenant resolves a tenant by ID on routes that do not name its cluster
+// and writes the error response when it cannot.
+func (s *Server) lookupTenant(w http.ResponseWriter, r *http.Request, tenantID string) (*types.Tenant, bool) {
+	t, err := s.store.GetTenantByID(r.Context(), tenantID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "KN-404", "tenant not found")
+			return nil, false
 		}
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return nil, false
 	}
-	return nil
+	return t, true
 }
 
-func (s *Server) findProject(ctx context.Context, projectID string) *types.Project {
-	projects, _ := s.store.ListProjects(ctx, "", "")
-	for _, p := range projects {
-		if p.ID == projectID {
-			return p
+// lookupProject is lookupTenant for projects.
+func (s *Server) lookupProject(w http.ResponseWriter, r *http.Request, projectID string) (*types.Project, bool) {
+	p, err := s.store.GetProjectByID(r.Context(), projectID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "KN-404", "project not found")
+			return nil, false
 		}
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return nil, false
 	}
-	return nil
+	return p, true
 }
 
 func (s *Server) clusterProxyBase(ctx context.Context, clusterID string) string {
@@ -1802,6 +2278,44 @@ func (s *Server) syncAppWithCluster(ctx context.Context, cluster *types.Cluster,
 	return upsertNovaApp(ctx, cli, tenant, project, app)
 }
 
+// applyApp applies the KubeVela Application and then the NovaApp it is rendered
+// from, so that an error means the cluster did not take the change. The
+// Application goes first: if it is rejected, the NovaApp still describes the
+// previous state and the operator keeps the cluster there.
+func (s *Server) applyApp(ctx context.Context, app *types.App, annotations map[string]string) error {
+	tenant, err := s.store.GetTenant(ctx, app.ClusterID, app.TenantID)
+	if err != nil {
+		return err
+	}
+	project, err := s.store.GetProject(ctx, app.ClusterID, app.TenantID, app.ProjectID)
+	if err != nil {
+		return err
+	}
+	cluster, err := s.store.GetCluster(ctx, app.ClusterID)
+	if err != nil {
+		return err
+	}
+	cli, err := s.kubeClientForCluster(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	manifest := vela.NewAppAdapter().ToApplication(app)
+	manifest["namespace"] = appsNamespace(tenant)
+	if len(annotations) > 0 {
+		manifest["annotations"] = annotations
+	}
+	if s.velaFactory == nil {
+		s.velaFactory = defaultVelaBackendFactory
+	}
+	if err := s.velaFactory(cli).ApplyApp(ctx, manifest); err != nil {
+		return fmt.Errorf("apply Application: %w", err)
+	}
+	if err := upsertNovaApp(ctx, cli, tenant, project, app); err != nil {
+		return fmt.Errorf("update NovaApp: %w", err)
+	}
+	return nil
+}
+
 func (s *Server) deleteTenantResource(ctx context.Context, tenant *types.Tenant) error {
 	if tenant == nil {
 		return errors.New("tenant is nil")
@@ -1959,6 +2473,14 @@ func upsertNovaProject(ctx context.Context, cli ctrlclient.Client, tenantName st
 	return cli.Update(ctx, current)
 }
 
+// appsNamespace is the namespace a tenant's apps run in.
+func appsNamespace(tenant *types.Tenant) string {
+	if tenant.AppsNamespace != "" {
+		return tenant.AppsNamespace
+	}
+	return tenant.Name + "-apps"
+}
+
 func upsertNovaApp(ctx context.Context, cli ctrlclient.Client, tenant *types.Tenant, project *types.Project, app *types.App) error {
 	if cli == nil {
 		return errors.New("kube client is nil")
@@ -1972,20 +2494,19 @@ func upsertNovaApp(ctx context.Context, cli ctrlclient.Client, tenant *types.Ten
 	if project == nil {
 		return errors.New("project is nil")
 	}
-	ns := tenant.AppsNamespace
-	if ns == "" {
-		ns = tenant.Name + "-apps"
-	}
+	ns := appsNamespace(tenant)
 	spec := v1alpha1.NovaAppSpec{
-		Tenant:      tenant.Name,
-		Project:     project.Name,
-		Namespace:   ns,
-		Description: app.Description,
-		Component:   app.Component,
-		Image:       app.Image,
-		Template:    app.Spec,
-		Traits:      app.Traits,
-		Policies:    app.Policies,
+		Tenant:         tenant.Name,
+		Project:        project.Name,
+		Namespace:      ns,
+		Description:    app.Description,
+		Component:      app.Component,
+		Image:          app.Image,
+		Template:       app.Spec,
+		Traits:         app.Traits,
+		Policies:       app.Policies,
+		Suspended:      app.Suspended,
+		PublishVersion: app.PublishVersion,
 	}
 	current := &v1alpha1.NovaApp{}
 	key := ctrlclient.ObjectKey{Name: app.Name, Namespace: ns}
@@ -2019,25 +2540,89 @@ func upsertNovaApp(ctx context.Context, cli ctrlclient.Client, tenant *types.Ten
 	return cli.Update(ctx, current)
 }
 
-func (s *Server) installOperator(ctx context.Context, c *types.Cluster) error {
+// installClusterComponent installs one component on the cluster with Helm.
+func installClusterComponent(ctx context.Context, c *types.Cluster, component string) error {
+	cli, scheme, err := clusterClient(c)
+	if err != nil {
+		return err
+	}
+	installer := cluster.NewInstaller(cli, scheme, []byte(c.Kubeconfig), nil, false)
+	installer.ClusterID = c.ID
+	return installer.Bootstrap(ctx, component)
+}
+
+// reinstallClusterComponents reruns the bootstrap job that installs every
+// foundational component.
+func reinstallClusterComponents(ctx context.Context, c *types.Cluster) error {
+	cli, scheme, err := clusterClient(c)
+	if err != nil {
+		return err
+	}
+	return reconcile.BootstrapHelmJob(ctx, cli, cli, scheme)
+}
+
+func clusterClient(c *types.Cluster) (ctrlclient.Client, *runtime.Scheme, error) {
 	if c.Kubeconfig == "" {
-		return errors.New("kubeconfig missing")
+		return nil, nil, errors.New("kubeconfig missing")
 	}
 	cfg, err := clientcmd.RESTConfigFromKubeConfig([]byte(c.Kubeconfig))
 	if err != nil {
-		return fmt.Errorf("parse kubeconfig: %w", err)
+		return nil, nil, fmt.Errorf("parse kubeconfig: %w", err)
 	}
 	scheme := runtime.NewScheme()
-	_ = clientgoscheme.AddToScheme(scheme)
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
 	cli, err := ctrlclient.New(cfg, ctrlclient.Options{Scheme: scheme})
 	if err != nil {
-		return fmt.Errorf("build client: %w", err)
+		return nil, nil, fmt.Errorf("build client: %w", err)
 	}
-	installer := cluster.NewInstaller(cli, scheme, []byte(c.Kubeconfig), nil, false)
-	if err := installer.Bootstrap(ctx, "operator"); err != nil {
-		return err
+	return cli, scheme, nil
+}
+
+// setClusterStatus records a status change on the latest stored copy of the
+// cluster, so long-running bootstrap work does not fail on or overwrite edits
+// made while it ran. c is refreshed in place.
+func (s *Server) setClusterStatus(ctx context.Context, c *types.Cluster, status string) error {
+	var prev string
+	updated, err := s.mutateCluster(ctx, c, func(c *types.Cluster) bool {
+		prev, c.Status = c.Status, status
+		return true
+	})
+	if updated && prev != status {
+		s.publishEvent(ctx, eventClusterStatusChanged, c)
 	}
-	return nil
+	return err
+}
+
+// mutateCluster applies fn to c and stores the result, applying fn again to
+// the latest stored copy when the cluster changed meanwhile. fn returns false
+// to leave the cluster alone. c is refreshed in place; the result reports
+// whether it was stored.
+func (s *Server) mutateCluster(ctx context.Context, c *types.Cluster, fn func(c *types.Cluster) bool) (bool, error) {
+	for attempt := 0; ; attempt++ {
+		if !fn(c) {
+			return false, nil
+		}
+		c.UpdatedAt = time.Now().UTC()
+		err := s.store.UpdateCluster(ctx, c)
+		if err == nil {
+			return true, nil
+		}
+		if !errors.Is(err, store.ErrVersionConflict) || attempt == maxStatusRetries {
+			return false, err
+		}
+		latest, err := s.store.GetCluster(ctx, c.ID)
+		if err != nil {
+			return false, err
+		}
+		*c = *latest
+	}
+}
+
+// failClusterBootstrap marks a cluster whose components could not be
+// installed and reports why.
+func (s *Server) failClusterBootstrap(ctx context.Context, c *types.Cluster, cause error) {
+	_ = s.setClusterStatus(ctx, c, "error")
+	s.publishEventMessage(ctx, eventClusterBootstrapFailed, c, cause.Error())
 }
 
 func (s *Server) requireRole(w http.ResponseWriter, r *http.Request, allowed ...string) bool {
@@ -2045,11 +2630,19 @@ func (s *Server) requireRole(w http.ResponseWriter, r *http.Request, allowed ...
 		return true
 	}
 	auth := s.authContext(r.Context())
-	for _, role := range auth.Roles {
-		for _, allowedRole := range allowed {
-			if role == allowedRole {
-				return true
-			}
+	if auth.globalRole(allowed...) {
+		return true
+	}
+	// The route's scope is only looked up for callers whose bindings could
+	// grant one of the roles.
+	if auth.anyRole(allowed...) {
+		sc, err := s.requestScope(r)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+			return false
+		}
+		if auth.can(sc, allowed...) {
+			return true
 		}
 	}
 	writeError(w, http.StatusForbidden, "KN-403", "forbidden")
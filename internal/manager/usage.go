@@ -0,0 +1,243 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/vaheed/kubenova/internal/logging"
+	"github.com/vaheed/kubenova/internal/store"
+	"github.com/vaheed/kubenova/pkg/types"
+	"go.uber.org/zap"
+)
+
+// ingestUsageReport persists the samples collected by a cluster operator.
+// Only admins and callers holding the operator role bound to the report's
+// cluster may post it. Tenants and projects unknown to the manager are
+// skipped rather than rejected so that one stale namespace does not drop the
+// whole report.
+func (s *Server) ingestUsageReport(w http.ResponseWriter, r *http.Request) {
+	var report types.UsageReport
+	if err := decodeJSON(r, &report); err != nil {
+		writeError(w, http.StatusBadRequest, "KN-400", err.Error())
+		return
+	}
+	if strings.TrimSpace(report.ClusterID) == "" {
+		writeError(w, http.StatusBadRequest, "KN-400", "clusterId is required")
+		return
+	}
+	if !s.requireScope(w, r, resourceScope{clusterID: report.ClusterID}, "admin", "operator") {
+		return
+	}
+	if _, err := s.store.GetCluster(r.Context(), report.ClusterID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "KN-404", "cluster not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return
+	}
+	collectedAt := report.CollectedAt.UTC()
+	if collectedAt.IsZero() {
+		collectedAt = time.Now().UTC()
+	}
+	tenants, _, err := s.store.ListTenants(r.Context(), report.ClusterID, store.ListOptions{})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return
+	}
+	tenantsByName := make(map[string]*types.Tenant, len(tenants))
+	for _, t := range tenants {
+		tenantsByName[t.Name] = t
+	}
+	accepted, skipped := 0, 0
+	for _, tr := range report.Tenants {
+		tenant, ok := tenantsByName[tr.Tenant]
+		if !ok {
+			skipped += 1 + len(tr.Projects)
+			continue
+		}
+		rec := tr.Usage
+		rec.ClusterID = report.ClusterID
+		rec.TenantID = tenant.ID
+		rec.Tenant = tenant.Name
+		rec.Plan = tenant.Plan
+		rec.ProjectID = ""
+		rec.LastReportedAt = collectedAt
+		if err := s.store.RecordUsage(r.Context(), &rec); err != nil {
+			writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+			return
+		}
+		accepted++
+		if len(tr.Projects) == 0 {
+			continue
+		}
+		projects, _, err := s.store.ListProjects(r.Context(), report.ClusterID, tenant.ID, store.ListOptions{})
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+			return
+		}
+		projectsByName := make(map[string]*types.Project, len(projects))
+		for _, p := range projects {
+			projectsByName[p.Name] = p
+		}
+		for _, pr := range tr.Projects {
+			project, ok := projectsByName[pr.Project]
+			if !ok {
+				skipped++
+				continue
+			}
+			rec := pr.Usage
+			rec.ClusterID = report.ClusterID
+			rec.TenantID = tenant.ID
+			rec.Tenant = tenant.Name
+			rec.Plan = tenant.Plan
+			rec.ProjectID = project.ID
+			rec.LastReportedAt = collectedAt
+			if err := s.store.RecordUsage(r.Context(), &rec); err != nil {
+				writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+				return
+			}
+			accepted++
+		}
+	}
+	logging.L.Info("usage_report_received",
+		zap.String("cluster_id", report.ClusterID),
+		zap.Int("accepted", accepted),
+		zap.Int("skipped", skipped),
+	)
+	writeJSON(w, http.StatusAccepted, map[string]int{"accepted": accepted, "skipped": skipped})
+}
+
+// emptyUsage is returned until the operator has reported a first sample.
+func emptyUsage(clusterID, tenantID, projectID string, apps int) *types.UsageRecord {
+	return &types.UsageRecord{
+		ClusterID:      clusterID,
+		TenantID:       tenantID,
+		ProjectID:      projectID,
+		CPURequests:    "0",
+		MemoryRequests: "0",
+		PVCStorage:     "0",
+		Apps:           apps,
+	}
+}
+
+const (
+	defaultUsageRange      = 24 * time.Hour
+	usageRetentionInterval = time.Hour
+	// usageRetentionLease keeps pruning to one manager replica.
+	usageRetentionLease        = "usage-retention"
+	defaultRawRetentionHours   = 7 * 24
+	defaultHourlyRetentionDays = 90
+	defaultDailyRetentionDays  = 730
+)
+
+// writeUsageSeries answers range queries (?from=&to=&step=) on the usage routes.
+// It returns false when none of the range parameters are present so the caller
+// can fall back to the latest sample.
+func (s *Server) writeUsageSeries(w http.ResponseWriter, r *http.Request, tenantID, projectID string) bool {
+	q := r.URL.Query()
+	if q.Get("from") == "" && q.Get("to") == "" && q.Get("step") == "" {
+		return false
+	}
+	query, err := parseUsageQuery(q.Get("from"), q.Get("to"), q.Get("step"), time.Now().UTC())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "KN-400", err.Error())
+		return true
+	}
+	query.TenantID = tenantID
+	query.ProjectID = projectID
+	points, err := s.store.ListUsage(r.Context(), query)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return true
+	}
+	writeJSON(w, http.StatusOK, &types.UsageSeries{
+		TenantID:  tenantID,
+		ProjectID: projectID,
+		From:      query.From,
+		To:        query.To,
+		Step:      query.Step,
+		Points:    points,
+	})
+	return true
+}
+
+func parseUsageQuery(from, to, step string, now time.Time) (store.UsageQuery, error) {
+	q := store.UsageQuery{To: now, Step: store.UsageStepHour}
+	switch strings.TrimSpace(step) {
+	case "":
+	case store.UsageStepRaw:
+		q.Step = store.UsageStepRaw
+	case store.UsageStepHour, "hour", "hourly":
+		q.Step = store.UsageStepHour
+	case store.UsageStepDay, "1d", "day", "daily":
+		q.Step = store.UsageStepDay
+	default:
+		return q, fmt.Errorf("step must be one of raw, 1h, 1d")
+	}
+	if to != "" {
+		t, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			return q, fmt.Errorf("to must be an RFC3339 timestamp")
+		}
+		q.To = t.UTC()
+	}
+	q.From = q.To.Add(-defaultUsageRange)
+	if from != "" {
+		t, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			return q, fmt.Errorf("from must be an RFC3339 timestamp")
+		}
+		q.From = t.UTC()
+	}
+	if !q.From.Before(q.To) {
+		return q, fmt.Errorf("from must be before to")
+	}
+	return q, nil
+}
+
+// RunUsageRetention prunes raw samples and rollups past their retention until
+// the context is canceled. A retention of zero keeps that tier forever. Only
+// the replica holding the retention lease prunes.
+func (s *Server) RunUsageRetention(ctx context.Context) {
+	ticker := time.NewTicker(usageRetentionInterval)
+	defer ticker.Stop()
+	for {
+		if s.holdLease(ctx, usageRetentionLease, 2*usageRetentionInterval) {
+			s.pruneUsage(ctx, time.Now().UTC())
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) pruneUsage(ctx context.Context, now time.Time) {
+	tiers := []struct {
+		step      string
+		retention time.Duration
+	}{
+		{store.UsageStepRaw, time.Duration(envInt("USAGE_RAW_RETENTION_HOURS", defaultRawRetentionHours)) * time.Hour},
+		{store.UsageStepHour, time.Duration(envInt("USAGE_HOURLY_RETENTION_DAYS", defaultHourlyRetentionDays)) * 24 * time.Hour},
+		{store.UsageStepDay, time.Duration(envInt("USAGE_DAILY_RETENTION_DAYS", defaultDailyRetentionDays)) * 24 * time.Hour},
+	}
+	for _, tier := range tiers {
+		if tier.retention <= 0 {
+			continue
+		}
+		removed, err := s.store.PruneUsage(ctx, tier.step, now.Add(-tier.retention))
+		if err != nil {
+			logging.L.Warn("usage_prune_failed", zap.String("step", tier.step), zap.Error(err))
+			continue
+		}
+		if removed > 0 {
+			logging.L.Info("usage_pruned", zap.String("step", tier.step), zap.Int64("removed", removed))
+		}
+	}
+}
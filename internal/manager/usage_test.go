@@ -0,0 +1,196 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/vaheed/kubenova/pkg/types"
+)
+
+func TestUsageReportsFeedUsageEndpoints(t *testing.T) {
+	t.Setenv("KUBENOVA_REQUIRE_AUTH", "false")
+	t.Setenv("CLUSTER_PREFLIGHT", "false")
+
+	srv := newTestServer(t)
+	client, baseURL := srv.client, srv.baseURL
+
+	cluster := doJSON[*types.Cluster](t, client, http.MethodPost, baseURL+"/clusters", map[string]any{
+		"name":       "usage",
+		"kubeconfig": fakeKubeconfigB64,
+	}, http.StatusCreated)
+	tenantsURL := fmt.Sprintf("%s/clusters/%s/tenants", baseURL, cluster.ID)
+	tenant := doJSON[*types.Tenant](t, client, http.MethodPost, tenantsURL, map[string]any{"name": "acme"}, http.StatusCreated)
+	project := doJSON[*types.Project](t, client, http.MethodPost,
+		fmt.Sprintf("%s/%s/projects", tenantsURL, tenant.ID), map[string]any{"name": "web"}, http.StatusCreated)
+
+	tenantUsageURL := fmt.Sprintf("%s/tenants/%s/usage", baseURL, tenant.ID)
+	projectUsageURL := fmt.Sprintf("%s/projects/%s/usage", baseURL, project.ID)
+	empty := doJSON[*types.UsageRecord](t, client, http.MethodGet, tenantUsageURL, nil, http.StatusOK)
+	if !empty.LastReportedAt.IsZero() || empty.Pods != 0 {
+		t.Fatalf("expected empty usage before first report, got %+v", empty)
+	}
+
+	doNoBody(t, client, http.MethodPost, baseURL+"/usage/reports", map[string]any{
+		"clusterId": "00000000-0000-0000-0000-000000000000",
+	}, http.StatusNotFound)
+
+	older := time.Date(2026, 9, 1, 10, 0, 0, 0, time.UTC)
+	collected := older.Add(5 * time.Minute)
+	for _, at := range []time.Time{older, collected} {
+		pods := 3
+		if at.Equal(older) {
+			pods = 1
+		}
+		res := doJSON[map[string]int](t, client, http.MethodPost, baseURL+"/usage/reports", types.UsageReport{
+			ClusterID:   cluster.ID,
+			CollectedAt: at,
+			Tenants: []types.TenantUsageReport{
+				{
+					Tenant: "acme",
+					Usage:  types.UsageRecord{CPURequests: "1500m", MemoryRequests: "3Gi", PVCStorage: "10Gi", Pods: pods, Namespaces: 2, LoadBalancers: 1},
+					Projects: []types.ProjectUsageReport{
+						{Project: "web", Usage: types.UsageRecord{CPURequests: "500m", MemoryRequests: "1Gi", Pods: 1}},
+						{Project: "ghost", Usage: types.UsageRecord{Pods: 1}},
+					},
+				},
+				{Tenant: "unknown"},
+			},
+		}, http.StatusAccepted)
+		if res["accepted"] != 2 || res["skipped"] != 2 {
+			t.Fatalf("unexpected ingestion result: %+v", res)
+		}
+	}
+
+	usage := doJSON[*types.UsageRecord](t, client, http.MethodGet, tenantUsageURL, nil, http.StatusOK)
+	if usage.Pods != 3 || usage.CPURequests != "1500m" || usage.LoadBalancers != 1 {
+		t.Fatalf("expected latest tenant sample, got %+v", usage)
+	}
+	if !usage.LastReportedAt.Equal(collected) {
+		t.Fatalf("expected lastReportedAt %s, got %s", collected, usage.LastReportedAt)
+	}
+	projectUsage := doJSON[*types.UsageRecord](t, client, http.MethodGet, projectUsageURL, nil, http.StatusOK)
+	if projectUsage.ProjectID != project.ID || projectUsage.MemoryRequests != "1Gi" || projectUsage.Pods != 1 {
+		t.Fatalf("expected project sample, got %+v", projectUsage)
+	}
+}
+
+func TestUsageHistoryRollupsAndRetention(t *testing.T) {
+	t.Setenv("KUBENOVA_REQUIRE_AUTH", "false")
+	t.Setenv("USAGE_RAW_RETENTION_HOURS", "24")
+
+	srv := newTestServer(t)
+	st, client := srv.store, srv.client
+	ctx := context.Background()
+	cluster := &types.Cluster{Name: "history"}
+	if err := st.CreateCluster(ctx, cluster); err != nil {
+		t.Fatalf("create cluster: %v", err)
+	}
+	tenant := &types.Tenant{ClusterID: cluster.ID, Name: "acme"}
+	if err := st.CreateTenant(ctx, tenant); err != nil {
+		t.Fatalf("create tenant: %v", err)
+	}
+	usageURL := fmt.Sprintf("%s/api/v1/tenants/%s/usage", srv.url, tenant.ID)
+
+	// Two samples per hour for three hours on 2026-09-01, plus one the next day.
+	day := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	samples := []struct {
+		at   time.Duration
+		cpu  string
+		pods int
+	}{
+		{10 * time.Minute, "1", 2}, {40 * time.Minute, "3", 4},
+		{70 * time.Minute, "2", 2}, {100 * time.Minute, "2", 2},
+		{130 * time.Minute, "500m", 1}, {160 * time.Minute, "1500m", 3},
+		{25 * time.Hour, "4", 8},
+	}
+	for _, sample := range samples {
+		if err := st.RecordUsage(ctx, &types.UsageRecord{
+			ClusterID:      cluster.ID,
+			TenantID:       tenant.ID,
+			CPURequests:    sample.cpu,
+			MemoryRequests: "1Gi",
+			Pods:           sample.pods,
+			LastReportedAt: day.Add(sample.at),
+		}); err != nil {
+			t.Fatalf("record usage: %v", err)
+		}
+	}
+
+	hourly := doJSON[*types.UsageSeries](t, client, http.MethodGet,
+		usageURL+"?from=2026-09-01T00:00:00Z&to=2026-09-01T03:00:00Z&step=1h", nil, http.StatusOK)
+	if hourly.Step != "1h" || len(hourly.Points) != 3 {
+		t.Fatalf("expected three hourly buckets, got %+v", hourly)
+	}
+	first := hourly.Points[0]
+	if first.CPURequests != "2" || first.Pods != 3 || first.Samples != 2 || !first.BucketStart.Equal(day) {
+		t.Fatalf("unexpected first bucket: %+v", first)
+	}
+	if hourly.Points[2].CPURequests != "1" || hourly.Points[2].MemoryRequests != "1Gi" {
+		t.Fatalf("unexpected third bucket: %+v", hourly.Points[2])
+	}
+
+	daily := doJSON[*types.UsageSeries](t, client, http.MethodGet,
+		usageURL+"?from=2026-09-01T00:00:00Z&to=2026-09-03T00:00:00Z&step=1d", nil, http.StatusOK)
+	if len(daily.Points) != 2 || daily.Points[0].Samples != 6 || daily.Points[1].Pods != 8 {
+		t.Fatalf("unexpected daily buckets: %+v", daily.Points)
+	}
+
+	raw := doJSON[*types.UsageSeries](t, client, http.MethodGet,
+		usageURL+"?from=2026-09-01T00:30:00Z&to=2026-09-01T01:30:00Z&step=raw", nil, http.StatusOK)
+	if len(raw.Points) != 2 || raw.Points[0].CPURequests != "3" {
+		t.Fatalf("unexpected raw samples: %+v", raw.Points)
+	}
+
+	doNoBody(t, client, http.MethodGet, usageURL+"?step=5m", nil, http.StatusBadRequest)
+	doNoBody(t, client, http.MethodGet, usageURL+"?from=2026-09-02T00:00:00Z&to=2026-09-01T00:00:00Z", nil, http.StatusBadRequest)
+
+	srv.pruneUsage(ctx, day.Add(27*time.Hour))
+	raw = doJSON[*types.UsageSeries](t, client, http.MethodGet,
+		usageURL+"?from=2026-09-01T00:00:00Z&to=2026-09-03T00:00:00Z&step=raw", nil, http.StatusOK)
+	if len(raw.Points) != 1 {
+		t.Fatalf("expected raw samples past retention to be pruned, got %+v", raw.Points)
+	}
+	hourly = doJSON[*types.UsageSeries](t, client, http.MethodGet,
+		usageURL+"?from=2026-09-01T00:00:00Z&to=2026-09-01T03:00:00Z&step=1h", nil, http.StatusOK)
+	if len(hourly.Points) != 3 {
+		t.Fatalf("expected hourly rollups to survive raw retention, got %+v", hourly.Points)
+	}
+}
+
+func TestUsageReportsRequireClusterOperator(t *testing.T) {
+	t.Setenv("KUBENOVA_REQUIRE_AUTH", "true")
+	t.Setenv("JWT_SIGNING_KEY", "usage-secret")
+
+	srv := newTestServer(t)
+	ctx := context.Background()
+	east := &types.Cluster{Name: "east", Kubeconfig: "fake"}
+	west := &types.Cluster{Name: "west", Kubeconfig: "fake"}
+	for _, c := range []*types.Cluster{east, west} {
+		if err := srv.store.CreateCluster(ctx, c); err != nil {
+			t.Fatalf("create cluster: %v", err)
+		}
+	}
+	as := func(roles []string, bindings ...types.RoleBinding) *http.Client {
+		tok := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"sub": "operator", "roles": roles, "bindings": bindings, "exp": time.Now().Add(time.Hour).Unix(),
+		})
+		signed, err := tok.SignedString([]byte("usage-secret"))
+		if err != nil {
+			t.Fatalf("sign token: %v", err)
+		}
+		return &http.Client{Transport: bearerTransport{token: signed, next: srv.client.Transport}}
+	}
+	reportsURL := srv.baseURL + "/usage/reports"
+	report := types.UsageReport{ClusterID: east.ID}
+
+	doNoBody(t, srv.client, http.MethodPost, reportsURL, report, http.StatusUnauthorized)
+	doNoBody(t, as([]string{"operator"}), http.MethodPost, reportsURL, report, http.StatusForbidden)
+	doNoBody(t, as([]string{"ops"}), http.MethodPost, reportsURL, report, http.StatusForbidden)
+	doNoBody(t, as(nil, types.RoleBinding{Role: "operator", ClusterID: west.ID}), http.MethodPost, reportsURL, report, http.StatusForbidden)
+	doNoBody(t, as(nil, types.RoleBinding{Role: "operator", ClusterID: east.ID}), http.MethodPost, reportsURL, report, http.StatusAccepted)
+	doNoBody(t, as([]string{"admin"}), http.MethodPost, reportsURL, report, http.StatusAccepted)
+}
@@ -0,0 +1,579 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/vaheed/kubenova/internal/logging"
+	"github.com/vaheed/kubenova/internal/store"
+	"github.com/vaheed/kubenova/pkg/types"
+	"go.uber.org/zap"
+)
+
+const (
+	webhookEventHeader     = "X-KubeNova-Event"
+	webhookDeliveryHeader  = "X-KubeNova-Delivery"
+	webhookSignatureHeader = "X-KubeNova-Signature"
+
+	webhookTimeout       = 10 * time.Second
+	webhookPollInterval  = 5 * time.Second
+	webhookPruneInterval = time.Hour
+	webhookBatchSize     = 20
+	// webhookClaimLease keeps a claimed batch away from other workers while it
+	// is sent. A batch is sent one delivery at a time, so the lease covers
+	// every delivery in it timing out, plus a margin for the store.
+	webhookClaimLease = webhookBatchSize*webhookTimeout + time.Minute
+	// webhookPruneLease keeps pruning to one manager replica.
+	webhookPruneLease = "webhook-delivery-retention"
+	// Retries wait webhookRetryBase, doubling after every failed attempt up
+	// to webhookRetryMax.
+	webhookRetryBase = 30 * time.Second
+	webhookRetryMax  = time.Hour
+
+	defaultWebhookMaxAttempts           = 8
+	defaultWebhookDeliveryRetentionDays = 7
+)
+
+// Roles that may read and manage subscriptions; tenantOwner only through a
+// binding to the subscription's tenant.
+var (
+	webhookReaders = []string{"admin", "ops", "tenantOwner", "readOnly"}
+	webhookWriters = []string{"admin", "ops", "tenantOwner"}
+)
+
+// newWebhookClient returns the client deliveries are sent with. The target is
+// checked again on every connection, after DNS resolution, so a name that
+// passed validation cannot later point the manager at an internal address.
+func newWebhookClient(targets *webhookGuard) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: webhookTimeout,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			ap, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			return targets.check(ap.Addr())
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would make the dialer check the proxy rather than the target.
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{
+		Timeout:   webhookTimeout,
+		Transport: transport,
+		// A redirect is reported as a failed attempt rather than followed.
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+}
+
+var errWebhookTarget = errors.New("webhook url must not resolve to a private, loopback or link-local address")
+
+// webhookGuard keeps webhooks away from the manager's own network: private,
+// loopback and link-local addresses are refused unless an admin allowed them
+// with WEBHOOK_ALLOWED_CIDRS.
+type webhookGuard struct {
+	allowed []netip.Prefix
+}
+
+// parseWebhookAllowedCIDRs parses a comma-separated list of CIDRs. Invalid
+// entries are reported and skipped.
+func parseWebhookAllowedCIDRs(raw string) ([]netip.Prefix, error) {
+	var (
+		out  []netip.Prefix
+		errs []error
+	)
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		p, err := netip.ParsePrefix(part)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("WEBHOOK_ALLOWED_CIDRS: %w", err))
+			continue
+		}
+		out = append(out, p.Masked())
+	}
+	return out, errors.Join(errs...)
+}
+
+func (g *webhookGuard) check(addr netip.Addr) error {
+	addr = addr.Unmap()
+	if !addr.IsPrivate() && !addr.IsLoopback() && !addr.IsLinkLocalUnicast() &&
+		!addr.IsLinkLocalMulticast() && !addr.IsInterfaceLocalMulticast() && !addr.IsUnspecified() {
+		return nil
+	}
+	for _, p := range g.allowed {
+		if p.Contains(addr) {
+			return nil
+		}
+	}
+	return errWebhookTarget
+}
+
+// checkHost rejects a host that is, or currently resolves to, a blocked
+// address. Names that do not resolve yet are left to the check at dial time.
+func (g *webhookGuard) checkHost(ctx context.Context, host string) error {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return g.check(addr)
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return nil
+	}
+	for _, addr := range addrs {
+		if err := g.check(addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Server) createWebhook(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAnyRole(w, r, webhookWriters...) {
+		return
+	}
+	var req WebhookRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "KN-400", err.Error())
+		return
+	}
+	sub := &types.WebhookSubscription{
+		URL:         strings.TrimSpace(req.URL),
+		Description: req.Description,
+		EventTypes:  req.EventTypes,
+		TenantID:    strings.TrimSpace(req.TenantID),
+		Active:      req.Active == nil || *req.Active,
+		Secret:      req.Secret,
+	}
+	if !s.validWebhook(w, r, sub) {
+		return
+	}
+	if sub.Secret == "" {
+		sub.Secret = newWebhookSecret()
+	}
+	if err := s.store.CreateWebhook(r.Context(), sub); err != nil {
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return
+	}
+	// The generated secret is only ever returned here.
+	writeJSON(w, http.StatusCreated, sub)
+}
+
+func (s *Server) listWebhooks(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAnyRole(w, r, webhookReaders...) {
+		return
+	}
+	subs, err := s.store.ListWebhooks(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return
+	}
+	tenantID := r.URL.Query().Get("tenantId")
+	out := make([]*types.WebhookSubscription, 0, len(subs))
+	for _, sub := range subs {
+		if tenantID != "" && sub.TenantID != tenantID {
+			continue
+		}
+		sc, err := s.webhookScope(r.Context(), sub)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+			return
+		}
+		if s.canAccess(r, sc, webhookReaders...) {
+			out = append(out, redactWebhook(sub))
+		}
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (s *Server) getWebhook(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAnyRole(w, r, webhookReaders...) {
+		return
+	}
+	sub, ok := s.lookupWebhook(w, r, webhookReaders...)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, redactWebhook(sub))
+}
+
+func (s *Server) updateWebhook(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAnyRole(w, r, webhookWriters...) {
+		return
+	}
+	sub, ok := s.lookupWebhook(w, r, webhookWriters...)
+	if !ok {
+		return
+	}
+	var req WebhookRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "KN-400", err.Error())
+		return
+	}
+	if req.URL != "" {
+		sub.URL = strings.TrimSpace(req.URL)
+	}
+	if req.Description != "" {
+		sub.Description = req.Description
+	}
+	if req.EventTypes != nil {
+		sub.EventTypes = req.EventTypes
+	}
+	if req.TenantID != "" {
+		sub.TenantID = strings.TrimSpace(req.TenantID)
+	}
+	if req.Active != nil {
+		sub.Active = *req.Active
+	}
+	if req.Secret != "" {
+		sub.Secret = req.Secret
+	}
+	if !s.validWebhook(w, r, sub) {
+		return
+	}
+	if err := s.store.UpdateWebhook(r.Context(), sub); err != nil {
+		writeUpdateError(w, r, err)
+		return
+	}
+	if req.Secret != "" {
+		writeJSON(w, http.StatusOK, sub)
+		return
+	}
+	writeJSON(w, http.StatusOK, redactWebhook(sub))
+}
+
+func (s *Server) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAnyRole(w, r, webhookWriters...) {
+		return
+	}
+	sub, ok := s.lookupWebhook(w, r, webhookWriters...)
+	if !ok {
+		return
+	}
+	if err := s.store.DeleteWebhook(r.Context(), sub.ID); err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "KN-404", "webhook not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAnyRole(w, r, webhookReaders...) {
+		return
+	}
+	sub, ok := s.lookupWebhook(w, r, webhookReaders...)
+	if !ok {
+		return
+	}
+	values := r.URL.Query()
+	q := store.WebhookDeliveryQuery{SubscriptionID: sub.ID, Status: values.Get("status")}
+	switch q.Status {
+	case "", types.WebhookDeliveryPending, types.WebhookDeliverySucceeded, types.WebhookDeliveryFailed:
+	default:
+		writeError(w, http.StatusBadRequest, "KN-400", "status must be pending, succeeded or failed")
+		return
+	}
+	if raw := values.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 1 || limit > store.MaxWebhookDeliveryLimit {
+			writeError(w, http.StatusBadRequest, "KN-400", "limit must be between 1 and 1000")
+			return
+		}
+		q.Limit = limit
+	}
+	deliveries, err := s.store.ListWebhookDeliveries(r.Context(), q)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, deliveries)
+}
+
+// lookupWebhook loads the subscription named by the route. Subscriptions the
+// caller holds none of roles on are reported as not found.
+func (s *Server) lookupWebhook(w http.ResponseWriter, r *http.Request, roles ...string) (*types.WebhookSubscription, bool) {
+	sub, err := s.store.GetWebhook(r.Context(), chi.URLParam(r, "webhookID"))
+	if err == nil {
+		var sc resourceScope
+		if sc, err = s.webhookScope(r.Context(), sub); err == nil && !s.canAccess(r, sc, roles...) {
+			err = store.ErrNotFound
+		}
+	}
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "KN-404", "webhook not found")
+			return nil, false
+		}
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return nil, false
+	}
+	return sub, true
+}
+
+// webhookScope is the tenant a subscription is limited to; subscriptions to
+// every tenant are only visible to callers with a global role.
+func (s *Server) webhookScope(ctx context.Context, sub *types.WebhookSubscription) (resourceScope, error) {
+	if sub.TenantID == "" {
+		return resourceScope{}, nil
+	}
+	return s.tenantScope(ctx, sub.TenantID)
+}
+
+// validWebhook checks a subscription before it is stored. Callers without
+// admin or ops may only subscribe to the events of a tenant they own.
+func (s *Server) validWebhook(w http.ResponseWriter, r *http.Request, sub *types.WebhookSubscription) bool {
+	u, err := url.Parse(sub.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		writeError(w, http.StatusBadRequest, "KN-400", "url must be an absolute http or https URL")
+		return false
+	}
+	if err := s.webhookTargets.checkHost(r.Context(), u.Hostname()); err != nil {
+		writeError(w, http.StatusUnprocessableEntity, "KN-422", err.Error())
+		return false
+	}
+	for _, p := range sub.EventTypes {
+		if !validEventPattern(p) {
+			writeError(w, http.StatusBadRequest, "KN-400", fmt.Sprintf("unknown event type %q", p))
+			return false
+		}
+	}
+	if sub.TenantID == "" {
+		if s.requireAuth && !s.authContext(r.Context()).globalRole("admin", "ops") {
+			writeError(w, http.StatusForbidden, "KN-403", "tenantId is required")
+			return false
+		}
+		return true
+	}
+	sc, err := s.tenantScope(r.Context(), sub.TenantID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return false
+	}
+	if !s.canAccess(r, sc, webhookWriters...) {
+		writeError(w, http.StatusForbidden, "KN-403", "forbidden")
+		return false
+	}
+	if sc.clusterID == "" {
+		writeError(w, http.StatusUnprocessableEntity, "KN-422", fmt.Sprintf("tenant %q not found", sub.TenantID))
+		return false
+	}
+	return true
+}
+
+func redactWebhook(sub *types.WebhookSubscription) *types.WebhookSubscription {
+	out := *sub
+	out.Secret = ""
+	return &out
+}
+
+func newWebhookSecret() string {
+	buf := make([]byte, 32)
+	_, _ = rand.Read(buf)
+	return "whsec_" + hex.EncodeToString(buf)
+}
+
+// signWebhook returns the signature header value for a delivery body sent at
+// the given time: the HMAC-SHA256 of "<unix time>.<body>" keyed with the
+// subscription secret.
+func signWebhook(secret string, at time.Time, body []byte) string {
+	ts := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// enqueueWebhooks queues e for every active subscription it matches.
+func (s *Server) enqueueWebhooks(ctx context.Context, e *types.Event) {
+	subs, err := s.store.ListWebhooks(ctx)
+	if err != nil {
+		logging.L.Warn("webhook_list_failed", zap.Error(err))
+		return
+	}
+	var payload []byte
+	for _, sub := range subs {
+		if !sub.Active || (sub.TenantID != "" && sub.TenantID != e.TenantID) || !eventTypeMatches(sub.EventTypes, e.Type) {
+			continue
+		}
+		if payload == nil {
+			if payload, err = json.Marshal(e); err != nil {
+				logging.L.Warn("webhook_encode_failed", zap.Int64("event", e.ID), zap.Error(err))
+				return
+			}
+		}
+		next := e.Time
+		d := &types.WebhookDelivery{
+			SubscriptionID: sub.ID,
+			EventID:        e.ID,
+			EventType:      e.Type,
+			Status:         types.WebhookDeliveryPending,
+			Payload:        payload,
+			NextAttemptAt:  &next,
+		}
+		if err := s.store.CreateWebhookDelivery(ctx, d); err != nil {
+			logging.L.Warn("webhook_enqueue_failed", zap.String("webhook", sub.ID), zap.Int64("event", e.ID), zap.Error(err))
+		}
+	}
+}
+
+// RunWebhookDelivery sends queued webhook deliveries and prunes old ones until
+// the context is canceled. Only the replica holding the retention lease
+// prunes.
+func (s *Server) RunWebhookDelivery(ctx context.Context) {
+	poll := time.NewTicker(webhookPollInterval)
+	defer poll.Stop()
+	prune := time.NewTicker(webhookPruneInterval)
+	defer prune.Stop()
+	if s.holdLease(ctx, webhookPruneLease, 2*webhookPruneInterval) {
+		s.pruneWebhookDeliveries(ctx, time.Now().UTC())
+	}
+	for {
+		// New events wake the worker so first attempts go out right away.
+		wake := s.events.wait()
+		s.deliverWebhooks(ctx, time.Now().UTC())
+		select {
+		case <-ctx.Done():
+			return
+		case <-wake:
+		case <-poll.C:
+		case <-prune.C:
+			if s.holdLease(ctx, webhookPruneLease, 2*webhookPruneInterval) {
+				s.pruneWebhookDeliveries(ctx, time.Now().UTC())
+			}
+		}
+	}
+}
+
+// deliverWebhooks attempts every delivery that is due at now. Each attempt is
+// timed from when it starts, so the retries of the last deliveries in a slow
+// batch are not scheduled from a stale time.
+func (s *Server) deliverWebhooks(ctx context.Context, now time.Time) {
+	start := time.Now()
+	for {
+		batch, err := s.store.ClaimWebhookDeliveries(ctx, now, webhookClaimLease, webhookBatchSize)
+		if err != nil {
+			logging.L.Warn("webhook_claim_failed", zap.Error(err))
+			return
+		}
+		for _, d := range batch {
+			s.attemptWebhookDelivery(ctx, d, now.Add(time.Since(start)))
+		}
+		if len(batch) < webhookBatchSize {
+			return
+		}
+	}
+}
+
+func (s *Server) attemptWebhookDelivery(ctx context.Context, d *types.WebhookDelivery, now time.Time) {
+	sub, err := s.store.GetWebhook(ctx, d.SubscriptionID)
+	if errors.Is(err, store.ErrNotFound) {
+		return
+	}
+	if err != nil {
+		logging.L.Warn("webhook_lookup_failed", zap.String("delivery", d.ID), zap.Error(err))
+		return
+	}
+	attempt := types.WebhookAttempt{At: now}
+	if !sub.Active {
+		attempt.Error = "subscription is inactive"
+		d.Attempts = append(d.Attempts, attempt)
+		d.Status, d.NextAttemptAt = types.WebhookDeliveryFailed, nil
+		s.saveWebhookDelivery(ctx, d)
+		return
+	}
+	start := time.Now()
+	attempt.StatusCode, err = s.postWebhook(ctx, sub, d)
+	attempt.DurationMS = time.Since(start).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+	d.Attempts = append(d.Attempts, attempt)
+	switch {
+	case err == nil:
+		d.Status, d.NextAttemptAt, d.DeliveredAt = types.WebhookDeliverySucceeded, nil, &now
+	case len(d.Attempts) >= envInt("WEBHOOK_MAX_ATTEMPTS", defaultWebhookMaxAttempts):
+		d.Status, d.NextAttemptAt = types.WebhookDeliveryFailed, nil
+		logging.L.Warn("webhook_delivery_failed", zap.String("webhook", sub.ID), zap.String("delivery", d.ID), zap.Error(err))
+	default:
+		next := now.Add(webhookBackoff(len(d.Attempts)))
+		d.NextAttemptAt = &next
+	}
+	s.saveWebhookDelivery(ctx, d)
+}
+
+// postWebhook sends one delivery and returns the response status. Anything
+// but a 2xx response is an error.
+func (s *Server) postWebhook(ctx context.Context, sub *types.WebhookSubscription, d *types.WebhookDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "KubeNova-Webhooks/"+version)
+	req.Header.Set(webhookEventHeader, d.EventType)
+	req.Header.Set(webhookDeliveryHeader, d.ID)
+	req.Header.Set(webhookSignatureHeader, signWebhook(sub.Secret, time.Now(), d.Payload))
+	resp, err := s.webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+func (s *Server) saveWebhookDelivery(ctx context.Context, d *types.WebhookDelivery) {
+	if err := s.store.UpdateWebhookDelivery(ctx, d); err != nil && !errors.Is(err, store.ErrNotFound) {
+		logging.L.Warn("webhook_delivery_update_failed", zap.String("delivery", d.ID), zap.Error(err))
+	}
+}
+
+// webhookBackoff returns how long to wait after the given number of failed
+// attempts.
+func webhookBackoff(attempts int) time.Duration {
+	wait := webhookRetryBase
+	for i := 1; i < attempts && wait < webhookRetryMax; i++ {
+		wait *= 2
+	}
+	return min(wait, webhookRetryMax)
+}
+
+func (s *Server) pruneWebhookDeliveries(ctx context.Context, now time.Time) {
+	days := envInt("WEBHOOK_DELIVERY_RETENTION_DAYS", defaultWebhookDeliveryRetentionDays)
+	if days <= 0 {
+		return
+	}
+	removed, err := s.store.PruneWebhookDeliveries(ctx, now.Add(-time.Duration(days)*24*time.Hour))
+	if err != nil {
+		logging.L.Warn("webhook_delivery_prune_failed", zap.Error(err))
+	} else if removed > 0 {
+		logging.L.Info("webhook_deliveries_pruned", zap.Int64("removed", removed))
+	}
+}
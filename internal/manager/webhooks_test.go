@@ -0,0 +1,235 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/vaheed/kubenova/internal/store"
+	"github.com/vaheed/kubenova/pkg/types"
+)
+
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+func TestWebhookDeliveriesAreSignedAndRetried(t *testing.T) {
+	t.Setenv("KUBENOVA_REQUIRE_AUTH", "false")
+	t.Setenv("WEBHOOK_ALLOWED_CIDRS", "127.0.0.0/8, ::1/128")
+
+	srv := newTestServer(t)
+	st, client, baseURL := srv.store, srv.client, srv.baseURL
+	ctx := context.Background()
+
+	// The receiver fails the first delivery and accepts the retry.
+	var (
+		mu       sync.Mutex
+		received []receivedWebhook
+	)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, receivedWebhook{header: r.Header.Clone(), body: body})
+		if len(received) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer receiver.Close()
+
+	cluster := &types.Cluster{Name: "webhooks", Kubeconfig: "fake"}
+	if err := st.CreateCluster(ctx, cluster); err != nil {
+		t.Fatalf("create cluster: %v", err)
+	}
+	tenant := doJSON[*types.Tenant](t, client, http.MethodPost,
+		fmt.Sprintf("%s/clusters/%s/tenants", baseURL, cluster.ID), map[string]any{"name": "acme"}, http.StatusCreated)
+	other := doJSON[*types.Tenant](t, client, http.MethodPost,
+		fmt.Sprintf("%s/clusters/%s/tenants", baseURL, cluster.ID), map[string]any{"name": "globex"}, http.StatusCreated)
+	project := doJSON[*types.Project](t, client, http.MethodPost,
+		fmt.Sprintf("%s/clusters/%s/tenants/%s/projects", baseURL, cluster.ID, tenant.ID),
+		map[string]any{"name": "web"}, http.StatusCreated)
+
+	sub := doJSON[*types.WebhookSubscription](t, client, http.MethodPost, baseURL+"/webhooks", map[string]any{
+		"url": receiver.URL, "eventTypes": []string{"app.deployed"}, "tenantId": tenant.ID,
+	}, http.StatusCreated)
+	if !sub.Active || !strings.HasPrefix(sub.Secret, "whsec_") {
+		t.Fatalf("expected an active subscription with a generated secret, got %+v", sub)
+	}
+	if got := doJSON[*types.WebhookSubscription](t, client, http.MethodGet, baseURL+"/webhooks/"+sub.ID, nil, http.StatusOK); got.Secret != "" {
+		t.Fatalf("expected the secret to be redacted, got %q", got.Secret)
+	}
+	elsewhere := doJSON[*types.WebhookSubscription](t, client, http.MethodPost, baseURL+"/webhooks", map[string]any{
+		"url": receiver.URL, "tenantId": other.ID,
+	}, http.StatusCreated)
+	doNoBody(t, client, http.MethodPost, baseURL+"/webhooks", map[string]any{"url": "ftp://example.com"}, http.StatusBadRequest)
+	doNoBody(t, client, http.MethodPost, baseURL+"/webhooks",
+		map[string]any{"url": receiver.URL, "eventTypes": []string{"app.exploded"}}, http.StatusBadRequest)
+	doNoBody(t, client, http.MethodPost, baseURL+"/webhooks",
+		map[string]any{"url": receiver.URL, "tenantId": "missing"}, http.StatusUnprocessableEntity)
+
+	appsURL := fmt.Sprintf("%s/clusters/%s/tenants/%s/projects/%s/apps", baseURL, cluster.ID, tenant.ID, project.ID)
+	app := doJSON[*types.App](t, client, http.MethodPost, appsURL,
+		map[string]any{"name": "api", "spec": map[string]any{"type": "webservice"}}, http.StatusCreated)
+	doJSON[map[string]any](t, client, http.MethodPost, appsURL+"/"+app.ID+":deploy", nil, http.StatusAccepted)
+
+	deliveriesURL := baseURL + "/webhooks/" + sub.ID + "/deliveries"
+	now := time.Now().UTC().Add(time.Second)
+	srv.deliverWebhooks(ctx, now)
+	deliveries := doJSON[[]*types.WebhookDelivery](t, client, http.MethodGet, deliveriesURL, nil, http.StatusOK)
+	if len(deliveries) != 1 {
+		t.Fatalf("expected one delivery for the deploy, got %d", len(deliveries))
+	}
+	d := deliveries[0]
+	if d.EventType != eventAppDeployed || d.Status != types.WebhookDeliveryPending || len(d.Attempts) != 1 ||
+		d.Attempts[0].StatusCode != http.StatusInternalServerError || d.NextAttemptAt == nil ||
+		d.NextAttemptAt.Before(now.Add(webhookRetryBase)) || d.NextAttemptAt.After(now.Add(webhookRetryBase+time.Second)) {
+		t.Fatalf("expected a failed first attempt retried after %s, got %+v", webhookRetryBase, d)
+	}
+
+	srv.deliverWebhooks(ctx, now.Add(10*time.Second))
+	mu.Lock()
+	if len(received) != 1 {
+		t.Fatalf("expected no retry before the backoff elapsed, got %d requests", len(received))
+	}
+	mu.Unlock()
+
+	srv.deliverWebhooks(ctx, now.Add(webhookRetryBase+time.Second))
+	d = doJSON[[]*types.WebhookDelivery](t, client, http.MethodGet, deliveriesURL+"?status=succeeded", nil, http.StatusOK)[0]
+	if len(d.Attempts) != 2 || d.DeliveredAt == nil || d.NextAttemptAt != nil {
+		t.Fatalf("expected the retry to succeed, got %+v", d)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 2 {
+		t.Fatalf("expected two requests, got %d", len(received))
+	}
+	last := received[1]
+	if last.header.Get(webhookEventHeader) != eventAppDeployed || last.header.Get(webhookDeliveryHeader) != d.ID {
+		t.Fatalf("unexpected delivery headers: %v", last.header)
+	}
+	sig := last.header.Get(webhookSignatureHeader)
+	sent, _, _ := strings.Cut(strings.TrimPrefix(sig, "t="), ",")
+	unix, _ := strconv.ParseInt(sent, 10, 64)
+	if sig != signWebhook(sub.Secret, time.Unix(unix, 0), last.body) {
+		t.Fatalf("signature %q does not verify against the body", sig)
+	}
+	if !strings.Contains(string(last.body), `"type":"app.deployed"`) {
+		t.Fatalf("expected the event as the body, got %s", last.body)
+	}
+
+	if got := doJSON[[]*types.WebhookDelivery](t, client, http.MethodGet, baseURL+"/webhooks/"+elsewhere.ID+"/deliveries", nil, http.StatusOK); len(got) != 0 {
+		t.Fatalf("expected no deliveries for another tenant's subscription, got %d", len(got))
+	}
+	doNoBody(t, client, http.MethodGet, deliveriesURL+"?status=lost", nil, http.StatusBadRequest)
+	doNoBody(t, client, http.MethodDelete, baseURL+"/webhooks/"+sub.ID, nil, http.StatusNoContent)
+	doNoBody(t, client, http.MethodGet, deliveriesURL, nil, http.StatusNotFound)
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	cases := map[int]time.Duration{
+		1:  30 * time.Second,
+		2:  time.Minute,
+		3:  2 * time.Minute,
+		7:  32 * time.Minute,
+		8:  time.Hour,
+		20: time.Hour,
+	}
+	for attempts, want := range cases {
+		if got := webhookBackoff(attempts); got != want {
+			t.Errorf("after %d attempts: got %s, want %s", attempts, got, want)
+		}
+	}
+}
+
+func TestWebhooksRefuseInternalTargets(t *testing.T) {
+	t.Setenv("KUBENOVA_REQUIRE_AUTH", "false")
+	t.Setenv("WEBHOOK_ALLOWED_CIDRS", "10.20.0.0/16")
+
+	srv := newTestServer(t)
+	ctx := context.Background()
+	var hits atomic.Int32
+	receiver := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { hits.Add(1) }))
+	defer receiver.Close()
+
+	for _, target := range []string{receiver.URL, "http://localhost:8080/hook", "http://169.254.169.254/latest", "http://10.0.0.1/", "http://[::1]/", "http://0.0.0.0/"} {
+		doNoBody(t, srv.client, http.MethodPost, srv.baseURL+"/webhooks", map[string]any{"url": target}, http.StatusUnprocessableEntity)
+	}
+	doJSON[*types.WebhookSubscription](t, srv.client, http.MethodPost, srv.baseURL+"/webhooks",
+		map[string]any{"url": "http://10.20.1.2/hook"}, http.StatusCreated)
+
+	// A subscription whose name later resolves to an internal address is
+	// stopped when the connection is made.
+	sub := &types.WebhookSubscription{URL: receiver.URL, Active: true, Secret: "s"}
+	if err := srv.store.CreateWebhook(ctx, sub); err != nil {
+		t.Fatalf("create webhook: %v", err)
+	}
+	next := time.Now().UTC()
+	d := &types.WebhookDelivery{SubscriptionID: sub.ID, EventType: eventAppDeployed, Status: types.WebhookDeliveryPending, Payload: []byte(`{}`), NextAttemptAt: &next}
+	if err := srv.store.CreateWebhookDelivery(ctx, d); err != nil {
+		t.Fatalf("create delivery: %v", err)
+	}
+	srv.deliverWebhooks(ctx, next.Add(time.Second))
+	deliveries := doJSON[[]*types.WebhookDelivery](t, srv.client, http.MethodGet, srv.baseURL+"/webhooks/"+sub.ID+"/deliveries", nil, http.StatusOK)
+	if hits.Load() != 0 || len(deliveries) != 1 || len(deliveries[0].Attempts) != 1 ||
+		!strings.Contains(deliveries[0].Attempts[0].Error, errWebhookTarget.Error()) {
+		t.Fatalf("expected the dial to be refused, got %d requests and %+v", hits.Load(), deliveries)
+	}
+}
+
+func TestWebhooksSkipUnauthenticatedTelemetry(t *testing.T) {
+	for _, auth := range []bool{false, true} {
+		t.Run(fmt.Sprintf("auth=%t", auth), func(t *testing.T) {
+			t.Setenv("KUBENOVA_REQUIRE_AUTH", strconv.FormatBool(auth))
+			t.Setenv("JWT_SIGNING_KEY", "webhooks-secret")
+			t.Setenv("WEBHOOK_ALLOWED_CIDRS", "127.0.0.0/8, ::1/128")
+
+			srv := newTestServer(t)
+			ctx := context.Background()
+			client := srv.client
+			if auth {
+				tok := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+					"sub": "admin", "roles": []string{"admin"}, "exp": time.Now().Add(time.Hour).Unix(),
+				})
+				signed, err := tok.SignedString([]byte("webhooks-secret"))
+				if err != nil {
+					t.Fatalf("sign token: %v", err)
+				}
+				client = &http.Client{Transport: bearerTransport{token: signed, next: srv.client.Transport}}
+			}
+			cluster := &types.Cluster{Name: "east", Kubeconfig: "fake"}
+			if err := srv.store.CreateCluster(ctx, cluster); err != nil {
+				t.Fatalf("create cluster: %v", err)
+			}
+			sub := doJSON[*types.WebhookSubscription](t, client, http.MethodPost, srv.baseURL+"/webhooks", map[string]any{
+				"url": "http://127.0.0.1:9/hook", "eventTypes": []string{"telemetry.*"},
+			}, http.StatusCreated)
+			doNoBody(t, client, http.MethodPost, srv.baseURL+"/telemetry/events", map[string]any{
+				"stream": "component_install", "clusterId": cluster.ID,
+			}, http.StatusAccepted)
+
+			deliveries := doJSON[[]*types.WebhookDelivery](t, client, http.MethodGet,
+				srv.baseURL+"/webhooks/"+sub.ID+"/deliveries", nil, http.StatusOK)
+			want := 0
+			if auth {
+				want = 1
+			}
+			if len(deliveries) != want {
+				t.Fatalf("expected %d deliveries, got %d", want, len(deliveries))
+			}
+			if events, err := srv.store.ListEvents(ctx, store.EventQuery{}); err != nil || len(events) != 1 {
+				t.Fatalf("expected the telemetry event to be streamed either way, got %d %v", len(events), err)
+			}
+		})
+	}
+}
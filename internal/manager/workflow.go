@@ -0,0 +1,361 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	velabackend "github.com/vaheed/kubenova/internal/backends/vela"
+	"github.com/vaheed/kubenova/internal/logging"
+	"github.com/vaheed/kubenova/internal/store"
+	"github.com/vaheed/kubenova/pkg/types"
+	"go.uber.org/zap"
+)
+
+const (
+	// Annotations set on the Application when a run starts. Workflow steps
+	// can read them through context.appAnnotations.
+	workflowRunAnnotation    = "kubenova.io/workflow-run"
+	workflowInputsAnnotation = "kubenova.io/workflow-inputs"
+
+	workflowSyncInterval = 15 * time.Second
+	// workflowSyncLease keeps run syncing to one manager replica.
+	workflowSyncLease = "workflow-sync"
+)
+
+func (s *Server) runWorkflow(w http.ResponseWriter, r *http.Request) {
+	if !s.requireRole(w, r, "admin", "ops", "projectDev", "tenantOwner") {
+		return
+	}
+	clusterID := chi.URLParam(r, "clusterID")
+	tenantID := chi.URLParam(r, "tenantID")
+	projectID := chi.URLParam(r, "projectID")
+	appID := chi.URLParam(r, "appID")
+	app, err := s.store.GetApp(r.Context(), clusterID, tenantID, projectID, appID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "KN-404", "app not found")
+		return
+	}
+	if !checkIfMatch(w, r, app.ResourceVersion) {
+		return
+	}
+	var req WorkflowRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "KN-400", err.Error())
+		return
+	}
+	inputs, err := json.Marshal(req.Inputs)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "KN-400", fmt.Sprintf("inputs: %v", err))
+		return
+	}
+	now := time.Now().UTC()
+	run := &types.WorkflowRun{
+		ID:        uuid.NewString(),
+		ClusterID: app.ClusterID,
+		TenantID:  app.TenantID,
+		ProjectID: app.ProjectID,
+		AppID:     app.ID,
+		Status:    types.WorkflowRunRunning,
+		Inputs:    req.Inputs,
+		StartedAt: now,
+		// Like any change, the run gets a new publish version, which makes
+		// KubeVela re-run the workflow; it also tells this run's execution
+		// apart from earlier ones in status.workflow.
+		PublishVersion: publishVersion(app, now),
+	}
+	if err := s.store.CreateWorkflowRun(r.Context(), run); err != nil {
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return
+	}
+
+	desired := *app
+	desired.PublishVersion = run.PublishVersion
+	if err := s.applyApp(r.Context(), &desired, map[string]string{
+		workflowRunAnnotation:    run.ID,
+		workflowInputsAnnotation: string(inputs),
+	}); err != nil {
+		finishRun(run, types.WorkflowRunFailed, "workflow was not started: "+err.Error(), time.Now().UTC())
+		if err := s.store.UpdateWorkflowRun(context.WithoutCancel(r.Context()), run); err != nil {
+			logging.L.Warn("workflow_run_update_failed", zap.String("run", run.ID), zap.Error(err))
+		} else {
+			s.publishEvent(r.Context(), eventWorkflowRunFinished, run)
+		}
+		writeError(w, http.StatusInternalServerError, "KN-500", fmt.Sprintf("start workflow: %v", err))
+		return
+	}
+	app.PublishVersion = run.PublishVersion
+	app.UpdatedAt = time.Now().UTC()
+	if err := s.store.UpdateApp(r.Context(), app); err != nil {
+		writeUpdateError(w, r, err)
+		return
+	}
+	s.publishEvent(r.Context(), eventWorkflowRunStarted, run)
+	writeVersioned(w, http.StatusAccepted, app.ResourceVersion, run)
+}
+
+func (s *Server) listWorkflowRuns(w http.ResponseWriter, r *http.Request) {
+	if !s.requireRole(w, r, "admin", "ops", "projectDev", "tenantOwner", "readOnly") && s.requireAuth {
+		return
+	}
+	clusterID := chi.URLParam(r, "clusterID")
+	tenantID := chi.URLParam(r, "tenantID")
+	projectID := chi.URLParam(r, "projectID")
+	appID := chi.URLParam(r, "appID")
+	if _, err := s.store.GetApp(r.Context(), clusterID, tenantID, projectID, appID); err != nil {
+		writeError(w, http.StatusNotFound, "KN-404", "app not found")
+		return
+	}
+	runs, err := s.store.ListWorkflowRuns(r.Context(), store.WorkflowRunQuery{
+		ClusterID: clusterID,
+		TenantID:  tenantID,
+		ProjectID: projectID,
+		AppID:     appID,
+	})
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, runs)
+}
+
+func (s *Server) getWorkflowRun(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAnyRole(w, r, "admin", "ops", "projectDev", "tenantOwner", "readOnly") {
+		return
+	}
+	run, err := s.store.GetWorkflowRun(r.Context(), chi.URLParam(r, "runID"))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "KN-404", "run not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return
+	}
+	if !s.requireScope(w, r, runScope(run), "admin", "ops", "projectDev", "tenantOwner", "readOnly") {
+		return
+	}
+	if !run.Finished() {
+		// Serve the freshest state we can; the background sync catches up
+		// otherwise.
+		if err := s.syncWorkflowRun(r.Context(), run); err != nil {
+			logging.L.Warn("workflow_run_sync_failed", zap.String("run", run.ID), zap.Error(err))
+		}
+	}
+	writeJSON(w, http.StatusOK, run)
+}
+
+func (s *Server) cancelWorkflowRun(w http.ResponseWriter, r *http.Request) {
+	if !s.requireAnyRole(w, r, "admin", "ops", "projectDev", "tenantOwner") {
+		return
+	}
+	run, err := s.store.GetWorkflowRun(r.Context(), chi.URLParam(r, "runID"))
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "KN-404", "run not found")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return
+	}
+	if !s.requireScope(w, r, runScope(run), "admin", "ops", "projectDev", "tenantOwner") {
+		return
+	}
+	if run.Finished() {
+		writeError(w, http.StatusConflict, "KN-409", fmt.Sprintf("run already %s", strings.ToLower(run.Status)))
+		return
+	}
+	backend, app, ns, err := s.velaForRun(r.Context(), run)
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusInternalServerError, "KN-500", fmt.Sprintf("cluster client: %v", err))
+		return
+	}
+	if err == nil {
+		ws, err := backend.WorkflowStatus(r.Context(), ns, app.Name)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "KN-500", fmt.Sprintf("read workflow status: %v", err))
+			return
+		}
+		// Only stop the workflow if it is still executing this run.
+		if ws.PublishVersion == run.PublishVersion {
+			if err := backend.TerminateWorkflow(r.Context(), ns, app.Name); err != nil {
+				writeError(w, http.StatusInternalServerError, "KN-500", fmt.Sprintf("terminate workflow: %v", err))
+				return
+			}
+		}
+	}
+	finishRun(run, types.WorkflowRunCanceled, "canceled", time.Now().UTC())
+	if err := s.store.UpdateWorkflowRun(r.Context(), run); err != nil {
+		writeError(w, http.StatusInternalServerError, "KN-500", err.Error())
+		return
+	}
+	s.publishEvent(r.Context(), eventWorkflowRunFinished, run)
+	writeJSON(w, http.StatusOK, run)
+}
+
+func runScope(run *types.WorkflowRun) resourceScope {
+	return resourceScope{clusterID: run.ClusterID, tenantID: run.TenantID, projectID: run.ProjectID}
+}
+
+// velaForRun returns the KubeVela backend for the cluster of the run's app,
+// along with the app and the namespace its Application lives in.
+func (s *Server) velaForRun(ctx context.Context, run *types.WorkflowRun) (velabackend.Interface, *types.App, string, error) {
+	app, err := s.store.GetApp(ctx, run.ClusterID, run.TenantID, run.ProjectID, run.AppID)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	tenant, err := s.store.GetTenant(ctx, run.ClusterID, run.TenantID)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	cluster, err := s.store.GetCluster(ctx, run.ClusterID)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	cli, err := s.kubeClientForCluster(ctx, cluster)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if s.velaFactory == nil {
+		s.velaFactory = defaultVelaBackendFactory
+	}
+	return s.velaFactory(cli), app, appsNamespace(tenant), nil
+}
+
+// syncWorkflowRun updates an unfinished run from the Application's workflow
+// status and saves it when anything changed.
+func (s *Server) syncWorkflowRun(ctx context.Context, run *types.WorkflowRun) error {
+	now := time.Now().UTC()
+	backend, app, ns, err := s.velaForRun(ctx, run)
+	if errors.Is(err, store.ErrNotFound) {
+		finishRun(run, types.WorkflowRunCanceled, "app was deleted", now)
+		return s.saveWorkflowRun(ctx, run)
+	}
+	if err != nil {
+		return err
+	}
+	ws, err := backend.WorkflowStatus(ctx, ns, app.Name)
+	if err != nil {
+		return err
+	}
+	before, _ := json.Marshal(run)
+	applyWorkflowStatus(run, ws, now)
+	if after, _ := json.Marshal(run); string(after) == string(before) {
+		return nil
+	}
+	return s.saveWorkflowRun(ctx, run)
+}
+
+// saveWorkflowRun stores a synced run and announces it once it finished.
+func (s *Server) saveWorkflowRun(ctx context.Context, run *types.WorkflowRun) error {
+	if err := s.store.UpdateWorkflowRun(ctx, run); err != nil {
+		return err
+	}
+	if run.Finished() {
+		s.publishEvent(ctx, eventWorkflowRunFinished, run)
+	}
+	return nil
+}
+
+// applyWorkflowStatus copies the steps of the run's workflow execution onto the
+// run and finishes it once KubeVela reports a final phase.
+func applyWorkflowStatus(run *types.WorkflowRun, ws *velabackend.WorkflowStatus, now time.Time) {
+	if ws.PublishVersion != run.PublishVersion {
+		finishRun(run, types.WorkflowRunCanceled, "superseded by a later deploy or workflow run", now)
+		return
+	}
+	if !workflowRanFor(ws.AppRevision, run.PublishVersion) {
+		// KubeVela has not picked up the new publish version yet.
+		return
+	}
+	run.Steps = run.Steps[:0]
+	for _, st := range ws.Steps {
+		run.Steps = append(run.Steps, types.WorkflowStep{
+			Name:    st.Name,
+			Type:    st.Type,
+			Phase:   st.Phase,
+			Message: st.Message,
+			Reason:  st.Reason,
+		})
+	}
+	end := now
+	if !ws.EndTime.IsZero() {
+		end = ws.EndTime.UTC()
+	}
+	switch {
+	case ws.Phase == "succeeded" || (ws.Phase == "" && ws.Finished && !ws.Terminated):
+		finishRun(run, types.WorkflowRunSucceeded, ws.Message, end)
+	case ws.Phase == "failed" || (ws.Terminated && hasFailedStep(ws.Steps)):
+		finishRun(run, types.WorkflowRunFailed, ws.Message, end)
+	case ws.Phase == "terminated" || ws.Terminated:
+		finishRun(run, types.WorkflowRunCanceled, ws.Message, end)
+	}
+}
+
+// workflowRanFor reports whether status.workflow.appRevision belongs to the
+// given publish version. KubeVela names revisions after the publish version
+// when one is set.
+func workflowRanFor(appRevision, publishVersion string) bool {
+	return appRevision == publishVersion || strings.HasSuffix(appRevision, "-"+publishVersion)
+}
+
+func hasFailedStep(steps []velabackend.WorkflowStep) bool {
+	for _, st := range steps {
+		if st.Phase == "failed" {
+			return true
+		}
+	}
+	return false
+}
+
+// finishRun sets the final status of a run and summarizes it in Result.
+func finishRun(run *types.WorkflowRun, status, message string, at time.Time) {
+	run.Status = status
+	run.EndedAt = &at
+	result := map[string]any{"status": status}
+	if message != "" {
+		result["message"] = message
+	}
+	if len(run.Steps) > 0 {
+		steps := map[string]any{}
+		for _, st := range run.Steps {
+			steps[st.Name] = st.Phase
+		}
+		result["steps"] = steps
+	}
+	run.Result = result
+}
+
+// RunWorkflowSync keeps unfinished workflow runs in line with the workflow
+// status of their Applications until the context is canceled. Only the replica
+// holding the sync lease polls the clusters.
+func (s *Server) RunWorkflowSync(ctx context.Context) {
+	ticker := time.NewTicker(workflowSyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !s.holdLease(ctx, workflowSyncLease, 2*workflowSyncInterval) {
+			continue
+		}
+		runs, err := s.store.ListWorkflowRuns(ctx, store.WorkflowRunQuery{Active: true})
+		if err != nil {
+			logging.L.Warn("workflow_run_list_failed", zap.Error(err))
+			continue
+		}
+		for _, run := range runs {
+			if err := s.syncWorkflowRun(ctx, run); err != nil {
+				logging.L.Warn("workflow_run_sync_failed", zap.String("run", run.ID), zap.Error(err))
+			}
+		}
+	}
+}
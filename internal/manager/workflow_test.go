@@ -0,0 +1,135 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	velabackend "github.com/vaheed/kubenova/internal/backends/vela"
+	"github.com/vaheed/kubenova/pkg/types"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	ctrlclient "sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// stubWorkflow applies Applications for real but reports a scripted workflow
+// status, standing in for the KubeVela controller.
+type stubWorkflow struct {
+	velabackend.Interface
+	status     velabackend.WorkflowStatus
+	terminated int
+}
+
+func (s *stubWorkflow) WorkflowStatus(context.Context, string, string) (*velabackend.WorkflowStatus, error) {
+	ws := s.status
+	return &ws, nil
+}
+
+func (s *stubWorkflow) TerminateWorkflow(context.Context, string, string) error {
+	s.terminated++
+	return nil
+}
+
+func TestWorkflowRunsTrackVelaStatus(t *testing.T) {
+	t.Setenv("KUBENOVA_REQUIRE_AUTH", "false")
+
+	srv := newTestServer(t)
+	st, client, baseURL := srv.store, srv.client, srv.baseURL
+	stub := &stubWorkflow{Interface: velabackend.NewClient(srv.kube, srv.scheme)}
+	srv.velaFactory = func(ctrlclient.Client) velabackend.Interface { return stub }
+	ctx := context.Background()
+
+	cluster := &types.Cluster{Name: "workflows", Kubeconfig: "fake"}
+	if err := st.CreateCluster(ctx, cluster); err != nil {
+		t.Fatalf("create cluster: %v", err)
+	}
+	tenant := doJSON[*types.Tenant](t, client, http.MethodPost,
+		fmt.Sprintf("%s/clusters/%s/tenants", baseURL, cluster.ID), map[string]any{"name": "acme"}, http.StatusCreated)
+	project := doJSON[*types.Project](t, client, http.MethodPost,
+		fmt.Sprintf("%s/clusters/%s/tenants/%s/projects", baseURL, cluster.ID, tenant.ID),
+		map[string]any{"name": "web"}, http.StatusCreated)
+	app := doJSON[*types.App](t, client, http.MethodPost,
+		fmt.Sprintf("%s/clusters/%s/tenants/%s/projects/%s/apps", baseURL, cluster.ID, tenant.ID, project.ID),
+		map[string]any{"name": "api", "spec": map[string]any{"type": "webservice"}}, http.StatusCreated)
+	appURL := fmt.Sprintf("%s/clusters/%s/tenants/%s/projects/%s/apps/%s", baseURL, cluster.ID, tenant.ID, project.ID, app.ID)
+	runURL := func(id string) string { return baseURL + "/apps/runs/" + id }
+
+	first := doJSON[*types.WorkflowRun](t, client, http.MethodPost, appURL+"/workflow/run",
+		map[string]any{"inputs": map[string]any{"action": "smoke"}}, http.StatusAccepted)
+	if first.Status != types.WorkflowRunRunning || first.PublishVersion == "" || strings.HasPrefix(first.PublishVersion, "run-") {
+		t.Fatalf("expected a running run with a publish version, got %+v", first)
+	}
+	if stored, err := st.GetApp(ctx, cluster.ID, tenant.ID, project.ID, app.ID); err != nil || stored.PublishVersion != first.PublishVersion {
+		t.Fatalf("expected the app to record the publish version applied for the run, got %+v (%v)", stored, err)
+	}
+	obj := &unstructured.Unstructured{}
+	obj.SetGroupVersionKind(schema.GroupVersionKind{Group: "core.oam.dev", Version: "v1beta1", Kind: "Application"})
+	if err := srv.kube.Get(ctx, ctrlclient.ObjectKey{Name: "api", Namespace: "acme-apps"}, obj); err != nil {
+		t.Fatalf("get Application: %v", err)
+	}
+	annotations := obj.GetAnnotations()
+	if annotations[velabackend.PublishVersionAnnotation] != first.PublishVersion ||
+		annotations[workflowRunAnnotation] != first.ID ||
+		annotations[workflowInputsAnnotation] != `{"action":"smoke"}` {
+		t.Fatalf("expected the run to restart the workflow with its inputs, got annotations %v", annotations)
+	}
+
+	second := doJSON[*types.WorkflowRun](t, client, http.MethodPost, appURL+"/workflow/run",
+		map[string]any{"inputs": map[string]any{"action": "migrate"}}, http.StatusAccepted)
+	if second.ID == first.ID {
+		t.Fatalf("expected unique run IDs, got %s twice", second.ID)
+	}
+
+	// The controller has not picked up the second run yet.
+	stub.status = velabackend.WorkflowStatus{PublishVersion: second.PublishVersion, AppRevision: "api-v1", Phase: "succeeded"}
+	got := doJSON[*types.WorkflowRun](t, client, http.MethodGet, runURL(second.ID), nil, http.StatusOK)
+	if got.Status != types.WorkflowRunRunning {
+		t.Fatalf("expected run to stay running until its revision executes, got %s", got.Status)
+	}
+
+	stub.status = velabackend.WorkflowStatus{
+		PublishVersion: second.PublishVersion,
+		AppRevision:    "api-" + second.PublishVersion,
+		Phase:          "executing",
+		Steps:          []velabackend.WorkflowStep{{Name: "deploy", Type: "deploy", Phase: "running"}},
+	}
+	got = doJSON[*types.WorkflowRun](t, client, http.MethodGet, runURL(second.ID), nil, http.StatusOK)
+	if got.Status != types.WorkflowRunRunning || len(got.Steps) != 1 || got.Steps[0].Phase != "running" {
+		t.Fatalf("expected running step results, got %+v", got)
+	}
+
+	ended := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	stub.status.Phase = "succeeded"
+	stub.status.Finished = true
+	stub.status.EndTime = ended
+	stub.status.Steps = []velabackend.WorkflowStep{{Name: "deploy", Type: "deploy", Phase: "succeeded"}}
+	got = doJSON[*types.WorkflowRun](t, client, http.MethodGet, runURL(second.ID), nil, http.StatusOK)
+	if got.Status != types.WorkflowRunSucceeded || got.EndedAt == nil || !got.EndedAt.Equal(ended) {
+		t.Fatalf("expected a succeeded run ending at %s, got %+v", ended, got)
+	}
+	if steps, _ := got.Result["steps"].(map[string]any); steps["deploy"] != "succeeded" {
+		t.Fatalf("expected step results in the run result, got %v", got.Result)
+	}
+
+	got = doJSON[*types.WorkflowRun](t, client, http.MethodGet, runURL(first.ID), nil, http.StatusOK)
+	if got.Status != types.WorkflowRunCanceled || got.EndedAt == nil {
+		t.Fatalf("expected the first run to be superseded, got %+v", got)
+	}
+
+	third := doJSON[*types.WorkflowRun](t, client, http.MethodPost, appURL+"/workflow/run", map[string]any{}, http.StatusAccepted)
+	stub.status = velabackend.WorkflowStatus{PublishVersion: third.PublishVersion, AppRevision: "api-" + third.PublishVersion, Phase: "executing"}
+	canceled := doJSON[*types.WorkflowRun](t, client, http.MethodPost, runURL(third.ID)+":cancel", nil, http.StatusOK)
+	if canceled.Status != types.WorkflowRunCanceled || canceled.EndedAt == nil || stub.terminated != 1 {
+		t.Fatalf("expected cancel to terminate the workflow, got %+v (terminated %d)", canceled, stub.terminated)
+	}
+	doNoBody(t, client, http.MethodPost, runURL(third.ID)+":cancel", nil, http.StatusConflict)
+
+	runs := doJSON[[]*types.WorkflowRun](t, client, http.MethodGet, appURL+"/workflow/runs", nil, http.StatusOK)
+	if len(runs) != 3 || runs[0].ID != third.ID || runs[2].ID != first.ID {
+		t.Fatalf("expected three runs newest first, got %d", len(runs))
+	}
+	doNoBody(t, client, http.MethodGet, runURL("missing"), nil, http.StatusNotFound)
+}
@@ -24,8 +24,24 @@ var (
 		Name:      "heartbeat_total",
 		Help:      "Total agent heartbeat posts received.",
 	})
+	RateLimitRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "kubenova",
+		Name:      "ratelimit_requests_total",
+		Help:      "Manager API requests checked against a rate limit, by limit, route class and outcome.",
+	}, []string{"limit", "class", "outcome"})
+	ClusterProbesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "kubenova",
+		Name:      "cluster_probes_total",
+		Help:      "Cluster API server health probes, by outcome (ok, slow or failed).",
+	}, []string{"outcome"})
+	ClusterProbeSeconds = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "kubenova",
+		Name:      "cluster_probe_seconds",
+		Help:      "Round trip of successful cluster API server health probes.",
+		Buckets:   prometheus.DefBuckets,
+	})
 )
 
 func init() {
-	prometheus.MustRegister(ReconcileSeconds, EventsTotal, AdapterErrorsTotal, HeartbeatsTotal)
+	prometheus.MustRegister(ReconcileSeconds, EventsTotal, AdapterErrorsTotal, HeartbeatsTotal, RateLimitRequestsTotal, ClusterProbesTotal, ClusterProbeSeconds)
 }
@@ -207,16 +207,18 @@ func (r *AppReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.R
 	}
 
 	appModel := &types.App{
-		Name:        app.Name,
-		ProjectID:   app.Spec.Project,
-		TenantID:    app.Spec.Tenant,
-		Description: app.Spec.Description,
-		Component:   app.Spec.Component,
-		Image:       app.Spec.Image,
-		Spec:        app.Spec.Template,
-		Traits:      app.Spec.Traits,
-		Policies:    app.Spec.Policies,
-		Revision:    1,
+		Name:           app.Name,
+		ProjectID:      app.Spec.Project,
+		TenantID:       app.Spec.Tenant,
+		Description:    app.Spec.Description,
+		Component:      app.Spec.Component,
+		Image:          app.Spec.Image,
+		Spec:           app.Spec.Template,
+		Traits:         app.Spec.Traits,
+		Policies:       app.Spec.Policies,
+		Revision:       1,
+		Suspended:      app.Spec.Suspended,
+		PublishVersion: app.Spec.PublishVersion,
 	}
 
 	adapter := vela.NewAppAdapter()
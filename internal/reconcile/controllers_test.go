@@ -43,6 +43,14 @@ func (m *mockVela) ApplyProject(ctx context.Context, spec map[string]any) error
 	return nil
 }
 
+func (m *mockVela) WorkflowStatus(ctx context.Context, namespace, name string) (*velabackend.WorkflowStatus, error) {
+	return &velabackend.WorkflowStatus{}, nil
+}
+
+func (m *mockVela) TerminateWorkflow(ctx context.Context, namespace, name string) error {
+	return nil
+}
+
 func TestTenantReconcilerCreatesNamespacesAndPublishes(t *testing.T) {
 	scheme := runtime.NewScheme()
 	_ = corev1.AddToScheme(scheme)
@@ -0,0 +1,81 @@
+package security
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// envelopePrefix marks a string as an encoded Envelope.
+const envelopePrefix = "kn-enc:v1:"
+
+// Envelope is a value encrypted with its own data key, stored next to the
+// data key wrapped by a master key.
+type Envelope struct {
+	KeyID      string `json:"kid"`
+	WrappedKey string `json:"wk"`
+	Ciphertext string `json:"ct"`
+}
+
+// Seal encrypts plaintext under a new data key wrapped by kp. The same aad
+// must be passed to Open, which binds the envelope to the record it belongs
+// to.
+func Seal(ctx context.Context, kp KeyProvider, plaintext, aad []byte) (*Envelope, error) {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	ct, err := Encrypt(dataKey, plaintext, aad)
+	if err != nil {
+		return nil, err
+	}
+	keyID, wrapped, err := kp.Wrap(ctx, dataKey, aad)
+	if err != nil {
+		return nil, err
+	}
+	return &Envelope{KeyID: keyID, WrappedKey: wrapped, Ciphertext: ct}, nil
+}
+
+// Open decrypts an envelope made by Seal.
+func Open(ctx context.Context, kp KeyProvider, env *Envelope, aad []byte) ([]byte, error) {
+	dataKey, err := kp.Unwrap(ctx, env.KeyID, env.WrappedKey, aad)
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key: %w", err)
+	}
+	return Decrypt(dataKey, env.Ciphertext, aad)
+}
+
+// Encode renders the envelope as a string that fits where the plaintext
+// was stored.
+func (e *Envelope) Encode() (string, error) {
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	return envelopePrefix + base64.StdEncoding.EncodeToString(raw), nil
+}
+
+// IsEnvelope reports whether s was made by Envelope.Encode.
+func IsEnvelope(s string) bool {
+	return strings.HasPrefix(s, envelopePrefix)
+}
+
+// DecodeEnvelope parses a string made by Envelope.Encode.
+func DecodeEnvelope(s string) (*Envelope, error) {
+	if !IsEnvelope(s) {
+		return nil, errors.New("not an encrypted envelope")
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(s, envelopePrefix))
+	if err != nil {
+		return nil, err
+	}
+	var env Envelope
+	if err := json.Unmarshal(raw, &env); err != nil {
+		return nil, err
+	}
+	return &env, nil
+}
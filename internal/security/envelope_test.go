@@ -0,0 +1,72 @@
+package security
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+}
+
+func TestEnvelopeRotation(t *testing.T) {
+	old, err := ParseKeyring("k1="+testKey(1), "")
+	if err != nil {
+		t.Fatalf("parse keyring: %v", err)
+	}
+	aad := []byte("cluster:c1:kubeconfig")
+	env, err := Seal(context.Background(), old, []byte("secret"), aad)
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	encoded, err := env.Encode()
+	if err != nil || !IsEnvelope(encoded) || strings.Contains(encoded, "secret") {
+		t.Fatalf("unexpected encoding %q: %v", encoded, err)
+	}
+
+	// After a rotation the old key still opens what it wrapped.
+	rotated, err := ParseKeyring("k1="+testKey(1)+", k2="+testKey(2), "k2")
+	if err != nil {
+		t.Fatalf("parse rotated keyring: %v", err)
+	}
+	decoded, err := DecodeEnvelope(encoded)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if pt, err := Open(context.Background(), rotated, decoded, aad); err != nil || string(pt) != "secret" {
+		t.Fatalf("open with rotated keyring: %q %v", pt, err)
+	}
+	if _, err := Open(context.Background(), rotated, decoded, []byte("cluster:c2:kubeconfig")); err == nil {
+		t.Fatal("expected the envelope to be bound to its record")
+	}
+	if env, _ := Seal(context.Background(), rotated, []byte("secret"), aad); env.KeyID != "k2" {
+		t.Fatalf("expected new envelopes under k2, got %s", env.KeyID)
+	}
+	newOnly, _ := ParseKeyring("k2="+testKey(2), "")
+	if _, err := Open(context.Background(), newOnly, decoded, aad); err == nil || !strings.Contains(err.Error(), `unknown key "k1"`) {
+		t.Fatalf("expected the removed key to be reported, got %v", err)
+	}
+}
+
+func TestParseKeyring(t *testing.T) {
+	cases := map[string]string{
+		"k1=" + testKey(1) + ",k1=" + testKey(2): "listed twice",
+		"k1":                                     "id=base64key",
+		"k1=" + base64.StdEncoding.EncodeToString([]byte("short")): "32 bytes",
+		"k1=not-base64!": "illegal base64",
+	}
+	for spec, want := range cases {
+		if _, err := ParseKeyring(spec, ""); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("%s: expected %q, got %v", spec, want, err)
+		}
+	}
+	if _, err := ParseKeyring("k1="+testKey(1), "k9"); err == nil {
+		t.Error("expected an unknown primary key to be rejected")
+	}
+	if kr, err := ParseKeyring(" ", ""); kr != nil || err != nil {
+		t.Errorf("expected no keyring, got %v %v", kr, err)
+	}
+}
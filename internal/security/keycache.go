@@ -0,0 +1,63 @@
+package security
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+)
+
+// defaultUnwrapCacheTTL is how long an unwrapped data key is reused. It
+// bounds how long a key revoked in the KMS keeps opening envelopes.
+const defaultUnwrapCacheTTL = time.Minute
+
+// cachedUnwrap keeps the data keys a provider unwrapped for a short while,
+// so that listing records does not call a remote KMS once per record.
+type cachedUnwrap struct {
+	KeyProvider
+	ttl time.Duration
+	now func() time.Time
+
+	mu    sync.Mutex
+	keys  map[string]cachedKey
+	swept time.Time
+}
+
+type cachedKey struct {
+	key     []byte
+	expires time.Time
+}
+
+// CacheUnwrapped returns kp with the data keys Unwrap returns kept for ttl.
+// They are keyed by the wrapped key together with its key ID and associated
+// data, so an envelope moved to another record is still sent to kp.
+func CacheUnwrapped(kp KeyProvider, ttl time.Duration) KeyProvider {
+	return &cachedUnwrap{KeyProvider: kp, ttl: ttl, now: time.Now, keys: map[string]cachedKey{}}
+}
+
+func (c *cachedUnwrap) Unwrap(ctx context.Context, keyID, wrapped string, aad []byte) ([]byte, error) {
+	id := keyID + "\x00" + wrapped + "\x00" + string(aad)
+	c.mu.Lock()
+	k, ok := c.keys[id]
+	c.mu.Unlock()
+	if ok && c.now().Before(k.expires) {
+		return bytes.Clone(k.key), nil
+	}
+	key, err := c.KeyProvider.Unwrap(ctx, keyID, wrapped, aad)
+	if err != nil {
+		return nil, err
+	}
+	now := c.now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now.Sub(c.swept) >= c.ttl {
+		for id, k := range c.keys {
+			if !now.Before(k.expires) {
+				delete(c.keys, id)
+			}
+		}
+		c.swept = now
+	}
+	c.keys[id] = cachedKey{key: bytes.Clone(key), expires: now.Add(c.ttl)}
+	return key, nil
+}
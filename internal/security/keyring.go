@@ -0,0 +1,117 @@
+package security
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Keyring is a KeyProvider holding master keys by ID in memory. Data keys
+// are wrapped with the primary key; the other keys are kept to unwrap data
+// keys wrapped before a rotation.
+type Keyring struct {
+	primary string
+	keys    map[string][]byte
+}
+
+// NewKeyring returns a keyring wrapping with the key named primary.
+func NewKeyring(primary string, keys map[string][]byte) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("keyring needs at least one key")
+	}
+	for id, key := range keys {
+		if id == "" || strings.ContainsAny(id, ",=") {
+			return nil, fmt.Errorf("invalid key ID %q", id)
+		}
+		if len(key) != 32 {
+			return nil, fmt.Errorf("key %s must be 32 bytes (AES-256)", id)
+		}
+	}
+	if _, ok := keys[primary]; !ok {
+		return nil, fmt.Errorf("primary key %q is not in the keyring", primary)
+	}
+	return &Keyring{primary: primary, keys: keys}, nil
+}
+
+// ParseKeyring reads keys written as "id=base64key,id2=base64key". The
+// primary key defaults to the first one listed. An empty spec gives a nil
+// keyring.
+func ParseKeyring(spec, primary string) (*Keyring, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" {
+		return nil, nil
+	}
+	keys := map[string][]byte{}
+	for _, part := range strings.Split(spec, ",") {
+		id, raw, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return nil, fmt.Errorf("key %q must be written as id=base64key", part)
+		}
+		if _, dup := keys[id]; dup {
+			return nil, fmt.Errorf("key %s is listed twice", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(raw)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+		keys[id] = key
+		if primary == "" {
+			primary = id
+		}
+	}
+	return NewKeyring(strings.TrimSpace(primary), keys)
+}
+
+// keyringFile is the layout of a keyring file:
+//
+//	{"primaryKeyId": "2026-10", "keys": {"2026-04": "<base64>", "2026-10": "<base64>"}}
+type keyringFile struct {
+	PrimaryKeyID string            `json:"primaryKeyId"`
+	Keys         map[string]string `json:"keys"`
+}
+
+// LoadKeyringFile reads a keyring from a JSON file, such as a mounted
+// Kubernetes Secret. A non-empty primary overrides the file's primaryKeyId.
+func LoadKeyringFile(path, primary string) (*Keyring, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f keyringFile
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return nil, fmt.Errorf("parse keyring file %s: %w", path, err)
+	}
+	if primary == "" {
+		primary = f.PrimaryKeyID
+	}
+	keys := make(map[string][]byte, len(f.Keys))
+	for id, b64 := range f.Keys {
+		key, err := base64.StdEncoding.DecodeString(b64)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+		keys[id] = key
+	}
+	return NewKeyring(primary, keys)
+}
+
+func (k *Keyring) PrimaryKeyID(context.Context) (string, error) {
+	return k.primary, nil
+}
+
+func (k *Keyring) Wrap(_ context.Context, dataKey, aad []byte) (keyID, wrapped string, err error) {
+	wrapped, err = Encrypt(k.keys[k.primary], dataKey, aad)
+	return k.primary, wrapped, err
+}
+
+func (k *Keyring) Unwrap(_ context.Context, keyID, wrapped string, aad []byte) ([]byte, error) {
+	key, ok := k.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+	}
+	return Decrypt(key, wrapped, aad)
+}
@@ -0,0 +1,108 @@
+package security
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrUnknownKey is returned by KeyProvider.Unwrap for a key ID the provider
+// does not hold.
+var ErrUnknownKey = errors.New("unknown key")
+
+// KeyProvider wraps data keys with master keys that it keeps to itself, so
+// that callers only ever handle wrapped data keys and key IDs.
+type KeyProvider interface {
+	// PrimaryKeyID names the master key Wrap currently uses.
+	PrimaryKeyID(ctx context.Context) (string, error)
+	// Wrap encrypts a data key, binding it to aad, and returns the ID of the
+	// master key it used.
+	Wrap(ctx context.Context, dataKey, aad []byte) (keyID, wrapped string, err error)
+	// Unwrap decrypts a data key wrapped with the master key keyID.
+	Unwrap(ctx context.Context, keyID, wrapped string, aad []byte) ([]byte, error)
+}
+
+// chain wraps with its first provider and unwraps with whichever provider
+// holds the key.
+type chain []KeyProvider
+
+// Chain returns a provider that wraps with primary and can still unwrap data
+// keys wrapped by the others, which is how data moves from one provider to
+// another.
+func Chain(primary KeyProvider, others ...KeyProvider) KeyProvider {
+	if len(others) == 0 {
+		return primary
+	}
+	return append(chain{primary}, others...)
+}
+
+func (c chain) PrimaryKeyID(ctx context.Context) (string, error) {
+	return c[0].PrimaryKeyID(ctx)
+}
+
+func (c chain) Wrap(ctx context.Context, dataKey, aad []byte) (string, string, error) {
+	return c[0].Wrap(ctx, dataKey, aad)
+}
+
+func (c chain) Unwrap(ctx context.Context, keyID, wrapped string, aad []byte) ([]byte, error) {
+	for _, p := range c {
+		key, err := p.Unwrap(ctx, keyID, wrapped, aad)
+		if !errors.Is(err, ErrUnknownKey) {
+			return key, err
+		}
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+}
+
+// KeyProviderFromEnv builds the provider configured by the environment:
+// Vault Transit (VAULT_TRANSIT_KEY), a keyring file (ENCRYPTION_KEYRING_FILE)
+// or inline keys (ENCRYPTION_KEYS). When Vault and a local keyring are both
+// set, Vault wraps new data keys and the keyring only unwraps older ones.
+// With Vault, unwrapped data keys are cached briefly. It returns nil when
+// nothing is configured.
+func KeyProviderFromEnv() (KeyProvider, error) {
+	var local KeyProvider
+	primary := strings.TrimSpace(os.Getenv("ENCRYPTION_KEY_ID"))
+	file := strings.TrimSpace(os.Getenv("ENCRYPTION_KEYRING_FILE"))
+	inline := os.Getenv("ENCRYPTION_KEYS")
+	switch {
+	case file != "" && strings.TrimSpace(inline) != "":
+		return nil, errors.New("set only one of ENCRYPTION_KEYRING_FILE and ENCRYPTION_KEYS")
+	case file != "":
+		kr, err := LoadKeyringFile(file, primary)
+		if err != nil {
+			return nil, fmt.Errorf("ENCRYPTION_KEYRING_FILE: %w", err)
+		}
+		local = kr
+	default:
+		kr, err := ParseKeyring(inline, primary)
+		if err != nil {
+			return nil, fmt.Errorf("ENCRYPTION_KEYS: %w", err)
+		}
+		if kr != nil {
+			local = kr
+		}
+	}
+
+	if strings.TrimSpace(os.Getenv("VAULT_TRANSIT_KEY")) == "" {
+		return local, nil
+	}
+	transit, err := NewTransitProvider(TransitConfig{
+		Address:   os.Getenv("VAULT_ADDR"),
+		Mount:     os.Getenv("VAULT_TRANSIT_MOUNT"),
+		Key:       os.Getenv("VAULT_TRANSIT_KEY"),
+		Token:     os.Getenv("VAULT_TOKEN"),
+		TokenFile: os.Getenv("VAULT_TOKEN_FILE"),
+		Namespace: os.Getenv("VAULT_NAMESPACE"),
+		CACert:    os.Getenv("VAULT_CACERT"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if local == nil {
+		return CacheUnwrapped(transit, defaultUnwrapCacheTTL), nil
+	}
+	return CacheUnwrapped(Chain(transit, local), defaultUnwrapCacheTTL), nil
+}
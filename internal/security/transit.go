@@ -0,0 +1,200 @@
+package security
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTransitMount = "transit"
+	transitTimeout      = 10 * time.Second
+	// transitKeyIDPrefix starts the key IDs of data keys wrapped by Transit,
+	// which read transit:<key>:v<version>.
+	transitKeyIDPrefix = "transit:"
+)
+
+// TransitConfig locates a key in a Vault Transit secrets engine, or any KMS
+// serving the same API.
+type TransitConfig struct {
+	// Address is the base URL of the server, e.g. https://vault:8200.
+	Address string
+	// Mount is the path the engine is mounted at (default "transit").
+	Mount string
+	// Key names the encryption key; Vault keeps its versions.
+	Key string
+	// Token authenticates requests. TokenFile is read before every request
+	// instead, so a token renewed by an agent sidecar is picked up.
+	Token     string
+	TokenFile string
+	Namespace string
+	// CACert is a PEM file of CAs to trust for the server certificate.
+	CACert string
+	// Client overrides the HTTP client.
+	Client *http.Client
+}
+
+// TransitProvider is a KeyProvider backed by a Vault Transit key. The master
+// key never leaves Vault; data keys are sent to it to be wrapped and
+// unwrapped.
+type TransitProvider struct {
+	cfg    TransitConfig
+	base   *url.URL
+	client *http.Client
+}
+
+// NewTransitProvider checks cfg and returns a provider for it.
+func NewTransitProvider(cfg TransitConfig) (*TransitProvider, error) {
+	cfg.Address = strings.TrimRight(strings.TrimSpace(cfg.Address), "/")
+	cfg.Key = strings.TrimSpace(cfg.Key)
+	cfg.Mount = strings.Trim(strings.TrimSpace(cfg.Mount), "/")
+	if cfg.Mount == "" {
+		cfg.Mount = defaultTransitMount
+	}
+	base, err := url.Parse(cfg.Address)
+	if err != nil || (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, fmt.Errorf("VAULT_ADDR %q must be an http or https URL", cfg.Address)
+	}
+	if cfg.Key == "" || strings.ContainsAny(cfg.Key, "/:") {
+		return nil, fmt.Errorf("invalid transit key name %q", cfg.Key)
+	}
+	if cfg.Token == "" && cfg.TokenFile == "" {
+		return nil, errors.New("VAULT_TOKEN or VAULT_TOKEN_FILE is required")
+	}
+	client := cfg.Client
+	if client == nil {
+		client = &http.Client{Timeout: transitTimeout}
+		if cfg.CACert != "" {
+			pem, err := os.ReadFile(cfg.CACert)
+			if err != nil {
+				return nil, fmt.Errorf("VAULT_CACERT: %w", err)
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("VAULT_CACERT %s holds no certificates", cfg.CACert)
+			}
+			client.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}}
+		}
+	}
+	return &TransitProvider{cfg: cfg, base: base, client: client}, nil
+}
+
+func (t *TransitProvider) keyID(version int) string {
+	return transitKeyIDPrefix + t.cfg.Key + ":v" + strconv.Itoa(version)
+}
+
+// PrimaryKeyID returns the ID of the latest version of the key, which Vault
+// encrypts with.
+func (t *TransitProvider) PrimaryKeyID(ctx context.Context) (string, error) {
+	var out struct {
+		LatestVersion int `json:"latest_version"`
+	}
+	if err := t.do(ctx, http.MethodGet, "keys/"+t.cfg.Key, nil, &out); err != nil {
+		return "", err
+	}
+	return t.keyID(out.LatestVersion), nil
+}
+
+func (t *TransitProvider) Wrap(ctx context.Context, dataKey, aad []byte) (string, string, error) {
+	var out struct {
+		Ciphertext string `json:"ciphertext"`
+	}
+	err := t.do(ctx, http.MethodPost, "encrypt/"+t.cfg.Key, map[string]string{
+		"plaintext":       base64.StdEncoding.EncodeToString(dataKey),
+		"associated_data": base64.StdEncoding.EncodeToString(aad),
+	}, &out)
+	if err != nil {
+		return "", "", err
+	}
+	// Ciphertexts read vault:v<version>:<data>.
+	parts := strings.SplitN(out.Ciphertext, ":", 3)
+	if len(parts) != 3 || !strings.HasPrefix(parts[1], "v") {
+		return "", "", errors.New("transit: unexpected ciphertext format")
+	}
+	version, err := strconv.Atoi(strings.TrimPrefix(parts[1], "v"))
+	if err != nil {
+		return "", "", errors.New("transit: unexpected ciphertext format")
+	}
+	return t.keyID(version), out.Ciphertext, nil
+}
+
+func (t *TransitProvider) Unwrap(ctx context.Context, keyID, wrapped string, aad []byte) ([]byte, error) {
+	if !strings.HasPrefix(keyID, transitKeyIDPrefix+t.cfg.Key+":") {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+	}
+	var out struct {
+		Plaintext string `json:"plaintext"`
+	}
+	err := t.do(ctx, http.MethodPost, "decrypt/"+t.cfg.Key, map[string]string{
+		"ciphertext":      wrapped,
+		"associated_data": base64.StdEncoding.EncodeToString(aad),
+	}, &out)
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(out.Plaintext)
+}
+
+// do calls the engine and decodes the data field of its response into out.
+func (t *TransitProvider) do(ctx context.Context, method, path string, body, out any) error {
+	token := t.cfg.Token
+	if t.cfg.TokenFile != "" {
+		raw, err := os.ReadFile(t.cfg.TokenFile)
+		if err != nil {
+			return fmt.Errorf("transit: read token: %w", err)
+		}
+		token = strings.TrimSpace(string(raw))
+	}
+	var reader io.Reader
+	if body != nil {
+		raw, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(raw)
+	}
+	u := t.base.JoinPath("v1", t.cfg.Mount, path)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), reader)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("X-Vault-Token", token)
+	if t.cfg.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", t.cfg.Namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("transit: %w", err)
+	}
+	defer resp.Body.Close()
+	var envelope struct {
+		Data   json.RawMessage `json:"data"`
+		Errors []string        `json:"errors"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&envelope); err != nil && resp.StatusCode < 300 {
+		return fmt.Errorf("transit: decode %s response: %w", path, err)
+	}
+	if resp.StatusCode >= 300 {
+		msg := resp.Status
+		if len(envelope.Errors) > 0 {
+			msg = strings.Join(envelope.Errors, "; ")
+		}
+		return fmt.Errorf("transit: %s %s: %s", method, path, msg)
+	}
+	return json.Unmarshal(envelope.Data, out)
+}
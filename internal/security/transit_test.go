@@ -0,0 +1,262 @@
+package security
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// stubTransit serves the encrypt, decrypt and key endpoints of a Vault
+// Transit engine mounted at transit/ with a single key.
+type stubTransit struct {
+	*httptest.Server
+	mu       sync.Mutex
+	token    string
+	versions [][]byte
+	decrypts int
+}
+
+func newStubTransit(t *testing.T, key, token string) *stubTransit {
+	t.Helper()
+	st := &stubTransit{token: token}
+	st.rotate()
+	fail := func(w http.ResponseWriter, status int, msg string) {
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(map[string][]string{"errors": {msg}})
+	}
+	reply := func(w http.ResponseWriter, data any) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"data": data})
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/transit/keys/"+key, func(w http.ResponseWriter, r *http.Request) {
+		st.mu.Lock()
+		defer st.mu.Unlock()
+		reply(w, map[string]int{"latest_version": len(st.versions)})
+	})
+	mux.HandleFunc("POST /v1/transit/encrypt/"+key, func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Plaintext      string `json:"plaintext"`
+			AssociatedData string `json:"associated_data"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		pt, _ := base64.StdEncoding.DecodeString(req.Plaintext)
+		aad, _ := base64.StdEncoding.DecodeString(req.AssociatedData)
+		st.mu.Lock()
+		version := len(st.versions)
+		ct, err := Encrypt(st.versions[version-1], pt, aad)
+		st.mu.Unlock()
+		if err != nil {
+			fail(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		reply(w, map[string]any{"ciphertext": fmt.Sprintf("vault:v%d:%s", version, ct), "key_version": version})
+	})
+	mux.HandleFunc("POST /v1/transit/decrypt/"+key, func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Ciphertext     string `json:"ciphertext"`
+			AssociatedData string `json:"associated_data"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		parts := strings.SplitN(req.Ciphertext, ":", 3)
+		version, _ := strconv.Atoi(strings.TrimPrefix(parts[1], "v"))
+		aad, _ := base64.StdEncoding.DecodeString(req.AssociatedData)
+		st.mu.Lock()
+		defer st.mu.Unlock()
+		st.decrypts++
+		if version < 1 || version > len(st.versions) {
+			fail(w, http.StatusBadRequest, "invalid key version")
+			return
+		}
+		pt, err := Decrypt(st.versions[version-1], parts[2], aad)
+		if err != nil {
+			fail(w, http.StatusBadRequest, "cipher: message authentication failed")
+			return
+		}
+		reply(w, map[string]string{"plaintext": base64.StdEncoding.EncodeToString(pt)})
+	})
+	st.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Vault-Token") != st.token {
+			fail(w, http.StatusForbidden, "permission denied")
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(st.Close)
+	return st
+}
+
+func (st *stubTransit) rotate() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.versions = append(st.versions, bytes.Repeat([]byte{byte(len(st.versions) + 1)}, 32))
+}
+
+func TestTransitProvider(t *testing.T) {
+	ctx := context.Background()
+	vault := newStubTransit(t, "kubenova", "s.token")
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("s.token\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	kp, err := NewTransitProvider(TransitConfig{Address: vault.URL + "/", Key: "kubenova", TokenFile: tokenFile})
+	if err != nil {
+		t.Fatalf("new provider: %v", err)
+	}
+	aad := []byte("cluster:c1:kubeconfig")
+	env, err := Seal(ctx, kp, []byte("secret"), aad)
+	if err != nil || env.KeyID != "transit:kubenova:v1" {
+		t.Fatalf("seal: %+v %v", env, err)
+	}
+	if primary, err := kp.PrimaryKeyID(ctx); err != nil || primary != "transit:kubenova:v1" {
+		t.Fatalf("primary key: %q %v", primary, err)
+	}
+
+	// Vault rotates the key; old envelopes still open.
+	vault.rotate()
+	if primary, _ := kp.PrimaryKeyID(ctx); primary != "transit:kubenova:v2" {
+		t.Fatalf("expected v2 after the rotation, got %q", primary)
+	}
+	if pt, err := Open(ctx, kp, env, aad); err != nil || string(pt) != "secret" {
+		t.Fatalf("open: %q %v", pt, err)
+	}
+	if _, err := Open(ctx, kp, env, []byte("cluster:c2:kubeconfig")); err == nil || !strings.Contains(err.Error(), "authentication failed") {
+		t.Fatalf("expected the wrapped key to be bound to its record, got %v", err)
+	}
+	if env, _ := Seal(ctx, kp, []byte("secret"), aad); env.KeyID != "transit:kubenova:v2" {
+		t.Fatalf("expected new envelopes under v2, got %s", env.KeyID)
+	}
+	if _, err := kp.Unwrap(ctx, "k1", env.WrappedKey, aad); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("expected a local key ID to be unknown, got %v", err)
+	}
+
+	// The token is read before every request.
+	if err := os.WriteFile(tokenFile, []byte("s.expired"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Seal(ctx, kp, []byte("secret"), aad); err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Fatalf("expected Vault's error, got %v", err)
+	}
+
+	for _, cfg := range []TransitConfig{
+		{Address: "vault:8200", Key: "k", Token: "t"},
+		{Address: vault.URL, Key: "a/b", Token: "t"},
+		{Address: vault.URL, Key: "k"},
+	} {
+		if _, err := NewTransitProvider(cfg); err == nil {
+			t.Errorf("expected %+v to be rejected", cfg)
+		}
+	}
+}
+
+func TestKeyProviderFromEnv(t *testing.T) {
+	ctx := context.Background()
+	vault := newStubTransit(t, "kubenova", "s.token")
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	raw, _ := json.Marshal(keyringFile{PrimaryKeyID: "k1", Keys: map[string]string{"k1": testKey(1), "k2": testKey(2)}})
+	if err := os.WriteFile(path, raw, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for _, env := range []string{"ENCRYPTION_KEYS", "ENCRYPTION_KEY_ID", "ENCRYPTION_KEYRING_FILE", "VAULT_ADDR", "VAULT_TRANSIT_KEY", "VAULT_TOKEN"} {
+		t.Setenv(env, "")
+	}
+	if kp, err := KeyProviderFromEnv(); kp != nil || err != nil {
+		t.Fatalf("expected no provider, got %v %v", kp, err)
+	}
+
+	t.Setenv("ENCRYPTION_KEYRING_FILE", path)
+	local, err := KeyProviderFromEnv()
+	if err != nil {
+		t.Fatalf("keyring file: %v", err)
+	}
+	if primary, _ := local.PrimaryKeyID(ctx); primary != "k1" {
+		t.Fatalf("expected the file's primary key, got %q", primary)
+	}
+	old, err := Seal(ctx, local, []byte("secret"), nil)
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+
+	t.Setenv("ENCRYPTION_KEYS", "k3="+testKey(3))
+	if _, err := KeyProviderFromEnv(); err == nil {
+		t.Fatal("expected a keyring file and inline keys to be rejected together")
+	}
+	t.Setenv("ENCRYPTION_KEYS", "")
+
+	// Moving to Vault: Vault wraps, the keyring still unwraps.
+	t.Setenv("VAULT_ADDR", vault.URL)
+	t.Setenv("VAULT_TRANSIT_KEY", "kubenova")
+	t.Setenv("VAULT_TOKEN", "s.token")
+	kp, err := KeyProviderFromEnv()
+	if err != nil {
+		t.Fatalf("vault: %v", err)
+	}
+	if env, err := Seal(ctx, kp, []byte("secret"), nil); err != nil || env.KeyID != "transit:kubenova:v1" {
+		t.Fatalf("expected Vault to wrap, got %+v %v", env, err)
+	}
+	if pt, err := Open(ctx, kp, old, nil); err != nil || string(pt) != "secret" {
+		t.Fatalf("expected the keyring to unwrap, got %q %v", pt, err)
+	}
+	if _, err := kp.Unwrap(ctx, "k9", old.WrappedKey, nil); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("expected an unknown key, got %v", err)
+	}
+}
+
+func TestCacheUnwrapped(t *testing.T) {
+	ctx := context.Background()
+	vault := newStubTransit(t, "kubenova", "s.token")
+	transit, err := NewTransitProvider(TransitConfig{Address: vault.URL, Key: "kubenova", Token: "s.token"})
+	if err != nil {
+		t.Fatalf("new provider: %v", err)
+	}
+	kp := CacheUnwrapped(transit, time.Minute)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	kp.(*cachedUnwrap).now = func() time.Time { return now }
+	decrypts := func() int {
+		vault.mu.Lock()
+		defer vault.mu.Unlock()
+		return vault.decrypts
+	}
+
+	aad := []byte("cluster:c1:kubeconfig")
+	env, err := Seal(ctx, kp, []byte("secret"), aad)
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	for range 3 {
+		if pt, err := Open(ctx, kp, env, aad); err != nil || string(pt) != "secret" {
+			t.Fatalf("open: %q %v", pt, err)
+		}
+	}
+	if got := decrypts(); got != 1 {
+		t.Fatalf("expected one decrypt call for repeated opens, got %d", got)
+	}
+
+	// Other associated data is not served from the cache.
+	if _, err := Open(ctx, kp, env, []byte("cluster:c2:kubeconfig")); err == nil {
+		t.Fatal("expected the wrapped key to stay bound to its record")
+	}
+	if got := decrypts(); got != 2 {
+		t.Fatalf("expected the other record to reach Vault, got %d decrypts", got)
+	}
+
+	// Expired keys are unwrapped again.
+	now = now.Add(time.Minute)
+	if _, err := Open(ctx, kp, env, aad); err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if got := decrypts(); got != 3 {
+		t.Fatalf("expected an expired key to be unwrapped again, got %d decrypts", got)
+	}
+}
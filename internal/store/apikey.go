@@ -0,0 +1,17 @@
+package store
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vaheed/kubenova/pkg/types"
+)
+
+func assignAPIKeyID(k *types.APIKey) {
+	now := time.Now().UTC()
+	if k.ID == "" {
+		k.ID = uuid.NewString()
+	}
+	k.CreatedAt = now
+	k.UpdatedAt = now
+}
@@ -0,0 +1,62 @@
+package store
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vaheed/kubenova/pkg/types"
+)
+
+// Page sizes for ListAudit.
+const (
+	DefaultAuditLimit = 100
+	MaxAuditLimit     = 1000
+)
+
+// AuditQuery filters the audit log. Empty fields match everything; Resource
+// matches the resource path and everything below it. The range is half-open:
+// [From, To).
+type AuditQuery struct {
+	Actor     string
+	Resource  string
+	ClusterID string
+	TenantID  string
+	Action    string
+	From      time.Time
+	To        time.Time
+	Limit     int
+}
+
+func (q AuditQuery) limit() int {
+	if q.Limit <= 0 {
+		return DefaultAuditLimit
+	}
+	if q.Limit > MaxAuditLimit {
+		return MaxAuditLimit
+	}
+	return q.Limit
+}
+
+func (q AuditQuery) matches(e *types.AuditEvent) bool {
+	switch {
+	case q.Actor != "" && e.Actor != q.Actor,
+		q.ClusterID != "" && e.ClusterID != q.ClusterID,
+		q.TenantID != "" && e.TenantID != q.TenantID,
+		q.Action != "" && e.Action != q.Action,
+		q.Resource != "" && e.Resource != q.Resource && !strings.HasPrefix(e.Resource, strings.TrimSuffix(q.Resource, "/")+"/"),
+		!q.From.IsZero() && e.Time.Before(q.From),
+		!q.To.IsZero() && !e.Time.Before(q.To):
+		return false
+	}
+	return true
+}
+
+func assignAuditID(e *types.AuditEvent) {
+	if e.ID == "" {
+		e.ID = uuid.NewString()
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+}
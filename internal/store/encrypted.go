@@ -0,0 +1,242 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/vaheed/kubenova/internal/logging"
+	"github.com/vaheed/kubenova/internal/security"
+	"github.com/vaheed/kubenova/pkg/types"
+	"go.uber.org/zap"
+)
+
+// rewrapAttempts bounds how often a record that changed underneath a rewrap
+// is read again.
+const rewrapAttempts = 3
+
+// EncryptionStatus describes the encryption of the secrets a store holds.
+type EncryptionStatus struct {
+	Enabled bool `json:"enabled"`
+	// KeyID is the master key new secrets are encrypted under.
+	KeyID string `json:"keyId,omitempty"`
+	// Secrets counts the stored secrets by the ID of the master key wrapping
+	// them; "plaintext" counts those stored before encryption was enabled.
+	Secrets map[string]int `json:"secrets,omitempty"`
+	// Rewrapped is how many secrets a rewrap moved to KeyID.
+	Rewrapped int `json:"rewrapped"`
+}
+
+// SecretEncryption is implemented by stores that encrypt secrets at rest.
+type SecretEncryption interface {
+	EncryptionStatus(ctx context.Context) (*EncryptionStatus, error)
+	// RewrapSecrets encrypts every secret that is not yet under the primary
+	// master key with it. Records are updated one at a time with their
+	// ResourceVersion, so writers can carry on meanwhile.
+	RewrapSecrets(ctx context.Context) (*EncryptionStatus, error)
+}
+
+// encryptedStore envelope-encrypts cluster kubeconfigs before they reach the
+// wrapped store, binding each to its cluster ID.
+type encryptedStore struct {
+	Store
+	keys security.KeyProvider
+}
+
+// NewEncryptedStore wraps st so that cluster kubeconfigs are stored
+// encrypted with data keys wrapped by keys. Kubeconfigs stored in plaintext
+// earlier are still read, and encrypted by RewrapSecrets.
+func NewEncryptedStore(st Store, keys security.KeyProvider) Store {
+	return &encryptedStore{Store: st, keys: keys}
+}
+
+func kubeconfigAAD(clusterID string) []byte {
+	return []byte("cluster:" + clusterID + ":kubeconfig")
+}
+
+func (e *encryptedStore) seal(ctx context.Context, c *types.Cluster) (*types.Cluster, error) {
+	out := *c
+	if c.Kubeconfig == "" {
+		return &out, nil
+	}
+	// Envelopes are only ever produced here; one passed in would be stored
+	// as if this store had sealed it.
+	if security.IsEnvelope(c.Kubeconfig) {
+		return nil, fmt.Errorf("kubeconfig of cluster %s: %w", c.ID, ErrEncryptedInput)
+	}
+	env, err := security.Seal(ctx, e.keys, []byte(c.Kubeconfig), kubeconfigAAD(c.ID))
+	if err != nil {
+		return nil, fmt.Errorf("encrypt kubeconfig of cluster %s: %w", c.ID, err)
+	}
+	if out.Kubeconfig, err = env.Encode(); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+func (e *encryptedStore) open(ctx context.Context, c *types.Cluster) error {
+	if !security.IsEnvelope(c.Kubeconfig) {
+		return nil
+	}
+	env, err := security.DecodeEnvelope(c.Kubeconfig)
+	if err == nil {
+		var pt []byte
+		if pt, err = security.Open(ctx, e.keys, env, kubeconfigAAD(c.ID)); err == nil {
+			c.Kubeconfig = string(pt)
+			return nil
+		}
+	}
+	return fmt.Errorf("decrypt kubeconfig of cluster %s: %w", c.ID, err)
+}
+
+// keyID returns the master key the kubeconfig is wrapped with, "plaintext"
+// when it is not encrypted and "" when there is none.
+func keyID(c *types.Cluster) string {
+	switch {
+	case c.Kubeconfig == "":
+		return ""
+	case !security.IsEnvelope(c.Kubeconfig):
+		return "plaintext"
+	}
+	env, err := security.DecodeEnvelope(c.Kubeconfig)
+	if err != nil {
+		return "invalid"
+	}
+	return env.KeyID
+}
+
+func (e *encryptedStore) CreateCluster(ctx context.Context, c *types.Cluster) error {
+	// The ID is part of the associated data, so it is needed up front.
+	if c.ID == "" {
+		c.ID = uuid.NewString()
+	}
+	sealed, err := e.seal(ctx, c)
+	if err != nil {
+		return err
+	}
+	if err := e.Store.CreateCluster(ctx, sealed); err != nil {
+		return err
+	}
+	kubeconfig := c.Kubeconfig
+	*c = *sealed
+	c.Kubeconfig = kubeconfig
+	return nil
+}
+
+func (e *encryptedStore) UpdateCluster(ctx context.Context, c *types.Cluster) error {
+	sealed, err := e.seal(ctx, c)
+	if err != nil {
+		return err
+	}
+	if err := e.Store.UpdateCluster(ctx, sealed); err != nil {
+		return err
+	}
+	kubeconfig := c.Kubeconfig
+	*c = *sealed
+	c.Kubeconfig = kubeconfig
+	return nil
+}
+
+func (e *encryptedStore) GetCluster(ctx context.Context, id string) (*types.Cluster, error) {
+	c, err := e.Store.GetCluster(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.open(ctx, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (e *encryptedStore) ListClusters(ctx context.Context, opts ListOptions) ([]*types.Cluster, string, error) {
+	clusters, next, err := e.Store.ListClusters(ctx, opts)
+	if err != nil {
+		return nil, "", err
+	}
+	// One kubeconfig that no longer decrypts, e.g. because its master key
+	// was dropped, must not hide every other cluster; it is left out and
+	// logged, and GetCluster still reports the error.
+	out := clusters[:0]
+	for _, c := range clusters {
+		if err := e.open(ctx, c); err != nil {
+			logging.L.Warn("cluster_kubeconfig_decrypt_failed", zap.String("cluster_id", c.ID), zap.Error(err))
+			continue
+		}
+		out = append(out, c)
+	}
+	return out, next, nil
+}
+
+func (e *encryptedStore) EncryptionStatus(ctx context.Context) (*EncryptionStatus, error) {
+	clusters, _, err := e.Store.ListClusters(ctx, ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	primary, err := e.keys.PrimaryKeyID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status := &EncryptionStatus{Enabled: true, KeyID: primary, Secrets: map[string]int{}}
+	for _, c := range clusters {
+		if id := keyID(c); id != "" {
+			status.Secrets[id]++
+		}
+	}
+	return status, nil
+}
+
+func (e *encryptedStore) RewrapSecrets(ctx context.Context) (*EncryptionStatus, error) {
+	primary, err := e.keys.PrimaryKeyID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	clusters, _, err := e.Store.ListClusters(ctx, ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	rewrapped := 0
+	for _, c := range clusters {
+		done, err := e.rewrapCluster(ctx, c, primary)
+		if err != nil {
+			return nil, err
+		}
+		if done {
+			rewrapped++
+		}
+	}
+	status, err := e.EncryptionStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	status.Rewrapped = rewrapped
+	return status, nil
+}
+
+// rewrapCluster stores the kubeconfig of c, as read from the wrapped store,
+// under the primary key, reading it again when it changed meanwhile.
+func (e *encryptedStore) rewrapCluster(ctx context.Context, c *types.Cluster, primary string) (bool, error) {
+	for attempt := 1; ; attempt++ {
+		if id := keyID(c); id == "" || id == primary {
+			return false, nil
+		}
+		if err := e.open(ctx, c); err != nil {
+			return false, err
+		}
+		err := e.UpdateCluster(ctx, c)
+		switch {
+		case err == nil:
+			return true, nil
+		case errors.Is(err, ErrNotFound):
+			return false, nil
+		case !errors.Is(err, ErrVersionConflict) || attempt == rewrapAttempts:
+			return false, fmt.Errorf("rewrap kubeconfig of cluster %s: %w", c.ID, err)
+		}
+		if c, err = e.Store.GetCluster(ctx, c.ID); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				return false, nil
+			}
+			return false, err
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package store
+
+import (
+	"time"
+
+	"github.com/vaheed/kubenova/pkg/types"
+)
+
+// Page sizes for ListEvents.
+const (
+	DefaultEventLimit = 100
+	MaxEventLimit     = 1000
+)
+
+// EventQuery selects the events published after the event with ID After.
+type EventQuery struct {
+	After int64
+	Limit int
+}
+
+func (q EventQuery) limit() int {
+	if q.Limit <= 0 {
+		return DefaultEventLimit
+	}
+	if q.Limit > MaxEventLimit {
+		return MaxEventLimit
+	}
+	return q.Limit
+}
+
+func stampEvent(e *types.Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+}
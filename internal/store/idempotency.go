@@ -0,0 +1,23 @@
+package store
+
+import "time"
+
+// IdempotencyRecord remembers a request made with an Idempotency-Key and, once
+// the request has finished, the response to replay for retries of it.
+type IdempotencyRecord struct {
+	// Key identifies the caller and the client-supplied key.
+	Key string `json:"key"`
+	// Fingerprint is a digest of the method, path and body of the first request.
+	Fingerprint string `json:"fingerprint"`
+	// Status is zero while the first request is still being handled.
+	Status    int               `json:"status"`
+	Header    map[string]string `json:"header,omitempty"`
+	Body      []byte            `json:"body,omitempty"`
+	CreatedAt time.Time         `json:"createdAt"`
+	ExpiresAt time.Time         `json:"expiresAt"`
+}
+
+// Pending reports whether the first request holding the key has not finished.
+func (r *IdempotencyRecord) Pending() bool {
+	return r.Status == 0
+}
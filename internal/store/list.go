@@ -0,0 +1,363 @@
+package store
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vaheed/kubenova/pkg/types"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// ErrInvalidList is returned for malformed sort keys, label selectors or
+// continue tokens.
+var ErrInvalidList = errors.New("invalid list options")
+
+// Sort fields understood by the list calls.
+const (
+	SortName      = "name"
+	SortCreatedAt = "createdAt"
+	SortUpdatedAt = "updatedAt"
+	MaxListLimit  = 1000
+)
+
+// sortColumns maps sort fields onto table columns. Names compare bytewise so
+// that Postgres and the memory store agree on the order.
+var sortColumns = map[string]string{
+	SortName:      `name COLLATE "C"`,
+	SortCreatedAt: "created_at",
+	SortUpdatedAt: "updated_at",
+}
+
+// ListOptions controls paging, ordering and label filtering of list calls.
+// The zero value returns every item ordered by creation time.
+type ListOptions struct {
+	// Limit caps the page size; zero means no limit.
+	Limit int
+	// Continue is the token returned with the previous page.
+	Continue string
+	// Sort orders the items; the ID always breaks ties.
+	Sort     []SortKey
+	Selector labels.Selector
+}
+
+// SortKey orders a list by one field.
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// ParseSort reads a comma-separated list of fields such as "name,-createdAt".
+func ParseSort(v string) ([]SortKey, error) {
+	var keys []SortKey
+	for _, part := range strings.Split(v, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		key := SortKey{Field: strings.TrimPrefix(part, "-"), Desc: strings.HasPrefix(part, "-")}
+		if _, ok := sortColumns[key.Field]; !ok {
+			return nil, fmt.Errorf("%w: unknown sort field %q", ErrInvalidList, key.Field)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// ParseSelector parses a Kubernetes-style label selector such as
+// "env=prod,tier!=free". Numeric comparisons are not supported.
+func ParseSelector(v string) (labels.Selector, error) {
+	if strings.TrimSpace(v) == "" {
+		return nil, nil
+	}
+	sel, err := labels.Parse(v)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidList, err)
+	}
+	reqs, _ := sel.Requirements()
+	for _, req := range reqs {
+		if op := req.Operator(); op == selection.GreaterThan || op == selection.LessThan {
+			return nil, fmt.Errorf("%w: operator %s is not supported", ErrInvalidList, op)
+		}
+	}
+	return sel, nil
+}
+
+func (o ListOptions) sortKeys() []SortKey {
+	if len(o.Sort) == 0 {
+		return []SortKey{{Field: SortCreatedAt}}
+	}
+	return o.Sort
+}
+
+func sortSignature(keys []SortKey) string {
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		if k.Desc {
+			parts = append(parts, "-"+k.Field)
+		} else {
+			parts = append(parts, k.Field)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// listMeta is the part of a resource that list calls sort, page and filter on.
+type listMeta struct {
+	ID        string
+	Name      string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Labels    map[string]string
+}
+
+func clusterMeta(c *types.Cluster) listMeta {
+	return listMeta{ID: c.ID, Name: c.Name, CreatedAt: c.CreatedAt, UpdatedAt: c.UpdatedAt, Labels: c.Labels}
+}
+
+func tenantMeta(t *types.Tenant) listMeta {
+	return listMeta{ID: t.ID, Name: t.Name, CreatedAt: t.CreatedAt, UpdatedAt: t.UpdatedAt, Labels: t.Labels}
+}
+
+func projectMeta(p *types.Project) listMeta {
+	return listMeta{ID: p.ID, Name: p.Name, CreatedAt: p.CreatedAt, UpdatedAt: p.UpdatedAt, Labels: p.Labels}
+}
+
+// Apps have no labels of their own, so selectors never match a labelled app.
+func appMeta(a *types.App) listMeta {
+	return listMeta{ID: a.ID, Name: a.Name, CreatedAt: a.CreatedAt, UpdatedAt: a.UpdatedAt}
+}
+
+// listCursor is the decoded form of a continue token: the sort values and ID
+// of the last item on the previous page. Timestamps are kept at microsecond
+// precision, which is what Postgres stores.
+type listCursor struct {
+	Sort   string   `json:"s"`
+	Values []string `json:"v"`
+	ID     string   `json:"id"`
+}
+
+func encodeCursor(keys []SortKey, m listMeta) string {
+	c := listCursor{Sort: sortSignature(keys), ID: m.ID}
+	for _, k := range keys {
+		switch k.Field {
+		case SortName:
+			c.Values = append(c.Values, m.Name)
+		case SortCreatedAt:
+			c.Values = append(c.Values, listTime(m.CreatedAt).Format(time.RFC3339Nano))
+		case SortUpdatedAt:
+			c.Values = append(c.Values, listTime(m.UpdatedAt).Format(time.RFC3339Nano))
+		}
+	}
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// decodeCursor returns the position encoded in token as a listMeta so that it
+// can be compared like any other item.
+func decodeCursor(token string, keys []SortKey) (listMeta, error) {
+	var m listMeta
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return m, fmt.Errorf("%w: malformed continue token", ErrInvalidList)
+	}
+	var c listCursor
+	if err := json.Unmarshal(raw, &c); err != nil || len(c.Values) != len(keys) {
+		return m, fmt.Errorf("%w: malformed continue token", ErrInvalidList)
+	}
+	// The ID is compared as a uuid in Postgres; anything else is forged.
+	if _, err := uuid.Parse(c.ID); err != nil {
+		return m, fmt.Errorf("%w: malformed continue token", ErrInvalidList)
+	}
+	if c.Sort != sortSignature(keys) {
+		return m, fmt.Errorf("%w: continue token was issued for a different sort", ErrInvalidList)
+	}
+	m.ID = c.ID
+	for i, k := range keys {
+		switch k.Field {
+		case SortName:
+			m.Name = c.Values[i]
+		case SortCreatedAt, SortUpdatedAt:
+			t, err := time.Parse(time.RFC3339Nano, c.Values[i])
+			if err != nil {
+				return m, fmt.Errorf("%w: malformed continue token", ErrInvalidList)
+			}
+			if k.Field == SortCreatedAt {
+				m.CreatedAt = t
+			} else {
+				m.UpdatedAt = t
+			}
+		}
+	}
+	return m, nil
+}
+
+func listTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Microsecond)
+}
+
+func compareMeta(a, b listMeta, keys []SortKey) int {
+	for _, k := range keys {
+		var c int
+		switch k.Field {
+		case SortName:
+			c = strings.Compare(a.Name, b.Name)
+		case SortCreatedAt:
+			c = listTime(a.CreatedAt).Compare(listTime(b.CreatedAt))
+		case SortUpdatedAt:
+			c = listTime(a.UpdatedAt).Compare(listTime(b.UpdatedAt))
+		}
+		if k.Desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return strings.Compare(a.ID, b.ID)
+}
+
+// pageItems filters, sorts and pages items in memory. It mirrors the SQL built
+// by listClause so both stores return identical pages.
+func pageItems[T any](items []*T, meta func(*T) listMeta, opts ListOptions) ([]*T, string, error) {
+	keys := opts.sortKeys()
+	var after *listMeta
+	if opts.Continue != "" {
+		m, err := decodeCursor(opts.Continue, keys)
+		if err != nil {
+			return nil, "", err
+		}
+		after = &m
+	}
+	out := make([]*T, 0, len(items))
+	for _, item := range items {
+		m := meta(item)
+		if opts.Selector != nil && !opts.Selector.Matches(labels.Set(m.Labels)) {
+			continue
+		}
+		if after != nil && compareMeta(m, *after, keys) <= 0 {
+			continue
+		}
+		out = append(out, item)
+	}
+	sort.Slice(out, func(i, j int) bool { return compareMeta(meta(out[i]), meta(out[j]), keys) < 0 })
+	if opts.Limit > 0 && len(out) > opts.Limit {
+		out = out[:opts.Limit]
+		return out, encodeCursor(keys, meta(out[len(out)-1])), nil
+	}
+	return out, "", nil
+}
+
+// sqlArgs collects positional arguments while a query is being assembled.
+type sqlArgs []any
+
+func (a *sqlArgs) add(v any) string {
+	*a = append(*a, v)
+	return fmt.Sprintf("$%d", len(*a))
+}
+
+// listClause renders the label selector, keyset condition, ORDER BY and LIMIT
+// for a list query. Filters already in where are kept. One extra row is
+// fetched so the caller can tell whether another page exists.
+func listClause(where []string, args *sqlArgs, opts ListOptions) (string, error) {
+	keys := opts.sortKeys()
+	if opts.Selector != nil {
+		reqs, _ := opts.Selector.Requirements()
+		for _, req := range reqs {
+			cond, err := selectorCondition(req, args)
+			if err != nil {
+				return "", err
+			}
+			where = append(where, cond)
+		}
+	}
+	if opts.Continue != "" {
+		after, err := decodeCursor(opts.Continue, keys)
+		if err != nil {
+			return "", err
+		}
+		where = append(where, keysetCondition(keys, after, args))
+	}
+	var b strings.Builder
+	if len(where) > 0 {
+		b.WriteString(" WHERE ")
+		b.WriteString(strings.Join(where, " AND "))
+	}
+	b.WriteString(" ORDER BY ")
+	for _, k := range keys {
+		b.WriteString(sortColumns[k.Field])
+		if k.Desc {
+			b.WriteString(" DESC")
+		}
+		b.WriteString(", ")
+	}
+	b.WriteString("id")
+	if opts.Limit > 0 {
+		b.WriteString(" LIMIT " + args.add(opts.Limit+1))
+	}
+	return b.String(), nil
+}
+
+// keysetCondition selects rows strictly after the cursor:
+// (k1 > v1) OR (k1 = v1 AND k2 > v2) OR ... OR (k1 = v1 AND ... AND id > vid).
+func keysetCondition(keys []SortKey, after listMeta, args *sqlArgs) string {
+	var (
+		ors    []string
+		prefix []string
+	)
+	for _, k := range keys {
+		col := sortColumns[k.Field]
+		var v string
+		switch k.Field {
+		case SortName:
+			v = args.add(after.Name)
+		case SortCreatedAt:
+			v = args.add(after.CreatedAt)
+		case SortUpdatedAt:
+			v = args.add(after.UpdatedAt)
+		}
+		op := ">"
+		if k.Desc {
+			op = "<"
+		}
+		ors = append(ors, "("+strings.Join(append(append([]string{}, prefix...), col+" "+op+" "+v), " AND ")+")")
+		prefix = append(prefix, col+" = "+v)
+	}
+	id := args.add(after.ID)
+	ors = append(ors, "("+strings.Join(append(prefix, "id > "+id+"::uuid"), " AND ")+")")
+	return "(" + strings.Join(ors, " OR ") + ")"
+}
+
+// selectorCondition matches one selector requirement against the labels in
+// the JSONB payload, following Kubernetes semantics: != and notin also match
+// items that lack the label. Equality uses containment so the GIN index on
+// the labels applies.
+func selectorCondition(req labels.Requirement, args *sqlArgs) (string, error) {
+	key := args.add(req.Key())
+	contains := func() string {
+		vals := req.Values().List()
+		ors := make([]string, 0, len(vals))
+		for _, v := range vals {
+			ors = append(ors, "payload->'labels' @> jsonb_build_object("+key+"::text, "+args.add(v)+"::text)")
+		}
+		return "(" + strings.Join(ors, " OR ") + ")"
+	}
+	switch req.Operator() {
+	case selection.Equals, selection.DoubleEquals, selection.In:
+		return contains(), nil
+	case selection.NotEquals, selection.NotIn:
+		return "NOT COALESCE(" + contains() + ", false)", nil
+	case selection.Exists:
+		return "(payload->'labels'->>" + key + "::text) IS NOT NULL", nil
+	case selection.DoesNotExist:
+		return "(payload->'labels'->>" + key + "::text) IS NULL", nil
+	default:
+		return "", fmt.Errorf("%w: operator %s is not supported", ErrInvalidList, req.Operator())
+	}
+}
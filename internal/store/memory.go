@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -16,15 +17,47 @@ type memoryStore struct {
 	tenants  map[string]*types.Tenant
 	projects map[string]*types.Project
 	apps     map[string]*types.App
+	plans    map[string]*types.Plan
+	usage    []*types.UsageRecord
+	rollups  map[string]*usageRollup
+	idem     map[string]*IdempotencyRecord
+	audit    []*types.AuditEvent
+	runs     map[string]*types.WorkflowRun
+	events   []*types.Event
+	eventSeq int64
+	webhooks map[string]*types.WebhookSubscription
+	// deliveries are kept in creation order.
+	deliveries []*types.WebhookDelivery
+	operations map[string]*types.Operation
+	apiKeys    map[string]*types.APIKey
+	revoked    map[string]*types.RevokedToken
+	health     map[string]*types.ClusterHealth
+	leases     map[string]lease
+}
+
+// lease is who holds a named lease and until when.
+type lease struct {
+	holder string
+	until  time.Time
 }
 
 // NewMemoryStore returns an in-memory Store suitable for development and tests.
 func NewMemoryStore() Store {
 	return &memoryStore{
-		clusters: make(map[string]*types.Cluster),
-		tenants:  make(map[string]*types.Tenant),
-		projects: make(map[string]*types.Project),
-		apps:     make(map[string]*types.App),
+		clusters:   make(map[string]*types.Cluster),
+		tenants:    make(map[string]*types.Tenant),
+		projects:   make(map[string]*types.Project),
+		apps:       make(map[string]*types.App),
+		plans:      make(map[string]*types.Plan),
+		rollups:    make(map[string]*usageRollup),
+		idem:       make(map[string]*IdempotencyRecord),
+		runs:       make(map[string]*types.WorkflowRun),
+		webhooks:   make(map[string]*types.WebhookSubscription),
+		operations: make(map[string]*types.Operation),
+		apiKeys:    make(map[string]*types.APIKey),
+		revoked:    make(map[string]*types.RevokedToken),
+		health:     make(map[string]*types.ClusterHealth),
+		leases:     make(map[string]lease),
 	}
 }
 
@@ -41,14 +74,14 @@ func (m *memoryStore) CreateCluster(ctx context.Context, c *types.Cluster) error
 	return nil
 }
 
-func (m *memoryStore) ListClusters(ctx context.Context) ([]*types.Cluster, error) {
+func (m *memoryStore) ListClusters(ctx context.Context, opts ListOptions) ([]*types.Cluster, string, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	out := make([]*types.Cluster, 0, len(m.clusters))
 	for _, c := range m.clusters {
-		out = append(out, clone(c))
+		out = append(out, c)
 	}
-	return out, nil
+	return clonePage(pageItems(out, clusterMeta, opts))
 }
 
 func (m *memoryStore) GetCluster(ctx context.Context, id string) (*types.Cluster, error) {
@@ -68,6 +101,7 @@ func (m *memoryStore) DeleteCluster(ctx context.Context, id string) error {
 		return ErrNotFound
 	}
 	delete(m.clusters, id)
+	delete(m.health, id)
 	for tid, t := range m.tenants {
 		if t.ClusterID == id {
 			delete(m.tenants, tid)
@@ -83,6 +117,12 @@ func (m *memoryStore) DeleteCluster(ctx context.Context, id string) error {
 			delete(m.apps, aid)
 		}
 	}
+	m.usage = filterUsage(m.usage, func(u *types.UsageRecord) bool { return u.ClusterID != id })
+	for key, r := range m.rollups {
+		if r.ClusterID == id {
+			delete(m.rollups, key)
+		}
+	}
 	return nil
 }
 
@@ -97,6 +137,10 @@ func (m *memoryStore) UpdateCluster(ctx context.Context, c *types.Cluster) error
 	if !ok {
 		return ErrNotFound
 	}
+	if c.ResourceVersion != cur.ResourceVersion {
+		return ErrVersionConflict
+	}
+	c.ResourceVersion++
 	c.CreatedAt = cur.CreatedAt
 	m.clusters[c.ID] = clone(c)
 	return nil
@@ -114,20 +158,35 @@ func (m *memoryStore) CreateTenant(ctx context.Context, t *types.Tenant) error {
 			return ErrConflict
 		}
 	}
+	if err := m.checkPlan(t.Plan, ""); err != nil {
+		return err
+	}
 	m.tenants[t.ID] = clone(t)
 	return nil
 }
 
-func (m *memoryStore) ListTenants(ctx context.Context, clusterID string) ([]*types.Tenant, error) {
+// checkPlan rejects a tenant moving from current onto a plan that is not in
+// the catalog. The caller holds the lock.
+func (m *memoryStore) checkPlan(plan, current string) error {
+	if plan == "" || plan == current {
+		return nil
+	}
+	if _, ok := m.plans[plan]; !ok {
+		return fmt.Errorf("%w %q", ErrUnknownPlan, plan)
+	}
+	return nil
+}
+
+func (m *memoryStore) ListTenants(ctx context.Context, clusterID string, opts ListOptions) ([]*types.Tenant, string, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	out := []*types.Tenant{}
 	for _, t := range m.tenants {
 		if clusterID == "" || t.ClusterID == clusterID {
-			out = append(out, clone(t))
+			out = append(out, t)
 		}
 	}
-	return out, nil
+	return clonePage(pageItems(out, tenantMeta, opts))
 }
 
 func (m *memoryStore) GetTenant(ctx context.Context, clusterID, tenantID string) (*types.Tenant, error) {
@@ -140,6 +199,10 @@ func (m *memoryStore) GetTenant(ctx context.Context, clusterID, tenantID string)
 	return clone(t), nil
 }
 
+func (m *memoryStore) GetTenantByID(ctx context.Context, tenantID string) (*types.Tenant, error) {
+	return m.GetTenant(ctx, "", tenantID)
+}
+
 func (m *memoryStore) UpdateTenant(ctx context.Context, t *types.Tenant) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -150,6 +213,13 @@ func (m *memoryStore) UpdateTenant(ctx context.Context, t *types.Tenant) error {
 	if cur.ClusterID != t.ClusterID {
 		return errors.New("cluster mismatch")
 	}
+	if t.ResourceVersion != cur.ResourceVersion {
+		return ErrVersionConflict
+	}
+	if err := m.checkPlan(t.Plan, cur.Plan); err != nil {
+		return err
+	}
+	t.ResourceVersion++
 	t.CreatedAt = cur.CreatedAt
 	if t.UpdatedAt.IsZero() {
 		t.UpdatedAt = time.Now().UTC()
@@ -196,16 +266,16 @@ func (m *memoryStore) CreateProject(ctx context.Context, p *types.Project) error
 	return nil
 }
 
-func (m *memoryStore) ListProjects(ctx context.Context, clusterID, tenantID string) ([]*types.Project, error) {
+func (m *memoryStore) ListProjects(ctx context.Context, clusterID, tenantID string, opts ListOptions) ([]*types.Project, string, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	out := []*types.Project{}
 	for _, p := range m.projects {
 		if (clusterID == "" || p.ClusterID == clusterID) && (tenantID == "" || p.TenantID == tenantID) {
-			out = append(out, clone(p))
+			out = append(out, p)
 		}
 	}
-	return out, nil
+	return clonePage(pageItems(out, projectMeta, opts))
 }
 
 func (m *memoryStore) GetProject(ctx context.Context, clusterID, tenantID, projectID string) (*types.Project, error) {
@@ -218,6 +288,10 @@ func (m *memoryStore) GetProject(ctx context.Context, clusterID, tenantID, proje
 	return clone(p), nil
 }
 
+func (m *memoryStore) GetProjectByID(ctx context.Context, projectID string) (*types.Project, error) {
+	return m.GetProject(ctx, "", "", projectID)
+}
+
 func (m *memoryStore) UpdateProject(ctx context.Context, p *types.Project) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -228,6 +302,10 @@ func (m *memoryStore) UpdateProject(ctx context.Context, p *types.Project) error
 	if cur.ClusterID != p.ClusterID || cur.TenantID != p.TenantID {
 		return errors.New("parent mismatch")
 	}
+	if p.ResourceVersion != cur.ResourceVersion {
+		return ErrVersionConflict
+	}
+	p.ResourceVersion++
 	p.CreatedAt = cur.CreatedAt
 	if p.UpdatedAt.IsZero() {
 		p.UpdatedAt = time.Now().UTC()
@@ -269,16 +347,28 @@ func (m *memoryStore) CreateApp(ctx context.Context, a *types.App) error {
 	return nil
 }
 
-func (m *memoryStore) ListApps(ctx context.Context, clusterID, tenantID, projectID string) ([]*types.App, error) {
+func (m *memoryStore) ListApps(ctx context.Context, clusterID, tenantID, projectID string, opts ListOptions) ([]*types.App, string, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 	out := []*types.App{}
 	for _, a := range m.apps {
 		if (clusterID == "" || a.ClusterID == clusterID) && (tenantID == "" || a.TenantID == tenantID) && (projectID == "" || a.ProjectID == projectID) {
-			out = append(out, clone(a))
+			out = append(out, a)
 		}
 	}
-	return out, nil
+	return clonePage(pageItems(out, appMeta, opts))
+}
+
+// clonePage copies a page of stored items; only the items that are returned
+// are cloned.
+func clonePage[T any](items []*T, next string, err error) ([]*T, string, error) {
+	if err != nil {
+		return nil, "", err
+	}
+	for i, item := range items {
+		items[i] = clone(item)
+	}
+	return items, next, nil
 }
 
 func (m *memoryStore) GetApp(ctx context.Context, clusterID, tenantID, projectID, appID string) (*types.App, error) {
@@ -301,6 +391,10 @@ func (m *memoryStore) UpdateApp(ctx context.Context, a *types.App) error {
 	if cur.ClusterID != a.ClusterID || cur.TenantID != a.TenantID || cur.ProjectID != a.ProjectID {
 		return errors.New("parent mismatch")
 	}
+	if a.ResourceVersion != cur.ResourceVersion {
+		return ErrVersionConflict
+	}
+	a.ResourceVersion++
 	a.CreatedAt = cur.CreatedAt
 	if a.UpdatedAt.IsZero() {
 		a.UpdatedAt = time.Now().UTC()
@@ -323,5 +417,705 @@ func (m *memoryStore) DeleteApp(ctx context.Context, clusterID, tenantID, projec
 		return ErrNotFound
 	}
 	delete(m.apps, appID)
+	for id, run := range m.runs {
+		if run.AppID == appID {
+			delete(m.runs, id)
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) CreatePlan(ctx context.Context, p *types.Plan) error {
+	assignPlanID(p)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.plans[p.Name]; ok {
+		return ErrConflict
+	}
+	m.plans[p.Name] = clone(p)
+	return nil
+}
+
+func (m *memoryStore) ListPlans(ctx context.Context) ([]*types.Plan, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make([]*types.Plan, 0, len(m.plans))
+	for _, p := range m.plans {
+		out = append(out, clone(p))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out, nil
+}
+
+func (m *memoryStore) GetPlan(ctx context.Context, name string) (*types.Plan, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	p, ok := m.plans[name]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return clone(p), nil
+}
+
+func (m *memoryStore) UpdatePlan(ctx context.Context, p *types.Plan) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cur, ok := m.plans[p.Name]
+	if !ok {
+		return ErrNotFound
+	}
+	p.ID = cur.ID
+	p.CreatedAt = cur.CreatedAt
+	p.UpdatedAt = time.Now().UTC()
+	m.plans[p.Name] = clone(p)
+	return nil
+}
+
+func (m *memoryStore) DeletePlan(ctx context.Context, name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.plans[name]; !ok {
+		return ErrNotFound
+	}
+	for _, t := range m.tenants {
+		if t.Plan == name {
+			return fmt.Errorf("%w: assigned to tenant %s", ErrPlanInUse, t.Name)
+		}
+	}
+	delete(m.plans, name)
+	return nil
+}
+
+func (m *memoryStore) RecordUsage(ctx context.Context, u *types.UsageRecord) error {
+	if u.LastReportedAt.IsZero() {
+		u.LastReportedAt = time.Now().UTC()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.usage = append(m.usage, clone(u))
+	for _, step := range rollupSteps {
+		r := newUsageRollup(u, step)
+		key := rollupKey(u.TenantID, u.ProjectID, step, r.Start)
+		if existing, ok := m.rollups[key]; ok {
+			r = existing
+		} else {
+			m.rollups[key] = r
+		}
+		r.add(u)
+	}
+	return nil
+}
+
+func (m *memoryStore) LatestUsage(ctx context.Context, tenantID, projectID string) (*types.UsageRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var latest *types.UsageRecord
+	for _, u := range m.usage {
+		if u.TenantID != tenantID || u.ProjectID != projectID {
+			continue
+		}
+		if latest == nil || !u.LastReportedAt.Before(latest.LastReportedAt) {
+			latest = u
+		}
+	}
+	if latest == nil {
+		return nil, ErrNotFound
+	}
+	return clone(latest), nil
+}
+
+func filterUsage(in []*types.UsageRecord, keep func(*types.UsageRecord) bool) []*types.UsageRecord {
+	out := in[:0]
+	for _, u := range in {
+		if keep(u) {
+			out = append(out, u)
+		}
+	}
+	return out
+}
+
+func (m *memoryStore) ListUsage(ctx context.Context, q UsageQuery) ([]*types.UsageRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := []*types.UsageRecord{}
+	if q.Step == UsageStepRaw {
+		for _, u := range m.usage {
+			if u.TenantID != q.TenantID || u.ProjectID != q.ProjectID {
+				continue
+			}
+			if u.LastReportedAt.Before(q.From) || !u.LastReportedAt.Before(q.To) {
+				continue
+			}
+			out = append(out, clone(u))
+		}
+		sort.Slice(out, func(i, j int) bool { return out[i].LastReportedAt.Before(out[j].LastReportedAt) })
+	} else {
+		from := UsageBucketStart(q.From, q.Step)
+		for _, r := range m.rollups {
+			if r.TenantID != q.TenantID || r.ProjectID != q.ProjectID || r.Step != q.Step {
+				continue
+			}
+			if r.Start.Before(from) || !r.Start.Before(q.To) {
+				continue
+			}
+			out = append(out, r.record())
+		}
+		sort.Slice(out, func(i, j int) bool { return out[i].BucketStart.Before(out[j].BucketStart) })
+	}
+	if len(out) > maxUsagePoints {
+		out = out[:maxUsagePoints]
+	}
+	return out, nil
+}
+
+func (m *memoryStore) ListTenantUsage(ctx context.Context, clusterID string, from, to time.Time) ([]*TenantUsage, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	from = UsageBucketStart(from, UsageStepHour)
+	var rollups []*usageRollup
+	for _, r := range m.rollups {
+		if r.Step != UsageStepHour || r.ProjectID != "" || (clusterID != "" && r.ClusterID != clusterID) {
+			continue
+		}
+		if r.Start.Before(from) || !r.Start.Before(to) {
+			continue
+		}
+		rollups = append(rollups, r)
+	}
+	sort.Slice(rollups, func(i, j int) bool {
+		if rollups[i].TenantID != rollups[j].TenantID {
+			return rollups[i].TenantID < rollups[j].TenantID
+		}
+		return rollups[i].Start.Before(rollups[j].Start)
+	})
+	return tenantUsage(rollups), nil
+}
+
+func (m *memoryStore) PruneUsage(ctx context.Context, step string, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var removed int64
+	if step == UsageStepRaw {
+		n := len(m.usage)
+		m.usage = filterUsage(m.usage, func(u *types.UsageRecord) bool { return !u.LastReportedAt.Before(before) })
+		return int64(n - len(m.usage)), nil
+	}
+	for key, r := range m.rollups {
+		if r.Step == step && r.Start.Before(before) {
+			delete(m.rollups, key)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+func rollupKey(tenantID, projectID, step string, start time.Time) string {
+	return tenantID + "|" + projectID + "|" + step + "|" + start.Format(time.RFC3339)
+}
+
+func (m *memoryStore) ReserveIdempotencyKey(ctx context.Context, rec *IdempotencyRecord) (*IdempotencyRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if existing, ok := m.idem[rec.Key]; ok && existing.ExpiresAt.After(time.Now()) {
+		return clone(existing), nil
+	}
+	rec.Status = 0
+	m.idem[rec.Key] = clone(rec)
+	return nil, nil
+}
+
+func (m *memoryStore) CompleteIdempotencyKey(ctx context.Context, rec *IdempotencyRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.idem[rec.Key]; !ok {
+		return ErrNotFound
+	}
+	m.idem[rec.Key] = clone(rec)
+	return nil
+}
+
+func (m *memoryStore) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.idem, key)
+	return nil
+}
+
+func (m *memoryStore) PruneIdempotencyKeys(ctx context.Context, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var removed int64
+	for key, rec := range m.idem {
+		if rec.ExpiresAt.Before(before) {
+			delete(m.idem, key)
+			removed++
+		}
+	}
+	return removed, nil
+}
+
+func (m *memoryStore) RecordAudit(ctx context.Context, e *types.AuditEvent) error {
+	assignAuditID(e)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.audit = append(m.audit, clone(e))
 	return nil
 }
+
+func (m *memoryStore) ListAudit(ctx context.Context, q AuditQuery) ([]*types.AuditEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := []*types.AuditEvent{}
+	for i := len(m.audit) - 1; i >= 0 && len(out) < q.limit(); i-- {
+		if q.matches(m.audit[i]) {
+			out = append(out, clone(m.audit[i]))
+		}
+	}
+	return out, nil
+}
+
+func (m *memoryStore) CreateWorkflowRun(ctx context.Context, r *types.WorkflowRun) error {
+	assignWorkflowRunID(r)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.runs[r.ID]; ok {
+		return ErrConflict
+	}
+	m.runs[r.ID] = clone(r)
+	return nil
+}
+
+func (m *memoryStore) GetWorkflowRun(ctx context.Context, id string) (*types.WorkflowRun, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	r, ok := m.runs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return clone(r), nil
+}
+
+func (m *memoryStore) UpdateWorkflowRun(ctx context.Context, r *types.WorkflowRun) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.runs[r.ID]; !ok {
+		return ErrNotFound
+	}
+	m.runs[r.ID] = clone(r)
+	return nil
+}
+
+func (m *memoryStore) ListWorkflowRuns(ctx context.Context, q WorkflowRunQuery) ([]*types.WorkflowRun, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := []*types.WorkflowRun{}
+	for _, r := range m.runs {
+		if q.matches(r) {
+			out = append(out, clone(r))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].StartedAt.Equal(out[j].StartedAt) {
+			return out[i].StartedAt.After(out[j].StartedAt)
+		}
+		return out[i].ID > out[j].ID
+	})
+	return out, nil
+}
+
+func (m *memoryStore) AppendEvent(ctx context.Context, e *types.Event) error {
+	stampEvent(e)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.eventSeq++
+	e.ID = m.eventSeq
+	m.events = append(m.events, clone(e))
+	return nil
+}
+
+func (m *memoryStore) ListEvents(ctx context.Context, q EventQuery) ([]*types.Event, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	i := sort.Search(len(m.events), func(i int) bool { return m.events[i].ID > q.After })
+	out := []*types.Event{}
+	for ; i < len(m.events) && len(out) < q.limit(); i++ {
+		out = append(out, clone(m.events[i]))
+	}
+	return out, nil
+}
+
+func (m *memoryStore) LatestEventID(ctx context.Context) (int64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.eventSeq, nil
+}
+
+func (m *memoryStore) PruneEvents(ctx context.Context, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kept := m.events[:0]
+	for _, e := range m.events {
+		if e.Time.Before(before) {
+			continue
+		}
+		kept = append(kept, e)
+	}
+	removed := int64(len(m.events) - len(kept))
+	m.events = kept
+	return removed, nil
+}
+
+func (m *memoryStore) CreateWebhook(ctx context.Context, w *types.WebhookSubscription) error {
+	assignWebhookID(w)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.webhooks[w.ID]; ok {
+		return ErrConflict
+	}
+	m.webhooks[w.ID] = clone(w)
+	return nil
+}
+
+func (m *memoryStore) GetWebhook(ctx context.Context, id string) (*types.WebhookSubscription, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	w, ok := m.webhooks[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return clone(w), nil
+}
+
+func (m *memoryStore) ListWebhooks(ctx context.Context) ([]*types.WebhookSubscription, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make([]*types.WebhookSubscription, 0, len(m.webhooks))
+	for _, w := range m.webhooks {
+		out = append(out, clone(w))
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].ID < out[j].ID
+		}
+		return out[i].CreatedAt.Before(out[j].CreatedAt)
+	})
+	return out, nil
+}
+
+func (m *memoryStore) UpdateWebhook(ctx context.Context, w *types.WebhookSubscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cur, ok := m.webhooks[w.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	w.CreatedAt = cur.CreatedAt
+	w.UpdatedAt = time.Now().UTC()
+	m.webhooks[w.ID] = clone(w)
+	return nil
+}
+
+func (m *memoryStore) DeleteWebhook(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.webhooks[id]; !ok {
+		return ErrNotFound
+	}
+	delete(m.webhooks, id)
+	kept := m.deliveries[:0]
+	for _, d := range m.deliveries {
+		if d.SubscriptionID != id {
+			kept = append(kept, d)
+		}
+	}
+	m.deliveries = kept
+	return nil
+}
+
+func (m *memoryStore) CreateWebhookDelivery(ctx context.Context, d *types.WebhookDelivery) error {
+	assignWebhookDeliveryID(d)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.webhooks[d.SubscriptionID]; !ok {
+		return ErrNotFound
+	}
+	m.deliveries = append(m.deliveries, clone(d))
+	return nil
+}
+
+func (m *memoryStore) UpdateWebhookDelivery(ctx context.Context, d *types.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, cur := range m.deliveries {
+		if cur.ID == d.ID {
+			m.deliveries[i] = clone(d)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (m *memoryStore) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*types.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var claimed []*types.WebhookDelivery
+	until := now.Add(lease)
+	for _, d := range m.deliveries {
+		if len(claimed) == limit {
+			break
+		}
+		if due(d, now) {
+			d.NextAttemptAt = &until
+			claimed = append(claimed, clone(d))
+		}
+	}
+	return claimed, nil
+}
+
+func (m *memoryStore) ListWebhookDeliveries(ctx context.Context, q WebhookDeliveryQuery) ([]*types.WebhookDelivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := []*types.WebhookDelivery{}
+	for i := len(m.deliveries) - 1; i >= 0 && len(out) < q.limit(); i-- {
+		if q.matches(m.deliveries[i]) {
+			out = append(out, clone(m.deliveries[i]))
+		}
+	}
+	return out, nil
+}
+
+func (m *memoryStore) PruneWebhookDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	kept := m.deliveries[:0]
+	var removed int64
+	for _, d := range m.deliveries {
+		if d.Status != types.WebhookDeliveryPending && d.CreatedAt.Before(before) {
+			removed++
+			continue
+		}
+		kept = append(kept, d)
+	}
+	m.deliveries = kept
+	return removed, nil
+}
+
+func (m *memoryStore) CreateOperation(ctx context.Context, o *types.Operation) error {
+	assignOperationID(o)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.operations[o.ID]; ok {
+		return ErrConflict
+	}
+	if !o.Finished() {
+		for _, cur := range m.operations {
+			if cur.ClusterID == o.ClusterID && !cur.Finished() {
+				return ErrConflict
+			}
+		}
+	}
+	m.operations[o.ID] = clone(o)
+	return nil
+}
+
+func (m *memoryStore) GetOperation(ctx context.Context, id string) (*types.Operation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	o, ok := m.operations[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return clone(o), nil
+}
+
+func (m *memoryStore) UpdateOperation(ctx context.Context, o *types.Operation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cur, ok := m.operations[o.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if cur.LeaseGeneration != o.LeaseGeneration {
+		return ErrLeaseLost
+	}
+	o.CreatedAt = cur.CreatedAt
+	o.UpdatedAt = time.Now().UTC()
+	m.operations[o.ID] = clone(o)
+	return nil
+}
+
+func (m *memoryStore) ListOperations(ctx context.Context, q OperationQuery) ([]*types.Operation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := []*types.Operation{}
+	for _, o := range m.operations {
+		if q.matches(o) {
+			out = append(out, clone(o))
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].CreatedAt.After(out[j].CreatedAt)
+		}
+		return out[i].ID > out[j].ID
+	})
+	if len(out) > q.limit() {
+		out = out[:q.limit()]
+	}
+	return out, nil
+}
+
+func (m *memoryStore) ClaimOperations(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*types.Operation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var claimed []*types.Operation
+	until := now.Add(lease)
+	for _, o := range m.operations {
+		if len(claimed) == limit {
+			break
+		}
+		if resumable(o, now) {
+			o.LeaseExpiresAt = &until
+			o.LeaseGeneration++
+			claimed = append(claimed, clone(o))
+		}
+	}
+	return claimed, nil
+}
+
+func (m *memoryStore) CreateAPIKey(ctx context.Context, k *types.APIKey) error {
+	assignAPIKeyID(k)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.apiKeys[k.ID]; ok {
+		return ErrConflict
+	}
+	m.apiKeys[k.ID] = clone(k)
+	return nil
+}
+
+func (m *memoryStore) GetAPIKey(ctx context.Context, id string) (*types.APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	k, ok := m.apiKeys[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return clone(k), nil
+}
+
+func (m *memoryStore) ListAPIKeys(ctx context.Context) ([]*types.APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make([]*types.APIKey, 0, len(m.apiKeys))
+	for _, k := range m.apiKeys {
+		out = append(out, clone(k))
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].CreatedAt.Equal(out[j].CreatedAt) {
+			return out[i].ID < out[j].ID
+		}
+		return out[i].CreatedAt.Before(out[j].CreatedAt)
+	})
+	return out, nil
+}
+
+func (m *memoryStore) UpdateAPIKey(ctx context.Context, k *types.APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cur, ok := m.apiKeys[k.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	k.CreatedAt = cur.CreatedAt
+	k.UpdatedAt = time.Now().UTC()
+	m.apiKeys[k.ID] = clone(k)
+	return nil
+}
+
+func (m *memoryStore) TouchAPIKey(ctx context.Context, id string, at time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	k, ok := m.apiKeys[id]
+	if !ok {
+		return ErrNotFound
+	}
+	at = at.UTC()
+	k.LastUsedAt = &at
+	return nil
+}
+
+func (m *memoryStore) RevokeToken(ctx context.Context, t *types.RevokedToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.revoked[t.JTI]; !ok {
+		m.revoked[t.JTI] = clone(t)
+	}
+	return nil
+}
+
+func (m *memoryStore) TokenRevoked(ctx context.Context, jti string) (bool, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.revoked[jti]
+	return ok, nil
+}
+
+func (m *memoryStore) ListRevokedTokens(ctx context.Context) ([]*types.RevokedToken, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	out := make([]*types.RevokedToken, 0, len(m.revoked))
+	for _, t := range m.revoked {
+		out = append(out, clone(t))
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].RevokedAt.Equal(out[j].RevokedAt) {
+			return out[i].JTI > out[j].JTI
+		}
+		return out[i].RevokedAt.After(out[j].RevokedAt)
+	})
+	return out, nil
+}
+
+func (m *memoryStore) PruneRevokedTokens(ctx context.Context, before time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var n int64
+	for jti, t := range m.revoked {
+		if t.ExpiresAt != nil && t.ExpiresAt.Before(before) {
+			delete(m.revoked, jti)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *memoryStore) SaveClusterHealth(ctx context.Context, h *types.ClusterHealth) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.clusters[h.ClusterID]; !ok {
+		return ErrNotFound
+	}
+	m.health[h.ClusterID] = clone(h)
+	return nil
+}
+
+func (m *memoryStore) GetClusterHealth(ctx context.Context, clusterID string) (*types.ClusterHealth, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	h, ok := m.health[clusterID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return clone(h), nil
+}
+
+func (m *memoryStore) AcquireLease(ctx context.Context, name, holder string, now time.Time, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if l, ok := m.leases[name]; ok && l.holder != holder && l.until.After(now) {
+		return false, nil
+	}
+	m.leases[name] = lease{holder: holder, until: now.Add(ttl)}
+	return true, nil
+}
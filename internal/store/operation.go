@@ -0,0 +1,60 @@
+package store
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vaheed/kubenova/pkg/types"
+)
+
+// Page sizes for ListOperations.
+const (
+	DefaultOperationLimit = 100
+	MaxOperationLimit     = 1000
+)
+
+// OperationQuery filters operations. Empty fields match everything.
+type OperationQuery struct {
+	ClusterID string
+	Phase     string
+	// Active limits the result to operations that have not finished.
+	Active bool
+	Limit  int
+}
+
+func (q OperationQuery) limit() int {
+	if q.Limit <= 0 {
+		return DefaultOperationLimit
+	}
+	if q.Limit > MaxOperationLimit {
+		return MaxOperationLimit
+	}
+	return q.Limit
+}
+
+func (q OperationQuery) matches(o *types.Operation) bool {
+	switch {
+	case q.ClusterID != "" && o.ClusterID != q.ClusterID,
+		q.Phase != "" && o.Phase != q.Phase,
+		q.Active && o.Finished():
+		return false
+	}
+	return true
+}
+
+func assignOperationID(o *types.Operation) {
+	now := time.Now().UTC()
+	if o.ID == "" {
+		o.ID = uuid.NewString()
+	}
+	if o.CreatedAt.IsZero() {
+		o.CreatedAt = now
+	}
+	o.UpdatedAt = now
+}
+
+// resumable reports whether an unfinished operation has no manager working on
+// it at now.
+func resumable(o *types.Operation, now time.Time) bool {
+	return !o.Finished() && (o.LeaseExpiresAt == nil || !o.LeaseExpiresAt.After(now))
+}
@@ -101,31 +101,14 @@ func (p *postgresStore) CreateCluster(ctx context.Context, c *types.Cluster) err
 		return err
 	}
 	_, err = p.db.ExecContext(ctx, `
-		INSERT INTO clusters (id, name, payload, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5)
-	`, c.ID, c.Name, payload, c.CreatedAt, c.UpdatedAt)
+		INSERT INTO clusters (id, name, payload, created_at, updated_at, version)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, c.ID, c.Name, payload, c.CreatedAt, c.UpdatedAt, c.ResourceVersion)
 	return handleSQLError(err)
 }
 
-func (p *postgresStore) ListClusters(ctx context.Context) ([]*types.Cluster, error) {
-	rows, err := p.db.QueryContext(ctx, `SELECT payload FROM clusters ORDER BY created_at`)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var out []*types.Cluster
-	for rows.Next() {
-		var raw []byte
-		if err := rows.Scan(&raw); err != nil {
-			return nil, err
-		}
-		var c types.Cluster
-		if err := unmarshalPayload(raw, &c); err != nil {
-			return nil, err
-		}
-		out = append(out, &c)
-	}
-	return out, rows.Err()
+func (p *postgresStore) ListClusters(ctx context.Context, opts ListOptions) ([]*types.Cluster, string, error) {
+	return listRows(ctx, p.db, "clusters", nil, nil, opts, clusterMeta)
 }
 
 func (p *postgresStore) GetCluster(ctx context.Context, id string) (*types.Cluster, error) {
@@ -142,7 +125,15 @@ func (p *postgresStore) GetCluster(ctx context.Context, id string) (*types.Clust
 }
 
 func (p *postgresStore) DeleteCluster(ctx context.Context, id string) error {
-	_, err := p.db.ExecContext(ctx, `DELETE FROM apps WHERE cluster_id=$1`, id)
+	_, err := p.db.ExecContext(ctx, `DELETE FROM usage_records WHERE cluster_id=$1`, id)
+	if err != nil {
+		return err
+	}
+	_, err = p.db.ExecContext(ctx, `DELETE FROM usage_rollups WHERE cluster_id=$1`, id)
+	if err != nil {
+		return err
+	}
+	_, err = p.db.ExecContext(ctx, `DELETE FROM apps WHERE cluster_id=$1`, id)
 	if err != nil {
 		return err
 	}
@@ -165,6 +156,43 @@ func (p *postgresStore) DeleteCluster(ctx context.Context, id string) error {
 	return nil
 }
 
+// sqlQuerier is the part of *sql.DB and *sql.Tx that writes share.
+type sqlQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// updateVersioned writes a resource only if its stored version still equals
+// *version, bumping the version in the same statement. On failure *version is
+// left unchanged.
+func (p *postgresStore) updateVersioned(ctx context.Context, db sqlQuerier, table, id string, version *int64, render func() ([]byte, time.Time, error)) error {
+	expected := *version
+	*version = expected + 1
+	payload, updatedAt, err := render()
+	if err != nil {
+		*version = expected
+		return err
+	}
+	res, err := db.ExecContext(ctx, `UPDATE `+table+` SET payload=$1, updated_at=$2, version=$3 WHERE id=$4 AND version=$5`,
+		payload, updatedAt, *version, id, expected)
+	if err != nil {
+		*version = expected
+		return err
+	}
+	if aff, _ := res.RowsAffected(); aff > 0 {
+		return nil
+	}
+	*version = expected
+	var exists bool
+	if err := db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM `+table+` WHERE id=$1)`, id).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return ErrVersionConflict
+	}
+	return ErrNotFound
+}
+
 type migration struct {
 	ID  string
 	SQL string
@@ -211,6 +239,235 @@ CREATE TABLE IF NOT EXISTS apps (
 	updated_at TIMESTAMPTZ NOT NULL,
 	UNIQUE(project_id, name)
 );
+`,
+	},
+	{
+		ID: "0002_plans",
+		SQL: `
+CREATE TABLE IF NOT EXISTS plans (
+	id UUID PRIMARY KEY,
+	name TEXT UNIQUE NOT NULL,
+	payload JSONB NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL
+);
+`,
+	},
+	{
+		ID: "0003_usage_records",
+		SQL: `
+CREATE TABLE IF NOT EXISTS usage_records (
+	id BIGSERIAL PRIMARY KEY,
+	cluster_id UUID NOT NULL,
+	tenant_id UUID NOT NULL,
+	project_id UUID,
+	payload JSONB NOT NULL,
+	collected_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS usage_records_scope_idx ON usage_records (tenant_id, project_id, collected_at DESC);
+`,
+	},
+	{
+		ID: "0004_usage_rollups",
+		SQL: `
+CREATE TABLE IF NOT EXISTS usage_rollups (
+	tenant_id UUID NOT NULL,
+	project_id TEXT NOT NULL DEFAULT '',
+	step TEXT NOT NULL,
+	bucket_start TIMESTAMPTZ NOT NULL,
+	cluster_id UUID NOT NULL,
+	payload JSONB NOT NULL,
+	PRIMARY KEY (tenant_id, project_id, step, bucket_start)
+);
+CREATE INDEX IF NOT EXISTS usage_records_collected_idx ON usage_records (collected_at);
+CREATE INDEX IF NOT EXISTS usage_rollups_step_idx ON usage_rollups (step, bucket_start);
+`,
+	},
+	{
+		ID: "0005_list_indexes",
+		SQL: `
+CREATE INDEX IF NOT EXISTS clusters_created_idx ON clusters (created_at, id);
+CREATE INDEX IF NOT EXISTS tenants_cluster_created_idx ON tenants (cluster_id, created_at, id);
+CREATE INDEX IF NOT EXISTS projects_tenant_created_idx ON projects (tenant_id, created_at, id);
+CREATE INDEX IF NOT EXISTS apps_project_created_idx ON apps (project_id, created_at, id);
+CREATE INDEX IF NOT EXISTS clusters_labels_idx ON clusters USING GIN ((payload->'labels'));
+CREATE INDEX IF NOT EXISTS tenants_labels_idx ON tenants USING GIN ((payload->'labels'));
+CREATE INDEX IF NOT EXISTS projects_labels_idx ON projects USING GIN ((payload->'labels'));
+`,
+	},
+	{
+		ID: "0006_resource_versions",
+		SQL: `
+ALTER TABLE clusters ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE tenants ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE projects ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE apps ADD COLUMN IF NOT EXISTS version BIGINT NOT NULL DEFAULT 0;
+`,
+	},
+	{
+		ID: "0007_idempotency_keys",
+		SQL: `
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+	key TEXT PRIMARY KEY,
+	payload JSONB NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL
+);
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_idx ON idempotency_keys (expires_at);
+`,
+	},
+	{
+		ID: "0008_audit_events",
+		SQL: `
+CREATE TABLE IF NOT EXISTS audit_events (
+	id UUID PRIMARY KEY,
+	time TIMESTAMPTZ NOT NULL,
+	actor TEXT NOT NULL,
+	action TEXT NOT NULL,
+	resource TEXT NOT NULL,
+	cluster_id TEXT NOT NULL DEFAULT '',
+	tenant_id TEXT NOT NULL DEFAULT '',
+	payload JSONB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS audit_events_time_idx ON audit_events (time DESC);
+CREATE INDEX IF NOT EXISTS audit_events_actor_idx ON audit_events (actor, time DESC);
+CREATE INDEX IF NOT EXISTS audit_events_tenant_idx ON audit_events (tenant_id, time DESC);
+CREATE INDEX IF NOT EXISTS audit_events_resource_idx ON audit_events (resource text_pattern_ops);
+`,
+	},
+	{
+		// Runs used to live in the app payload with per-app IDs such as run-1.
+		// They are moved here under IDs prefixed with the app ID; runs still
+		// marked Running never executed and are closed as Canceled.
+		ID: "0009_workflow_runs",
+		SQL: `
+CREATE TABLE IF NOT EXISTS workflow_runs (
+	id TEXT PRIMARY KEY,
+	cluster_id UUID NOT NULL,
+	tenant_id UUID NOT NULL,
+	project_id UUID NOT NULL,
+	app_id UUID NOT NULL,
+	payload JSONB NOT NULL,
+	started_at TIMESTAMPTZ NOT NULL,
+	ended_at TIMESTAMPTZ
+);
+CREATE INDEX IF NOT EXISTS workflow_runs_app_idx ON workflow_runs (app_id, started_at DESC);
+CREATE INDEX IF NOT EXISTS workflow_runs_active_idx ON workflow_runs (started_at) WHERE ended_at IS NULL;
+INSERT INTO workflow_runs (id, cluster_id, tenant_id, project_id, app_id, payload, started_at, ended_at)
+SELECT a.id::text || '-' || (r->>'id'), a.cluster_id, a.tenant_id, a.project_id, a.id,
+	r || jsonb_build_object(
+		'id', a.id::text || '-' || (r->>'id'),
+		'clusterId', a.cluster_id,
+		'tenantId', a.tenant_id,
+		'projectId', a.project_id,
+		'status', CASE WHEN r->>'status' = 'Running' THEN 'Canceled' ELSE r->>'status' END,
+		'endedAt', COALESCE(r->'endedAt', to_jsonb(a.updated_at))
+	),
+	(r->>'startedAt')::timestamptz,
+	COALESCE((r->>'endedAt')::timestamptz, a.updated_at)
+FROM apps a, jsonb_array_elements(COALESCE(a.payload->'workflowRuns', '[]'::jsonb)) r
+ON CONFLICT (id) DO NOTHING;
+UPDATE apps SET payload = payload - 'workflowRuns' WHERE payload ? 'workflowRuns';
+`,
+	},
+	{
+		ID: "0010_events",
+		SQL: `
+CREATE TABLE IF NOT EXISTS events (
+	id BIGSERIAL PRIMARY KEY,
+	time TIMESTAMPTZ NOT NULL,
+	type TEXT NOT NULL,
+	payload JSONB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS events_time_idx ON events (time);
+`,
+	},
+	{
+		ID: "0011_webhooks",
+		SQL: `
+CREATE TABLE IF NOT EXISTS webhooks (
+	id UUID PRIMARY KEY,
+	payload JSONB NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL
+);
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+	id UUID PRIMARY KEY,
+	subscription_id UUID NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+	status TEXT NOT NULL,
+	next_attempt_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL,
+	payload JSONB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS webhook_deliveries_subscription_idx ON webhook_deliveries (subscription_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+`,
+	},
+	{
+		ID: "0012_operations",
+		SQL: `
+CREATE TABLE IF NOT EXISTS operations (
+	id UUID PRIMARY KEY,
+	cluster_id TEXT NOT NULL,
+	phase TEXT NOT NULL,
+	lease_expires_at TIMESTAMPTZ,
+	created_at TIMESTAMPTZ NOT NULL,
+	payload JSONB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS operations_cluster_idx ON operations (cluster_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS operations_unfinished_idx ON operations (lease_expires_at) WHERE phase IN ('Pending', 'Running');
+`,
+	},
+	{
+		ID: "0013_api_keys",
+		SQL: `
+CREATE TABLE IF NOT EXISTS api_keys (
+	id UUID PRIMARY KEY,
+	created_at TIMESTAMPTZ NOT NULL,
+	payload JSONB NOT NULL
+);
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+	jti TEXT PRIMARY KEY,
+	expires_at TIMESTAMPTZ,
+	revoked_at TIMESTAMPTZ NOT NULL,
+	payload JSONB NOT NULL
+);
+CREATE INDEX IF NOT EXISTS revoked_tokens_expires_idx ON revoked_tokens (expires_at);
+`,
+	},
+	{
+		ID: "0014_cluster_health",
+		SQL: `
+CREATE TABLE IF NOT EXISTS cluster_health (
+	cluster_id UUID PRIMARY KEY REFERENCES clusters(id) ON DELETE CASCADE,
+	payload JSONB NOT NULL
+);
+CREATE TABLE IF NOT EXISTS leases (
+	name TEXT PRIMARY KEY,
+	holder TEXT NOT NULL,
+	expires_at TIMESTAMPTZ NOT NULL
+);
+`,
+	},
+	{
+		ID: "0015_tenant_plans",
+		SQL: `
+CREATE INDEX IF NOT EXISTS tenants_plan_idx ON tenants ((payload->>'plan'));
+`,
+	},
+	{
+		// Only the newest unfinished operation of a cluster survives; older
+		// ones could only have been started by racing requests.
+		ID: "0016_operation_leases",
+		SQL: `
+ALTER TABLE operations ADD COLUMN IF NOT EXISTS lease_generation BIGINT NOT NULL DEFAULT 0;
+UPDATE operations o
+SET phase = 'Failed', lease_expires_at = NULL,
+	payload = (o.payload - 'leaseExpiresAt') || '{"phase": "Failed", "error": "superseded by another operation on the cluster"}'::jsonb
+WHERE o.phase IN ('Pending', 'Running') AND EXISTS (
+	SELECT 1 FROM operations n
+	WHERE n.cluster_id = o.cluster_id AND n.phase IN ('Pending', 'Running') AND (n.created_at, n.id) > (o.created_at, o.id)
+);
+CREATE UNIQUE INDEX IF NOT EXISTS operations_active_cluster_idx ON operations (cluster_id) WHERE phase IN ('Pending', 'Running');
 `,
 	},
 }
@@ -246,39 +503,48 @@ func (p *postgresStore) CreateTenant(ctx context.Context, t *types.Tenant) error
 	if err != nil {
 		return err
 	}
-	_, err = p.db.ExecContext(ctx, `
-		INSERT INTO tenants (id, cluster_id, name, payload, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6)
-	`, t.ID, t.ClusterID, t.Name, payload, t.CreatedAt, t.UpdatedAt)
-	return handleSQLError(err)
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if err := lockPlan(ctx, tx, t.Plan, ""); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO tenants (id, cluster_id, name, payload, created_at, updated_at, version)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, t.ID, t.ClusterID, t.Name, payload, t.CreatedAt, t.UpdatedAt, t.ResourceVersion)
+	if err != nil {
+		return handleSQLError(err)
+	}
+	return tx.Commit()
 }
 
-func (p *postgresStore) ListTenants(ctx context.Context, clusterID string) ([]*types.Tenant, error) {
-	query := `SELECT payload FROM tenants`
-	args := []any{}
-	if clusterID != "" {
-		query += ` WHERE cluster_id=$1`
-		args = append(args, clusterID)
+// lockPlan holds a share lock on the plan a tenant moves onto from current
+// until tx ends, so that DeletePlan waits for the tenant write and then sees
+// it. Moving onto a plan that is not in the catalog fails.
+func lockPlan(ctx context.Context, tx *sql.Tx, plan, current string) error {
+	if plan == "" || plan == current {
+		return nil
 	}
-	query += ` ORDER BY created_at`
-	rows, err := p.db.QueryContext(ctx, query, args...)
-	if err != nil {
-		return nil, err
+	var one int
+	err := tx.QueryRowContext(ctx, `SELECT 1 FROM plans WHERE name=$1 FOR SHARE`, plan).Scan(&one)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w %q", ErrUnknownPlan, plan)
 	}
-	defer rows.Close()
-	var out []*types.Tenant
-	for rows.Next() {
-		var raw []byte
-		if err := rows.Scan(&raw); err != nil {
-			return nil, err
-		}
-		var t types.Tenant
-		if err := unmarshalPayload(raw, &t); err != nil {
-			return nil, err
-		}
-		out = append(out, &t)
+	return err
+}
+
+func (p *postgresStore) ListTenants(ctx context.Context, clusterID string, opts ListOptions) ([]*types.Tenant, string, error) {
+	var (
+		where []string
+		args  sqlArgs
+	)
+	if clusterID != "" {
+		where = append(where, "cluster_id="+args.add(clusterID))
 	}
-	return out, rows.Err()
+	return listRows(ctx, p.db, "tenants", where, args, opts, tenantMeta)
 }
 
 func (p *postgresStore) GetTenant(ctx context.Context, clusterID, tenantID string) (*types.Tenant, error) {
@@ -297,40 +563,48 @@ func (p *postgresStore) GetTenant(ctx context.Context, clusterID, tenantID strin
 	return &t, nil
 }
 
+func (p *postgresStore) GetTenantByID(ctx context.Context, tenantID string) (*types.Tenant, error) {
+	return p.GetTenant(ctx, "", tenantID)
+}
+
 func (p *postgresStore) UpdateTenant(ctx context.Context, t *types.Tenant) error {
-	t.UpdatedAt = time.Now().UTC()
-	payload, err := marshalPayload(t)
-	if err != nil {
-		return err
-	}
-	res, err := p.db.ExecContext(ctx, `
-		UPDATE tenants SET payload=$1, updated_at=$2 WHERE id=$3
-	`, payload, t.UpdatedAt, t.ID)
+	tx, err := p.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
-	if aff, _ := res.RowsAffected(); aff == 0 {
-		return ErrNotFound
+	defer func() { _ = tx.Rollback() }()
+	var current sql.NullString
+	if err := tx.QueryRowContext(ctx, `SELECT payload->>'plan' FROM tenants WHERE id=$1`, t.ID).Scan(&current); err != nil {
+		return handleSQLError(err)
 	}
-	return nil
-}
-
-func (p *postgresStore) UpdateCluster(ctx context.Context, c *types.Cluster) error {
-	c.UpdatedAt = time.Now().UTC()
-	payload, err := marshalPayload(c)
-	if err != nil {
+	if err := lockPlan(ctx, tx, t.Plan, current.String); err != nil {
 		return err
 	}
-	res, err := p.db.ExecContext(ctx, `UPDATE clusters SET payload=$1, updated_at=$2 WHERE id=$3`, payload, c.UpdatedAt, c.ID)
+	err = p.updateVersioned(ctx, tx, "tenants", t.ID, &t.ResourceVersion, func() ([]byte, time.Time, error) {
+		t.UpdatedAt = time.Now().UTC()
+		payload, err := marshalPayload(t)
+		return payload, t.UpdatedAt, err
+	})
 	if err != nil {
 		return err
 	}
-	if aff, _ := res.RowsAffected(); aff == 0 {
-		return ErrNotFound
+	if err := tx.Commit(); err != nil {
+		t.ResourceVersion--
+		return err
 	}
 	return nil
 }
 
+func (p *postgresStore) UpdateCluster(ctx context.Context, c *types.Cluster) error {
+	return p.updateVersioned(ctx, p.db, "clusters", c.ID, &c.ResourceVersion, func() ([]byte, time.Time, error) {
+		c.UpdatedAt = time.Now().UTC()
+		payload, err := marshalPayload(c)
+		return payload, c.UpdatedAt, err
+	})
+}
+
+// DeleteTenant keeps the tenant's usage; retention drops it once it can no
+// longer be billed.
 func (p *postgresStore) DeleteTenant(ctx context.Context, clusterID, tenantID string) error {
 	_, err := p.db.ExecContext(ctx, `DELETE FROM apps WHERE tenant_id=$1`, tenantID)
 	if err != nil {
@@ -357,44 +631,24 @@ func (p *postgresStore) CreateProject(ctx context.Context, pr *types.Project) er
 		return err
 	}
 	_, err = p.db.ExecContext(ctx, `
-		INSERT INTO projects (id, cluster_id, tenant_id, name, payload, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-	`, pr.ID, pr.ClusterID, pr.TenantID, pr.Name, payload, pr.CreatedAt, pr.UpdatedAt)
+		INSERT INTO projects (id, cluster_id, tenant_id, name, payload, created_at, updated_at, version)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, pr.ID, pr.ClusterID, pr.TenantID, pr.Name, payload, pr.CreatedAt, pr.UpdatedAt, pr.ResourceVersion)
 	return handleSQLError(err)
 }
 
-func (p *postgresStore) ListProjects(ctx context.Context, clusterID, tenantID string) ([]*types.Project, error) {
-	query := `SELECT payload FROM projects`
-	args := []any{}
-	if clusterID != "" && tenantID != "" {
-		query += ` WHERE cluster_id=$1 AND tenant_id=$2`
-		args = append(args, clusterID, tenantID)
-	} else if clusterID != "" {
-		query += ` WHERE cluster_id=$1`
-		args = append(args, clusterID)
-	} else if tenantID != "" {
-		query += ` WHERE tenant_id=$1`
-		args = append(args, tenantID)
-	}
-	query += ` ORDER BY created_at`
-	rows, err := p.db.QueryContext(ctx, query, args...)
-	if err != nil {
-		return nil, err
+func (p *postgresStore) ListProjects(ctx context.Context, clusterID, tenantID string, opts ListOptions) ([]*types.Project, string, error) {
+	var (
+		where []string
+		args  sqlArgs
+	)
+	if clusterID != "" {
+		where = append(where, "cluster_id="+args.add(clusterID))
 	}
-	defer rows.Close()
-	var out []*types.Project
-	for rows.Next() {
-		var raw []byte
-		if err := rows.Scan(&raw); err != nil {
-			return nil, err
-		}
-		var pjt types.Project
-		if err := unmarshalPayload(raw, &pjt); err != nil {
-			return nil, err
-		}
-		out = append(out, &pjt)
+	if tenantID != "" {
+		where = append(where, "tenant_id="+args.add(tenantID))
 	}
-	return out, rows.Err()
+	return listRows(ctx, p.db, "projects", where, args, opts, projectMeta)
 }
 
 func (p *postgresStore) GetProject(ctx context.Context, clusterID, tenantID, projectID string) (*types.Project, error) {
@@ -413,22 +667,16 @@ func (p *postgresStore) GetProject(ctx context.Context, clusterID, tenantID, pro
 	return &pr, nil
 }
 
+func (p *postgresStore) GetProjectByID(ctx context.Context, projectID string) (*types.Project, error) {
+	return p.GetProject(ctx, "", "", projectID)
+}
+
 func (p *postgresStore) UpdateProject(ctx context.Context, pr *types.Project) error {
-	pr.UpdatedAt = time.Now().UTC()
-	payload, err := marshalPayload(pr)
-	if err != nil {
-		return err
-	}
-	res, err := p.db.ExecContext(ctx, `
-		UPDATE projects SET payload=$1, updated_at=$2 WHERE id=$3
-	`, payload, pr.UpdatedAt, pr.ID)
-	if err != nil {
-		return err
-	}
-	if aff, _ := res.RowsAffected(); aff == 0 {
-		return ErrNotFound
-	}
-	return nil
+	return p.updateVersioned(ctx, p.db, "projects", pr.ID, &pr.ResourceVersion, func() ([]byte, time.Time, error) {
+		pr.UpdatedAt = time.Now().UTC()
+		payload, err := marshalPayload(pr)
+		return payload, pr.UpdatedAt, err
+	})
 }
 
 func (p *postgresStore) DeleteProject(ctx context.Context, clusterID, tenantID, projectID string) error {
@@ -453,54 +701,61 @@ func (p *postgresStore) CreateApp(ctx context.Context, a *types.App) error {
 		return err
 	}
 	_, err = p.db.ExecContext(ctx, `
-		INSERT INTO apps (id, cluster_id, tenant_id, project_id, name, payload, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-	`, a.ID, a.ClusterID, a.TenantID, a.ProjectID, a.Name, payload, a.CreatedAt, a.UpdatedAt)
+		INSERT INTO apps (id, cluster_id, tenant_id, project_id, name, payload, created_at, updated_at, version)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, a.ID, a.ClusterID, a.TenantID, a.ProjectID, a.Name, payload, a.CreatedAt, a.UpdatedAt, a.ResourceVersion)
 	return handleSQLError(err)
 }
 
-func (p *postgresStore) ListApps(ctx context.Context, clusterID, tenantID, projectID string) ([]*types.App, error) {
-	query := `SELECT payload FROM apps`
-	args := []any{}
-	switch {
-	case clusterID != "" && tenantID != "" && projectID != "":
-		query += ` WHERE cluster_id=$1 AND tenant_id=$2 AND project_id=$3`
-		args = append(args, clusterID, tenantID, projectID)
-	case clusterID != "" && tenantID != "":
-		query += ` WHERE cluster_id=$1 AND tenant_id=$2`
-		args = append(args, clusterID, tenantID)
-	case tenantID != "" && projectID != "":
-		query += ` WHERE tenant_id=$1 AND project_id=$2`
-		args = append(args, tenantID, projectID)
-	case clusterID != "":
-		query += ` WHERE cluster_id=$1`
-		args = append(args, clusterID)
-	case tenantID != "":
-		query += ` WHERE tenant_id=$1`
-		args = append(args, tenantID)
-	case projectID != "":
-		query += ` WHERE project_id=$1`
-		args = append(args, projectID)
+func (p *postgresStore) ListApps(ctx context.Context, clusterID, tenantID, projectID string, opts ListOptions) ([]*types.App, string, error) {
+	var (
+		where []string
+		args  sqlArgs
+	)
+	if clusterID != "" {
+		where = append(where, "cluster_id="+args.add(clusterID))
 	}
-	query += ` ORDER BY created_at`
-	rows, err := p.db.QueryContext(ctx, query, args...)
+	if tenantID != "" {
+		where = append(where, "tenant_id="+args.add(tenantID))
+	}
+	if projectID != "" {
+		where = append(where, "project_id="+args.add(projectID))
+	}
+	return listRows(ctx, p.db, "apps", where, args, opts, appMeta)
+}
+
+// listRows runs a paged list query against one of the resource tables. Label
+// selectors, sorting and the continue position are all evaluated in SQL.
+func listRows[T any](ctx context.Context, db *sql.DB, table string, where []string, args sqlArgs, opts ListOptions, meta func(*T) listMeta) ([]*T, string, error) {
+	clause, err := listClause(where, &args, opts)
 	if err != nil {
-		return nil, err
+		return nil, "", err
+	}
+	rows, err := db.QueryContext(ctx, `SELECT payload FROM `+table+clause, args...)
+	if err != nil {
+		return nil, "", err
 	}
 	defer rows.Close()
-	var out []*types.App
+	out := []*T{}
 	for rows.Next() {
 		var raw []byte
 		if err := rows.Scan(&raw); err != nil {
-			return nil, err
+			return nil, "", err
 		}
-		var app types.App
-		if err := unmarshalPayload(raw, &app); err != nil {
-			return nil, err
+		var item T
+		if err := unmarshalPayload(raw, &item); err != nil {
+			return nil, "", err
 		}
-		out = append(out, &app)
+		out = append(out, &item)
 	}
-	return out, rows.Err()
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+	if opts.Limit > 0 && len(out) > opts.Limit {
+		out = out[:opts.Limit]
+		return out, encodeCursor(opts.sortKeys(), meta(out[len(out)-1])), nil
+	}
+	return out, "", nil
 }
 
 func (p *postgresStore) GetApp(ctx context.Context, clusterID, tenantID, projectID, appID string) (*types.App, error) {
@@ -520,30 +775,1040 @@ func (p *postgresStore) GetApp(ctx context.Context, clusterID, tenantID, project
 }
 
 func (p *postgresStore) UpdateApp(ctx context.Context, a *types.App) error {
-	a.UpdatedAt = time.Now().UTC()
-	payload, err := marshalPayload(a)
-	if err != nil {
-		return err
-	}
-	res, err := p.db.ExecContext(ctx, `
-		UPDATE apps SET payload=$1, updated_at=$2 WHERE id=$3
-	`, payload, a.UpdatedAt, a.ID)
+	return p.updateVersioned(ctx, p.db, "apps", a.ID, &a.ResourceVersion, func() ([]byte, time.Time, error) {
+		a.UpdatedAt = time.Now().UTC()
+		payload, err := marshalPayload(a)
+		return payload, a.UpdatedAt, err
+	})
+}
+
+func (p *postgresStore) DeleteApp(ctx context.Context, clusterID, tenantID, projectID, appID string) error {
+	res, err := p.db.ExecContext(ctx, `DELETE FROM apps WHERE id=$1`, appID)
 	if err != nil {
 		return err
 	}
 	if aff, _ := res.RowsAffected(); aff == 0 {
 		return ErrNotFound
 	}
-	return nil
+	_, err = p.db.ExecContext(ctx, `DELETE FROM workflow_runs WHERE app_id=$1`, appID)
+	return err
 }
 
-func (p *postgresStore) DeleteApp(ctx context.Context, clusterID, tenantID, projectID, appID string) error {
-	res, err := p.db.ExecContext(ctx, `DELETE FROM apps WHERE id=$1`, appID)
+func (p *postgresStore) CreatePlan(ctx context.Context, pl *types.Plan) error {
+	assignPlanID(pl)
+	payload, err := marshalPayload(pl)
 	if err != nil {
 		return err
 	}
-	if aff, _ := res.RowsAffected(); aff == 0 {
-		return ErrNotFound
-	}
-	return nil
+	_, err = p.db.ExecContext(ctx, `
+		INSERT INTO plans (id, name, payload, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, pl.ID, pl.Name, payload, pl.CreatedAt, pl.UpdatedAt)
+	return handleSQLError(err)
+}
+
+func (p *postgresStore) ListPlans(ctx context.Context) ([]*types.Plan, error) {
+	rows, err := p.db.QueryContext(ctx, `SELECT payload FROM plans ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*types.Plan
+	for rows.Next() {
+		var raw []byte
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		var pl types.Plan
+		if err := unmarshalPayload(raw, &pl); err != nil {
+			return nil, err
+		}
+		out = append(out, &pl)
+	}
+	return out, rows.Err()
+}
+
+func (p *postgresStore) GetPlan(ctx context.Context, name string) (*types.Plan, error) {
+	var raw []byte
+	err := p.db.QueryRowContext(ctx, `SELECT payload FROM plans WHERE name=$1`, name).Scan(&raw)
+	if err != nil {
+		return nil, handleSQLError(err)
+	}
+	var pl types.Plan
+	if err := unmarshalPayload(raw, &pl); err != nil {
+		return nil, err
+	}
+	return &pl, nil
+}
+
+func (p *postgresStore) UpdatePlan(ctx context.Context, pl *types.Plan) error {
+	cur, err := p.GetPlan(ctx, pl.Name)
+	if err != nil {
+		return err
+	}
+	pl.ID = cur.ID
+	pl.CreatedAt = cur.CreatedAt
+	pl.UpdatedAt = time.Now().UTC()
+	payload, err := marshalPayload(pl)
+	if err != nil {
+		return err
+	}
+	res, err := p.db.ExecContext(ctx, `UPDATE plans SET payload=$1, updated_at=$2 WHERE name=$3`, payload, pl.UpdatedAt, pl.Name)
+	if err != nil {
+		return err
+	}
+	if aff, _ := res.RowsAffected(); aff == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *postgresStore) DeletePlan(ctx context.Context, name string) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	var one int
+	if err := tx.QueryRowContext(ctx, `SELECT 1 FROM plans WHERE name=$1 FOR UPDATE`, name).Scan(&one); err != nil {
+		return handleSQLError(err)
+	}
+	var tenant string
+	err = tx.QueryRowContext(ctx, `SELECT name FROM tenants WHERE payload->>'plan'=$1 LIMIT 1`, name).Scan(&tenant)
+	switch {
+	case err == nil:
+		return fmt.Errorf("%w: assigned to tenant %s", ErrPlanInUse, tenant)
+	case !errors.Is(err, sql.ErrNoRows):
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM plans WHERE name=$1`, name); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (p *postgresStore) RecordUsage(ctx context.Context, u *types.UsageRecord) error {
+	if u.LastReportedAt.IsZero() {
+		u.LastReportedAt = time.Now().UTC()
+	}
+	payload, err := marshalPayload(u)
+	if err != nil {
+		return err
+	}
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO usage_records (cluster_id, tenant_id, project_id, payload, collected_at)
+		VALUES ($1, $2, NULLIF($3, '')::uuid, $4, $5)
+	`, u.ClusterID, u.TenantID, u.ProjectID, payload, u.LastReportedAt)
+	if err != nil {
+		return handleSQLError(err)
+	}
+	for _, step := range rollupSteps {
+		if err := foldUsageRollup(ctx, tx, u, step); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// foldUsageRollup adds the sample to its bucket. The empty row is inserted
+// first so that concurrent reports serialize on the row lock instead of
+// overwriting each other.
+func foldUsageRollup(ctx context.Context, tx *sql.Tx, u *types.UsageRecord, step string) error {
+	r := newUsageRollup(u, step)
+	empty, err := marshalPayload(r)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO usage_rollups (tenant_id, project_id, step, bucket_start, cluster_id, payload)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (tenant_id, project_id, step, bucket_start) DO NOTHING
+	`, u.TenantID, u.ProjectID, step, r.Start, u.ClusterID, empty); err != nil {
+		return handleSQLError(err)
+	}
+	var raw []byte
+	if err := tx.QueryRowContext(ctx, `
+		SELECT payload FROM usage_rollups
+		WHERE tenant_id=$1 AND project_id=$2 AND step=$3 AND bucket_start=$4
+		FOR UPDATE
+	`, u.TenantID, u.ProjectID, step, r.Start).Scan(&raw); err != nil {
+		return handleSQLError(err)
+	}
+	if err := unmarshalPayload(raw, r); err != nil {
+		return err
+	}
+	r.add(u)
+	payload, err := marshalPayload(r)
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE usage_rollups SET payload=$5
+		WHERE tenant_id=$1 AND project_id=$2 AND step=$3 AND bucket_start=$4
+	`, u.TenantID, u.ProjectID, step, r.Start, payload)
+	return handleSQLError(err)
+}
+
+func (p *postgresStore) LatestUsage(ctx context.Context, tenantID, projectID string) (*types.UsageRecord, error) {
+	query := `SELECT payload FROM usage_records WHERE tenant_id=$1 AND project_id IS NULL ORDER BY collected_at DESC LIMIT 1`
+	args := []any{tenantID}
+	if projectID != "" {
+		query = `SELECT payload FROM usage_records WHERE tenant_id=$1 AND project_id=$2 ORDER BY collected_at DESC LIMIT 1`
+		args = append(args, projectID)
+	}
+	var raw []byte
+	if err := p.db.QueryRowContext(ctx, query, args...).Scan(&raw); err != nil {
+		return nil, handleSQLError(err)
+	}
+	var u types.UsageRecord
+	if err := unmarshalPayload(raw, &u); err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (p *postgresStore) ListUsage(ctx context.Context, q UsageQuery) ([]*types.UsageRecord, error) {
+	if q.Step == UsageStepRaw {
+		query := `SELECT payload FROM usage_records WHERE tenant_id=$1 AND project_id IS NULL AND collected_at >= $2 AND collected_at < $3 ORDER BY collected_at LIMIT $4`
+		args := []any{q.TenantID, q.From, q.To, maxUsagePoints}
+		if q.ProjectID != "" {
+			query = `SELECT payload FROM usage_records WHERE tenant_id=$1 AND project_id=$5 AND collected_at >= $2 AND collected_at < $3 ORDER BY collected_at LIMIT $4`
+			args = append(args, q.ProjectID)
+		}
+		rows, err := p.db.QueryContext(ctx, query, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		out := []*types.UsageRecord{}
+		for rows.Next() {
+			var raw []byte
+			if err := rows.Scan(&raw); err != nil {
+				return nil, err
+			}
+			var u types.UsageRecord
+			if err := unmarshalPayload(raw, &u); err != nil {
+				return nil, err
+			}
+			out = append(out, &u)
+		}
+		return out, rows.Err()
+	}
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT payload FROM usage_rollups
+		WHERE tenant_id=$1 AND project_id=$2 AND step=$3 AND bucket_start >= $4 AND bucket_start < $5
+		ORDER BY bucket_start LIMIT $6
+	`, q.TenantID, q.ProjectID, q.Step, UsageBucketStart(q.From, q.Step), q.To, maxUsagePoints)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []*types.UsageRecord{}
+	for rows.Next() {
+		var raw []byte
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		var r usageRollup
+		if err := unmarshalPayload(raw, &r); err != nil {
+			return nil, err
+		}
+		out = append(out, r.record())
+	}
+	return out, rows.Err()
+}
+
+func (p *postgresStore) ListTenantUsage(ctx context.Context, clusterID string, from, to time.Time) ([]*TenantUsage, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT payload FROM usage_rollups
+		WHERE step=$1 AND project_id='' AND bucket_start >= $2 AND bucket_start < $3
+		AND ($4 = '' OR cluster_id::text = $4)
+		ORDER BY tenant_id, bucket_start
+	`, UsageStepHour, UsageBucketStart(from, UsageStepHour), to, clusterID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var rollups []*usageRollup
+	for rows.Next() {
+		var raw []byte
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		var r usageRollup
+		if err := unmarshalPayload(raw, &r); err != nil {
+			return nil, err
+		}
+		rollups = append(rollups, &r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return tenantUsage(rollups), nil
+}
+
+func (p *postgresStore) PruneUsage(ctx context.Context, step string, before time.Time) (int64, error) {
+	var (
+		res sql.Result
+		err error
+	)
+	if step == UsageStepRaw {
+		res, err = p.db.ExecContext(ctx, `DELETE FROM usage_records WHERE collected_at < $1`, before)
+	} else {
+		res, err = p.db.ExecContext(ctx, `DELETE FROM usage_rollups WHERE step=$1 AND bucket_start < $2`, step, before)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (p *postgresStore) ReserveIdempotencyKey(ctx context.Context, rec *IdempotencyRecord) (*IdempotencyRecord, error) {
+	rec.Status = 0
+	payload, err := marshalPayload(rec)
+	if err != nil {
+		return nil, err
+	}
+	// An expired record is taken over in place; a live one is left untouched
+	// and the upsert returns no row.
+	var key string
+	err = p.db.QueryRowContext(ctx, `
+		INSERT INTO idempotency_keys (key, payload, created_at, expires_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (key) DO UPDATE
+		SET payload=EXCLUDED.payload, created_at=EXCLUDED.created_at, expires_at=EXCLUDED.expires_at
+		WHERE idempotency_keys.expires_at <= now()
+		RETURNING key
+	`, rec.Key, payload, rec.CreatedAt, rec.ExpiresAt).Scan(&key)
+	if err == nil {
+		return nil, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, handleSQLError(err)
+	}
+	var raw []byte
+	if err := p.db.QueryRowContext(ctx, `SELECT payload FROM idempotency_keys WHERE key=$1`, rec.Key).Scan(&raw); err != nil {
+		return nil, handleSQLError(err)
+	}
+	var existing IdempotencyRecord
+	if err := unmarshalPayload(raw, &existing); err != nil {
+		return nil, err
+	}
+	return &existing, nil
+}
+
+func (p *postgresStore) CompleteIdempotencyKey(ctx context.Context, rec *IdempotencyRecord) error {
+	payload, err := marshalPayload(rec)
+	if err != nil {
+		return err
+	}
+	res, err := p.db.ExecContext(ctx, `UPDATE idempotency_keys SET payload=$2 WHERE key=$1`, rec.Key, payload)
+	if err != nil {
+		return handleSQLError(err)
+	}
+	if aff, _ := res.RowsAffected(); aff == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *postgresStore) ReleaseIdempotencyKey(ctx context.Context, key string) error {
+	_, err := p.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE key=$1`, key)
+	return err
+}
+
+func (p *postgresStore) PruneIdempotencyKeys(ctx context.Context, before time.Time) (int64, error) {
+	res, err := p.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (p *postgresStore) RecordAudit(ctx context.Context, e *types.AuditEvent) error {
+	assignAuditID(e)
+	payload, err := marshalPayload(e)
+	if err != nil {
+		return err
+	}
+	_, err = p.db.ExecContext(ctx, `
+		INSERT INTO audit_events (id, time, actor, action, resource, cluster_id, tenant_id, payload)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, e.ID, e.Time, e.Actor, e.Action, e.Resource, e.ClusterID, e.TenantID, payload)
+	return handleSQLError(err)
+}
+
+func (p *postgresStore) ListAudit(ctx context.Context, q AuditQuery) ([]*types.AuditEvent, error) {
+	var (
+		args  sqlArgs
+		where []string
+	)
+	for _, f := range []struct{ col, val string }{
+		{"actor", q.Actor},
+		{"cluster_id", q.ClusterID},
+		{"tenant_id", q.TenantID},
+		{"action", q.Action},
+	} {
+		if f.val != "" {
+			where = append(where, f.col+" = "+args.add(f.val))
+		}
+	}
+	if q.Resource != "" {
+		where = append(where, "(resource = "+args.add(q.Resource)+" OR starts_with(resource, "+args.add(strings.TrimSuffix(q.Resource, "/")+"/")+"))")
+	}
+	if !q.From.IsZero() {
+		where = append(where, "time >= "+args.add(q.From))
+	}
+	if !q.To.IsZero() {
+		where = append(where, "time < "+args.add(q.To))
+	}
+	query := `SELECT payload FROM audit_events`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY time DESC, id DESC LIMIT " + args.add(q.limit())
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []*types.AuditEvent{}
+	for rows.Next() {
+		var raw []byte
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		var e types.AuditEvent
+		if err := unmarshalPayload(raw, &e); err != nil {
+			return nil, err
+		}
+		out = append(out, &e)
+	}
+	return out, rows.Err()
+}
+
+func (p *postgresStore) CreateWorkflowRun(ctx context.Context, r *types.WorkflowRun) error {
+	assignWorkflowRunID(r)
+	payload, err := marshalPayload(r)
+	if err != nil {
+		return err
+	}
+	_, err = p.db.ExecContext(ctx, `
+		INSERT INTO workflow_runs (id, cluster_id, tenant_id, project_id, app_id, payload, started_at, ended_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, r.ID, r.ClusterID, r.TenantID, r.ProjectID, r.AppID, payload, r.StartedAt, r.EndedAt)
+	return handleSQLError(err)
+}
+
+func (p *postgresStore) GetWorkflowRun(ctx context.Context, id string) (*types.WorkflowRun, error) {
+	var raw []byte
+	err := p.db.QueryRowContext(ctx, `SELECT payload FROM workflow_runs WHERE id=$1`, id).Scan(&raw)
+	if err != nil {
+		return nil, handleSQLError(err)
+	}
+	var r types.WorkflowRun
+	if err := unmarshalPayload(raw, &r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (p *postgresStore) UpdateWorkflowRun(ctx context.Context, r *types.WorkflowRun) error {
+	payload, err := marshalPayload(r)
+	if err != nil {
+		return err
+	}
+	res, err := p.db.ExecContext(ctx, `UPDATE workflow_runs SET payload=$2, ended_at=$3 WHERE id=$1`, r.ID, payload, r.EndedAt)
+	if err != nil {
+		return handleSQLError(err)
+	}
+	if aff, _ := res.RowsAffected(); aff == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *postgresStore) ListWorkflowRuns(ctx context.Context, q WorkflowRunQuery) ([]*types.WorkflowRun, error) {
+	var (
+		args  sqlArgs
+		where []string
+	)
+	for _, f := range []struct{ col, val string }{
+		{"cluster_id", q.ClusterID},
+		{"tenant_id", q.TenantID},
+		{"project_id", q.ProjectID},
+		{"app_id", q.AppID},
+	} {
+		if f.val != "" {
+			where = append(where, f.col+" = "+args.add(f.val))
+		}
+	}
+	if q.Active {
+		where = append(where, "ended_at IS NULL")
+	}
+	query := `SELECT payload FROM workflow_runs`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY started_at DESC, id DESC"
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []*types.WorkflowRun{}
+	for rows.Next() {
+		var raw []byte
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		var r types.WorkflowRun
+		if err := unmarshalPayload(raw, &r); err != nil {
+			return nil, err
+		}
+		out = append(out, &r)
+	}
+	return out, rows.Err()
+}
+
+// eventsLockKey serializes event inserts so that IDs become visible in the
+// order they were assigned and readers resuming after an ID never skip one.
+const eventsLockKey = 0x6b6e657674
+
+func (p *postgresStore) AppendEvent(ctx context.Context, e *types.Event) error {
+	stampEvent(e)
+	e.ID = 0
+	payload, err := marshalPayload(e)
+	if err != nil {
+		return err
+	}
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, eventsLockKey); err != nil {
+		return err
+	}
+	if err := tx.QueryRowContext(ctx, `
+		INSERT INTO events (time, type, payload) VALUES ($1, $2, $3) RETURNING id
+	`, e.Time, e.Type, payload).Scan(&e.ID); err != nil {
+		return handleSQLError(err)
+	}
+	return tx.Commit()
+}
+
+func (p *postgresStore) ListEvents(ctx context.Context, q EventQuery) ([]*types.Event, error) {
+	rows, err := p.db.QueryContext(ctx, `
+		SELECT id, payload FROM events WHERE id > $1 ORDER BY id LIMIT $2
+	`, q.After, q.limit())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []*types.Event{}
+	for rows.Next() {
+		var (
+			id  int64
+			raw []byte
+		)
+		if err := rows.Scan(&id, &raw); err != nil {
+			return nil, err
+		}
+		var e types.Event
+		if err := unmarshalPayload(raw, &e); err != nil {
+			return nil, err
+		}
+		e.ID = id
+		out = append(out, &e)
+	}
+	return out, rows.Err()
+}
+
+func (p *postgresStore) LatestEventID(ctx context.Context) (int64, error) {
+	var id int64
+	err := p.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(id), 0) FROM events`).Scan(&id)
+	return id, err
+}
+
+func (p *postgresStore) PruneEvents(ctx context.Context, before time.Time) (int64, error) {
+	res, err := p.db.ExecContext(ctx, `DELETE FROM events WHERE time < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (p *postgresStore) CreateWebhook(ctx context.Context, w *types.WebhookSubscription) error {
+	assignWebhookID(w)
+	payload, err := marshalPayload(w)
+	if err != nil {
+		return err
+	}
+	_, err = p.db.ExecContext(ctx, `
+		INSERT INTO webhooks (id, payload, created_at) VALUES ($1, $2, $3)
+	`, w.ID, payload, w.CreatedAt)
+	return handleSQLError(err)
+}
+
+func (p *postgresStore) GetWebhook(ctx context.Context, id string) (*types.WebhookSubscription, error) {
+	var raw []byte
+	if err := p.db.QueryRowContext(ctx, `SELECT payload FROM webhooks WHERE id=$1`, id).Scan(&raw); err != nil {
+		return nil, handleSQLError(err)
+	}
+	var w types.WebhookSubscription
+	if err := unmarshalPayload(raw, &w); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+func (p *postgresStore) ListWebhooks(ctx context.Context) ([]*types.WebhookSubscription, error) {
+	rows, err := p.db.QueryContext(ctx, `SELECT payload FROM webhooks ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []*types.WebhookSubscription{}
+	for rows.Next() {
+		var raw []byte
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		var w types.WebhookSubscription
+		if err := unmarshalPayload(raw, &w); err != nil {
+			return nil, err
+		}
+		out = append(out, &w)
+	}
+	return out, rows.Err()
+}
+
+func (p *postgresStore) UpdateWebhook(ctx context.Context, w *types.WebhookSubscription) error {
+	cur, err := p.GetWebhook(ctx, w.ID)
+	if err != nil {
+		return err
+	}
+	w.CreatedAt = cur.CreatedAt
+	w.UpdatedAt = time.Now().UTC()
+	payload, err := marshalPayload(w)
+	if err != nil {
+		return err
+	}
+	res, err := p.db.ExecContext(ctx, `UPDATE webhooks SET payload=$1 WHERE id=$2`, payload, w.ID)
+	if err != nil {
+		return handleSQLError(err)
+	}
+	if aff, _ := res.RowsAffected(); aff == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *postgresStore) DeleteWebhook(ctx context.Context, id string) error {
+	res, err := p.db.ExecContext(ctx, `DELETE FROM webhooks WHERE id=$1`, id)
+	if err != nil {
+		return handleSQLError(err)
+	}
+	if aff, _ := res.RowsAffected(); aff == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *postgresStore) CreateWebhookDelivery(ctx context.Context, d *types.WebhookDelivery) error {
+	assignWebhookDeliveryID(d)
+	payload, err := marshalPayload(d)
+	if err != nil {
+		return err
+	}
+	_, err = p.db.ExecContext(ctx, `
+		INSERT INTO webhook_deliveries (id, subscription_id, status, next_attempt_at, created_at, payload)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, d.ID, d.SubscriptionID, d.Status, d.NextAttemptAt, d.CreatedAt, payload)
+	return handleSQLError(err)
+}
+
+func (p *postgresStore) UpdateWebhookDelivery(ctx context.Context, d *types.WebhookDelivery) error {
+	payload, err := marshalPayload(d)
+	if err != nil {
+		return err
+	}
+	res, err := p.db.ExecContext(ctx, `
+		UPDATE webhook_deliveries SET status=$1, next_attempt_at=$2, payload=$3 WHERE id=$4
+	`, d.Status, d.NextAttemptAt, payload, d.ID)
+	if err != nil {
+		return handleSQLError(err)
+	}
+	if aff, _ := res.RowsAffected(); aff == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *postgresStore) ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*types.WebhookDelivery, error) {
+	until := now.Add(lease)
+	rows, err := p.db.QueryContext(ctx, `
+		UPDATE webhook_deliveries SET next_attempt_at = $2
+		WHERE id IN (
+			SELECT id FROM webhook_deliveries
+			WHERE status = 'pending' AND (next_attempt_at IS NULL OR next_attempt_at <= $1)
+			ORDER BY next_attempt_at NULLS FIRST
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING payload
+	`, now, until, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*types.WebhookDelivery
+	for rows.Next() {
+		var raw []byte
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		var d types.WebhookDelivery
+		if err := unmarshalPayload(raw, &d); err != nil {
+			return nil, err
+		}
+		d.NextAttemptAt = &until
+		out = append(out, &d)
+	}
+	return out, rows.Err()
+}
+
+func (p *postgresStore) ListWebhookDeliveries(ctx context.Context, q WebhookDeliveryQuery) ([]*types.WebhookDelivery, error) {
+	var args sqlArgs
+	query := `SELECT payload FROM webhook_deliveries WHERE subscription_id = ` + args.add(q.SubscriptionID)
+	if q.Status != "" {
+		query += " AND status = " + args.add(q.Status)
+	}
+	query += " ORDER BY created_at DESC, id DESC LIMIT " + args.add(q.limit())
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []*types.WebhookDelivery{}
+	for rows.Next() {
+		var raw []byte
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		var d types.WebhookDelivery
+		if err := unmarshalPayload(raw, &d); err != nil {
+			return nil, err
+		}
+		out = append(out, &d)
+	}
+	return out, rows.Err()
+}
+
+func (p *postgresStore) PruneWebhookDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	res, err := p.db.ExecContext(ctx, `DELETE FROM webhook_deliveries WHERE status <> 'pending' AND created_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (p *postgresStore) CreateOperation(ctx context.Context, o *types.Operation) error {
+	assignOperationID(o)
+	payload, err := marshalPayload(o)
+	if err != nil {
+		return err
+	}
+	_, err = p.db.ExecContext(ctx, `
+		INSERT INTO operations (id, cluster_id, phase, lease_expires_at, lease_generation, created_at, payload)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, o.ID, o.ClusterID, o.Phase, o.LeaseExpiresAt, o.LeaseGeneration, o.CreatedAt, payload)
+	return handleSQLError(err)
+}
+
+func (p *postgresStore) GetOperation(ctx context.Context, id string) (*types.Operation, error) {
+	var raw []byte
+	if err := p.db.QueryRowContext(ctx, `SELECT payload FROM operations WHERE id=$1`, id).Scan(&raw); err != nil {
+		return nil, handleSQLError(err)
+	}
+	var o types.Operation
+	if err := unmarshalPayload(raw, &o); err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+func (p *postgresStore) UpdateOperation(ctx context.Context, o *types.Operation) error {
+	cur, err := p.GetOperation(ctx, o.ID)
+	if err != nil {
+		return err
+	}
+	o.CreatedAt = cur.CreatedAt
+	o.UpdatedAt = time.Now().UTC()
+	payload, err := marshalPayload(o)
+	if err != nil {
+		return err
+	}
+	res, err := p.db.ExecContext(ctx, `
+		UPDATE operations SET phase=$1, lease_expires_at=$2, payload=$3 WHERE id=$4 AND lease_generation=$5
+	`, o.Phase, o.LeaseExpiresAt, payload, o.ID, o.LeaseGeneration)
+	if err != nil {
+		return handleSQLError(err)
+	}
+	if aff, _ := res.RowsAffected(); aff == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+func (p *postgresStore) ListOperations(ctx context.Context, q OperationQuery) ([]*types.Operation, error) {
+	var (
+		args  sqlArgs
+		where []string
+	)
+	if q.ClusterID != "" {
+		where = append(where, "cluster_id = "+args.add(q.ClusterID))
+	}
+	if q.Phase != "" {
+		where = append(where, "phase = "+args.add(q.Phase))
+	}
+	if q.Active {
+		where = append(where, "phase IN ('Pending', 'Running')")
+	}
+	query := `SELECT payload FROM operations`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY created_at DESC, id DESC LIMIT " + args.add(q.limit())
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []*types.Operation{}
+	for rows.Next() {
+		var raw []byte
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		var o types.Operation
+		if err := unmarshalPayload(raw, &o); err != nil {
+			return nil, err
+		}
+		out = append(out, &o)
+	}
+	return out, rows.Err()
+}
+
+func (p *postgresStore) ClaimOperations(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*types.Operation, error) {
+	until := now.Add(lease)
+	rows, err := p.db.QueryContext(ctx, `
+		UPDATE operations
+		SET lease_expires_at = $2, lease_generation = lease_generation + 1,
+			payload = jsonb_set(jsonb_set(payload, '{leaseExpiresAt}', to_jsonb($2::timestamptz)),
+				'{leaseGeneration}', to_jsonb(lease_generation + 1))
+		WHERE id IN (
+			SELECT id FROM operations
+			WHERE phase IN ('Pending', 'Running') AND (lease_expires_at IS NULL OR lease_expires_at <= $1)
+			ORDER BY created_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING payload
+	`, now, until, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []*types.Operation
+	for rows.Next() {
+		var raw []byte
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		var o types.Operation
+		if err := unmarshalPayload(raw, &o); err != nil {
+			return nil, err
+		}
+		o.LeaseExpiresAt = &until
+		out = append(out, &o)
+	}
+	return out, rows.Err()
+}
+
+func (p *postgresStore) CreateAPIKey(ctx context.Context, k *types.APIKey) error {
+	assignAPIKeyID(k)
+	payload, err := marshalPayload(k)
+	if err != nil {
+		return err
+	}
+	_, err = p.db.ExecContext(ctx, `
+		INSERT INTO api_keys (id, created_at, payload) VALUES ($1, $2, $3)
+	`, k.ID, k.CreatedAt, payload)
+	return handleSQLError(err)
+}
+
+func (p *postgresStore) GetAPIKey(ctx context.Context, id string) (*types.APIKey, error) {
+	var raw []byte
+	if err := p.db.QueryRowContext(ctx, `SELECT payload FROM api_keys WHERE id=$1`, id).Scan(&raw); err != nil {
+		return nil, handleSQLError(err)
+	}
+	var k types.APIKey
+	if err := unmarshalPayload(raw, &k); err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+func (p *postgresStore) ListAPIKeys(ctx context.Context) ([]*types.APIKey, error) {
+	rows, err := p.db.QueryContext(ctx, `SELECT payload FROM api_keys ORDER BY created_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []*types.APIKey{}
+	for rows.Next() {
+		var raw []byte
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		var k types.APIKey
+		if err := unmarshalPayload(raw, &k); err != nil {
+			return nil, err
+		}
+		out = append(out, &k)
+	}
+	return out, rows.Err()
+}
+
+func (p *postgresStore) UpdateAPIKey(ctx context.Context, k *types.APIKey) error {
+	cur, err := p.GetAPIKey(ctx, k.ID)
+	if err != nil {
+		return err
+	}
+	k.CreatedAt = cur.CreatedAt
+	k.UpdatedAt = time.Now().UTC()
+	payload, err := marshalPayload(k)
+	if err != nil {
+		return err
+	}
+	res, err := p.db.ExecContext(ctx, `UPDATE api_keys SET payload=$1 WHERE id=$2`, payload, k.ID)
+	if err != nil {
+		return handleSQLError(err)
+	}
+	if aff, _ := res.RowsAffected(); aff == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *postgresStore) TouchAPIKey(ctx context.Context, id string, at time.Time) error {
+	stamp, err := json.Marshal(at.UTC())
+	if err != nil {
+		return err
+	}
+	res, err := p.db.ExecContext(ctx, `
+		UPDATE api_keys SET payload = jsonb_set(payload, '{lastUsedAt}', $2::jsonb) WHERE id=$1
+	`, id, string(stamp))
+	if err != nil {
+		return handleSQLError(err)
+	}
+	if aff, _ := res.RowsAffected(); aff == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (p *postgresStore) RevokeToken(ctx context.Context, t *types.RevokedToken) error {
+	payload, err := marshalPayload(t)
+	if err != nil {
+		return err
+	}
+	_, err = p.db.ExecContext(ctx, `
+		INSERT INTO revoked_tokens (jti, expires_at, revoked_at, payload) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (jti) DO NOTHING
+	`, t.JTI, t.ExpiresAt, t.RevokedAt, payload)
+	return handleSQLError(err)
+}
+
+func (p *postgresStore) TokenRevoked(ctx context.Context, jti string) (bool, error) {
+	var revoked bool
+	err := p.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti=$1)`, jti).Scan(&revoked)
+	return revoked, err
+}
+
+func (p *postgresStore) ListRevokedTokens(ctx context.Context) ([]*types.RevokedToken, error) {
+	rows, err := p.db.QueryContext(ctx, `SELECT payload FROM revoked_tokens ORDER BY revoked_at DESC, jti DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := []*types.RevokedToken{}
+	for rows.Next() {
+		var raw []byte
+		if err := rows.Scan(&raw); err != nil {
+			return nil, err
+		}
+		var t types.RevokedToken
+		if err := unmarshalPayload(raw, &t); err != nil {
+			return nil, err
+		}
+		out = append(out, &t)
+	}
+	return out, rows.Err()
+}
+
+func (p *postgresStore) PruneRevokedTokens(ctx context.Context, before time.Time) (int64, error) {
+	res, err := p.db.ExecContext(ctx, `DELETE FROM revoked_tokens WHERE expires_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (p *postgresStore) SaveClusterHealth(ctx context.Context, h *types.ClusterHealth) error {
+	payload, err := marshalPayload(h)
+	if err != nil {
+		return err
+	}
+	_, err = p.db.ExecContext(ctx, `
+		INSERT INTO cluster_health (cluster_id, payload) VALUES ($1, $2)
+		ON CONFLICT (cluster_id) DO UPDATE SET payload = EXCLUDED.payload
+	`, h.ClusterID, payload)
+	if err != nil && containsAny(err.Error(), "foreign key constraint") {
+		return ErrNotFound
+	}
+	return handleSQLError(err)
+}
+
+func (p *postgresStore) GetClusterHealth(ctx context.Context, clusterID string) (*types.ClusterHealth, error) {
+	var raw []byte
+	err := p.db.QueryRowContext(ctx, `SELECT payload FROM cluster_health WHERE cluster_id=$1`, clusterID).Scan(&raw)
+	if err != nil {
+		return nil, handleSQLError(err)
+	}
+	var h types.ClusterHealth
+	if err := unmarshalPayload(raw, &h); err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+func (p *postgresStore) AcquireLease(ctx context.Context, name, holder string, now time.Time, ttl time.Duration) (bool, error) {
+	res, err := p.db.ExecContext(ctx, `
+		INSERT INTO leases (name, holder, expires_at) VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO UPDATE SET holder = EXCLUDED.holder, expires_at = EXCLUDED.expires_at
+		WHERE leases.holder = EXCLUDED.holder OR leases.expires_at <= $4
+	`, name, holder, now.Add(ttl), now)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 1, err
 }
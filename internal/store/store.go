@@ -19,32 +19,177 @@ var ErrNotFound = errors.New("not found")
 // ErrConflict is returned when a resource already exists.
 var ErrConflict = errors.New("conflict")
 
+// ErrPlanInUse is returned when deleting a plan that tenants are still on.
+var ErrPlanInUse = errors.New("plan in use")
+
+// ErrUnknownPlan is returned when a tenant is moved onto a plan that is not in
+// the catalog.
+var ErrUnknownPlan = errors.New("unknown plan")
+
+// ErrLeaseLost is returned when an operation is written by a manager that no
+// longer holds its lease.
+var ErrLeaseLost = errors.New("operation lease lost")
+
+// ErrVersionConflict is returned when an update carries a ResourceVersion that
+// no longer matches the stored record.
+var ErrVersionConflict = errors.New("resource version conflict")
+
+// ErrEncryptedInput is returned when a secret handed to a store that
+// encrypts it is already an encrypted envelope.
+var ErrEncryptedInput = errors.New("secret is already encrypted")
+
 // Store represents the persistence surface used by the Manager.
+// UpdateCluster, UpdateTenant, UpdateProject and UpdateApp only succeed when
+// the ResourceVersion matches the stored one, and bump it on success.
+// The List calls for clusters, tenants, projects and apps return one page and
+// the continue token for the next one, which is empty on the last page.
 type Store interface {
 	CreateCluster(ctx context.Context, c *types.Cluster) error
 	UpdateCluster(ctx context.Context, c *types.Cluster) error
-	ListClusters(ctx context.Context) ([]*types.Cluster, error)
+	ListClusters(ctx context.Context, opts ListOptions) ([]*types.Cluster, string, error)
 	GetCluster(ctx context.Context, id string) (*types.Cluster, error)
 	DeleteCluster(ctx context.Context, id string) error
 	Health(ctx context.Context) error
 
 	CreateTenant(ctx context.Context, t *types.Tenant) error
-	ListTenants(ctx context.Context, clusterID string) ([]*types.Tenant, error)
+	ListTenants(ctx context.Context, clusterID string, opts ListOptions) ([]*types.Tenant, string, error)
 	GetTenant(ctx context.Context, clusterID, tenantID string) (*types.Tenant, error)
+	// GetTenantByID looks a tenant up by ID alone, for routes that do not
+	// name its cluster.
+	GetTenantByID(ctx context.Context, tenantID string) (*types.Tenant, error)
 	UpdateTenant(ctx context.Context, t *types.Tenant) error
 	DeleteTenant(ctx context.Context, clusterID, tenantID string) error
 
 	CreateProject(ctx context.Context, p *types.Project) error
-	ListProjects(ctx context.Context, clusterID, tenantID string) ([]*types.Project, error)
+	ListProjects(ctx context.Context, clusterID, tenantID string, opts ListOptions) ([]*types.Project, string, error)
 	GetProject(ctx context.Context, clusterID, tenantID, projectID string) (*types.Project, error)
+	// GetProjectByID looks a project up by ID alone, for routes that do not
+	// name its tenant.
+	GetProjectByID(ctx context.Context, projectID string) (*types.Project, error)
 	UpdateProject(ctx context.Context, p *types.Project) error
 	DeleteProject(ctx context.Context, clusterID, tenantID, projectID string) error
 
 	CreateApp(ctx context.Context, a *types.App) error
-	ListApps(ctx context.Context, clusterID, tenantID, projectID string) ([]*types.App, error)
+	ListApps(ctx context.Context, clusterID, tenantID, projectID string, opts ListOptions) ([]*types.App, string, error)
 	GetApp(ctx context.Context, clusterID, tenantID, projectID, appID string) (*types.App, error)
 	UpdateApp(ctx context.Context, a *types.App) error
 	DeleteApp(ctx context.Context, clusterID, tenantID, projectID, appID string) error
+
+	CreatePlan(ctx context.Context, p *types.Plan) error
+	ListPlans(ctx context.Context) ([]*types.Plan, error)
+	GetPlan(ctx context.Context, name string) (*types.Plan, error)
+	UpdatePlan(ctx context.Context, p *types.Plan) error
+	// DeletePlan fails with ErrPlanInUse while a tenant is on the plan. Tenant
+	// writes that move a tenant onto a plan fail with ErrUnknownPlan once it
+	// is gone, so the two cannot interleave.
+	DeletePlan(ctx context.Context, name string) error
+
+	RecordUsage(ctx context.Context, u *types.UsageRecord) error
+	// LatestUsage returns the most recent sample for a tenant, or for one of its
+	// projects when projectID is set.
+	LatestUsage(ctx context.Context, tenantID, projectID string) (*types.UsageRecord, error)
+	// ListUsage returns raw samples or hourly/daily rollups ordered by time.
+	ListUsage(ctx context.Context, q UsageQuery) ([]*types.UsageRecord, error)
+	// ListTenantUsage returns the hourly rollups of every tenant with usage in
+	// [from, to), optionally limited to one cluster. Usage outlives the tenant
+	// until retention drops it, so deleted tenants are included.
+	ListTenantUsage(ctx context.Context, clusterID string, from, to time.Time) ([]*TenantUsage, error)
+	// PruneUsage drops samples (step raw) or rollup buckets older than before.
+	PruneUsage(ctx context.Context, step string, before time.Time) (int64, error)
+
+	// ReserveIdempotencyKey stores rec as pending unless an unexpired record
+	// with the same key exists, in which case that record is returned instead.
+	ReserveIdempotencyKey(ctx context.Context, rec *IdempotencyRecord) (*IdempotencyRecord, error)
+	// CompleteIdempotencyKey saves the response of a reserved key.
+	CompleteIdempotencyKey(ctx context.Context, rec *IdempotencyRecord) error
+	// ReleaseIdempotencyKey forgets a key so the request can be retried.
+	ReleaseIdempotencyKey(ctx context.Context, key string) error
+	// PruneIdempotencyKeys drops records that expired before the given time.
+	PruneIdempotencyKeys(ctx context.Context, before time.Time) (int64, error)
+
+	RecordAudit(ctx context.Context, e *types.AuditEvent) error
+	// ListAudit returns matching audit events, newest first.
+	ListAudit(ctx context.Context, q AuditQuery) ([]*types.AuditEvent, error)
+
+	CreateWorkflowRun(ctx context.Context, r *types.WorkflowRun) error
+	GetWorkflowRun(ctx context.Context, id string) (*types.WorkflowRun, error)
+	UpdateWorkflowRun(ctx context.Context, r *types.WorkflowRun) error
+	// ListWorkflowRuns returns matching runs, newest first.
+	ListWorkflowRuns(ctx context.Context, q WorkflowRunQuery) ([]*types.WorkflowRun, error)
+
+	// AppendEvent stores e under an ID higher than that of any event appended
+	// before it.
+	AppendEvent(ctx context.Context, e *types.Event) error
+	// ListEvents returns the events after q.After, oldest first.
+	ListEvents(ctx context.Context, q EventQuery) ([]*types.Event, error)
+	// LatestEventID returns the ID of the newest event, or 0 when there is none.
+	LatestEventID(ctx context.Context) (int64, error)
+	// PruneEvents drops events published before the given time.
+	PruneEvents(ctx context.Context, before time.Time) (int64, error)
+
+	CreateWebhook(ctx context.Context, w *types.WebhookSubscription) error
+	GetWebhook(ctx context.Context, id string) (*types.WebhookSubscription, error)
+	// ListWebhooks returns every subscription, oldest first.
+	ListWebhooks(ctx context.Context) ([]*types.WebhookSubscription, error)
+	UpdateWebhook(ctx context.Context, w *types.WebhookSubscription) error
+	// DeleteWebhook removes a subscription together with its deliveries.
+	DeleteWebhook(ctx context.Context, id string) error
+
+	CreateWebhookDelivery(ctx context.Context, d *types.WebhookDelivery) error
+	UpdateWebhookDelivery(ctx context.Context, d *types.WebhookDelivery) error
+	// ClaimWebhookDeliveries returns up to limit pending deliveries that are
+	// due at now and moves their next attempt to now+lease, so that other
+	// workers leave them alone while they are being sent.
+	ClaimWebhookDeliveries(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*types.WebhookDelivery, error)
+	// ListWebhookDeliveries returns matching deliveries, newest first.
+	ListWebhookDeliveries(ctx context.Context, q WebhookDeliveryQuery) ([]*types.WebhookDelivery, error)
+	// PruneWebhookDeliveries drops finished deliveries created before the
+	// given time.
+	PruneWebhookDeliveries(ctx context.Context, before time.Time) (int64, error)
+
+	CreateAPIKey(ctx context.Context, k *types.APIKey) error
+	GetAPIKey(ctx context.Context, id string) (*types.APIKey, error)
+	// ListAPIKeys returns every key, revoked ones included, oldest first.
+	ListAPIKeys(ctx context.Context) ([]*types.APIKey, error)
+	UpdateAPIKey(ctx context.Context, k *types.APIKey) error
+	// TouchAPIKey records that the key was used at the given time without
+	// rewriting the rest of the key, so it cannot undo a revocation.
+	TouchAPIKey(ctx context.Context, id string, at time.Time) error
+
+	// RevokeToken puts an issued token on the revocation list; revoking it
+	// again is not an error.
+	RevokeToken(ctx context.Context, t *types.RevokedToken) error
+	// TokenRevoked reports whether the token ID is on the revocation list.
+	TokenRevoked(ctx context.Context, jti string) (bool, error)
+	// ListRevokedTokens returns the revocation list, newest first.
+	ListRevokedTokens(ctx context.Context) ([]*types.RevokedToken, error)
+	// PruneRevokedTokens drops revocations of tokens that expired before the
+	// given time.
+	PruneRevokedTokens(ctx context.Context, before time.Time) (int64, error)
+
+	// CreateOperation fails with ErrConflict while another operation on the
+	// same cluster has not finished.
+	CreateOperation(ctx context.Context, o *types.Operation) error
+	GetOperation(ctx context.Context, id string) (*types.Operation, error)
+	// UpdateOperation fails with ErrLeaseLost when the operation was claimed
+	// again since o was read, i.e. its LeaseGeneration is stale.
+	UpdateOperation(ctx context.Context, o *types.Operation) error
+	// ListOperations returns matching operations, newest first.
+	ListOperations(ctx context.Context, q OperationQuery) ([]*types.Operation, error)
+	// ClaimOperations returns up to limit unfinished operations whose lease
+	// has expired at now, extends their lease to now+lease and bumps their
+	// LeaseGeneration, so that only one manager resumes each of them.
+	ClaimOperations(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]*types.Operation, error)
+
+	// SaveClusterHealth stores the latest health of a cluster, replacing the
+	// previous one. It is dropped together with the cluster.
+	SaveClusterHealth(ctx context.Context, h *types.ClusterHealth) error
+	GetClusterHealth(ctx context.Context, clusterID string) (*types.ClusterHealth, error)
+
+	// AcquireLease gives the named lease to holder until now+ttl and reports
+	// whether it did. A holder renews its own lease; a lease held by another
+	// is only taken over once it has expired.
+	AcquireLease(ctx context.Context, name, holder string, now time.Time, ttl time.Duration) (bool, error)
 }
 
 // EnvOrMemory builds a store using DATABASE_URL when provided; otherwise
@@ -79,6 +224,7 @@ func assignIDs(c *types.Cluster, t *types.Tenant, p *types.Project, a *types.App
 		if c.Status == "" {
 			c.Status = "pending"
 		}
+		c.ResourceVersion = 1
 		c.CreatedAt = now
 		c.UpdatedAt = now
 		if c.NovaClusterID == "" {
@@ -95,6 +241,7 @@ func assignIDs(c *types.Cluster, t *types.Tenant, p *types.Project, a *types.App
 		if t.AppsNamespace == "" {
 			t.AppsNamespace = sanitizeNS(t.Name, "apps")
 		}
+		t.ResourceVersion = 1
 		t.CreatedAt = now
 		t.UpdatedAt = now
 	}
@@ -102,6 +249,7 @@ func assignIDs(c *types.Cluster, t *types.Tenant, p *types.Project, a *types.App
 		if p.ID == "" {
 			p.ID = uuid.NewString()
 		}
+		p.ResourceVersion = 1
 		p.CreatedAt = now
 		p.UpdatedAt = now
 	}
@@ -109,6 +257,7 @@ func assignIDs(c *types.Cluster, t *types.Tenant, p *types.Project, a *types.App
 		if a.ID == "" {
 			a.ID = uuid.NewString()
 		}
+		a.ResourceVersion = 1
 		a.CreatedAt = now
 		a.UpdatedAt = now
 		if a.Revision == 0 {
@@ -129,6 +278,16 @@ func assignIDs(c *types.Cluster, t *types.Tenant, p *types.Project, a *types.App
 	}
 }
 
+// assignPlanID normalizes the ID and timestamps for a new plan.
+func assignPlanID(p *types.Plan) {
+	now := time.Now().UTC()
+	if p.ID == "" {
+		p.ID = uuid.NewString()
+	}
+	p.CreatedAt = now
+	p.UpdatedAt = now
+}
+
 func sanitizeNS(name, suffix string) string {
 	base := strings.TrimSpace(strings.ToLower(name))
 	if base == "" {
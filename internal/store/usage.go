@@ -0,0 +1,155 @@
+package store
+
+import (
+	"time"
+
+	"github.com/vaheed/kubenova/pkg/types"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// Usage steps understood by ListUsage and PruneUsage.
+const (
+	UsageStepRaw   = "raw"
+	UsageStepHour  = "1h"
+	UsageStepDay   = "24h"
+	maxUsagePoints = 10000
+)
+
+// rollupSteps are the buckets every recorded sample is folded into.
+var rollupSteps = []string{UsageStepHour, UsageStepDay}
+
+// UsageQuery selects a usage time series for a tenant, or one of its projects
+// when ProjectID is set. The range is half-open: [From, To).
+type UsageQuery struct {
+	TenantID  string
+	ProjectID string
+	From      time.Time
+	To        time.Time
+	Step      string
+}
+
+// TenantUsage is the hourly usage of one tenant over a period. Tenant and Plan
+// are as of the latest sample, so tenants deleted since are still reported.
+type TenantUsage struct {
+	ClusterID string
+	TenantID  string
+	Tenant    string
+	Plan      string
+	Points    []*types.UsageRecord
+}
+
+// tenantUsage groups tenant-level hourly rollups, ordered by tenant and then
+// bucket start, into one entry per tenant.
+func tenantUsage(rollups []*usageRollup) []*TenantUsage {
+	out := []*TenantUsage{}
+	var cur *TenantUsage
+	for _, r := range rollups {
+		if cur == nil || cur.TenantID != r.TenantID {
+			cur = &TenantUsage{ClusterID: r.ClusterID, TenantID: r.TenantID}
+			out = append(out, cur)
+		}
+		if r.Tenant != "" {
+			cur.Tenant, cur.Plan = r.Tenant, r.Plan
+		}
+		cur.Points = append(cur.Points, r.record())
+	}
+	return out
+}
+
+// usageRollup accumulates samples of one bucket. Sums are kept rather than
+// averages so that buckets can be updated incrementally as samples arrive.
+type usageRollup struct {
+	ClusterID       string    `json:"clusterId"`
+	TenantID        string    `json:"tenantId"`
+	ProjectID       string    `json:"projectId,omitempty"`
+	Tenant          string    `json:"tenant,omitempty"`
+	Plan            string    `json:"plan,omitempty"`
+	Step            string    `json:"step"`
+	Start           time.Time `json:"start"`
+	Samples         int64     `json:"samples"`
+	CPUMilli        int64     `json:"cpuMilli"`
+	MemoryBytes     int64     `json:"memoryBytes"`
+	StorageBytes    int64     `json:"storageBytes"`
+	LoadBalancers   int64     `json:"loadBalancers"`
+	Pods            int64     `json:"pods"`
+	Namespaces      int64     `json:"namespaces"`
+	Apps            int64     `json:"apps"`
+	QuotaViolations int64     `json:"quotaViolations"`
+	LastReportedAt  time.Time `json:"lastReportedAt"`
+}
+
+func newUsageRollup(u *types.UsageRecord, step string) *usageRollup {
+	return &usageRollup{
+		ClusterID: u.ClusterID,
+		TenantID:  u.TenantID,
+		ProjectID: u.ProjectID,
+		Step:      step,
+		Start:     UsageBucketStart(u.LastReportedAt, step),
+	}
+}
+
+func (r *usageRollup) add(u *types.UsageRecord) {
+	r.Samples++
+	cpu, memory, storage := parseQuantity(u.CPURequests), parseQuantity(u.MemoryRequests), parseQuantity(u.PVCStorage)
+	r.CPUMilli += cpu.MilliValue()
+	r.MemoryBytes += memory.Value()
+	r.StorageBytes += storage.Value()
+	r.LoadBalancers += int64(u.LoadBalancers)
+	r.Pods += int64(u.Pods)
+	r.Namespaces += int64(u.Namespaces)
+	r.Apps += int64(u.Apps)
+	r.QuotaViolations += int64(u.QuotaViolations)
+	if u.LastReportedAt.After(r.LastReportedAt) {
+		r.LastReportedAt = u.LastReportedAt
+		if u.Tenant != "" {
+			r.Tenant, r.Plan = u.Tenant, u.Plan
+		}
+	}
+}
+
+// record returns the bucket as the mean of its samples.
+func (r *usageRollup) record() *types.UsageRecord {
+	n := r.Samples
+	if n == 0 {
+		n = 1
+	}
+	avg := func(v int64) int { return int((v + n/2) / n) }
+	return &types.UsageRecord{
+		ClusterID:       r.ClusterID,
+		TenantID:        r.TenantID,
+		ProjectID:       r.ProjectID,
+		CPURequests:     resource.NewMilliQuantity(r.CPUMilli/n, resource.DecimalSI).String(),
+		MemoryRequests:  resource.NewQuantity(r.MemoryBytes/n, resource.BinarySI).String(),
+		PVCStorage:      resource.NewQuantity(r.StorageBytes/n, resource.BinarySI).String(),
+		LoadBalancers:   avg(r.LoadBalancers),
+		Pods:            avg(r.Pods),
+		Namespaces:      avg(r.Namespaces),
+		Apps:            avg(r.Apps),
+		QuotaViolations: avg(r.QuotaViolations),
+		LastReportedAt:  r.LastReportedAt,
+		BucketStart:     r.Start,
+		Samples:         int(r.Samples),
+	}
+}
+
+// UsageBucketStart aligns t to the start of its bucket in UTC.
+func UsageBucketStart(t time.Time, step string) time.Time {
+	switch step {
+	case UsageStepHour:
+		return t.UTC().Truncate(time.Hour)
+	case UsageStepDay:
+		return t.UTC().Truncate(24 * time.Hour)
+	default:
+		return t.UTC()
+	}
+}
+
+// parseQuantity treats malformed or empty values as zero so one bad sample
+// cannot poison a bucket.
+func parseQuantity(v string) resource.Quantity {
+	q, err := resource.ParseQuantity(v)
+	if err != nil {
+		return resource.Quantity{}
+	}
+	return q
+}
@@ -0,0 +1,59 @@
+package store
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vaheed/kubenova/pkg/types"
+)
+
+// Page sizes for ListWebhookDeliveries.
+const (
+	DefaultWebhookDeliveryLimit = 100
+	MaxWebhookDeliveryLimit     = 1000
+)
+
+// WebhookDeliveryQuery filters the deliveries of one subscription. An empty
+// Status matches every state.
+type WebhookDeliveryQuery struct {
+	SubscriptionID string
+	Status         string
+	Limit          int
+}
+
+func (q WebhookDeliveryQuery) limit() int {
+	if q.Limit <= 0 {
+		return DefaultWebhookDeliveryLimit
+	}
+	if q.Limit > MaxWebhookDeliveryLimit {
+		return MaxWebhookDeliveryLimit
+	}
+	return q.Limit
+}
+
+func (q WebhookDeliveryQuery) matches(d *types.WebhookDelivery) bool {
+	return d.SubscriptionID == q.SubscriptionID && (q.Status == "" || d.Status == q.Status)
+}
+
+func assignWebhookID(w *types.WebhookSubscription) {
+	now := time.Now().UTC()
+	if w.ID == "" {
+		w.ID = uuid.NewString()
+	}
+	w.CreatedAt = now
+	w.UpdatedAt = now
+}
+
+func assignWebhookDeliveryID(d *types.WebhookDelivery) {
+	if d.ID == "" {
+		d.ID = uuid.NewString()
+	}
+	if d.CreatedAt.IsZero() {
+		d.CreatedAt = time.Now().UTC()
+	}
+}
+
+// due reports whether a pending delivery should be attempted at now.
+func due(d *types.WebhookDelivery, now time.Time) bool {
+	return d.Status == types.WebhookDeliveryPending && (d.NextAttemptAt == nil || !d.NextAttemptAt.After(now))
+}
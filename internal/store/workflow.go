@@ -0,0 +1,39 @@
+package store
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vaheed/kubenova/pkg/types"
+)
+
+// WorkflowRunQuery filters workflow runs. Empty fields match everything.
+type WorkflowRunQuery struct {
+	ClusterID string
+	TenantID  string
+	ProjectID string
+	AppID     string
+	// Active limits the result to runs that have not finished.
+	Active bool
+}
+
+func (q WorkflowRunQuery) matches(r *types.WorkflowRun) bool {
+	switch {
+	case q.ClusterID != "" && r.ClusterID != q.ClusterID,
+		q.TenantID != "" && r.TenantID != q.TenantID,
+		q.ProjectID != "" && r.ProjectID != q.ProjectID,
+		q.AppID != "" && r.AppID != q.AppID,
+		q.Active && r.Finished():
+		return false
+	}
+	return true
+}
+
+func assignWorkflowRunID(r *types.WorkflowRun) {
+	if r.ID == "" {
+		r.ID = uuid.NewString()
+	}
+	if r.StartedAt.IsZero() {
+		r.StartedAt = time.Now().UTC()
+	}
+}
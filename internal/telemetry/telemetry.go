@@ -72,6 +72,11 @@ func StartHeartbeat(ctx context.Context, managerURL string, interval time.Durati
 
 // RedisBuffer is a stubbed buffer that keeps events in memory.
 type RedisBuffer struct {
+	// Token authenticates forwarded events, like UsageCollector.Token.
+	Token string
+	// ClusterID is stamped on events that do not name a cluster.
+	ClusterID string
+
 	events     chan map[string]string
 	stop       chan struct{}
 	managerURL string
@@ -116,6 +121,9 @@ func (b *RedisBuffer) Enqueue(stream string, payload map[string]string) {
 		payload = map[string]string{}
 	}
 	payload["stream"] = stream
+	if payload["clusterId"] == "" && b.ClusterID != "" {
+		payload["clusterId"] = b.ClusterID
+	}
 	select {
 	case b.events <- payload:
 	default:
@@ -139,6 +147,9 @@ func (b *RedisBuffer) forward(ev map[string]string) {
 		return
 	}
 	req.Header.Set("Content-Type", "application/json")
+	if b.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+b.Token)
+	}
 	resp, err := b.client.Do(req)
 	if err != nil {
 		logging.L.Warn("telemetry_forward_failed", zap.String("url", url), zap.Error(err))
@@ -152,6 +163,11 @@ func (b *RedisBuffer) forward(ev map[string]string) {
 
 // SpoolBuffer persists events to disk so they can be replayed when the manager returns.
 type SpoolBuffer struct {
+	// Token authenticates flushed events, like UsageCollector.Token.
+	Token string
+	// ClusterID is stamped on events that do not name a cluster.
+	ClusterID string
+
 	dir           string
 	managerURL    string
 	client        *http.Client
@@ -194,6 +210,9 @@ func (b *SpoolBuffer) Enqueue(stream string, payload map[string]string) {
 		payload = map[string]string{}
 	}
 	payload["stream"] = stream
+	if payload["clusterId"] == "" && b.ClusterID != "" {
+		payload["clusterId"] = b.ClusterID
+	}
 	if err := b.storeEvent(payload); err != nil {
 		logging.L.Warn("telemetry_spool_store_failed", zap.Error(err))
 	}
@@ -283,6 +302,9 @@ func (b *SpoolBuffer) flush() {
 			continue
 		}
 		req.Header.Set("Content-Type", "application/json")
+		if b.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+b.Token)
+		}
 		resp, err := b.client.Do(req)
 		if err != nil {
 			logging.L.Warn("telemetry_spool_forward_failed", zap.String("url", req.URL.String()), zap.Error(err))
@@ -0,0 +1,40 @@
+package telemetry
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestSpoolBufferAuthenticatesFlushedEvents(t *testing.T) {
+	var got []map[string]string
+	manager := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/telemetry/events" || r.Header.Get("Authorization") != "Bearer op-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var ev map[string]string
+		_ = json.NewDecoder(r.Body).Decode(&ev)
+		got = append(got, ev)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer manager.Close()
+
+	buf := NewSpoolBuffer(manager.URL, t.TempDir())
+	buf.Token = "op-token"
+	buf.ClusterID = "c1"
+	buf.Enqueue("events", map[string]string{"event": "operator_started"})
+	buf.Enqueue("component_install", map[string]string{"clusterId": "c2"})
+	buf.flush()
+
+	if len(got) != 2 {
+		t.Fatalf("expected both events to be flushed, got %v", got)
+	}
+	if got[0]["clusterId"] != "c1" || got[0]["stream"] != "events" {
+		t.Fatalf("expected the buffer's cluster on the event, got %v", got[0])
+	}
+	if got[1]["clusterId"] != "c2" {
+		t.Fatalf("expected an event's own cluster to be kept, got %v", got[1])
+	}
+}
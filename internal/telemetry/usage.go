@@ -0,0 +1,350 @@
+package telemetry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	"github.com/vaheed/kubenova/internal/logging"
+	v1alpha1 "github.com/vaheed/kubenova/pkg/api/v1alpha1"
+	"github.com/vaheed/kubenova/pkg/types"
+	"go.uber.org/zap"
+)
+
+const (
+	// capsuleTenantLabel marks namespaces that Capsule assigned to a tenant.
+	capsuleTenantLabel = "capsule.clastix.io/tenant"
+	// velaAppLabel is stamped by KubeVela on workloads rendered for an Application.
+	velaAppLabel = "app.oam.dev/name"
+)
+
+// UsageCollector periodically sums resource consumption per tenant namespace and
+// reports it to the manager.
+type UsageCollector struct {
+	Client     client.Reader
+	ManagerURL string
+	ClusterID  string
+	// Token is the manager credential the reports are sent with. It must
+	// carry the operator role bound to ClusterID.
+	Token      string
+	Interval   time.Duration
+	HTTPClient *http.Client
+}
+
+// Run collects and reports usage on every interval until the context is canceled.
+func (c *UsageCollector) Run(ctx context.Context) error {
+	if strings.TrimSpace(c.ManagerURL) == "" || strings.TrimSpace(c.ClusterID) == "" {
+		logging.L.Info("usage_collector_disabled", zap.String("reason", "manager url or cluster id not set"))
+		return nil
+	}
+	interval := c.Interval
+	if interval <= 0 {
+		interval = 5 * time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		c.collectAndSend(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *UsageCollector) collectAndSend(ctx context.Context) {
+	report, err := c.Collect(ctx)
+	if err != nil {
+		logging.L.Warn("usage_collect_failed", zap.Error(err))
+		return
+	}
+	if err := c.Send(ctx, report); err != nil {
+		logging.L.Warn("usage_report_failed", zap.Error(err))
+		return
+	}
+	logging.L.Info("usage_reported", zap.Int("tenants", len(report.Tenants)))
+}
+
+// Collect builds a usage report for every NovaTenant on the cluster.
+func (c *UsageCollector) Collect(ctx context.Context) (*types.UsageReport, error) {
+	var tenants v1alpha1.NovaTenantList
+	if err := c.Client.List(ctx, &tenants); err != nil {
+		return nil, fmt.Errorf("list tenants: %w", err)
+	}
+	var namespaces corev1.NamespaceList
+	if err := c.Client.List(ctx, &namespaces); err != nil {
+		return nil, fmt.Errorf("list namespaces: %w", err)
+	}
+	var pods corev1.PodList
+	if err := c.Client.List(ctx, &pods); err != nil {
+		return nil, fmt.Errorf("list pods: %w", err)
+	}
+	var pvcs corev1.PersistentVolumeClaimList
+	if err := c.Client.List(ctx, &pvcs); err != nil {
+		return nil, fmt.Errorf("list pvcs: %w", err)
+	}
+	var services corev1.ServiceList
+	if err := c.Client.List(ctx, &services); err != nil {
+		return nil, fmt.Errorf("list services: %w", err)
+	}
+	var quotas corev1.ResourceQuotaList
+	if err := c.Client.List(ctx, &quotas); err != nil {
+		return nil, fmt.Errorf("list resource quotas: %w", err)
+	}
+	var apps v1alpha1.NovaAppList
+	if err := c.Client.List(ctx, &apps); err != nil {
+		return nil, fmt.Errorf("list apps: %w", err)
+	}
+
+	// Map each namespace to the tenant that owns it.
+	existing := map[string]corev1.Namespace{}
+	for _, ns := range namespaces.Items {
+		existing[ns.Name] = ns
+	}
+	owner := map[string]string{}
+	for _, t := range tenants.Items {
+		ownerNS := t.Spec.OwnerNamespace
+		if ownerNS == "" {
+			ownerNS = t.Name + "-owner"
+		}
+		appsNS := t.Spec.AppsNamespace
+		if appsNS == "" {
+			appsNS = t.Name + "-apps"
+		}
+		for _, name := range []string{ownerNS, appsNS} {
+			if _, ok := existing[name]; ok {
+				owner[name] = t.Name
+			}
+		}
+	}
+	for _, ns := range namespaces.Items {
+		if tenant := ns.Labels[capsuleTenantLabel]; tenant != "" {
+			if _, ok := owner[ns.Name]; !ok {
+				owner[ns.Name] = tenant
+			}
+		}
+	}
+
+	totals := map[string]*usageTotals{}
+	for _, t := range tenants.Items {
+		totals[t.Name] = newUsageTotals()
+	}
+	tenantTotals := func(namespace string) *usageTotals {
+		tenant, ok := owner[namespace]
+		if !ok {
+			return nil
+		}
+		return totals[tenant]
+	}
+	for ns, tenant := range owner {
+		if tt := totals[tenant]; tt != nil {
+			tt.namespaces[ns] = struct{}{}
+		}
+	}
+
+	// Workloads are attributed to projects through the NovaApp that rendered them.
+	appProject := map[string]string{}
+	for _, a := range apps.Items {
+		tt := totals[a.Spec.Tenant]
+		if tt == nil || a.Spec.Project == "" {
+			continue
+		}
+		appProject[a.Namespace+"/"+a.Name] = a.Spec.Project
+		tt.apps++
+		pt := tt.project(a.Spec.Project)
+		pt.apps++
+		if a.Namespace != "" {
+			pt.namespaces[a.Namespace] = struct{}{}
+		}
+	}
+	projectFor := func(tt *usageTotals, namespace string, labels map[string]string) *usageTotals {
+		if project, ok := appProject[namespace+"/"+labels[velaAppLabel]]; ok {
+			return tt.project(project)
+		}
+		return nil
+	}
+
+	for i := range pods.Items {
+		pod := &pods.Items[i]
+		if pod.Status.Phase == corev1.PodSucceeded || pod.Status.Phase == corev1.PodFailed {
+			continue
+		}
+		tt := tenantTotals(pod.Namespace)
+		if tt == nil {
+			continue
+		}
+		for _, target := range []*usageTotals{tt, projectFor(tt, pod.Namespace, pod.Labels)} {
+			if target == nil {
+				continue
+			}
+			target.pods++
+			for _, ctr := range pod.Spec.Containers {
+				if q, ok := ctr.Resources.Requests[corev1.ResourceCPU]; ok {
+					target.cpu.Add(q)
+				}
+				if q, ok := ctr.Resources.Requests[corev1.ResourceMemory]; ok {
+					target.memory.Add(q)
+				}
+			}
+		}
+	}
+	for i := range pvcs.Items {
+		pvc := &pvcs.Items[i]
+		tt := tenantTotals(pvc.Namespace)
+		if tt == nil {
+			continue
+		}
+		q, ok := pvc.Spec.Resources.Requests[corev1.ResourceStorage]
+		if !ok {
+			continue
+		}
+		tt.storage.Add(q)
+		if pt := projectFor(tt, pvc.Namespace, pvc.Labels); pt != nil {
+			pt.storage.Add(q)
+		}
+	}
+	for i := range services.Items {
+		svc := &services.Items[i]
+		if svc.Spec.Type != corev1.ServiceTypeLoadBalancer {
+			continue
+		}
+		tt := tenantTotals(svc.Namespace)
+		if tt == nil {
+			continue
+		}
+		tt.loadBalancers++
+		if pt := projectFor(tt, svc.Namespace, svc.Labels); pt != nil {
+			pt.loadBalancers++
+		}
+	}
+	for i := range quotas.Items {
+		rq := &quotas.Items[i]
+		tt := tenantTotals(rq.Namespace)
+		if tt == nil {
+			continue
+		}
+		tt.quotaViolations += quotaViolations(rq)
+	}
+
+	now := time.Now().UTC()
+	report := &types.UsageReport{ClusterID: c.ClusterID, CollectedAt: now}
+	names := make([]string, 0, len(totals))
+	for name := range totals {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		tt := totals[name]
+		entry := types.TenantUsageReport{Tenant: name, Usage: tt.record(now)}
+		projects := make([]string, 0, len(tt.projects))
+		for project := range tt.projects {
+			projects = append(projects, project)
+		}
+		sort.Strings(projects)
+		for _, project := range projects {
+			entry.Projects = append(entry.Projects, types.ProjectUsageReport{
+				Project: project,
+				Usage:   tt.projects[project].record(now),
+			})
+		}
+		report.Tenants = append(report.Tenants, entry)
+	}
+	return report, nil
+}
+
+// Send posts the report to the manager ingestion endpoint.
+func (c *UsageCollector) Send(ctx context.Context, report *types.UsageReport) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	url := strings.TrimRight(c.ManagerURL, "/") + "/api/v1/usage/reports"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("manager returned %s", resp.Status)
+	}
+	return nil
+}
+
+type usageTotals struct {
+	cpu             resource.Quantity
+	memory          resource.Quantity
+	storage         resource.Quantity
+	loadBalancers   int
+	pods            int
+	apps            int
+	quotaViolations int
+	namespaces      map[string]struct{}
+	projects        map[string]*usageTotals
+}
+
+func newUsageTotals() *usageTotals {
+	return &usageTotals{
+		namespaces: map[string]struct{}{},
+		projects:   map[string]*usageTotals{},
+	}
+}
+
+func (u *usageTotals) project(name string) *usageTotals {
+	p, ok := u.projects[name]
+	if !ok {
+		p = newUsageTotals()
+		u.projects[name] = p
+	}
+	return p
+}
+
+func (u *usageTotals) record(at time.Time) types.UsageRecord {
+	return types.UsageRecord{
+		CPURequests:     u.cpu.String(),
+		MemoryRequests:  u.memory.String(),
+		PVCStorage:      u.storage.String(),
+		LoadBalancers:   u.loadBalancers,
+		Pods:            u.pods,
+		Namespaces:      len(u.namespaces),
+		Apps:            u.apps,
+		QuotaViolations: u.quotaViolations,
+		LastReportedAt:  at,
+	}
+}
+
+// quotaViolations counts the resources of a quota whose usage reached the hard limit.
+func quotaViolations(rq *corev1.ResourceQuota) int {
+	count := 0
+	for name, hard := range rq.Status.Hard {
+		used, ok := rq.Status.Used[name]
+		if !ok || hard.IsZero() {
+			continue
+		}
+		if used.Cmp(hard) >= 0 {
+			count++
+		}
+	}
+	return count
+}
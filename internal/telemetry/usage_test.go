@@ -0,0 +1,114 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	v1alpha1 "github.com/vaheed/kubenova/pkg/api/v1alpha1"
+	"github.com/vaheed/kubenova/pkg/types"
+)
+
+func TestUsageCollectorSumsTenantNamespaces(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+	_ = v1alpha1.AddToScheme(scheme)
+
+	pod := func(ns, name, app, cpu, mem string, phase corev1.PodPhase) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: ns, Labels: map[string]string{velaAppLabel: app}},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{
+				Name: "main",
+				Resources: corev1.ResourceRequirements{Requests: corev1.ResourceList{
+					corev1.ResourceCPU:    resource.MustParse(cpu),
+					corev1.ResourceMemory: resource.MustParse(mem),
+				}},
+			}}},
+			Status: corev1.PodStatus{Phase: phase},
+		}
+	}
+	cli := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		&v1alpha1.NovaTenant{ObjectMeta: metav1.ObjectMeta{Name: "acme"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "acme-owner"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "acme-apps"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "acme-extra", Labels: map[string]string{capsuleTenantLabel: "acme"}}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "other"}},
+		&v1alpha1.NovaApp{
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "acme-apps"},
+			Spec:       v1alpha1.NovaAppSpec{Tenant: "acme", Project: "web"},
+		},
+		pod("acme-apps", "api-1", "api", "250m", "256Mi", corev1.PodRunning),
+		pod("acme-apps", "api-2", "api", "250m", "256Mi", corev1.PodRunning),
+		pod("acme-extra", "batch", "", "1", "1Gi", corev1.PodPending),
+		pod("acme-extra", "done", "", "4", "4Gi", corev1.PodSucceeded),
+		pod("other", "noise", "", "8", "8Gi", corev1.PodRunning),
+		&corev1.PersistentVolumeClaim{
+			ObjectMeta: metav1.ObjectMeta{Name: "data", Namespace: "acme-apps", Labels: map[string]string{velaAppLabel: "api"}},
+			Spec: corev1.PersistentVolumeClaimSpec{Resources: corev1.VolumeResourceRequirements{
+				Requests: corev1.ResourceList{corev1.ResourceStorage: resource.MustParse("10Gi")},
+			}},
+		},
+		&corev1.Service{
+			ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "acme-apps", Labels: map[string]string{velaAppLabel: "api"}},
+			Spec:       corev1.ServiceSpec{Type: corev1.ServiceTypeLoadBalancer},
+		},
+		&corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: "quota", Namespace: "acme-apps"},
+			Status: corev1.ResourceQuotaStatus{
+				Hard: corev1.ResourceList{corev1.ResourcePods: resource.MustParse("3"), corev1.ResourceCPU: resource.MustParse("4")},
+				Used: corev1.ResourceList{corev1.ResourcePods: resource.MustParse("3"), corev1.ResourceCPU: resource.MustParse("1")},
+			},
+		},
+	).Build()
+
+	var received types.UsageReport
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/usage/reports" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if got := r.Header.Get("Authorization"); got != "Bearer op-token" {
+			t.Errorf("unexpected authorization %q", got)
+		}
+		_ = json.NewDecoder(r.Body).Decode(&received)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	collector := &UsageCollector{Client: cli, ManagerURL: srv.URL, ClusterID: "c-1", Token: "op-token"}
+	report, err := collector.Collect(context.Background())
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	if len(report.Tenants) != 1 {
+		t.Fatalf("expected one tenant, got %+v", report.Tenants)
+	}
+	usage := report.Tenants[0].Usage
+	if usage.CPURequests != "1500m" || usage.MemoryRequests != "1536Mi" || usage.Pods != 3 {
+		t.Fatalf("unexpected compute usage: %+v", usage)
+	}
+	if usage.PVCStorage != "10Gi" || usage.LoadBalancers != 1 || usage.Namespaces != 3 || usage.Apps != 1 || usage.QuotaViolations != 1 {
+		t.Fatalf("unexpected tenant usage: %+v", usage)
+	}
+	if len(report.Tenants[0].Projects) != 1 {
+		t.Fatalf("expected one project, got %+v", report.Tenants[0].Projects)
+	}
+	web := report.Tenants[0].Projects[0]
+	if web.Project != "web" || web.Usage.Pods != 2 || web.Usage.CPURequests != "500m" || web.Usage.PVCStorage != "10Gi" {
+		t.Fatalf("unexpected project usage: %+v", web)
+	}
+
+	if err := collector.Send(context.Background(), report); err != nil {
+		t.Fatalf("send: %v", err)
+	}
+	if received.ClusterID != "c-1" || len(received.Tenants) != 1 {
+		t.Fatalf("manager did not receive report: %+v", received)
+	}
+}
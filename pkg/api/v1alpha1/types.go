@@ -160,6 +160,11 @@ type NovaAppSpec struct {
 	Template    map[string]any   `json:"template,omitempty"`
 	Traits      []map[string]any `json:"traits,omitempty"`
 	Policies    []map[string]any `json:"policies,omitempty"`
+	// Suspended scales the app's components to zero.
+	Suspended bool `json:"suspended,omitempty"`
+	// PublishVersion is passed to KubeVela; changing it forces a new
+	// application revision.
+	PublishVersion string `json:"publishVersion,omitempty"`
 }
 
 func (s NovaAppSpec) DeepCopy() NovaAppSpec {
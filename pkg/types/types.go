@@ -1,6 +1,9 @@
 package types
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // Cluster represents a registered Kubernetes cluster managed by KubeNova.
 type Cluster struct {
@@ -14,15 +17,87 @@ type Cluster struct {
 	// CapsuleProxyEndpoint is the base URL for the cluster-specific Capsule Proxy instance.
 	CapsuleProxyEndpoint string       `json:"capsuleProxyEndpoint,omitempty"`
 	Capabilities         Capabilities `json:"capabilities,omitempty"`
-	CreatedAt            time.Time    `json:"createdAt"`
-	UpdatedAt            time.Time    `json:"updatedAt"`
+	// Preflight is the report of the checks run when the cluster was registered.
+	Preflight *PreflightReport `json:"preflight,omitempty"`
+	// ResourceVersion increases on every update; the API returns it as the ETag.
+	ResourceVersion int64     `json:"resourceVersion"`
+	CreatedAt       time.Time `json:"createdAt"`
+	UpdatedAt       time.Time `json:"updatedAt"`
+}
+
+// Cluster connectivity states set by the health prober.
+const (
+	ClusterConnected   = "connected"
+	ClusterDegraded    = "degraded"
+	ClusterUnreachable = "unreachable"
+)
+
+// ClusterHealth is what the manager last learned about a cluster's API
+// server. The consecutive counters make a state change wait for several
+// probes that agree.
+type ClusterHealth struct {
+	ClusterID string `json:"clusterId"`
+	// Status is the connectivity state the probes settled on.
+	Status        string `json:"status"`
+	ServerVersion string `json:"serverVersion,omitempty"`
+	// LatencyMs is the round trip of the last successful probe.
+	LatencyMs int64 `json:"latencyMs"`
+	// LastSeenAt is when the API server last answered.
+	LastSeenAt *time.Time `json:"lastSeenAt,omitempty"`
+	// LastProbeAt is nil until the cluster was first probed.
+	LastProbeAt *time.Time `json:"lastProbeAt,omitempty"`
+	// LastError is why the last probe failed; empty when it succeeded.
+	LastError string `json:"lastError,omitempty"`
+	// ConsecutiveFailures, ConsecutiveSlow and ConsecutiveSuccesses count the
+	// latest run of failed, slow and healthy probes; a probe of one kind
+	// resets the other two.
+	ConsecutiveFailures  int        `json:"consecutiveFailures"`
+	ConsecutiveSlow      int        `json:"consecutiveSlow"`
+	ConsecutiveSuccesses int        `json:"consecutiveSuccesses"`
+	StatusChangedAt      *time.Time `json:"statusChangedAt,omitempty"`
 }
 
 // Capabilities captures optional cluster feature flags returned to clients.
+// They are discovered from the cluster's API after every bootstrap and
+// refresh; the versions are the preferred versions of the API groups.
 type Capabilities struct {
-	Capsule      bool `json:"capsule"`
-	CapsuleProxy bool `json:"capsuleProxy"`
-	KubeVela     bool `json:"kubeVela"`
+	Capsule            bool   `json:"capsule"`
+	CapsuleVersion     string `json:"capsuleVersion,omitempty"`
+	CapsuleProxy       bool   `json:"capsuleProxy"`
+	KubeVela           bool   `json:"kubeVela"`
+	KubeVelaVersion    string `json:"kubeVelaVersion,omitempty"`
+	GatewayAPI         bool   `json:"gatewayAPI"`
+	GatewayAPIVersion  string `json:"gatewayAPIVersion,omitempty"`
+	CertManager        bool   `json:"certManager"`
+	CertManagerVersion string `json:"certManagerVersion,omitempty"`
+	// DiscoveredAt is nil for capabilities that were never discovered.
+	DiscoveredAt *time.Time `json:"discoveredAt,omitempty"`
+}
+
+// Preflight check results, from best to worst.
+const (
+	PreflightPass = "pass"
+	PreflightWarn = "warn"
+	PreflightFail = "fail"
+)
+
+// PreflightReport is the outcome of the checks run on a cluster before it is
+// registered. Result is the worst result of the checks; checks that depend on
+// a failed one are left out.
+type PreflightReport struct {
+	Result        string           `json:"result"`
+	ServerVersion string           `json:"serverVersion,omitempty"`
+	Checks        []PreflightCheck `json:"checks"`
+	CheckedAt     time.Time        `json:"checkedAt"`
+}
+
+// PreflightCheck is one check of a preflight report.
+type PreflightCheck struct {
+	Name    string `json:"name"`
+	Result  string `json:"result"`
+	Message string `json:"message"`
+	// Missing lists the permissions the credentials lack, as "verb resource".
+	Missing []string `json:"missing,omitempty"`
 }
 
 // Tenant models a Capsule-backed tenant inside a cluster.
@@ -38,10 +113,38 @@ type Tenant struct {
 	NetworkPolicies []string          `json:"networkPolicies,omitempty"`
 	OwnerNamespace  string            `json:"ownerNamespace,omitempty"`
 	AppsNamespace   string            `json:"appsNamespace,omitempty"`
+	ResourceVersion int64             `json:"resourceVersion"`
 	CreatedAt       time.Time         `json:"createdAt"`
 	UpdatedAt       time.Time         `json:"updatedAt"`
 }
 
+// Plan describes a commercial tier that seeds tenant resource envelopes.
+type Plan struct {
+	ID              string            `json:"id"`
+	Name            string            `json:"name"`
+	Description     string            `json:"description,omitempty"`
+	Quotas          map[string]string `json:"quotas,omitempty"`
+	Limits          map[string]string `json:"limits,omitempty"`
+	NetworkPolicies []string          `json:"networkPolicies,omitempty"`
+	// Components lists the KubeVela component types tenants on this plan may deploy.
+	// An empty list allows every component type.
+	Components []string     `json:"components,omitempty"`
+	Pricing    *PlanPricing `json:"pricing,omitempty"`
+	CreatedAt  time.Time    `json:"createdAt"`
+	UpdatedAt  time.Time    `json:"updatedAt"`
+}
+
+// PlanPricing is the price table billing exports apply to tenants on a plan.
+// Usage prices are per unit-hour of the requested resources.
+type PlanPricing struct {
+	Currency         string  `json:"currency,omitempty"`
+	MonthlyBase      float64 `json:"monthlyBase,omitempty"`
+	CPUCoreHour      float64 `json:"cpuCoreHour,omitempty"`
+	MemoryGiBHour    float64 `json:"memoryGiBHour,omitempty"`
+	StorageGiBHour   float64 `json:"storageGiBHour,omitempty"`
+	LoadBalancerHour float64 `json:"loadBalancerHour,omitempty"`
+}
+
 // TenantSummary aggregates tenant-scoped status and counts.
 type TenantSummary struct {
 	TenantID        string `json:"tenantId"`
@@ -55,37 +158,39 @@ type TenantSummary struct {
 
 // Project captures an application project under a tenant.
 type Project struct {
-	ID          string            `json:"id"`
-	ClusterID   string            `json:"clusterId"`
-	TenantID    string            `json:"tenantId"`
-	Name        string            `json:"name"`
-	Description string            `json:"description,omitempty"`
-	Labels      map[string]string `json:"labels,omitempty"`
-	Access      []string          `json:"access,omitempty"`
-	CreatedAt   time.Time         `json:"createdAt"`
-	UpdatedAt   time.Time         `json:"updatedAt"`
+	ID              string            `json:"id"`
+	ClusterID       string            `json:"clusterId"`
+	TenantID        string            `json:"tenantId"`
+	Name            string            `json:"name"`
+	Description     string            `json:"description,omitempty"`
+	Labels          map[string]string `json:"labels,omitempty"`
+	Access          []string          `json:"access,omitempty"`
+	ResourceVersion int64             `json:"resourceVersion"`
+	CreatedAt       time.Time         `json:"createdAt"`
+	UpdatedAt       time.Time         `json:"updatedAt"`
 }
 
 // App models a KubeVela application.
 type App struct {
-	ID           string           `json:"id"`
-	ClusterID    string           `json:"clusterId"`
-	TenantID     string           `json:"tenantId"`
-	ProjectID    string           `json:"projectId"`
-	Name         string           `json:"name"`
-	Description  string           `json:"description,omitempty"`
-	Component    string           `json:"component,omitempty"`
-	Image        string           `json:"image,omitempty"`
-	Spec         map[string]any   `json:"spec,omitempty"`
-	Traits       []map[string]any `json:"traits,omitempty"`
-	Policies     []map[string]any `json:"policies,omitempty"`
-	Revision     int              `json:"revision"`
-	Revisions    []AppRevision    `json:"revisions,omitempty"`
-	Status       string           `json:"status"`
-	Suspended    bool             `json:"suspended"`
-	CreatedAt    time.Time        `json:"createdAt"`
-	UpdatedAt    time.Time        `json:"updatedAt"`
-	WorkflowRuns []WorkflowRun    `json:"workflowRuns,omitempty"`
+	ID              string           `json:"id"`
+	ClusterID       string           `json:"clusterId"`
+	TenantID        string           `json:"tenantId"`
+	ProjectID       string           `json:"projectId"`
+	Name            string           `json:"name"`
+	Description     string           `json:"description,omitempty"`
+	Component       string           `json:"component,omitempty"`
+	Image           string           `json:"image,omitempty"`
+	Spec            map[string]any   `json:"spec,omitempty"`
+	Traits          []map[string]any `json:"traits,omitempty"`
+	Policies        []map[string]any `json:"policies,omitempty"`
+	Revision        int              `json:"revision"`
+	Revisions       []AppRevision    `json:"revisions,omitempty"`
+	Status          string           `json:"status"`
+	Suspended       bool             `json:"suspended"`
+	PublishVersion  string           `json:"publishVersion,omitempty"`
+	ResourceVersion int64            `json:"resourceVersion"`
+	CreatedAt       time.Time        `json:"createdAt"`
+	UpdatedAt       time.Time        `json:"updatedAt"`
 }
 
 // AppRevision keeps a lightweight history of changes.
@@ -97,19 +202,53 @@ type AppRevision struct {
 	CreatedAt time.Time        `json:"createdAt"`
 }
 
-// WorkflowRun tracks a workflow execution for an app.
+// Workflow run statuses.
+const (
+	WorkflowRunRunning   = "Running"
+	WorkflowRunSucceeded = "Succeeded"
+	WorkflowRunFailed    = "Failed"
+	WorkflowRunCanceled  = "Canceled"
+)
+
+// WorkflowRun tracks one execution of an app's KubeVela workflow.
 type WorkflowRun struct {
 	ID        string         `json:"id"`
+	ClusterID string         `json:"clusterId"`
+	TenantID  string         `json:"tenantId"`
+	ProjectID string         `json:"projectId"`
 	AppID     string         `json:"appId"`
 	Status    string         `json:"status"`
 	Inputs    map[string]any `json:"inputs,omitempty"`
 	Result    map[string]any `json:"result,omitempty"`
-	StartedAt time.Time      `json:"startedAt"`
-	EndedAt   *time.Time     `json:"endedAt,omitempty"`
+	Steps     []WorkflowStep `json:"steps,omitempty"`
+	// PublishVersion is the Application publish version the run was started
+	// with; it ties the run to one execution of the workflow.
+	PublishVersion string     `json:"publishVersion,omitempty"`
+	StartedAt      time.Time  `json:"startedAt"`
+	EndedAt        *time.Time `json:"endedAt,omitempty"`
+}
+
+// Finished reports whether the run has reached a final status.
+func (r *WorkflowRun) Finished() bool {
+	return r.EndedAt != nil
+}
+
+// WorkflowStep is the state of one step of a workflow run as reported by
+// KubeVela.
+type WorkflowStep struct {
+	Name    string `json:"name"`
+	Type    string `json:"type,omitempty"`
+	Phase   string `json:"phase"`
+	Message string `json:"message,omitempty"`
+	Reason  string `json:"reason,omitempty"`
 }
 
 // UsageRecord represents aggregated usage metrics for a tenant or project.
+// Project-level samples carry a ProjectID; tenant-level samples leave it empty.
 type UsageRecord struct {
+	ClusterID       string    `json:"clusterId,omitempty"`
+	TenantID        string    `json:"tenantId,omitempty"`
+	ProjectID       string    `json:"projectId,omitempty"`
 	CPURequests     string    `json:"cpuRequests"`
 	MemoryRequests  string    `json:"memoryRequests"`
 	PVCStorage      string    `json:"pvcStorage"`
@@ -119,4 +258,237 @@ type UsageRecord struct {
 	Apps            int       `json:"apps"`
 	QuotaViolations int       `json:"quotaViolations"`
 	LastReportedAt  time.Time `json:"lastReportedAt"`
+	// BucketStart and Samples are set on hourly/daily rollups, whose values are
+	// the mean of the samples collected in the bucket.
+	BucketStart time.Time `json:"bucketStart,omitzero"`
+	Samples     int       `json:"samples,omitempty"`
+	// Tenant and Plan are set by the manager when it records a sample so that
+	// rollups can still be billed after the tenant is deleted.
+	Tenant string `json:"-"`
+	Plan   string `json:"-"`
+}
+
+// UsageSeries is a usage time series for a tenant or project.
+type UsageSeries struct {
+	TenantID  string         `json:"tenantId"`
+	ProjectID string         `json:"projectId,omitempty"`
+	From      time.Time      `json:"from"`
+	To        time.Time      `json:"to"`
+	Step      string         `json:"step"`
+	Points    []*UsageRecord `json:"points"`
+}
+
+// UsageReport is the payload operators post to the manager after each collection pass.
+// Tenants and projects are identified by name because that is all the cluster knows.
+type UsageReport struct {
+	ClusterID   string              `json:"clusterId"`
+	CollectedAt time.Time           `json:"collectedAt"`
+	Tenants     []TenantUsageReport `json:"tenants"`
+}
+
+// TenantUsageReport carries the usage of one tenant and its projects.
+type TenantUsageReport struct {
+	Tenant   string               `json:"tenant"`
+	Usage    UsageRecord          `json:"usage"`
+	Projects []ProjectUsageReport `json:"projects,omitempty"`
+}
+
+// ProjectUsageReport carries the usage attributed to a single project.
+type ProjectUsageReport struct {
+	Project string      `json:"project"`
+	Usage   UsageRecord `json:"usage"`
+}
+
+// BillingLineItem is one tenant's usage and charges for a billing period.
+// Usage is integrated over the hourly rollups the operator reported.
+type BillingLineItem struct {
+	Period            string  `json:"period"`
+	ClusterID         string  `json:"clusterId"`
+	TenantID          string  `json:"tenantId"`
+	Tenant            string  `json:"tenant"`
+	Plan              string  `json:"plan,omitempty"`
+	HoursReported     int     `json:"hoursReported"`
+	CPUCoreHours      float64 `json:"cpuCoreHours"`
+	MemoryGiBHours    float64 `json:"memoryGiBHours"`
+	StorageGiBHours   float64 `json:"storageGiBHours"`
+	LoadBalancerHours float64 `json:"loadBalancerHours"`
+	PeakPods          int     `json:"peakPods"`
+	Currency          string  `json:"currency,omitempty"`
+	BaseCost          float64 `json:"baseCost"`
+	UsageCost         float64 `json:"usageCost"`
+	Total             float64 `json:"total"`
+}
+
+// RoleBinding grants a role on one cluster, tenant or project and on
+// everything inside it. Every ID that is set must match the resource.
+type RoleBinding struct {
+	Role      string `json:"role"`
+	ClusterID string `json:"clusterId,omitempty"`
+	TenantID  string `json:"tenantId,omitempty"`
+	ProjectID string `json:"projectId,omitempty"`
+}
+
+// APIKey is a long-lived credential for machines such as CI systems. Only a
+// hash of the key is stored; the key itself is returned once, on creation.
+type APIKey struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Hash is the SHA-256 of the key. The API never returns it.
+	Hash      string        `json:"hash,omitempty"`
+	Roles     []string      `json:"roles,omitempty"`
+	Bindings  []RoleBinding `json:"bindings,omitempty"`
+	CreatedBy string        `json:"createdBy,omitempty"`
+	ExpiresAt time.Time     `json:"expiresAt"`
+	// LastUsedAt is updated at most once a minute.
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+}
+
+// RevokedToken is an issued JWT that is refused before it expires. A nil
+// ExpiresAt keeps the revocation forever.
+type RevokedToken struct {
+	JTI       string     `json:"jti"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	RevokedBy string     `json:"revokedBy,omitempty"`
+	RevokedAt time.Time  `json:"revokedAt"`
+}
+
+// AuditEvent records one mutating API call. Before and After hold the stored
+// resource the call targeted, as the API would return it, on either side of
+// the change.
+type AuditEvent struct {
+	ID        string          `json:"id"`
+	Time      time.Time       `json:"time"`
+	Actor     string          `json:"actor"`
+	Roles     []string        `json:"roles,omitempty"`
+	Action    string          `json:"action"`
+	Method    string          `json:"method"`
+	Resource  string          `json:"resource"`
+	ClusterID string          `json:"clusterId,omitempty"`
+	TenantID  string          `json:"tenantId,omitempty"`
+	ProjectID string          `json:"projectId,omitempty"`
+	AppID     string          `json:"appId,omitempty"`
+	RequestID string          `json:"requestId,omitempty"`
+	Status    int             `json:"status"`
+	Outcome   string          `json:"outcome"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+}
+
+// Event announces a change to a resource on the event stream. IDs increase
+// monotonically so subscribers can resume after the last event they saw. Data
+// holds the resource as the API renders it after the change.
+type Event struct {
+	ID        int64     `json:"id"`
+	Type      string    `json:"type"`
+	Time      time.Time `json:"time"`
+	ClusterID string    `json:"clusterId,omitempty"`
+	TenantID  string    `json:"tenantId,omitempty"`
+	ProjectID string    `json:"projectId,omitempty"`
+	AppID     string    `json:"appId,omitempty"`
+	// Message explains failure events, e.g. why a bootstrap failed.
+	Message string          `json:"message,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// WebhookSubscription delivers the events it matches to URL. Empty EventTypes
+// match every event; a TenantID limits it to events about that tenant.
+type WebhookSubscription struct {
+	ID          string   `json:"id"`
+	URL         string   `json:"url"`
+	Description string   `json:"description,omitempty"`
+	EventTypes  []string `json:"eventTypes,omitempty"`
+	TenantID    string   `json:"tenantId,omitempty"`
+	Active      bool     `json:"active"`
+	// Secret signs deliveries. The API only returns it when it is set.
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Webhook delivery states.
+const (
+	WebhookDeliveryPending   = "pending"
+	WebhookDeliverySucceeded = "succeeded"
+	WebhookDeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is one event queued for one subscription, with every
+// attempt made to deliver it.
+type WebhookDelivery struct {
+	ID             string           `json:"id"`
+	SubscriptionID string           `json:"subscriptionId"`
+	EventID        int64            `json:"eventId"`
+	EventType      string           `json:"eventType"`
+	Status         string           `json:"status"`
+	Payload        json.RawMessage  `json:"payload"`
+	Attempts       []WebhookAttempt `json:"attempts,omitempty"`
+	NextAttemptAt  *time.Time       `json:"nextAttemptAt,omitempty"`
+	CreatedAt      time.Time        `json:"createdAt"`
+	DeliveredAt    *time.Time       `json:"deliveredAt,omitempty"`
+}
+
+// WebhookAttempt records the outcome of one delivery attempt.
+type WebhookAttempt struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"durationMs"`
+}
+
+// Operation phases; steps use the same phases.
+const (
+	OperationPending   = "Pending"
+	OperationRunning   = "Running"
+	OperationSucceeded = "Succeeded"
+	OperationFailed    = "Failed"
+)
+
+// Operation tracks long-running work the manager does on a cluster, such as
+// installing components. Operations are stored so that another manager can
+// resume them after a restart.
+type Operation struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	ClusterID string          `json:"clusterId"`
+	Component string          `json:"component,omitempty"`
+	Phase     string          `json:"phase"`
+	Steps     []OperationStep `json:"steps"`
+	Logs      []OperationLog  `json:"logs,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	// Attempts counts how often the operation was started; it is above one
+	// when the operation was resumed.
+	Attempts int `json:"attempts"`
+	// LeaseExpiresAt is set while a manager works on the operation. Once it
+	// passes, the operation is resumed by another manager.
+	LeaseExpiresAt *time.Time `json:"leaseExpiresAt,omitempty"`
+	// LeaseGeneration goes up every time a manager claims the operation. A
+	// manager that lost the operation can no longer write it.
+	LeaseGeneration int64      `json:"leaseGeneration"`
+	CreatedAt       time.Time  `json:"createdAt"`
+	UpdatedAt       time.Time  `json:"updatedAt"`
+	StartedAt       *time.Time `json:"startedAt,omitempty"`
+	EndedAt         *time.Time `json:"endedAt,omitempty"`
+}
+
+// Finished reports whether the operation has reached a final phase.
+func (o *Operation) Finished() bool {
+	return o.Phase == OperationSucceeded || o.Phase == OperationFailed
+}
+
+// OperationStep is the progress of one step of an operation.
+type OperationStep struct {
+	Name      string     `json:"name"`
+	Phase     string     `json:"phase"`
+	Error     string     `json:"error,omitempty"`
+	StartedAt *time.Time `json:"startedAt,omitempty"`
+	EndedAt   *time.Time `json:"endedAt,omitempty"`
+}
+
+// OperationLog is a progress message recorded while an operation runs.
+type OperationLog struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
 }